@@ -146,8 +146,9 @@ func (bm *Benchmark) CSV() string {
 func NewSample(jobCount int, msgSize int, start, end time.Time, nc *nats.Conn) *Sample {
 	s := Sample{JobMsgCnt: jobCount, Start: start, End: end}
 	s.MsgBytes = uint64(msgSize * jobCount)
-	s.MsgCnt = nc.OutMsgs + nc.InMsgs
-	s.IOBytes = nc.OutBytes + nc.InBytes
+	stats := nc.Stats()
+	s.MsgCnt = stats.OutMsgs + stats.InMsgs
+	s.IOBytes = stats.OutBytes + stats.InBytes
 	return &s
 }
 
@@ -0,0 +1,167 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/nats-io/nuid"
+)
+
+// BridgeHeader is set on messages republished by a Bridge. It holds the IDs
+// of all bridges which forwarded the message, to prevent forwarding loops.
+const BridgeHeader = "Nats-Bridge"
+
+// ErrBridgeStarted is returned when starting a Bridge which is already started.
+var ErrBridgeStarted = errors.New("nats: bridge already started")
+
+type (
+	// BridgeConfig configures a Bridge.
+	BridgeConfig struct {
+		// Subject to subscribe to on the source connection.
+		// It may contain wildcards.
+		Subject string
+
+		// Queue is an optional queue group used to subscribe on the
+		// source connection, so that the load can be spread over
+		// several bridge instances.
+		Queue string
+
+		// Remap returns the subject on which a message received on the
+		// given subject is published on the destination connection.
+		// If not set, the subject is left unchanged.
+		Remap func(subject string) string
+
+		// ID identifies the bridge in the BridgeHeader of forwarded
+		// messages. Messages already forwarded by a bridge with the same ID
+		// are not forwarded again, so bridges forwarding messages in both
+		// directions between the same connections should share the same ID.
+		// Defaults to a unique ID.
+		ID string
+	}
+
+	// Bridge republishes messages received on a connection to another
+	// connection, e.g. to replicate subjects across clusters. Each
+	// connection handles its reconnects independently: messages received
+	// while the destination connection is reconnecting are buffered in its
+	// reconnect buffer. Reply subjects are not forwarded, as they could not
+	// be reached from the destination.
+	Bridge struct {
+		src, dst *Conn
+		cfg      BridgeConfig
+
+		mu  sync.Mutex
+		sub *Subscription
+
+		forwarded atomic.Uint64
+		skipped   atomic.Uint64
+		errors    atomic.Uint64
+	}
+
+	// BridgeStats contains the statistics of a Bridge.
+	BridgeStats struct {
+		// Forwarded is the number of messages published on the
+		// destination connection.
+		Forwarded uint64
+		// Skipped is the number of messages not forwarded, as they
+		// were already forwarded by this bridge.
+		Skipped uint64
+		// Errors is the number of messages which could not be published
+		// on the destination connection.
+		Errors uint64
+	}
+)
+
+// NewBridge creates a Bridge forwarding messages from src to dst.
+// The bridge does not forward messages until it is started.
+func NewBridge(src, dst *Conn, cfg BridgeConfig) (*Bridge, error) {
+	if src == nil || dst == nil {
+		return nil, ErrInvalidConnection
+	}
+	if cfg.Subject == _EMPTY_ || badSubject(cfg.Subject) {
+		return nil, ErrBadSubject
+	}
+	if cfg.Queue != _EMPTY_ && badQueue(cfg.Queue) {
+		return nil, ErrBadQueueName
+	}
+	if cfg.ID == _EMPTY_ {
+		cfg.ID = nuid.Next()
+	}
+	return &Bridge{src: src, dst: dst, cfg: cfg}, nil
+}
+
+// Start subscribes on the source connection and starts forwarding messages.
+func (b *Bridge) Start() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.sub != nil {
+		return ErrBridgeStarted
+	}
+	sub, err := b.src.QueueSubscribe(b.cfg.Subject, b.cfg.Queue, b.forward)
+	if err != nil {
+		return err
+	}
+	b.sub = sub
+	return nil
+}
+
+// Stop stops forwarding messages. A stopped bridge can be started again.
+func (b *Bridge) Stop() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.sub == nil {
+		return nil
+	}
+	err := b.sub.Unsubscribe()
+	b.sub = nil
+	return err
+}
+
+// Stats returns the statistics of the bridge.
+func (b *Bridge) Stats() BridgeStats {
+	return BridgeStats{
+		Forwarded: b.forwarded.Load(),
+		Skipped:   b.skipped.Load(),
+		Errors:    b.errors.Load(),
+	}
+}
+
+func (b *Bridge) forward(m *Msg) {
+	via := m.Header.Values(BridgeHeader)
+	if slices.Contains(via, b.cfg.ID) {
+		b.skipped.Add(1)
+		return
+	}
+	subject := m.Subject
+	if b.cfg.Remap != nil {
+		subject = b.cfg.Remap(subject)
+	}
+	out := &Msg{
+		Subject: subject,
+		Header:  copyHeader(m.Header),
+		Data:    m.Data,
+	}
+	if out.Header == nil {
+		out.Header = Header{}
+	}
+	out.Header.Add(BridgeHeader, b.cfg.ID)
+	if err := b.dst.PublishMsg(out); err != nil {
+		b.errors.Add(1)
+		return
+	}
+	b.forwarded.Add(1)
+}
@@ -15,7 +15,9 @@ package nats
 
 import (
 	"context"
+	"errors"
 	"reflect"
+	"time"
 )
 
 // RequestMsgWithContext takes a context, a subject and payload
@@ -61,6 +63,9 @@ func (nc *Conn) requestWithContext(ctx context.Context, subj string, hdr, data [
 		if err != nil {
 			return nil, err
 		}
+		canceled := make(chan struct{})
+		req := nc.inflight.add(nc.respSubPrefix+token, subj, func() { close(canceled) })
+		defer nc.inflight.remove(req)
 
 		var ok bool
 
@@ -74,6 +79,11 @@ func (nc *Conn) requestWithContext(ctx context.Context, subj string, hdr, data [
 			delete(nc.respMap, token)
 			nc.mu.Unlock()
 			return nil, ctx.Err()
+		case <-canceled:
+			nc.mu.Lock()
+			delete(nc.respMap, token)
+			nc.mu.Unlock()
+			return nil, ErrRequestCanceled
 		}
 	}
 	// Check for no responder status.
@@ -100,7 +110,36 @@ func (nc *Conn) oldRequestWithContext(ctx context.Context, subj string, hdr, dat
 		return nil, err
 	}
 
-	return s.NextMsgWithContext(ctx)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	req := nc.inflight.add(inbox, subj, cancel)
+	defer nc.inflight.remove(req)
+
+	m, err := s.NextMsgWithContext(ctx)
+	if err != nil && req.canceled.Load() {
+		return nil, ErrRequestCanceled
+	}
+	return m, err
+}
+
+// oldRequestWait waits for the response of an old style request sent
+// with a timeout, allowing the request to be canceled with CancelRequest.
+func (nc *Conn) oldRequestWait(s *Subscription, inbox, subj string, timeout time.Duration) (*Msg, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req := nc.inflight.add(inbox, subj, cancel)
+	defer nc.inflight.remove(req)
+
+	m, err := s.NextMsgWithContext(ctx)
+	if err != nil {
+		if req.canceled.Load() {
+			return nil, ErrRequestCanceled
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, ErrTimeout
+		}
+	}
+	return m, err
 }
 
 func (s *Subscription) nextMsgWithContext(ctx context.Context, pullSubInternal, waitIfNoMsg bool) (*Msg, error) {
@@ -183,6 +222,15 @@ func (nc *Conn) FlushWithContext(ctx context.Context) error {
 		return ErrNoDeadlineContext
 	}
 
+	// Wait for queued messages to be written first.
+	if nc.outq != nil {
+		select {
+		case <-nc.outq.emptied():
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
 	nc.mu.Lock()
 	if nc.isClosed() {
 		nc.mu.Unlock()
@@ -191,6 +239,7 @@ func (nc *Conn) FlushWithContext(ctx context.Context) error {
 	// Create a buffered channel to prevent chan send to block
 	// in processPong()
 	ch := make(chan struct{}, 1)
+	start := time.Now()
 	nc.sendPing(ch)
 	nc.mu.Unlock()
 
@@ -202,6 +251,7 @@ func (nc *Conn) FlushWithContext(ctx context.Context) error {
 			err = ErrConnectionClosed
 		} else {
 			close(ch)
+			nc.flushed(time.Since(start))
 		}
 	case <-ctx.Done():
 		err = ctx.Err()
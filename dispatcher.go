@@ -0,0 +1,101 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"sync"
+)
+
+const (
+	// DefaultSharedDispatcherWorkers is the default number of goroutines
+	// delivering messages when the SharedDispatcher option is set.
+	DefaultSharedDispatcherWorkers = 4
+
+	// sharedDispatcherBatch is the maximum number of messages delivered
+	// to a subscription before other queued subscriptions are dispatched.
+	sharedDispatcherBatch = 64
+)
+
+// subDispatcher delivers messages to asynchronous subscriptions using a
+// fixed pool of goroutines. Subscriptions with pending messages are queued
+// and dispatched by a single worker at a time, preserving per-subscription
+// ordering.
+type subDispatcher struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	subs   []*Subscription
+	closed bool
+}
+
+func newSubDispatcher(nc *Conn, workers int) *subDispatcher {
+	if workers <= 0 {
+		workers = DefaultSharedDispatcherWorkers
+	}
+	d := &subDispatcher{}
+	d.cond = sync.NewCond(&d.mu)
+	for i := 0; i < workers; i++ {
+		go d.run(nc)
+	}
+	return d
+}
+
+// run dispatches queued subscriptions until the dispatcher is closed
+// and all queued subscriptions have been dispatched.
+func (d *subDispatcher) run(nc *Conn) {
+	for {
+		d.mu.Lock()
+		for len(d.subs) == 0 && !d.closed {
+			d.cond.Wait()
+		}
+		if len(d.subs) == 0 {
+			d.mu.Unlock()
+			return
+		}
+		s := d.subs[0]
+		d.subs[0] = nil
+		d.subs = d.subs[1:]
+		d.mu.Unlock()
+
+		if nc.deliverMsgs(s, sharedDispatcherBatch) {
+			d.queue(s)
+		}
+	}
+}
+
+// queue adds the subscription to the list of subscriptions to dispatch.
+func (d *subDispatcher) queue(s *Subscription) {
+	d.mu.Lock()
+	d.subs = append(d.subs, s)
+	d.mu.Unlock()
+	d.cond.Signal()
+}
+
+// close stops the workers once all queued subscriptions are dispatched.
+func (d *subDispatcher) close() {
+	d.mu.Lock()
+	d.closed = true
+	d.mu.Unlock()
+	d.cond.Broadcast()
+}
+
+// schedule queues the subscription on the shared dispatcher, unless
+// it is already queued or being dispatched.
+// Lock for s should be held.
+func (s *Subscription) schedule() {
+	if s.dispatcher == nil || s.scheduled {
+		return
+	}
+	s.scheduled = true
+	s.dispatcher.queue(s)
+}
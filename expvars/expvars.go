@@ -0,0 +1,75 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package expvars publishes the statistics of a [nats.Conn] using the
+// standard [expvar] package, so that they are visible on /debug/vars.
+//
+// It is a separate package as importing expvar registers the /debug/vars
+// handler on [net/http.DefaultServeMux], which not all applications want.
+package expvars
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"sync"
+
+	"github.com/nats-io/nats.go"
+)
+
+// ErrNameInUse is returned by Publish if a variable with the given name
+// is already published.
+var ErrNameInUse = errors.New("expvars: name already in use")
+
+// mu prevents concurrent Publish calls from registering the same name,
+// which would make expvar panic.
+var mu sync.Mutex
+
+// Publish publishes the statistics of the connection as an expvar map
+// with the given name. The values are only computed when the variable is
+// read, e.g. when /debug/vars is requested, so publishing them does not add
+// any overhead to the connection.
+//
+// As expvar does not support removing variables, the connection is kept
+// referenced once published, even after it is closed.
+func Publish(nc *nats.Conn, name string) error {
+	if nc == nil {
+		return nats.ErrInvalidConnection
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if expvar.Get(name) != nil {
+		return fmt.Errorf("%w: %q", ErrNameInUse, name)
+	}
+	expvar.Publish(name, expvar.Func(func() any {
+		return Values(nc)
+	}))
+	return nil
+}
+
+// Values returns the statistics of the connection published by Publish.
+func Values(nc *nats.Conn) map[string]any {
+	stats := nc.Stats()
+	pendingMsgs, pendingBytes := nc.SubscriptionsPending()
+	return map[string]any{
+		"status":        nc.Status().String(),
+		"in_msgs":       stats.InMsgs,
+		"out_msgs":      stats.OutMsgs,
+		"in_bytes":      stats.InBytes,
+		"out_bytes":     stats.OutBytes,
+		"reconnects":    stats.Reconnects,
+		"subscriptions": nc.NumSubscriptions(),
+		"pending_msgs":  pendingMsgs,
+		"pending_bytes": pendingBytes,
+	}
+}
@@ -0,0 +1,453 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// faultInjector wraps the connections established by a client, allowing
+// tests to delay reads and writes, fail reads or drop the connection.
+type faultInjector struct {
+	mu         sync.Mutex
+	readDelay  time.Duration
+	writeDelay time.Duration
+	readErr    error
+	writeErr   error
+	writeN     int // bytes written before returning writeErr
+	conns      map[*faultConn]struct{}
+}
+
+type faultConn struct {
+	net.Conn
+	fi     *faultInjector
+	closed chan struct{}
+	once   sync.Once
+
+	mu            sync.Mutex
+	writeDeadline time.Time
+}
+
+func newFaultInjector() *faultInjector {
+	return &faultInjector{conns: make(map[*faultConn]struct{})}
+}
+
+// option enables fault injection on the connection.
+func (fi *faultInjector) option() Option {
+	return func(o *Options) error {
+		o.wrapConn = fi.wrap
+		return nil
+	}
+}
+
+func (fi *faultInjector) wrap(conn net.Conn) net.Conn {
+	fc := &faultConn{Conn: conn, fi: fi, closed: make(chan struct{})}
+	fi.mu.Lock()
+	fi.conns[fc] = struct{}{}
+	fi.mu.Unlock()
+	return fc
+}
+
+// delayReads delays the delivery of data read from the connection until
+// the delay expires or the connection is closed.
+func (fi *faultInjector) delayReads(d time.Duration) {
+	fi.mu.Lock()
+	fi.readDelay = d
+	fi.mu.Unlock()
+}
+
+// delayWrites delays every write until the delay expires, the write
+// deadline is exceeded or the connection is closed.
+func (fi *faultInjector) delayWrites(d time.Duration) {
+	fi.mu.Lock()
+	fi.writeDelay = d
+	fi.mu.Unlock()
+}
+
+// failNextRead makes the next read return err.
+func (fi *faultInjector) failNextRead(err error) {
+	fi.mu.Lock()
+	fi.readErr = err
+	fi.mu.Unlock()
+}
+
+// failNextWrite makes the next write return err after writing at most
+// n bytes, leaving a partial protocol message on the wire.
+func (fi *faultInjector) failNextWrite(err error, n int) {
+	fi.mu.Lock()
+	fi.writeErr = err
+	fi.writeN = n
+	fi.mu.Unlock()
+}
+
+// drop closes all open connections.
+func (fi *faultInjector) drop() {
+	fi.mu.Lock()
+	conns := make([]*faultConn, 0, len(fi.conns))
+	for fc := range fi.conns {
+		conns = append(conns, fc)
+	}
+	fi.mu.Unlock()
+	for _, fc := range conns {
+		fc.Close()
+	}
+}
+
+// readFault returns the delay and error to apply to the next read.
+func (fi *faultInjector) readFault() (time.Duration, error) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	err := fi.readErr
+	fi.readErr = nil
+	return fi.readDelay, err
+}
+
+func (fc *faultConn) wait(d time.Duration, deadline time.Time) error {
+	if d <= 0 {
+		return nil
+	}
+	var expired error
+	if !deadline.IsZero() && time.Until(deadline) < d {
+		d = time.Until(deadline)
+		expired = os.ErrDeadlineExceeded
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return expired
+	case <-fc.closed:
+		return net.ErrClosed
+	}
+}
+
+func (fc *faultConn) SetWriteDeadline(t time.Time) error {
+	fc.mu.Lock()
+	fc.writeDeadline = t
+	fc.mu.Unlock()
+	return fc.Conn.SetWriteDeadline(t)
+}
+
+// Read applies faults once data is received, so that they also apply to
+// a read which was already blocked when they were injected.
+func (fc *faultConn) Read(b []byte) (int, error) {
+	n, err := fc.Conn.Read(b)
+	if err != nil {
+		return n, err
+	}
+	delay, ferr := fc.fi.readFault()
+	if ferr != nil {
+		return 0, ferr
+	}
+	if err := fc.wait(delay, time.Time{}); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (fc *faultConn) Write(b []byte) (int, error) {
+	fc.fi.mu.Lock()
+	delay := fc.fi.writeDelay
+	werr, wn := fc.fi.writeErr, fc.fi.writeN
+	fc.fi.writeErr = nil
+	fc.fi.mu.Unlock()
+	fc.mu.Lock()
+	deadline := fc.writeDeadline
+	fc.mu.Unlock()
+	if err := fc.wait(delay, deadline); err != nil {
+		return 0, err
+	}
+	if werr != nil {
+		n, _ := fc.Conn.Write(b[:min(wn, len(b))])
+		return n, werr
+	}
+	return fc.Conn.Write(b)
+}
+
+func (fc *faultConn) Close() error {
+	fc.once.Do(func() {
+		close(fc.closed)
+		fc.fi.mu.Lock()
+		delete(fc.fi.conns, fc)
+		fc.fi.mu.Unlock()
+	})
+	return fc.Conn.Close()
+}
+
+// runFaultTestServer starts a minimal server accepting any number of
+// connections, answering PINGs and ignoring other protocol messages.
+// Like a real server, it closes connections sending malformed messages.
+func runFaultTestServer(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not listen on an ephemeral port: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.Write([]byte("INFO {\"server_id\":\"faults\",\"max_payload\":1048576}\r\n"))
+				br := bufio.NewReader(conn)
+				for {
+					line, err := br.ReadString('\n')
+					if err != nil {
+						return
+					}
+					switch {
+					case strings.HasPrefix(line, "PING"):
+						conn.Write([]byte(pongProto))
+					case strings.HasPrefix(line, "PUB "):
+						// skip the payload
+						args := strings.Fields(line)
+						size, err := strconv.Atoi(args[len(args)-1])
+						if err != nil || len(args) < 3 || len(args) > 4 {
+							conn.Write([]byte("-ERR 'Unknown Protocol Operation'\r\n"))
+							return
+						}
+						payload := make([]byte, size+2)
+						if _, err := io.ReadFull(br, payload); err != nil {
+							return
+						}
+						if !bytes.HasSuffix(payload, []byte(_CRLF_)) {
+							conn.Write([]byte("-ERR 'Unknown Protocol Operation'\r\n"))
+							return
+						}
+					case strings.HasPrefix(line, "CONNECT "), strings.HasPrefix(line, "SUB "),
+						strings.HasPrefix(line, "UNSUB "), strings.HasPrefix(line, "PONG"):
+					default:
+						conn.Write([]byte("-ERR 'Unknown Protocol Operation'\r\n"))
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return "nats://" + l.Addr().String()
+}
+
+func TestFaultInjectionReadError(t *testing.T) {
+	url := runFaultTestServer(t)
+	fi := newFaultInjector()
+	disconnected := make(chan error, 1)
+	reconnected := make(chan struct{}, 1)
+	nc, err := Connect(url, fi.option(),
+		ReconnectWait(10*time.Millisecond),
+		DisconnectErrHandler(func(_ *Conn, err error) {
+			disconnected <- err
+		}),
+		ReconnectHandler(func(*Conn) {
+			reconnected <- struct{}{}
+		}))
+	if err != nil {
+		t.Fatalf("Expected to connect, got %v", err)
+	}
+	defer nc.Close()
+
+	// The error is returned once the PONG for the flush is received.
+	readErr := errors.New("injected read error")
+	fi.failNextRead(readErr)
+	nc.Flush()
+
+	select {
+	case err := <-disconnected:
+		if !errors.Is(err, readErr) {
+			t.Fatalf("Expected error: %v; got: %v", readErr, err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout waiting for disconnect")
+	}
+	select {
+	case <-reconnected:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout waiting for reconnect")
+	}
+	if err := nc.FlushTimeout(time.Second); err != nil {
+		t.Fatalf("Unexpected error after reconnect: %v", err)
+	}
+	if reconnects := nc.Stats().Reconnects; reconnects != 1 {
+		t.Fatalf("Expected 1 reconnect; got: %d", reconnects)
+	}
+}
+
+func TestFaultInjectionFlushTimeout(t *testing.T) {
+	url := runFaultTestServer(t)
+	fi := newFaultInjector()
+	reconnected := make(chan struct{}, 1)
+	nc, err := Connect(url, fi.option(),
+		ReconnectWait(10*time.Millisecond),
+		FlusherTimeout(20*time.Millisecond),
+		ReconnectHandler(func(*Conn) {
+			reconnected <- struct{}{}
+		}))
+	if err != nil {
+		t.Fatalf("Expected to connect, got %v", err)
+	}
+	defer nc.Close()
+
+	// The PONG is not read before the flush times out.
+	fi.delayReads(time.Hour)
+	if err := nc.FlushTimeout(50 * time.Millisecond); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("Expected error: %v; got: %v", ErrTimeout, err)
+	}
+
+	// A stalled write fails once the flusher timeout is exceeded, so the
+	// PING is never sent and the connection is dropped, releasing the flush.
+	fi.delayReads(0)
+	fi.drop()
+	select {
+	case <-reconnected:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout waiting for reconnect")
+	}
+	fi.delayWrites(time.Hour)
+	if err := nc.FlushTimeout(100 * time.Millisecond); !errors.Is(err, ErrConnectionClosed) {
+		t.Fatalf("Expected error: %v; got: %v", ErrConnectionClosed, err)
+	}
+}
+
+func TestFaultInjectionFlushDuringReconnect(t *testing.T) {
+	url := runFaultTestServer(t)
+	fi := newFaultInjector()
+	reconnected := make(chan struct{}, 1)
+	nc, err := Connect(url, fi.option(),
+		ReconnectWait(10*time.Millisecond),
+		ReconnectHandler(func(*Conn) {
+			reconnected <- struct{}{}
+		}))
+	if err != nil {
+		t.Fatalf("Expected to connect, got %v", err)
+	}
+	defer nc.Close()
+
+	// Hold the PONG so the flush is still pending when the connection
+	// is dropped.
+	fi.delayReads(time.Hour)
+	flushErr := make(chan error, 1)
+	go func() {
+		flushErr <- nc.FlushTimeout(5 * time.Second)
+	}()
+	for deadline := time.Now().Add(time.Second); ; {
+		nc.mu.Lock()
+		pending := len(nc.pongs)
+		nc.mu.Unlock()
+		if pending > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Flush not pending")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	fi.delayReads(0)
+	fi.drop()
+
+	// Pending flush calls are released on disconnect, instead of
+	// waiting for the flush timeout.
+	select {
+	case err := <-flushErr:
+		if !errors.Is(err, ErrConnectionClosed) {
+			t.Fatalf("Expected error: %v; got: %v", ErrConnectionClosed, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Flush was not released on disconnect")
+	}
+	select {
+	case <-reconnected:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout waiting for reconnect")
+	}
+	if err := nc.FlushTimeout(time.Second); err != nil {
+		t.Fatalf("Unexpected error after reconnect: %v", err)
+	}
+}
+
+func TestFaultInjectionPartialWrite(t *testing.T) {
+	url := runFaultTestServer(t)
+	fi := newFaultInjector()
+	disconnected := make(chan error, 1)
+	reconnected := make(chan struct{}, 1)
+	nc, err := Connect(url, fi.option(),
+		ReconnectWait(10*time.Millisecond),
+		DisconnectErrHandler(func(_ *Conn, err error) {
+			disconnected <- err
+		}),
+		ReconnectHandler(func(*Conn) {
+			reconnected <- struct{}{}
+		}))
+	if err != nil {
+		t.Fatalf("Expected to connect, got %v", err)
+	}
+	defer nc.Close()
+
+	// Only part of the PUB line is written.
+	writeErr := errors.New("injected write error")
+	fi.failNextWrite(writeErr, 5)
+	if err := nc.Publish("foo", []byte("hello")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := nc.FlushTimeout(time.Second); err == nil {
+		t.Fatal("Expected flush to fail")
+	}
+
+	// Nothing is written after the partial message, which would corrupt
+	// the protocol stream, and nothing is kept to be sent after reconnect.
+	nc.mu.Lock()
+	buffered := nc.bw.buffered()
+	nc.mu.Unlock()
+	if buffered != 0 {
+		t.Fatalf("Expected no buffered data; got: %d bytes", buffered)
+	}
+	if err := nc.Publish("foo", []byte("hello")); err != nil && !errors.Is(err, writeErr) {
+		t.Fatalf("Expected error: %v; got: %v", writeErr, err)
+	}
+
+	select {
+	case err := <-disconnected:
+		if !errors.Is(err, writeErr) {
+			t.Fatalf("Expected error: %v; got: %v", writeErr, err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout waiting for disconnect")
+	}
+	select {
+	case <-reconnected:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout waiting for reconnect")
+	}
+	if err := nc.Publish("foo", []byte("hello")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := nc.FlushTimeout(time.Second); err != nil {
+		t.Fatalf("Unexpected error after reconnect: %v", err)
+	}
+	if !nc.IsConnected() {
+		t.Fatalf("Expected to be connected; got: %v", nc.Status())
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RequestInfo describes a request waiting for a response.
+type RequestInfo struct {
+	// Inbox is the reply subject of the request. It can be passed
+	// to CancelRequest.
+	Inbox string
+	// Subject is the subject the request was sent to.
+	Subject string
+	// Started is the time at which the request was sent.
+	Started time.Time
+	// Age is the time elapsed since the request was sent.
+	Age time.Duration
+}
+
+// inflightRequests keeps track of requests waiting for a response.
+// It has its own lock so that it does not contend with the connection lock.
+type inflightRequests struct {
+	mu   sync.Mutex
+	reqs map[string]*inflightRequest
+}
+
+type inflightRequest struct {
+	inbox    string
+	subject  string
+	started  time.Time
+	cancel   func()
+	canceled atomic.Bool
+}
+
+// add registers a request. The cancel function is invoked if the
+// request is canceled using CancelRequest.
+func (r *inflightRequests) add(inbox, subject string, cancel func()) *inflightRequest {
+	req := &inflightRequest{inbox: inbox, subject: subject, started: time.Now(), cancel: cancel}
+	r.mu.Lock()
+	if r.reqs == nil {
+		r.reqs = make(map[string]*inflightRequest)
+	}
+	r.reqs[inbox] = req
+	r.mu.Unlock()
+	return req
+}
+
+func (r *inflightRequests) remove(req *inflightRequest) {
+	r.mu.Lock()
+	if r.reqs[req.inbox] == req {
+		delete(r.reqs, req.inbox)
+	}
+	r.mu.Unlock()
+}
+
+// InflightRequests returns the requests sent on this connection which
+// are still waiting for a response, oldest first.
+func (nc *Conn) InflightRequests() []RequestInfo {
+	if nc == nil {
+		return nil
+	}
+	now := time.Now()
+	nc.inflight.mu.Lock()
+	infos := make([]RequestInfo, 0, len(nc.inflight.reqs))
+	for _, req := range nc.inflight.reqs {
+		infos = append(infos, RequestInfo{
+			Inbox:   req.inbox,
+			Subject: req.subject,
+			Started: req.started,
+			Age:     now.Sub(req.started),
+		})
+	}
+	nc.inflight.mu.Unlock()
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Started.Before(infos[j].Started)
+	})
+	return infos
+}
+
+// CancelRequest cancels the in-flight request with the given inbox,
+// as reported by InflightRequests. The canceled request returns
+// ErrRequestCanceled. It returns false if no such request is in flight.
+func (nc *Conn) CancelRequest(inbox string) bool {
+	if nc == nil {
+		return false
+	}
+	nc.inflight.mu.Lock()
+	req, ok := nc.inflight.reqs[inbox]
+	if ok {
+		delete(nc.inflight.reqs, inbox)
+	}
+	nc.inflight.mu.Unlock()
+	if !ok {
+		return false
+	}
+	req.canceled.Store(true)
+	req.cancel()
+	return true
+}
@@ -0,0 +1,144 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jetstream
+
+import (
+	"sync"
+	"time"
+)
+
+// ackBatcher coalesces acks of messages consumed with AckAllPolicy.
+// Acknowledging a message with AckAllPolicy acknowledges all messages
+// with lower stream sequences, so instead of sending an ack for every
+// message, the batcher only acks the highest completed sequence below
+// the lowest message which is still being processed.
+type ackBatcher struct {
+	sync.Mutex
+	size     int
+	maxDelay time.Duration
+	send     func(*jetStreamMsg) error
+
+	// stream sequences of messages delivered but not yet acked
+	pending map[uint64]struct{}
+	// messages acked by the user, but not yet acked on the server
+	completed map[uint64]*jetStreamMsg
+	timer     *time.Timer
+	closed    bool
+}
+
+func newAckBatcher(size int, maxDelay time.Duration, send func(*jetStreamMsg) error) *ackBatcher {
+	return &ackBatcher{
+		size:      size,
+		maxDelay:  maxDelay,
+		send:      send,
+		pending:   make(map[uint64]struct{}),
+		completed: make(map[uint64]*jetStreamMsg),
+	}
+}
+
+// track registers a message delivered to the handler. Messages which
+// cannot be tracked are acked individually.
+func (b *ackBatcher) track(m *jetStreamMsg) {
+	meta, err := m.Metadata()
+	if err != nil {
+		return
+	}
+	b.Lock()
+	defer b.Unlock()
+	if b.closed {
+		return
+	}
+	m.ackBatch = b
+	m.streamSeq = meta.Sequence.Stream
+	b.pending[m.streamSeq] = struct{}{}
+}
+
+// ack marks the message as completed, sending the batched ack if
+// batch size has been reached.
+func (b *ackBatcher) ack(m *jetStreamMsg) error {
+	b.Lock()
+	if _, ok := b.pending[m.streamSeq]; !ok || b.closed {
+		// not tracked anymore, ack the message on its own
+		b.Unlock()
+		return b.send(m)
+	}
+	delete(b.pending, m.streamSeq)
+	b.completed[m.streamSeq] = m
+	if len(b.completed) < b.size {
+		if b.timer == nil {
+			b.timer = time.AfterFunc(b.maxDelay, func() { b.flush() })
+		}
+		b.Unlock()
+		return nil
+	}
+	b.Unlock()
+	return b.flush()
+}
+
+// remove stops tracking a message which was terminated, so that it
+// no longer blocks acks of subsequent messages.
+func (b *ackBatcher) remove(m *jetStreamMsg) {
+	b.Lock()
+	defer b.Unlock()
+	delete(b.pending, m.streamSeq)
+	if len(b.completed) > 0 && b.timer == nil && !b.closed {
+		b.timer = time.AfterFunc(b.maxDelay, func() { b.flush() })
+	}
+}
+
+// flush acks the highest completed message for which all messages with
+// lower sequences delivered to this consumer are completed as well.
+// Completed messages above a message still being processed are kept
+// until it is acked or terminated, which schedules the next flush.
+func (b *ackBatcher) flush() error {
+	b.Lock()
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	floor := ^uint64(0)
+	for seq := range b.pending {
+		if seq < floor {
+			floor = seq
+		}
+	}
+	var last *jetStreamMsg
+	for seq, m := range b.completed {
+		if seq >= floor {
+			continue
+		}
+		if last == nil || seq > last.streamSeq {
+			last = m
+		}
+		delete(b.completed, seq)
+	}
+	b.Unlock()
+
+	if last == nil {
+		return nil
+	}
+	return b.send(last)
+}
+
+// close flushes outstanding acks and stops the batcher.
+func (b *ackBatcher) close() {
+	b.flush()
+	b.Lock()
+	b.closed = true
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.Unlock()
+}
@@ -0,0 +1,164 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jetstream
+
+import (
+	"bytes"
+	"sync"
+	"time"
+)
+
+// defaultAckWait is the server default used when the consumer's
+// AckWait is not known.
+const defaultAckWait = 30 * time.Second
+
+// minAckPendingPrune is the number of pending messages from which
+// messages with expired ack wait are dropped when tracking a message.
+const minAckPendingPrune = 1024
+
+// ackPending tracks messages passed to the handler which have not yet
+// been acknowledged, keyed by stream sequence. A message stops counting
+// as pending once it is acked, nacked or terminated, once a later
+// message is acked with AckAllPolicy, or once its ack wait expires and
+// the server is free to redeliver it. Messages of consumers with
+// AckNonePolicy are not tracked, as they are never acknowledged.
+type ackPending struct {
+	sync.Mutex
+	ackWait time.Duration
+	backOff []time.Duration
+	ackAll  bool
+	ackNone bool
+
+	// number of pending messages from which expired ones are dropped
+	// by track, so that unacknowledged messages do not accumulate
+	pruneAt int
+
+	// ack wait deadlines of pending messages
+	pending map[uint64]time.Time
+	timer   *time.Timer
+	stopped bool
+}
+
+func newAckPending(cfg *ConsumerConfig) *ackPending {
+	p := &ackPending{
+		ackWait: defaultAckWait,
+		pending: make(map[uint64]time.Time),
+		pruneAt: minAckPendingPrune,
+	}
+	if cfg != nil {
+		if cfg.AckWait > 0 {
+			p.ackWait = cfg.AckWait
+		}
+		p.backOff = cfg.BackOff
+		p.ackAll = cfg.AckPolicy == AckAllPolicy
+		p.ackNone = cfg.AckPolicy == AckNonePolicy
+	}
+	return p
+}
+
+// track registers a message delivered to the handler.
+func (p *ackPending) track(m *jetStreamMsg) {
+	meta, err := m.Metadata()
+	if err != nil {
+		return
+	}
+	m.streamSeq = meta.Sequence.Stream
+	if p.ackNone {
+		return
+	}
+	ackWait := p.ackWait
+	if len(p.backOff) > 0 && meta.NumDelivered > 0 {
+		ackWait = p.backOff[min(int(meta.NumDelivered)-1, len(p.backOff)-1)]
+	}
+	now := time.Now()
+	p.Lock()
+	defer p.Unlock()
+	p.pending[m.streamSeq] = now.Add(ackWait)
+	if len(p.pending) >= p.pruneAt {
+		p.prune(now)
+		p.pruneAt = max(2*len(p.pending), minAckPendingPrune)
+	}
+}
+
+// ack updates the pending messages for an ack of the given type.
+func (p *ackPending) ack(seq uint64, ackType []byte) {
+	p.Lock()
+	defer p.Unlock()
+	if _, ok := p.pending[seq]; !ok {
+		return
+	}
+	switch {
+	case bytes.Equal(ackType, ackProgress):
+		p.pending[seq] = time.Now().Add(p.ackWait)
+	case p.ackAll && bytes.Equal(ackType, ackAck):
+		for s := range p.pending {
+			if s <= seq {
+				delete(p.pending, s)
+			}
+		}
+	default:
+		delete(p.pending, seq)
+	}
+}
+
+// len returns the number of pending messages, dropping the ones
+// with expired ack wait.
+func (p *ackPending) len() int {
+	p.Lock()
+	defer p.Unlock()
+	p.prune(time.Now())
+	return len(p.pending)
+}
+
+// prune drops the pending messages with expired ack wait.
+// Lock should be held.
+func (p *ackPending) prune(now time.Time) {
+	for seq, deadline := range p.pending {
+		if !now.Before(deadline) {
+			delete(p.pending, seq)
+		}
+	}
+}
+
+// onExpiry calls f once the earliest ack wait deadline of the
+// pending messages passes, unless it is already scheduled.
+func (p *ackPending) onExpiry(f func()) {
+	p.Lock()
+	defer p.Unlock()
+	if p.timer != nil || p.stopped || len(p.pending) == 0 {
+		return
+	}
+	var next time.Time
+	for _, deadline := range p.pending {
+		if next.IsZero() || deadline.Before(next) {
+			next = deadline
+		}
+	}
+	p.timer = time.AfterFunc(max(time.Until(next), time.Millisecond), func() {
+		p.Lock()
+		p.timer = nil
+		p.Unlock()
+		f()
+	})
+}
+
+// stop cancels the scheduled expiry callback.
+func (p *ackPending) stop() {
+	p.Lock()
+	defer p.Unlock()
+	p.stopped = true
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+}
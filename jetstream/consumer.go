@@ -106,10 +106,22 @@ type (
 		//   consumption (both transient and terminal)
 		// - Consume can be configured to stop after a certain number of
 		//   messages is received using StopAfter option.
+		// - Messages which are about to exceed MaxDeliver can be routed to a
+		//   dead letter subject using WithConsumeDeadLetter option.
+		// - Redelivery of messages processed longer than AckWait can be
+		//   prevented using WithConsumeAckWaitExtension option.
 		// - Consume can be optimized for throughput or memory usage using
 		//   PullExpiry, PullMaxMessages, PullMaxBytes and PullHeartbeat options.
 		//   Unless there is a specific use case, these options should not be used.
 		//
+		// Messages received for pull requests sent before the connection was
+		// lost, and not yet passed to the handler, are discarded and nacked
+		// once reconnected, so that the server redelivers them. This prevents
+		// the client from handling a message twice for a single delivery, but
+		// delivery remains at least once: a message handled right before a
+		// disconnect may be redelivered if its ack was not received by the
+		// server. Each discarded delivery counts towards MaxDeliver.
+		//
 		// Consume returns a ConsumeContext, which can be used to stop or drain
 		// the consumer.
 		Consume(handler MessageHandler, opts ...PullConsumeOpt) (ConsumeContext, error)
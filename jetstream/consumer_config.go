@@ -217,6 +217,15 @@ type (
 		// associating metadata on the consumer. This feature requires
 		// nats-server v2.10.0 or later.
 		Metadata map[string]string `json:"metadata,omitempty"`
+
+		// PriorityPolicy defines how pull requests of the consumer's priority
+		// groups are served. Requires nats-server v2.11.0 or later, and
+		// v2.12.0 or later for PriorityPrioritized.
+		PriorityPolicy PriorityPolicy `json:"priority_policy,omitempty"`
+
+		// PriorityGroups is the list of priority groups pull requests have
+		// to specify when PriorityPolicy is set.
+		PriorityGroups []string `json:"priority_groups,omitempty"`
 	}
 
 	// OrderedConsumerConfig is the configuration of an ordered JetStream
@@ -281,6 +290,10 @@ type (
 	// already has queued in the stream.
 	ReplayPolicy int
 
+	// PriorityPolicy determines how the consumer serves pull requests
+	// of its priority groups.
+	PriorityPolicy int
+
 	// SequenceInfo has both the consumer and the stream sequence and last
 	// activity.
 	SequenceInfo struct {
@@ -463,3 +476,66 @@ func (p ReplayPolicy) String() string {
 	}
 	return ""
 }
+
+const (
+	// PriorityNone does not use priority groups. This is the default.
+	PriorityNone PriorityPolicy = iota
+
+	// PriorityOverflow serves pull requests setting a minimum number of
+	// pending messages or acks only once the threshold is reached.
+	PriorityOverflow
+
+	// PriorityPinnedClient serves messages to a single pinned client of
+	// the priority group at a time.
+	PriorityPinnedClient
+
+	// PriorityPrioritized serves pull requests with the lowest priority
+	// level first, other pull requests receive messages only if no higher
+	// priority request is waiting.
+	PriorityPrioritized
+)
+
+func (p *PriorityPolicy) UnmarshalJSON(data []byte) error {
+	switch string(data) {
+	case jsonString("none"):
+		*p = PriorityNone
+	case jsonString("overflow"):
+		*p = PriorityOverflow
+	case jsonString("pinned_client"):
+		*p = PriorityPinnedClient
+	case jsonString("prioritized"):
+		*p = PriorityPrioritized
+	default:
+		return fmt.Errorf("nats: can not unmarshal %q", data)
+	}
+
+	return nil
+}
+
+func (p PriorityPolicy) MarshalJSON() ([]byte, error) {
+	switch p {
+	case PriorityNone:
+		return json.Marshal("none")
+	case PriorityOverflow:
+		return json.Marshal("overflow")
+	case PriorityPinnedClient:
+		return json.Marshal("pinned_client")
+	case PriorityPrioritized:
+		return json.Marshal("prioritized")
+	}
+	return nil, fmt.Errorf("nats: unknown priority policy %v", p)
+}
+
+func (p PriorityPolicy) String() string {
+	switch p {
+	case PriorityNone:
+		return "none"
+	case PriorityOverflow:
+		return "overflow"
+	case PriorityPinnedClient:
+		return "pinned_client"
+	case PriorityPrioritized:
+		return "prioritized"
+	}
+	return ""
+}
@@ -161,6 +161,13 @@ var (
 	// does not exist.
 	ErrConsumerNameAlreadyInUse JetStreamError = &jsError{message: "consumer name already in use"}
 
+	// ErrSubjectPrefixNotSupported is returned when creating a JetStream
+	// instance on a connection configured with [nats.SubjectPrefix]. Subjects
+	// carried in JetStream API payloads (e.g. stream subjects or consumer
+	// filter subjects) are not namespaced, so JetStream cannot be used on
+	// such connections.
+	ErrSubjectPrefixNotSupported JetStreamError = &jsError{message: "jetstream is not supported on connections with a subject prefix"}
+
 	// ErrInvalidJSAck is returned when JetStream ack from message publish is
 	// invalid.
 	ErrInvalidJSAck JetStreamError = &jsError{message: "invalid jetstream publish response"}
@@ -211,6 +218,11 @@ var (
 	// Stream().
 	ErrHandlerRequired JetStreamError = &jsError{message: "handler cannot be empty"}
 
+	// ErrConsumeOutOfOrder is passed to the consume error handler when a
+	// message would be delivered out of stream sequence order while using
+	// WithConsumeOrdered.
+	ErrConsumeOutOfOrder JetStreamError = &jsError{message: "message delivered out of sequence order"}
+
 	// ErrEndOfData is returned when iterating over paged API from JetStream
 	// reaches end of data.
 	ErrEndOfData JetStreamError = &jsError{message: "end of data reached"}
@@ -270,6 +282,10 @@ var (
 	// of an ordered consumer which was not yet created.
 	ErrOrderedConsumerNotCreated JetStreamError = &jsError{message: "consumer instance not yet created"}
 
+	// ErrOrderedConsumerNotPromotable is returned when attempting to promote
+	// an ordered consumer to a durable consumer.
+	ErrOrderedConsumerNotPromotable JetStreamError = &jsError{message: "ordered consumer cannot be promoted to durable"}
+
 	// ErrJetStreamPublisherClosed is returned for each unfinished ack future when JetStream.Cleanup is called.
 	ErrJetStreamPublisherClosed JetStreamError = &jsError{message: "jetstream context closed"}
 
@@ -19,10 +19,12 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/internal/syncx"
 	"github.com/nats-io/nuid"
 )
 
@@ -49,6 +51,12 @@ type (
 		// returned.
 		AccountInfo(ctx context.Context) (*AccountInfo, error)
 
+		// ActiveConsumeContexts returns information about the consume
+		// contexts created with [Consumer.Consume] and [Consumer.Messages]
+		// on consumers obtained from this JetStream instance which have not
+		// been fully stopped yet, sorted by ID.
+		ActiveConsumeContexts() []ConsumeContextInfo
+
 		StreamConsumerManager
 		StreamManager
 		Publisher
@@ -189,6 +197,14 @@ type (
 		// pull consumers and are resilient to deletes and restarts.
 		OrderedConsumer(ctx context.Context, stream string, cfg OrderedConsumerConfig) (Consumer, error)
 
+		// ConsumeSubject creates an ephemeral consumer on the stream,
+		// delivering messages published on filterSubject from now on, and
+		// consumes it with the handler, as [Consumer.Consume] would. The
+		// consumer is deleted once the returned ConsumeContext is stopped or
+		// drained. Should the client be unable to delete it, e.g. because the
+		// connection is closed, the server removes it once inactive.
+		ConsumeSubject(ctx context.Context, stream, filterSubject string, handler MessageHandler, opts ...PullConsumeOpt) (ConsumeContext, error)
+
 		// Consumer returns an interface to an existing consumer, allowing processing
 		// of messages. If consumer does not exist, ErrConsumerNotFound is
 		// returned.
@@ -277,6 +293,9 @@ type (
 		jsOpts
 
 		publisher *jetStreamClient
+
+		// consume contexts which have not been stopped yet, by ID
+		consumeContexts syncx.Map[string, *pullSubscription]
 	}
 
 	// JetStreamOpt is a functional option for [New], [NewWithAPIPrefix] and
@@ -379,6 +398,9 @@ var subjectRegexp = regexp.MustCompile(`^[^ >]*[>]?$`)
 //   - [WithPublishAsyncMaxPending] - sets the maximum outstanding async publishes
 //     that can be inflight at one time.
 func New(nc *nats.Conn, opts ...JetStreamOpt) (JetStream, error) {
+	if nc.Opts.SubjectPrefix != "" {
+		return nil, ErrSubjectPrefixNotSupported
+	}
 	jsOpts := jsOpts{
 		apiPrefix: DefaultAPIPrefix,
 		publisherOpts: asyncPublisherOpts{
@@ -424,6 +446,9 @@ func setReplyPrefix(nc *nats.Conn, jsOpts *jsOpts) {
 //   - [WithPublishAsyncMaxPending] - sets the maximum outstanding async publishes
 //     that can be inflight at one time.
 func NewWithAPIPrefix(nc *nats.Conn, apiPrefix string, opts ...JetStreamOpt) (JetStream, error) {
+	if nc.Opts.SubjectPrefix != "" {
+		return nil, ErrSubjectPrefixNotSupported
+	}
 	jsOpts := jsOpts{
 		publisherOpts: asyncPublisherOpts{
 			maxpa: defaultAsyncPubAckInflight,
@@ -458,6 +483,9 @@ func NewWithAPIPrefix(nc *nats.Conn, apiPrefix string, opts ...JetStreamOpt) (Je
 //   - [WithPublishAsyncMaxPending] - sets the maximum outstanding async publishes
 //     that can be inflight at one time.
 func NewWithDomain(nc *nats.Conn, domain string, opts ...JetStreamOpt) (JetStream, error) {
+	if nc.Opts.SubjectPrefix != "" {
+		return nil, ErrSubjectPrefixNotSupported
+	}
 	jsOpts := jsOpts{
 		publisherOpts: asyncPublisherOpts{
 			maxpa: defaultAsyncPubAckInflight,
@@ -763,6 +791,43 @@ func (js *jetStream) OrderedConsumer(ctx context.Context, stream string, cfg Ord
 	return oc, nil
 }
 
+// ConsumeSubject creates an ephemeral consumer on the stream, delivering
+// messages published on filterSubject from now on, and consumes it with the
+// handler. The consumer is deleted once the returned ConsumeContext is
+// stopped or drained.
+func (js *jetStream) ConsumeSubject(ctx context.Context, stream, filterSubject string, handler MessageHandler, opts ...PullConsumeOpt) (ConsumeContext, error) {
+	if err := validateStreamName(stream); err != nil {
+		return nil, err
+	}
+	if filterSubject == "" {
+		return nil, fmt.Errorf("%w: filter subject is required", ErrInvalidOption)
+	}
+	cons, err := js.CreateConsumer(ctx, stream, ConsumerConfig{
+		FilterSubject: filterSubject,
+		DeliverPolicy: DeliverNewPolicy,
+		AckPolicy:     AckExplicitPolicy,
+	})
+	if err != nil {
+		return nil, err
+	}
+	name := cons.CachedInfo().Name
+	deleteConsumer := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), defaultAPITimeout)
+		defer cancel()
+		_ = js.DeleteConsumer(ctx, stream, name)
+	}
+	cc, err := cons.Consume(handler, opts...)
+	if err != nil {
+		deleteConsumer()
+		return nil, err
+	}
+	go func() {
+		<-cc.Closed()
+		deleteConsumer()
+	}()
+	return cc, nil
+}
+
 // Consumer returns an interface to an existing consumer, allowing processing
 // of messages. If consumer does not exist, ErrConsumerNotFound is
 // returned.
@@ -802,6 +867,21 @@ func validateSubject(subject string) error {
 	return nil
 }
 
+// ActiveConsumeContexts returns information about the consume contexts
+// created on consumers obtained from this JetStream instance which have not
+// been fully stopped yet, sorted by ID.
+func (js *jetStream) ActiveConsumeContexts() []ConsumeContextInfo {
+	var infos []ConsumeContextInfo
+	js.consumeContexts.Range(func(_ string, sub *pullSubscription) bool {
+		infos = append(infos, sub.info())
+		return true
+	})
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ID < infos[j].ID
+	})
+	return infos
+}
+
 // AccountInfo fetches account information from the server, containing details
 // about the account associated with this JetStream connection. If account is
 // not enabled for JetStream, ErrJetStreamNotEnabledForAccount is returned.
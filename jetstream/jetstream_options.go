@@ -56,10 +56,31 @@ func WithPublishAsyncMaxPending(max int) JetStreamOpt {
 	}
 }
 
+// WithPublishAsyncDedupWindow enables client-side suppression of async
+// publishes whose subject and message ID (set with [WithMsgID]) were already
+// acknowledged within the given window, counted from the first ack.
+// Publishing such a message again, e.g. when retrying after a reconnect, does
+// not send it to the server and returns a completed [PubAckFuture] with
+// [PubAck.Duplicate] set. The window should not exceed the stream's
+// [StreamConfig.Duplicates] window.
+func WithPublishAsyncDedupWindow(window time.Duration) JetStreamOpt {
+	return func(opts *jsOpts) error {
+		if window < 0 {
+			return fmt.Errorf("%w: dedup window cannot be negative", ErrInvalidOption)
+		}
+		opts.publisherOpts.dedupWindow = window
+		return nil
+	}
+}
+
 // WithPurgeSubject sets a specific subject for which messages on a stream will
-// be purged
+// be purged. The subject may contain wildcards, in which case all messages
+// matching the filter are purged.
 func WithPurgeSubject(subject string) StreamPurgeOpt {
 	return func(req *StreamPurgeRequest) error {
+		if err := validateSubject(subject); err != nil {
+			return fmt.Errorf("%w: invalid purge subject: %s", ErrInvalidOption, err)
+		}
 		req.Subject = subject
 		return nil
 	}
@@ -81,6 +102,12 @@ func WithPurgeSequence(sequence uint64) StreamPurgeOpt {
 // WithPurgeKeep sets the number of messages to be kept in the stream after
 // purge. Can be combined with [WithPurgeSubject] option, but not with
 // [WithPurgeSequence]
+//
+// When combined with [WithPurgeSubject], the server keeps the last keep
+// messages matching the subject filter as a whole. For a wildcard filter
+// (e.g. "FOO.*") this means keep messages in total across all matching
+// subjects, not keep messages per subject. To retain a number of messages
+// per subject, purge each subject separately.
 func WithPurgeKeep(keep uint64) StreamPurgeOpt {
 	return func(req *StreamPurgeRequest) error {
 		if req.Sequence != 0 {
@@ -199,6 +226,8 @@ func (t PullThresholdBytes) configureMessages(opts *consumeOpts) error {
 // than the idle heartbeat setting, the subscription will be removed
 // and error will be passed to the message handler.
 // If not provided, a default PullExpiry / 2 will be used (capped at 30 seconds)
+// The heartbeat has to be at most half of PullExpiry, otherwise Consume and
+// Messages return [ErrInvalidOption].
 type PullHeartbeat time.Duration
 
 func (hb PullHeartbeat) configureConsume(opts *consumeOpts) error {
@@ -250,6 +279,148 @@ func ConsumeErrHandler(cb ConsumeErrHandlerFunc) PullConsumeOpt {
 	})
 }
 
+// WithConsumeDeadLetter routes messages which are about to exceed the
+// consumer's MaxDeliver to the provided dead letter subject instead of letting
+// the server silently drop them.
+//
+// When a message on its last delivery (NumDelivered equal to MaxDeliver) is
+// negatively acknowledged using Nak or NakWithDelay, it is first published to
+// the dead letter subject (with its original headers, [DeadLetterReasonHeader]
+// and [DeadLetterSubjectHeader]) and only then terminated. The dead letter
+// subject has to be bound to a stream, as the message is only terminated once
+// its PubAck is received. If the publish fails, the error is returned from
+// Nak and the message is left unacknowledged: as the server does not redeliver
+// it, it is lost unless Nak is called again to retry routing it, or it is
+// handled otherwise before AckWait expires.
+//
+// Messages are only routed when nacked: a message whose last delivery is
+// neither acknowledged nor nacked before AckWait expires is not routed to the
+// dead letter subject.
+//
+// The option has no effect for consumers without MaxDeliver set.
+func WithConsumeDeadLetter(subject string) PullConsumeOpt {
+	return pullOptFunc(func(cfg *consumeOpts) error {
+		if err := validateSubject(subject); err != nil {
+			return err
+		}
+		cfg.DeadLetterSubject = subject
+		return nil
+	})
+}
+
+// WithConsumeAckBatch coalesces acknowledgements sent by [Msg.Ack] in
+// Consume, relying on AckAllPolicy semantics: acking a message acknowledges
+// all messages with lower sequences. An ack is sent once size messages have
+// been acked or after maxDelay, whichever comes first. Only the highest
+// message for which all lower messages delivered to this Consume were acked
+// is sent, so messages completing out of order are never acknowledged early.
+// The consumer must be configured with AckAllPolicy.
+//
+// Messages acked by the handler but not yet acknowledged on the server are
+// redelivered if the client stops before the batched ack is sent, so
+// handlers should be idempotent. A message acked with Nak blocks batched
+// acks of subsequent messages until it is redelivered and acked, or
+// terminated. Other acknowledgement types are sent immediately.
+func WithConsumeAckBatch(size int, maxDelay time.Duration) PullConsumeOpt {
+	return pullOptFunc(func(cfg *consumeOpts) error {
+		if size < 1 {
+			return fmt.Errorf("%w: ack batch size must be at least 1", ErrInvalidOption)
+		}
+		if maxDelay <= 0 {
+			return fmt.Errorf("%w: ack batch max delay must be greater than 0", ErrInvalidOption)
+		}
+		cfg.AckBatchSize = size
+		cfg.AckBatchMaxDelay = maxDelay
+		return nil
+	})
+}
+
+// WithConsumeAckWaitExtension makes Consume automatically send in progress
+// acknowledgements (see [Msg.InProgress]) at the given interval while the
+// message handler is running, preventing redelivery of messages processed
+// longer than the consumer's AckWait. The interval should be lower than
+// AckWait. Sending in progress acks stops as soon as the message is
+// acknowledged (Ack, Nak, Term etc.) or the handler returns.
+func WithConsumeAckWaitExtension(interval time.Duration) PullConsumeOpt {
+	return pullOptFunc(func(cfg *consumeOpts) error {
+		if interval <= 0 {
+			return fmt.Errorf("%w: ack wait extension interval must be greater than 0", ErrInvalidOption)
+		}
+		cfg.AckWaitExtension = interval
+		return nil
+	})
+}
+
+// WithConsumePriority sets the priority group and priority level sent with
+// the pull requests of Consume. The consumer has to be created with
+// PriorityPolicy set to [PriorityPrioritized] and the group listed in
+// PriorityGroups. When messages are scarce, pull requests with a lower
+// level are served first, 0 being the highest priority and 9 the lowest.
+// Requires nats-server v2.12.0 or later.
+func WithConsumePriority(group string, level int) PullConsumeOpt {
+	return pullOptFunc(func(cfg *consumeOpts) error {
+		if group == "" {
+			return fmt.Errorf("%w: priority group cannot be empty", ErrInvalidOption)
+		}
+		if level < 0 || level > 9 {
+			return fmt.Errorf("%w: priority level must be between 0 and 9", ErrInvalidOption)
+		}
+		cfg.PriorityGroup = group
+		cfg.Priority = level
+		return nil
+	})
+}
+
+// WithConsumeMaxAckPending limits the number of messages delivered to the
+// handler which have not yet been acknowledged. When the limit is reached,
+// Consume stops pulling new messages and resumes once messages are acked,
+// nacked or terminated, or once their ack wait expires. With AckAllPolicy,
+// an ack also releases all pending messages with lower stream sequences.
+// The current number of such messages is available via
+// [ConsumeContext.NumAckPending]. Cannot be used with AckNonePolicy.
+func WithConsumeMaxAckPending(n int) PullConsumeOpt {
+	return pullOptFunc(func(cfg *consumeOpts) error {
+		if n < 1 {
+			return fmt.Errorf("%w: max ack pending has to be greater than 0", ErrInvalidOption)
+		}
+		cfg.MaxAckPending = n
+		return nil
+	})
+}
+
+// WithConsumeDurableName sets the name of the durable consumer which an
+// ephemeral consumer is promoted to when calling [ConsumeContext.Promote].
+// The durable is not created until Promote is called. If the consumer is
+// already durable, the name has to match the consumer name.
+func WithConsumeDurableName(name string) PullConsumeOpt {
+	return pullOptFunc(func(cfg *consumeOpts) error {
+		if err := validateConsumerName(name); err != nil {
+			return err
+		}
+		cfg.DurableName = name
+		return nil
+	})
+}
+
+// WithConsumeOrdered guarantees that the handler processes messages in
+// strictly increasing stream sequence order, one message at a time, even
+// if several messages are buffered.
+//
+// If a message with a lower sequence than an already handled one is
+// received, e.g. a message redelivered after being nacked or after its
+// AckWait expired, Consume is stopped and [ErrConsumeOutOfOrder] is passed
+// to the error handler. The message and all messages buffered after it are
+// left unacknowledged, to be redelivered once consuming is restarted. To
+// allow redeliveries without stopping, use WithConsumeMaxAckPending(1), so
+// that no message is pulled before the previous one is acknowledged. This
+// trades throughput for ordering.
+func WithConsumeOrdered() PullConsumeOpt {
+	return pullOptFunc(func(cfg *consumeOpts) error {
+		cfg.Ordered = true
+		return nil
+	})
+}
+
 // WithMessagesErrOnMissingHeartbeat sets whether a missing heartbeat error
 // should be reported when calling [MessagesContext.Next] (Default: true).
 func WithMessagesErrOnMissingHeartbeat(hbErr bool) PullMessagesOpt {
@@ -259,6 +430,35 @@ func WithMessagesErrOnMissingHeartbeat(hbErr bool) PullMessagesOpt {
 	})
 }
 
+// WithNakDelay sets the delay after which a message negatively acknowledged
+// using [Msg.NakOrTerm] is redelivered.
+func WithNakDelay(delay time.Duration) NakOpt {
+	return func(opts *nakOpts) error {
+		if delay <= 0 {
+			return fmt.Errorf("%w: nak delay must be greater than 0", ErrInvalidOption)
+		}
+		opts.delay = delay
+		return nil
+	}
+}
+
+// WithNakDeadLetter sets the subject a message is published to by
+// [Msg.NakOrTerm] before it is terminated. The published message has the
+// original headers, as well as [DeadLetterReasonHeader] and
+// [DeadLetterSubjectHeader]. The subject has to be bound to a stream, as the
+// message is only terminated once its PubAck is received. If publishing
+// fails, the error is returned and the message is left unacknowledged, as the
+// server does not redeliver it. It is lost unless routing it is retried.
+func WithNakDeadLetter(subject string) NakOpt {
+	return func(opts *nakOpts) error {
+		if subject == "" {
+			return fmt.Errorf("%w: dead letter subject cannot be empty", ErrInvalidOption)
+		}
+		opts.deadLetter = subject
+		return nil
+	}
+}
+
 // FetchMaxWait sets custom timeout for fetching predefined batch of messages.
 //
 // If not provided, a default of 30 seconds will be used.
@@ -311,6 +511,21 @@ func WithSubjectFilter(subject string) StreamInfoOpt {
 	}
 }
 
+// WithSubjectsPagination can be used together with [WithSubjectFilter]
+// to fetch a single page of subjects, starting at the given offset,
+// instead of retrieving all matching subjects using multiple requests.
+// Use [Stream.ListSubjects] to iterate over all pages.
+func WithSubjectsPagination(offset int) StreamInfoOpt {
+	return func(req *streamInfoRequest) error {
+		if offset < 0 {
+			return fmt.Errorf("%w: offset cannot be negative", ErrInvalidOption)
+		}
+		req.Offset = offset
+		req.paged = true
+		return nil
+	}
+}
+
 // WithStreamListSubject can be used to filter results of ListStreams and
 // StreamNames requests to only streams that have given subject in their
 // configuration.
@@ -82,6 +82,138 @@ func TestMessageMetadata(t *testing.T) {
 	}
 }
 
+func TestAckBatcher(t *testing.T) {
+	newMsg := func(seq uint64) *jetStreamMsg {
+		return &jetStreamMsg{msg: &nats.Msg{
+			Reply: fmt.Sprintf("$JS.ACK.stream.cons.1.%d.%d.123456789.0", seq, seq),
+			Sub:   &nats.Subscription{},
+		}}
+	}
+	setup := func(size int, maxDelay time.Duration, seqs ...uint64) (*ackBatcher, chan uint64, map[uint64]*jetStreamMsg) {
+		sent := make(chan uint64, 10)
+		b := newAckBatcher(size, maxDelay, func(m *jetStreamMsg) error {
+			sent <- m.streamSeq
+			return nil
+		})
+		msgs := make(map[uint64]*jetStreamMsg)
+		for _, seq := range seqs {
+			msgs[seq] = newMsg(seq)
+			b.track(msgs[seq])
+		}
+		return b, sent, msgs
+	}
+	expectSent := func(t *testing.T, sent chan uint64, expected ...uint64) {
+		t.Helper()
+		for _, seq := range expected {
+			select {
+			case s := <-sent:
+				if s != seq {
+					t.Fatalf("Expected ack for sequence %d; got: %d", seq, s)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("Expected ack for sequence %d", seq)
+			}
+		}
+		select {
+		case s := <-sent:
+			t.Fatalf("Unexpected ack for sequence %d", s)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	t.Run("ack after batch size", func(t *testing.T) {
+		b, sent, msgs := setup(3, time.Hour, 1, 2, 3, 4)
+		for _, seq := range []uint64{1, 2} {
+			if err := b.ack(msgs[seq]); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+		expectSent(t, sent)
+		if err := b.ack(msgs[3]); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expectSent(t, sent, 3)
+		b.close()
+	})
+
+	t.Run("out of order completion", func(t *testing.T) {
+		b, sent, msgs := setup(2, time.Hour, 1, 2, 3, 4)
+		for _, seq := range []uint64{4, 2} {
+			if err := b.ack(msgs[seq]); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+		// 1 is still being processed, so nothing can be acked
+		expectSent(t, sent)
+		if err := b.ack(msgs[1]); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		// 3 is still being processed
+		expectSent(t, sent, 2)
+		b.remove(msgs[3])
+		b.flush()
+		expectSent(t, sent, 4)
+	})
+
+	t.Run("ack after max delay", func(t *testing.T) {
+		b, sent, msgs := setup(10, 50*time.Millisecond, 1, 2)
+		if err := b.ack(msgs[1]); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expectSent(t, sent, 1)
+		b.close()
+		expectSent(t, sent)
+	})
+
+	t.Run("flush on close", func(t *testing.T) {
+		b, sent, msgs := setup(10, time.Hour, 1, 2)
+		if err := b.ack(msgs[1]); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		b.close()
+		expectSent(t, sent, 1)
+		// acks after close are sent individually
+		if err := b.ack(msgs[2]); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expectSent(t, sent, 2)
+	})
+}
+
+func TestAckPending(t *testing.T) {
+	newMsg := func(seq uint64) *jetStreamMsg {
+		return &jetStreamMsg{msg: &nats.Msg{
+			Reply: fmt.Sprintf("$JS.ACK.stream.cons.1.%d.%d.123456789.0", seq, seq),
+			Sub:   &nats.Subscription{},
+		}}
+	}
+
+	t.Run("ack none policy", func(t *testing.T) {
+		p := newAckPending(&ConsumerConfig{AckPolicy: AckNonePolicy})
+		for seq := uint64(1); seq <= 10; seq++ {
+			p.track(newMsg(seq))
+		}
+		if n := p.len(); n != 0 {
+			t.Fatalf("Expected no pending messages; got: %d", n)
+		}
+		if len(p.pending) != 0 {
+			t.Fatalf("Expected no tracked messages; got: %d", len(p.pending))
+		}
+	})
+
+	t.Run("expired messages dropped on track", func(t *testing.T) {
+		p := newAckPending(&ConsumerConfig{AckPolicy: AckExplicitPolicy, AckWait: 10 * time.Millisecond})
+		for seq := uint64(1); seq < minAckPendingPrune; seq++ {
+			p.track(newMsg(seq))
+		}
+		time.Sleep(20 * time.Millisecond)
+		p.track(newMsg(minAckPendingPrune))
+		if len(p.pending) != 1 {
+			t.Fatalf("Expected expired messages to be dropped; got %d tracked messages", len(p.pending))
+		}
+	})
+}
+
 func TestValidateSubject(t *testing.T) {
 	tests := []struct {
 		subject   string
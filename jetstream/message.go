@@ -85,6 +85,22 @@ type (
 		// For older servers, TermWithReason will be ignored by the server and the message
 		// will not be terminated.
 		TermWithReason(reason string) error
+
+		// NakOrTerm negatively acknowledges a message if it was delivered
+		// less than maxDeliver times, so that it is redelivered. Otherwise,
+		// the message is routed to the dead letter subject set using
+		// [WithNakDeadLetter] (if any) and terminated. This is meant for
+		// handlers retrying the processing of a message a limited number
+		// of times, using [MsgMetadata.NumDelivered].
+		NakOrTerm(maxDeliver int, opts ...NakOpt) error
+	}
+
+	// NakOpt is used to configure [Msg.NakOrTerm].
+	NakOpt func(*nakOpts) error
+
+	nakOpts struct {
+		delay      time.Duration
+		deadLetter string
 	}
 
 	// MsgMetadata is the JetStream metadata associated with received messages.
@@ -126,9 +142,15 @@ type (
 	}
 
 	jetStreamMsg struct {
-		msg  *nats.Msg
-		ackd bool
-		js   *jetStream
+		msg        *nats.Msg
+		ackd       bool
+		js         *jetStream
+		deadLetter string
+		maxDeliver int
+		progress   chan struct{}
+		ackBatch   *ackBatcher
+		onAck      func(*jetStreamMsg, []byte)
+		streamSeq  uint64
 		sync.Mutex
 	}
 
@@ -217,6 +239,18 @@ const (
 	LastSequenceHeader = "Nats-Last-Sequence"
 )
 
+// Headers set on messages routed to a dead letter subject using
+// [WithConsumeDeadLetter].
+const (
+	// DeadLetterReasonHeader contains the reason the message was routed to the
+	// dead letter subject.
+	DeadLetterReasonHeader = "Nats-Dead-Letter-Reason"
+
+	// DeadLetterSubjectHeader contains the subject on which the message was
+	// originally received.
+	DeadLetterSubjectHeader = "Nats-Dead-Letter-Subject"
+)
+
 // Rollups, can be subject only or all messages.
 const (
 	// MsgRollupSubject is used to purge all messages before this message on the
@@ -327,6 +361,44 @@ func (m *jetStreamMsg) TermWithReason(reason string) error {
 	return m.ackReply(context.Background(), ackTerm, false, ackOpts{termReason: reason})
 }
 
+// NakOrTerm negatively acknowledges a message if it was delivered less
+// than maxDeliver times. Otherwise, it is routed to the dead letter
+// subject (if set) and terminated.
+func (m *jetStreamMsg) NakOrTerm(maxDeliver int, opts ...NakOpt) error {
+	if maxDeliver < 1 {
+		return fmt.Errorf("%w: max deliver has to be greater than 0", ErrInvalidOption)
+	}
+	var o nakOpts
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return err
+		}
+	}
+	meta, err := m.Metadata()
+	if err != nil {
+		return err
+	}
+	if meta.NumDelivered < uint64(maxDeliver) {
+		return m.ackReply(context.Background(), ackNak, false, ackOpts{nakDelay: o.delay})
+	}
+
+	m.Lock()
+	ackd := m.ackd
+	m.Unlock()
+	if ackd {
+		return ErrMsgAlreadyAckd
+	}
+	if o.deadLetter != "" {
+		// The server does not redeliver the message after its last
+		// delivery, so it is left unacknowledged if it is not persisted
+		// elsewhere, for the caller to retry or terminate it.
+		if err := m.publishDeadLetter(context.Background(), o.deadLetter); err != nil {
+			return err
+		}
+	}
+	return m.ackReply(context.Background(), ackTerm, false, ackOpts{termReason: deadLetterReason})
+}
+
 func (m *jetStreamMsg) ackReply(ctx context.Context, ackType ackType, sync bool, opts ackOpts) error {
 	err := m.checkReply()
 	if err != nil {
@@ -340,6 +412,27 @@ func (m *jetStreamMsg) ackReply(ctx context.Context, ackType ackType, sync bool,
 	}
 	m.Unlock()
 
+	// Route the message to the dead letter subject before terminating it,
+	// so that a message is never terminated without being persisted
+	// elsewhere first. If that fails, the message is left unacknowledged,
+	// as nacking it would not lead to a redelivery.
+	if bytes.Equal(ackType, ackNak) && m.onLastDelivery() {
+		if err := m.publishDeadLetter(ctx, m.deadLetter); err != nil {
+			return err
+		}
+		ackType = ackTerm
+		opts = ackOpts{termReason: deadLetterReason}
+	}
+
+	// Acks of messages consumed with WithConsumeAckBatch are coalesced.
+	if m.ackBatch != nil && !sync && bytes.Equal(ackType, ackAck) {
+		if err := m.ackBatch.ack(m); err != nil {
+			return err
+		}
+		m.markAcked(ackType)
+		return nil
+	}
+
 	if sync {
 		var cancel context.CancelFunc
 		ctx, cancel = wrapContextWithoutDeadline(ctx)
@@ -369,9 +462,92 @@ func (m *jetStreamMsg) ackReply(ctx context.Context, ackType ackType, sync bool,
 	// Mark that the message has been acked unless it is ackProgress
 	// which can be sent many times.
 	if !bytes.Equal(ackType, ackProgress) {
-		m.Lock()
-		m.ackd = true
-		m.Unlock()
+		m.markAcked(ackType)
+	} else if m.onAck != nil {
+		m.onAck(m, ackType)
+	}
+	// A terminated (or explicitly acked) message no longer blocks batched
+	// acks, while a nacked one does until it is redelivered and acked.
+	if m.ackBatch != nil && (bytes.Equal(ackType, ackTerm) || bytes.Equal(ackType, ackAck)) {
+		m.ackBatch.remove(m)
+	}
+	return nil
+}
+
+// extendAckWait periodically sends in progress acks for the message
+// until it is acknowledged or the returned function is called.
+func (m *jetStreamMsg) extendAckWait(interval time.Duration) func() {
+	done := make(chan struct{})
+	m.Lock()
+	m.progress = done
+	m.Unlock()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := m.InProgress(); err != nil {
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return m.stopAckWaitExtension
+}
+
+// markAcked marks the message as acknowledged, stopping the ack wait
+// extension and notifying the consume context the message was delivered by.
+func (m *jetStreamMsg) markAcked(ackType []byte) {
+	m.Lock()
+	wasAckd := m.ackd
+	m.ackd = true
+	m.Unlock()
+	m.stopAckWaitExtension()
+	if !wasAckd && m.onAck != nil {
+		m.onAck(m, ackType)
+	}
+}
+
+func (m *jetStreamMsg) stopAckWaitExtension() {
+	m.Lock()
+	defer m.Unlock()
+	if m.progress != nil {
+		close(m.progress)
+		m.progress = nil
+	}
+}
+
+const deadLetterReason = "max deliveries reached"
+
+// onLastDelivery returns true if dead letter routing is configured for the
+// message and the server will not redeliver it again.
+func (m *jetStreamMsg) onLastDelivery() bool {
+	if m.deadLetter == "" || m.maxDeliver <= 0 {
+		return false
+	}
+	meta, err := m.Metadata()
+	if err != nil {
+		return false
+	}
+	return meta.NumDelivered >= uint64(m.maxDeliver)
+}
+
+// publishDeadLetter publishes a copy of the message, including its original
+// headers, to the given dead letter subject and waits for it to be stored
+// on a stream.
+func (m *jetStreamMsg) publishDeadLetter(ctx context.Context, subject string) error {
+	dlq := nats.NewMsg(subject)
+	dlq.Data = m.msg.Data
+	for k, v := range m.msg.Header {
+		dlq.Header[k] = append([]string(nil), v...)
+	}
+	dlq.Header.Set(DeadLetterReasonHeader, deadLetterReason)
+	dlq.Header.Set(DeadLetterSubjectHeader, m.msg.Subject)
+	if _, err := m.js.PublishMsg(ctx, dlq); err != nil {
+		return fmt.Errorf("nats: publishing to dead letter subject %q: %w", subject, err)
 	}
 	return nil
 }
@@ -53,6 +53,9 @@ type (
 		opts     []PullMessagesOpt
 		done     chan struct{}
 		closed   atomic.Uint32
+		// paused is set while paused, so that consume contexts
+		// created on reset are paused as well
+		paused atomic.Bool
 	}
 
 	cursor struct {
@@ -171,11 +174,21 @@ func (c *orderedConsumer) Consume(handler MessageHandler, opts ...PullConsumeOpt
 				if c.withStopAfter {
 					opts = append(opts, consumeStopAfterNotify(c.stopAfter, c.stopAfterMsgsLeft))
 				}
-				if cc, err := c.currentConsumer.Consume(internalHandler(c.serial), opts...); err != nil {
+				consumeOpts := opts
+				if sub.paused.Load() {
+					consumeOpts = append(opts[:len(opts):len(opts)], consumePaused())
+				}
+				if cc, err := c.currentConsumer.Consume(internalHandler(c.serial), consumeOpts...); err != nil {
 					c.errHandler(c.serial)(cc, err)
 				} else {
 					c.Lock()
 					c.currentSub = cc.(*pullSubscription)
+					// paused or resumed while the consume context was created
+					if sub.paused.Load() {
+						c.currentSub.Pause()
+					} else {
+						c.currentSub.Resume()
+					}
 					c.Unlock()
 				}
 			case <-sub.done:
@@ -346,6 +359,9 @@ func (s *orderedSubscription) Drain() {
 	if !s.closed.CompareAndSwap(0, 1) {
 		return
 	}
+	// draining the current consume context passes the held
+	// messages to the handler
+	s.paused.Store(false)
 	if s.consumer.currentSub != nil {
 		s.consumer.currentConsumer.Lock()
 		s.consumer.currentSub.Drain()
@@ -385,6 +401,46 @@ func (s *orderedSubscription) Closed() <-chan struct{} {
 	return closedCh
 }
 
+// NumAckPending always returns 0 for ordered consumers, as messages
+// are not acknowledged.
+func (s *orderedSubscription) NumAckPending() int {
+	return 0
+}
+
+// Pause stops passing messages to the handler and pulling new messages.
+// Messages received while paused are held and passed to the handler once
+// Resume is called.
+func (s *orderedSubscription) Pause() {
+	s.consumer.Lock()
+	defer s.consumer.Unlock()
+	s.paused.Store(true)
+	if s.consumer.currentSub != nil {
+		s.consumer.currentSub.Pause()
+	}
+}
+
+// Resume resumes passing messages to the handler and pulling new messages
+// after Pause was called.
+func (s *orderedSubscription) Resume() {
+	s.consumer.Lock()
+	defer s.consumer.Unlock()
+	s.paused.Store(false)
+	if s.consumer.currentSub != nil {
+		s.consumer.currentSub.Resume()
+	}
+}
+
+// Paused returns true if the consume context is paused.
+func (s *orderedSubscription) Paused() bool {
+	return s.paused.Load()
+}
+
+// Promote is not supported for ordered consumers and always returns
+// [ErrOrderedConsumerNotPromotable].
+func (s *orderedSubscription) Promote(context.Context) (ConsumeContext, error) {
+	return nil, ErrOrderedConsumerNotPromotable
+}
+
 // Fetch is used to retrieve up to a provided number of messages from a
 // stream. This method will always send a single request and wait until
 // either all messages are retrieved or request times out.
@@ -665,6 +721,14 @@ func messagesStopAfterNotify(numMsgs int, msgsLeftAfterStop chan int) PullMessag
 	})
 }
 
+// consumePaused creates the consume context paused.
+func consumePaused() PullConsumeOpt {
+	return pullOptFunc(func(opts *consumeOpts) error {
+		opts.paused = true
+		return nil
+	})
+}
+
 func consumeReconnectNotify() PullConsumeOpt {
 	return pullOptFunc(func(opts *consumeOpts) error {
 		opts.notifyOnReconnect = true
@@ -35,6 +35,8 @@ type (
 		aecb MsgErrHandler
 		// Max async pub ack in flight
 		maxpa int
+		// How long acked message IDs are remembered to suppress re-sends.
+		dedupWindow time.Duration
 	}
 
 	// PublishOpt are the options that can be passed to Publish methods.
@@ -104,6 +106,15 @@ type (
 		rr          *rand.Rand
 		// channel to signal when server is disconnected or conn is closed
 		connStatusCh chan (nats.Status)
+		// acked message IDs keyed by subject and ID, in the order
+		// they were first acknowledged
+		ackedIDs   map[string]*ackedMsgID
+		ackedOrder []string
+	}
+
+	ackedMsgID struct {
+		ack *PubAck
+		at  time.Time
 	}
 
 	pubAckResponse struct {
@@ -279,6 +290,11 @@ func (js *jetStream) PublishMsgAsync(m *nats.Msg, opts ...PublishOpt) (PubAckFut
 	if paf == nil && m.Reply != "" {
 		return nil, ErrAsyncPublishReplySubjectSet
 	}
+	if paf == nil {
+		if paf := js.ackedPAF(m); paf != nil {
+			return paf, nil
+		}
+	}
 
 	var id string
 	var reply string
@@ -466,6 +482,7 @@ func (js *jetStream) handleAsyncReply(m *nats.Msg) {
 
 	// So here we have received a proper puback.
 	paf.ack = pa.PubAck
+	js.recordAckedID(paf.msg, paf.ack)
 	if paf.doneCh != nil {
 		paf.doneCh <- paf.ack
 	}
@@ -501,6 +518,81 @@ func (js *jetStream) resetPendingAcksOnReconnect() {
 	}
 }
 
+// ackedIDKey returns the key under which an acknowledged message is
+// remembered, or an empty string if the message has no ID. The same ID
+// may be used on different subjects, possibly bound to different streams.
+func ackedIDKey(m *nats.Msg) string {
+	if m.Header == nil {
+		return ""
+	}
+	msgID := m.Header.Get(MsgIDHeader)
+	if msgID == "" {
+		return ""
+	}
+	return m.Subject + " " + msgID
+}
+
+// recordAckedID remembers the message ID of an acknowledged message for the
+// configured dedup window. As with the server, the window starts when the
+// ID is first acknowledged. Lock should be held.
+func (js *jetStream) recordAckedID(m *nats.Msg, ack *PubAck) {
+	if js.publisher.asyncPublisherOpts.dedupWindow <= 0 {
+		return
+	}
+	key := ackedIDKey(m)
+	if key == "" {
+		return
+	}
+	now := time.Now()
+	js.expireAckedIDs(now)
+	if js.publisher.ackedIDs == nil {
+		js.publisher.ackedIDs = make(map[string]*ackedMsgID)
+	}
+	if _, ok := js.publisher.ackedIDs[key]; ok {
+		return
+	}
+	js.publisher.ackedOrder = append(js.publisher.ackedOrder, key)
+	js.publisher.ackedIDs[key] = &ackedMsgID{ack: ack, at: now}
+}
+
+// expireAckedIDs drops acked message IDs older than the dedup window.
+// Lock should be held.
+func (js *jetStream) expireAckedIDs(now time.Time) {
+	window := js.publisher.asyncPublisherOpts.dedupWindow
+	var i int
+	for ; i < len(js.publisher.ackedOrder); i++ {
+		key := js.publisher.ackedOrder[i]
+		if acked := js.publisher.ackedIDs[key]; acked != nil && now.Sub(acked.at) < window {
+			break
+		}
+		delete(js.publisher.ackedIDs, key)
+	}
+	js.publisher.ackedOrder = js.publisher.ackedOrder[i:]
+}
+
+// ackedPAF returns a completed PubAckFuture if a message with the same
+// subject and ID was already acknowledged within the dedup window, or nil
+// otherwise.
+func (js *jetStream) ackedPAF(m *nats.Msg) *pubAckFuture {
+	if js.publisher.asyncPublisherOpts.dedupWindow <= 0 {
+		return nil
+	}
+	key := ackedIDKey(m)
+	if key == "" {
+		return nil
+	}
+	js.publisher.Lock()
+	defer js.publisher.Unlock()
+	js.expireAckedIDs(time.Now())
+	acked, ok := js.publisher.ackedIDs[key]
+	if !ok {
+		return nil
+	}
+	ack := *acked.ack
+	ack.Duplicate = true
+	return &pubAckFuture{msg: m, jsClient: js.publisher, ack: &ack}
+}
+
 // registerPAF will register for a PubAckFuture.
 func (js *jetStream) registerPAF(id string, paf *pubAckFuture) (int, int) {
 	js.publisher.Lock()
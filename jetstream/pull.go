@@ -14,10 +14,13 @@
 package jetstream
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"math"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -58,12 +61,99 @@ type (
 
 		// Drain unsubscribes from the stream and cancels subscription.
 		// All messages that are already in the buffer will be processed in callback function.
+		// Drain is called when the underlying connection is drained, so that
+		// no more messages are pulled and acknowledgements are sent before
+		// the connection is closed.
 		Drain()
 
 		// Closed returns a channel that is closed when the consuming is
 		// fully stopped/drained. When the channel is closed, no more messages
 		// will be received and processing is complete.
 		Closed() <-chan struct{}
+
+		// NumAckPending returns the number of messages delivered to the
+		// handler which have not yet been acknowledged. It is always 0
+		// for consumers with AckNonePolicy.
+		NumAckPending() int
+
+		// Promote replaces the ephemeral consumer used by this consume
+		// context with a durable consumer named using
+		// [WithConsumeDurableName] and continues consuming from it.
+		//
+		// The consume context is drained first, so that buffered messages
+		// are processed. If a durable with the given name does not exist
+		// yet, it is created with the configuration of the ephemeral
+		// consumer, starting at the first message which has not been
+		// acknowledged (the ack floor of the ephemeral consumer). If it
+		// already exists, the consumer is bound to it and its own position
+		// is used. The ephemeral consumer is deleted afterwards.
+		//
+		// Messages acknowledged out of order before promotion, as well as
+		// messages acknowledged after the consume context was drained, will
+		// be redelivered by the durable consumer.
+		//
+		// Promote returns a new consume context which replaces this one.
+		// If the consumer is already durable, the current consume context
+		// is returned.
+		Promote(ctx context.Context) (ConsumeContext, error)
+
+		// Pause stops passing messages to the handler and pulling new
+		// messages, without unsubscribing or removing the consumer.
+		// Messages received while paused are held and passed to the handler,
+		// in order, once Resume is called. Messages held for longer than the
+		// consumer's AckWait may be redelivered by the server.
+		// Stop and Drain can be called while paused; Drain passes the held
+		// messages to the handler.
+		Pause()
+
+		// Resume resumes passing messages to the handler and pulling new
+		// messages after Pause was called.
+		Resume()
+
+		// Paused returns true if the consume context is paused.
+		Paused() bool
+	}
+
+	// ConsumeContextInfo describes the state of a consume context, as
+	// returned by [JetStream.ActiveConsumeContexts].
+	ConsumeContextInfo struct {
+		// ID uniquely identifies the consume context.
+		ID string
+
+		// Stream is the name of the stream the messages are consumed from.
+		Stream string
+
+		// Consumer is the name of the consumer. For ordered consumers, it is
+		// the name of the consumer currently in use.
+		Consumer string
+
+		// Iterator is true if the consume context was created using
+		// [Consumer.Messages], and false for [Consumer.Consume].
+		Iterator bool
+
+		// BufferedMsgs and BufferedBytes are the number and size of the
+		// messages received from the server which have not yet been passed
+		// to the handler or returned from Next. BufferedBytes is not
+		// tracked for [Consumer.Messages].
+		BufferedMsgs  int
+		BufferedBytes int
+
+		// AckPending is the number of messages passed to the handler which
+		// have not yet been acknowledged.
+		AckPending int
+
+		// Running is false once the consume context was stopped or is
+		// being drained.
+		Running bool
+
+		// Paused is true if the consume context is paused.
+		Paused bool
+
+		// Draining is true if the consume context is being drained.
+		Draining bool
+
+		// LastError is the last error reported while consuming, if any.
+		LastError error
 	}
 
 	// MessageHandler is a handler function used as callback in [Consume].
@@ -95,6 +185,8 @@ type (
 		MaxBytes  int           `json:"max_bytes,omitempty"`
 		NoWait    bool          `json:"no_wait,omitempty"`
 		Heartbeat time.Duration `json:"idle_heartbeat,omitempty"`
+		Group     string        `json:"group,omitempty"`
+		Priority  int           `json:"priority,omitempty"`
 	}
 
 	consumeOpts struct {
@@ -107,8 +199,18 @@ type (
 		ThresholdMessages       int
 		ThresholdBytes          int
 		StopAfter               int
+		DeadLetterSubject       string
+		AckWaitExtension        time.Duration
+		AckBatchSize            int
+		AckBatchMaxDelay        time.Duration
+		PriorityGroup           string
+		Priority                int
+		MaxAckPending           int
+		DurableName             string
+		Ordered                 bool
 		stopAfterMsgsLeft       chan int
 		notifyOnReconnect       bool
+		paused                  bool
 	}
 
 	ConsumeErrHandlerFunc func(consumeCtx ConsumeContext, err error)
@@ -118,6 +220,8 @@ type (
 		id                string
 		consumer          *pullConsumer
 		subscription      *nats.Subscription
+		handler           MessageHandler
+		opts              []PullConsumeOpt
 		msgs              chan *nats.Msg
 		errs              chan error
 		pending           pendingMsgs
@@ -131,6 +235,40 @@ type (
 		consumeOpts       *consumeOpts
 		delivered         int
 		closedCh          chan struct{}
+		maxDeliver        int
+		ackBatch          *ackBatcher
+		ackPending        *ackPending
+		lastErr           atomic.Pointer[error]
+		pause             pauseGate
+		// deliver passes a message to the handler, handlerMu serializes
+		// the subscription callback and passing held messages
+		deliver   func(*nats.Msg)
+		handlerMu sync.Mutex
+		// stream sequence of the last message passed to the handler
+		// with WithConsumeOrdered, only accessed by the message handler
+		lastStreamSeq uint64
+		// set if the heartbeat check expired while paused
+		hbExpiredPaused atomic.Bool
+		// For Consume, pull requests use a reply subject specific to the
+		// connection epoch, incremented on reconnect, so that messages
+		// buffered before the reconnect can be told apart and discarded.
+		replyPrefix string
+		epoch       int
+		reply       atomic.Pointer[string]
+	}
+
+	// pauseGate holds messages received while a consume context is paused,
+	// so that the subscription callback does not block. Held messages are
+	// passed to the handler in order once resumed.
+	pauseGate struct {
+		sync.Mutex
+		holding bool
+		// messages received while paused, or while held messages
+		// are passed to the handler
+		held []*nats.Msg
+		// closed once held messages are passed to the handler,
+		// nil if they are not being passed
+		replayed chan struct{}
 	}
 
 	pendingMsgs struct {
@@ -197,15 +335,50 @@ func (p *pullConsumer) Consume(handler MessageHandler, opts ...PullConsumeOpt) (
 		done:        make(chan struct{}, 1),
 		fetchNext:   make(chan *pullRequest, 1),
 		consumeOpts: consumeOpts,
+		handler:     handler,
+		opts:        opts,
+	}
+	if p.info != nil {
+		sub.maxDeliver = p.info.Config.MaxDeliver
+		sub.ackPending = newAckPending(&p.info.Config)
+	} else {
+		sub.ackPending = newAckPending(nil)
+	}
+	if consumeOpts.DurableName != "" && p.durable && consumeOpts.DurableName != p.name {
+		p.Unlock()
+		return nil, fmt.Errorf("%w: consumer is already durable with a different name", ErrInvalidOption)
+	}
+	if consumeOpts.AckBatchSize > 0 {
+		if p.info != nil && p.info.Config.AckPolicy != AckAllPolicy {
+			p.Unlock()
+			return nil, fmt.Errorf("%w: ack batching requires AckAllPolicy", ErrInvalidOption)
+		}
+		sub.ackBatch = newAckBatcher(consumeOpts.AckBatchSize, consumeOpts.AckBatchMaxDelay, func(m *jetStreamMsg) error {
+			return p.jetStream.conn.Publish(m.msg.Reply, ackAck)
+		})
+	}
+	if consumeOpts.MaxAckPending > 0 && p.info != nil && p.info.Config.AckPolicy == AckNonePolicy {
+		p.Unlock()
+		return nil, fmt.Errorf("%w: max ack pending cannot be used with AckNonePolicy", ErrInvalidOption)
 	}
-	sub.connStatusChanged = p.jetStream.conn.StatusChanged(nats.CONNECTED, nats.RECONNECTING)
+	if consumeOpts.paused {
+		sub.pause.pause()
+	}
+	sub.connStatusChanged = p.jetStream.conn.StatusChanged(nats.CONNECTED, nats.RECONNECTING, nats.DRAINING_SUBS)
 
 	sub.hbMonitor = sub.scheduleHeartbeatCheck(consumeOpts.Heartbeat)
 
 	p.subs.Store(sub.id, sub)
+	p.jetStream.consumeContexts.Store(sub.id, sub)
 	p.Unlock()
 
 	internalHandler := func(msg *nats.Msg) {
+		// Messages for pull requests sent before a reconnect are
+		// discarded and nacked, so that the server redelivers them.
+		if sub.stale(msg) {
+			sub.nakStale(msg)
+			return
+		}
 		if sub.hbMonitor != nil {
 			sub.hbMonitor.Stop()
 		}
@@ -238,6 +411,7 @@ func (p *pullConsumer) Consume(handler MessageHandler, opts ...PullConsumeOpt) (
 				if sub.closed.Load() == 1 {
 					return
 				}
+				sub.setLastError(err)
 				if sub.consumeOpts.ErrHandler != nil {
 					sub.consumeOpts.ErrHandler(sub, err)
 				}
@@ -245,7 +419,43 @@ func (p *pullConsumer) Consume(handler MessageHandler, opts ...PullConsumeOpt) (
 			}
 			return
 		}
-		handler(p.jetStream.toJSMsg(msg))
+		// hold the message while paused, rather than blocking
+		// the subscription callback
+		sub.handlerMu.Lock()
+		defer sub.handlerMu.Unlock()
+		if sub.pause.hold(msg) {
+			return
+		}
+		sub.deliver(msg)
+	}
+	sub.deliver = func(msg *nats.Msg) {
+		// discard messages received before the connection
+		// was re-established while they were held
+		if sub.stale(msg) {
+			sub.nakStale(msg)
+			return
+		}
+		jsMsg := sub.toJSMsg(msg)
+		if sub.consumeOpts.Ordered && !sub.inSequence(jsMsg) {
+			return
+		}
+		if sub.ackBatch != nil {
+			sub.ackBatch.track(jsMsg)
+		}
+		sub.ackPending.track(jsMsg)
+		jsMsg.onAck = sub.msgAcked
+		if sub.consumeOpts.AckWaitExtension > 0 {
+			stop := jsMsg.extendAckWait(sub.consumeOpts.AckWaitExtension)
+			handler(jsMsg)
+			stop()
+		} else {
+			handler(jsMsg)
+		}
+		// Acks have to be sent before the subscription is drained,
+		// as the connection may not accept publishing afterwards.
+		if sub.ackBatch != nil && (sub.draining.Load() == 1 || sub.subscription.IsDraining()) {
+			sub.ackBatch.flush()
+		}
 		sub.Lock()
 		sub.decrementPendingMsgs(msg)
 		sub.incrementDeliveredMsgs()
@@ -255,14 +465,21 @@ func (p *pullConsumer) Consume(handler MessageHandler, opts ...PullConsumeOpt) (
 			sub.Stop()
 		}
 	}
-	inbox := p.jetStream.conn.NewInbox()
-	sub.subscription, err = p.jetStream.conn.Subscribe(inbox, internalHandler)
+	sub.replyPrefix = p.jetStream.conn.NewInbox() + "."
+	sub.nextEpoch()
+	sub.subscription, err = p.jetStream.conn.Subscribe(sub.replyPrefix+"*", internalHandler)
 	if err != nil {
+		p.subs.Delete(sub.id)
+		p.jetStream.consumeContexts.Delete(sub.id)
 		return nil, err
 	}
 	sub.subscription.SetClosedHandler(func(sid string) func(string) {
 		return func(subject string) {
 			p.subs.Delete(sid)
+			p.jetStream.consumeContexts.Delete(sid)
+			if sub.ackBatch != nil {
+				sub.ackBatch.close()
+			}
 			sub.draining.CompareAndSwap(1, 0)
 			sub.Lock()
 			if sub.closedCh != nil {
@@ -285,6 +502,8 @@ func (p *pullConsumer) Consume(handler MessageHandler, opts ...PullConsumeOpt) (
 		Batch:     batchSize,
 		MaxBytes:  consumeOpts.MaxBytes,
 		Heartbeat: consumeOpts.Heartbeat,
+		Group:     consumeOpts.PriorityGroup,
+		Priority:  consumeOpts.Priority,
 	}, subject); err != nil {
 		sub.errs <- err
 	}
@@ -301,6 +520,12 @@ func (p *pullConsumer) Consume(handler MessageHandler, opts ...PullConsumeOpt) (
 				if !ok {
 					continue
 				}
+				// Stop pulling and process buffered messages
+				// if the connection is being drained.
+				if status == nats.DRAINING_SUBS {
+					sub.Drain()
+					continue
+				}
 				if status == nats.RECONNECTING {
 					if sub.hbMonitor != nil {
 						sub.hbMonitor.Stop()
@@ -311,15 +536,20 @@ func (p *pullConsumer) Consume(handler MessageHandler, opts ...PullConsumeOpt) (
 					sub.Lock()
 					if !isConnected {
 						isConnected = true
+						sub.nextEpoch()
 						if sub.consumeOpts.notifyOnReconnect {
 							sub.errs <- errConnected
 						}
 
-						sub.fetchNext <- &pullRequest{
-							Expires:   sub.consumeOpts.Expires,
-							Batch:     sub.consumeOpts.MaxMessages,
-							MaxBytes:  sub.consumeOpts.MaxBytes,
-							Heartbeat: sub.consumeOpts.Heartbeat,
+						if batchSize := sub.ackWindow(sub.consumeOpts.MaxMessages, 0); batchSize > 0 {
+							sub.fetchNext <- &pullRequest{
+								Expires:   sub.consumeOpts.Expires,
+								Batch:     batchSize,
+								MaxBytes:  sub.consumeOpts.MaxBytes,
+								Heartbeat: sub.consumeOpts.Heartbeat,
+								Group:     sub.consumeOpts.PriorityGroup,
+								Priority:  sub.consumeOpts.Priority,
+							}
 						}
 						if sub.hbMonitor != nil {
 							sub.hbMonitor.Reset(2 * sub.consumeOpts.Heartbeat)
@@ -330,6 +560,7 @@ func (p *pullConsumer) Consume(handler MessageHandler, opts ...PullConsumeOpt) (
 				}
 			case err := <-sub.errs:
 				sub.Lock()
+				sub.setLastError(err)
 				if sub.consumeOpts.ErrHandler != nil {
 					sub.consumeOpts.ErrHandler(sub, err)
 				}
@@ -338,11 +569,15 @@ func (p *pullConsumer) Consume(handler MessageHandler, opts ...PullConsumeOpt) (
 					if sub.consumeOpts.StopAfter > 0 {
 						batchSize = min(batchSize, sub.consumeOpts.StopAfter-sub.delivered)
 					}
-					sub.fetchNext <- &pullRequest{
-						Expires:   sub.consumeOpts.Expires,
-						Batch:     batchSize,
-						MaxBytes:  sub.consumeOpts.MaxBytes,
-						Heartbeat: sub.consumeOpts.Heartbeat,
+					if batchSize = sub.ackWindow(batchSize, 0); batchSize > 0 {
+						sub.fetchNext <- &pullRequest{
+							Expires:   sub.consumeOpts.Expires,
+							Batch:     batchSize,
+							MaxBytes:  sub.consumeOpts.MaxBytes,
+							Heartbeat: sub.consumeOpts.Heartbeat,
+							Group:     sub.consumeOpts.PriorityGroup,
+							Priority:  sub.consumeOpts.Priority,
+						}
 					}
 					if sub.hbMonitor != nil {
 						sub.hbMonitor.Reset(2 * sub.consumeOpts.Heartbeat)
@@ -361,14 +596,283 @@ func (p *pullConsumer) Consume(handler MessageHandler, opts ...PullConsumeOpt) (
 	return sub, nil
 }
 
+// toJSMsg converts core [nats.Msg] to [jetStreamMsg], applying
+// subscription-specific ack handling (e.g. dead letter routing).
+func (s *pullSubscription) toJSMsg(msg *nats.Msg) *jetStreamMsg {
+	jsMsg := s.consumer.jetStream.toJSMsg(msg)
+	if s.consumeOpts.DeadLetterSubject != "" && s.maxDeliver > 0 {
+		jsMsg.deadLetter = s.consumeOpts.DeadLetterSubject
+		jsMsg.maxDeliver = s.maxDeliver
+	}
+	return jsMsg
+}
+
+// inSequence reports whether msg can be passed to the handler without
+// breaking the stream sequence order guaranteed by WithConsumeOrdered.
+// A message with a sequence not higher than the last handled one, e.g. a
+// redelivery of a message nacked after later messages were delivered,
+// stops the consume context with ErrConsumeOutOfOrder, leaving the message
+// and all messages buffered after it unacknowledged.
+func (s *pullSubscription) inSequence(msg *jetStreamMsg) bool {
+	if s.closed.Load() == 1 {
+		return false
+	}
+	meta, err := msg.Metadata()
+	if err != nil {
+		// not a JetStream message, nothing to order by
+		return true
+	}
+	if meta.Sequence.Stream > s.lastStreamSeq {
+		s.lastStreamSeq = meta.Sequence.Stream
+		return true
+	}
+	err = fmt.Errorf("%w: received stream sequence %d after %d", ErrConsumeOutOfOrder, meta.Sequence.Stream, s.lastStreamSeq)
+	s.setLastError(err)
+	if s.consumeOpts.ErrHandler != nil {
+		s.consumeOpts.ErrHandler(s, err)
+	}
+	s.Stop()
+	return false
+}
+
+// nextEpoch switches pull requests to a new reply subject, so that
+// messages delivered for previous requests are considered stale.
+// Lock should be held.
+func (s *pullSubscription) nextEpoch() {
+	s.epoch++
+	reply := s.replyPrefix + strconv.Itoa(s.epoch)
+	s.reply.Store(&reply)
+}
+
+// stale reports whether msg was delivered for a pull request sent
+// before the connection was re-established.
+func (s *pullSubscription) stale(msg *nats.Msg) bool {
+	reply := s.reply.Load()
+	return reply != nil && msg.Subject != *reply
+}
+
+// nakStale nacks a stale message so that it is redelivered right away,
+// rather than once AckWait expires.
+func (s *pullSubscription) nakStale(msg *nats.Msg) {
+	if userMsg, _ := checkMsg(msg); userMsg && msg.Reply != "" {
+		s.consumer.jetStream.conn.Publish(msg.Reply, ackNak)
+	}
+}
+
 // resetPendingMsgs resets pending message count and byte count
 // to the values set in consumeOpts
 // lock should be held before calling this method
 func (s *pullSubscription) resetPendingMsgs() {
 	s.pending.msgCount = s.consumeOpts.MaxMessages
+	if s.consumeOpts.MaxAckPending > 0 {
+		s.pending.msgCount = max(0, s.ackWindow(s.consumeOpts.MaxMessages, 0))
+	}
 	s.pending.byteCount = s.consumeOpts.MaxBytes
 }
 
+// ackWindow limits the batch size of a pull request, so that the number of
+// messages pending acknowledgement and already requested does not exceed
+// MaxAckPending. If the window is full, pulling is resumed once the ack
+// wait of the oldest pending message expires.
+// lock should be held before calling this method
+func (s *pullSubscription) ackWindow(batchSize, requested int) int {
+	if s.consumeOpts.MaxAckPending == 0 {
+		return batchSize
+	}
+	window := s.consumeOpts.MaxAckPending - s.ackPending.len() - requested
+	if window <= 0 {
+		s.ackPending.onExpiry(s.resumePulling)
+	}
+	return min(batchSize, window)
+}
+
+// msgAcked is called when a message delivered to the handler is
+// acknowledged, resuming pulling if it was paused by MaxAckPending.
+func (s *pullSubscription) msgAcked(m *jetStreamMsg, ackType []byte) {
+	s.ackPending.ack(m.streamSeq, ackType)
+	if !bytes.Equal(ackType, ackProgress) {
+		s.resumePulling()
+	}
+}
+
+// resumePulling sends a new pull request if MaxAckPending allows it.
+func (s *pullSubscription) resumePulling() {
+	if s.consumeOpts.MaxAckPending == 0 || s.closed.Load() == 1 {
+		return
+	}
+	s.Lock()
+	s.checkPending()
+	s.Unlock()
+}
+
+// NumAckPending returns the number of messages delivered to the
+// handler which have not yet been acknowledged.
+func (s *pullSubscription) NumAckPending() int {
+	return s.ackPending.len()
+}
+
+// Pause stops passing messages to the handler and pulling new messages.
+func (s *pullSubscription) Pause() {
+	s.pause.pause()
+}
+
+// Resume resumes passing messages to the handler and pulling new messages.
+func (s *pullSubscription) Resume() {
+	if !s.resumeHeld() || s.closed.Load() == 1 {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	if s.hbExpiredPaused.CompareAndSwap(true, false) && s.hbMonitor != nil {
+		s.hbMonitor.Reset(2 * s.consumeOpts.Heartbeat)
+	}
+	s.checkPending()
+}
+
+// Paused returns true if the consume context is paused.
+func (s *pullSubscription) Paused() bool {
+	return s.pause.paused()
+}
+
+// resumeHeld resumes the pause gate, passing the held messages to the
+// handler in a separate goroutine. It returns false if it was not paused.
+func (s *pullSubscription) resumeHeld() bool {
+	resumed, replay := s.pause.resume()
+	if replay {
+		go s.replayHeld()
+	}
+	return resumed
+}
+
+// replayHeld passes the messages held while paused to the handler, until
+// none are left or the consume context is paused again. Held messages are
+// discarded if the consume context is stopped.
+func (s *pullSubscription) replayHeld() {
+	for {
+		s.handlerMu.Lock()
+		discard := s.closed.Load() == 1 && s.draining.Load() == 0
+		msg := s.pause.next(discard)
+		if msg == nil {
+			s.handlerMu.Unlock()
+			return
+		}
+		s.deliver(msg)
+		s.handlerMu.Unlock()
+		if s.closed.Load() == 0 {
+			s.Lock()
+			s.checkPending()
+			s.Unlock()
+		}
+	}
+}
+
+func (g *pauseGate) pause() {
+	g.Lock()
+	defer g.Unlock()
+	g.holding = true
+}
+
+// resume returns false if the gate was not paused, and whether
+// held messages should be passed to the handler.
+func (g *pauseGate) resume() (bool, bool) {
+	g.Lock()
+	defer g.Unlock()
+	if !g.holding {
+		return false, false
+	}
+	g.holding = false
+	if len(g.held) == 0 || g.replayed != nil {
+		return true, false
+	}
+	g.replayed = make(chan struct{})
+	return true, true
+}
+
+func (g *pauseGate) paused() bool {
+	g.Lock()
+	defer g.Unlock()
+	return g.holding
+}
+
+// hold queues the message if the gate is paused or held messages are
+// being passed to the handler, so that the order is preserved.
+// It reports whether the message was queued.
+func (g *pauseGate) hold(msg *nats.Msg) bool {
+	g.Lock()
+	defer g.Unlock()
+	if !g.holding && g.replayed == nil {
+		return false
+	}
+	g.held = append(g.held, msg)
+	return true
+}
+
+// next returns the next held message, or nil once none are left, the gate
+// is paused again or the held messages are discarded.
+func (g *pauseGate) next(discard bool) *nats.Msg {
+	g.Lock()
+	defer g.Unlock()
+	if discard {
+		g.held = nil
+	}
+	if g.holding || len(g.held) == 0 {
+		close(g.replayed)
+		g.replayed = nil
+		return nil
+	}
+	msg := g.held[0]
+	g.held[0] = nil
+	g.held = g.held[1:]
+	return msg
+}
+
+// wait blocks until the held messages are passed to the handler,
+// if they are being passed.
+func (g *pauseGate) wait() {
+	g.Lock()
+	replayed := g.replayed
+	g.Unlock()
+	if replayed != nil {
+		<-replayed
+	}
+}
+
+// setLastError stores the last error reported while consuming,
+// ignoring connection status changes passed on the errs channel.
+func (s *pullSubscription) setLastError(err error) {
+	if errors.Is(err, errConnected) || errors.Is(err, errDisconnected) {
+		return
+	}
+	s.lastErr.Store(&err)
+}
+
+// info returns the current state of the consume context.
+// It does not acquire the lock, which is held by Next while waiting
+// for messages.
+func (s *pullSubscription) info() ConsumeContextInfo {
+	info := ConsumeContextInfo{
+		ID:         s.id,
+		Stream:     s.consumer.stream,
+		Consumer:   s.consumer.name,
+		Iterator:   s.msgs != nil,
+		AckPending: s.ackPending.len(),
+		Running:    s.closed.Load() == 0,
+		Paused:     s.pause.paused(),
+		Draining:   s.draining.Load() == 1,
+	}
+	if s.msgs != nil {
+		info.BufferedMsgs = len(s.msgs)
+	} else if s.subscription != nil {
+		if msgs, bytes, err := s.subscription.Pending(); err == nil {
+			info.BufferedMsgs, info.BufferedBytes = msgs, bytes
+		}
+	}
+	if err := s.lastErr.Load(); err != nil {
+		info.LastError = *err
+	}
+	return info
+}
+
 // decrementPendingMsgs decrements pending message count and byte count
 // lock should be held before calling this method
 func (s *pullSubscription) decrementPendingMsgs(msg *nats.Msg) {
@@ -388,6 +892,9 @@ func (s *pullSubscription) incrementDeliveredMsgs() {
 // the buffer to trigger a new pull request.
 // lock should be held before calling this method
 func (s *pullSubscription) checkPending() {
+	if s.pause.paused() {
+		return
+	}
 	if (s.pending.msgCount < s.consumeOpts.ThresholdMessages ||
 		(s.pending.byteCount < s.consumeOpts.ThresholdBytes && s.consumeOpts.MaxBytes != 0)) &&
 		s.fetchInProgress.Load() == 0 {
@@ -404,15 +911,22 @@ func (s *pullSubscription) checkPending() {
 		if s.consumeOpts.StopAfter > 0 {
 			batchSize = min(batchSize, s.consumeOpts.StopAfter-s.delivered-s.pending.msgCount)
 		}
+		batchSize = s.ackWindow(batchSize, s.pending.msgCount)
 		if batchSize > 0 {
 			s.fetchNext <- &pullRequest{
 				Expires:   s.consumeOpts.Expires,
 				Batch:     batchSize,
 				MaxBytes:  maxBytes,
 				Heartbeat: s.consumeOpts.Heartbeat,
+				Group:     s.consumeOpts.PriorityGroup,
+				Priority:  s.consumeOpts.Priority,
 			}
 
-			s.pending.msgCount = s.consumeOpts.MaxMessages
+			if s.consumeOpts.MaxAckPending > 0 {
+				s.pending.msgCount += batchSize
+			} else {
+				s.pending.msgCount = s.consumeOpts.MaxMessages
+			}
 			s.pending.byteCount = s.consumeOpts.MaxBytes
 		}
 	}
@@ -444,7 +958,12 @@ func (p *pullConsumer) Messages(opts ...PullMessagesOpt) (MessagesContext, error
 		fetchNext:   make(chan *pullRequest, 1),
 		consumeOpts: consumeOpts,
 	}
-	sub.connStatusChanged = p.jetStream.conn.StatusChanged(nats.CONNECTED, nats.RECONNECTING)
+	if p.info != nil {
+		sub.ackPending = newAckPending(&p.info.Config)
+	} else {
+		sub.ackPending = newAckPending(nil)
+	}
+	sub.connStatusChanged = p.jetStream.conn.StatusChanged(nats.CONNECTED, nats.RECONNECTING, nats.DRAINING_SUBS)
 	inbox := p.jetStream.conn.NewInbox()
 	sub.subscription, err = p.jetStream.conn.ChanSubscribe(inbox, sub.msgs)
 	if err != nil {
@@ -459,12 +978,14 @@ func (p *pullConsumer) Messages(opts ...PullMessagesOpt) (MessagesContext, error
 				// otherwise, we need to wait until all messages are drained
 				// in Next
 				p.subs.Delete(sid)
+				p.jetStream.consumeContexts.Delete(sid)
 			}
 			close(msgs)
 		}
 	}(sub.id))
 
 	p.subs.Store(sub.id, sub)
+	p.jetStream.consumeContexts.Store(sub.id, sub)
 	p.Unlock()
 
 	go sub.pullMessages(subject)
@@ -476,6 +997,10 @@ func (p *pullConsumer) Messages(opts ...PullMessagesOpt) (MessagesContext, error
 				if !ok {
 					return
 				}
+				if status == nats.DRAINING_SUBS {
+					sub.Drain()
+					continue
+				}
 				if status == nats.CONNECTED {
 					sub.errs <- errConnected
 				}
@@ -527,6 +1052,7 @@ func (s *pullSubscription) Next() (Msg, error) {
 			if !ok {
 				// if msgs channel is closed, it means that subscription was either drained or stopped
 				s.consumer.subs.Delete(s.id)
+				s.consumer.jetStream.consumeContexts.Delete(s.id)
 				s.draining.CompareAndSwap(1, 0)
 				return nil, ErrMsgIteratorClosed
 			}
@@ -540,6 +1066,7 @@ func (s *pullSubscription) Next() (Msg, error) {
 					continue
 				}
 				if err := s.handleStatusMsg(msg, msgErr); err != nil {
+					s.setLastError(err)
 					s.Stop()
 					return nil, err
 				}
@@ -549,6 +1076,7 @@ func (s *pullSubscription) Next() (Msg, error) {
 			s.incrementDeliveredMsgs()
 			return s.consumer.jetStream.toJSMsg(msg), nil
 		case err := <-s.errs:
+			s.setLastError(err)
 			if errors.Is(err, ErrNoHeartbeat) {
 				s.pending.msgCount = 0
 				s.pending.byteCount = 0
@@ -588,6 +1116,7 @@ func (s *pullSubscription) handleStatusMsg(msg *nats.Msg, msgErr error) error {
 		if errors.Is(msgErr, ErrConsumerDeleted) || errors.Is(msgErr, ErrBadRequest) {
 			return msgErr
 		}
+		s.setLastError(msgErr)
 		if s.consumeOpts.ErrHandler != nil {
 			s.consumeOpts.ErrHandler(s, msgErr)
 		}
@@ -652,6 +1181,8 @@ func (s *pullSubscription) Drain() {
 		return
 	}
 	s.draining.Store(1)
+	// pass the held messages to the handler
+	s.resumeHeld()
 	close(s.done)
 	if s.consumeOpts.stopAfterMsgsLeft != nil {
 		if s.delivered >= s.consumeOpts.StopAfter {
@@ -662,6 +1193,51 @@ func (s *pullSubscription) Drain() {
 	}
 }
 
+// Promote replaces the ephemeral consumer with a durable consumer and
+// continues consuming from it using a new consume context.
+func (s *pullSubscription) Promote(ctx context.Context) (ConsumeContext, error) {
+	p := s.consumer
+	name := s.consumeOpts.DurableName
+	if name == "" {
+		return nil, fmt.Errorf("%w: durable name not set", ErrInvalidOption)
+	}
+	if p.durable {
+		return s, nil
+	}
+
+	s.Drain()
+	select {
+	case <-s.Closed():
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	js := p.jetStream
+	durable, err := getConsumer(ctx, js, p.stream, name)
+	if errors.Is(err, ErrConsumerNotFound) {
+		var info *ConsumerInfo
+		info, err = p.Info(ctx)
+		if err != nil {
+			return nil, err
+		}
+		cfg := info.Config
+		cfg.Name = name
+		cfg.Durable = name
+		cfg.InactiveThreshold = 0
+		cfg.DeliverPolicy = DeliverByStartSequencePolicy
+		cfg.OptStartSeq = info.AckFloor.Stream + 1
+		cfg.OptStartTime = nil
+		durable, err = upsertConsumer(ctx, js, p.stream, cfg, consumerActionCreate)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := deleteConsumer(ctx, js, p.stream, p.name); err != nil && !errors.Is(err, ErrConsumerNotFound) {
+		return nil, err
+	}
+	return durable.Consume(s.handler, s.opts...)
+}
+
 // Closed returns a channel that is closed when consuming is
 // fully stopped/drained. When the channel is closed, no more messages
 // will be received and processing is complete.
@@ -703,7 +1279,7 @@ func (p *pullConsumer) Fetch(batch int, opts ...FetchOpt) (MessageBatch, error)
 		}
 	}
 	if req.Expires < 2*req.Heartbeat {
-		return nil, fmt.Errorf("%w: expiry time should be at least 2 times the heartbeat", ErrInvalidOption)
+		return nil, fmt.Errorf("%w: heartbeat (%v) must be at most half of the expiry (%v)", ErrInvalidOption, req.Heartbeat, req.Expires)
 	}
 
 	return p.fetch(req)
@@ -732,7 +1308,7 @@ func (p *pullConsumer) FetchBytes(maxBytes int, opts ...FetchOpt) (MessageBatch,
 		}
 	}
 	if req.Expires < 2*req.Heartbeat {
-		return nil, fmt.Errorf("%w: expiry time should be at least 2 times the heartbeat", ErrInvalidOption)
+		return nil, fmt.Errorf("%w: heartbeat (%v) must be at most half of the expiry (%v)", ErrInvalidOption, req.Heartbeat, req.Expires)
 	}
 
 	return p.fetch(req)
@@ -895,6 +1471,12 @@ func (s *pullSubscription) scheduleHeartbeatCheck(dur time.Duration) *hbMonitor
 	}
 	return &hbMonitor{
 		timer: time.AfterFunc(2*dur, func() {
+			// no pull requests are sent while paused,
+			// the check is rescheduled on resume
+			if s.pause.paused() {
+				s.hbExpiredPaused.Store(true)
+				return
+			}
 			s.errs <- ErrNoHeartbeat
 		}),
 	}
@@ -912,9 +1494,15 @@ func (s *pullSubscription) cleanup() {
 	if s.hbMonitor != nil {
 		s.hbMonitor.Stop()
 	}
+	s.ackPending.stop()
 	drainMode := s.draining.Load() == 1
 	if drainMode {
-		s.subscription.Drain()
+		// held messages are passed to the handler before draining
+		s.pause.wait()
+		// The subscription may already be drained by the connection.
+		if !s.subscription.IsDraining() {
+			s.subscription.Drain()
+		}
 	} else {
 		s.subscription.Unsubscribe()
 	}
@@ -938,6 +1526,9 @@ func (s *pullSubscription) pull(req *pullRequest, subject string) error {
 	}
 
 	reply := s.subscription.Subject
+	if r := s.reply.Load(); r != nil {
+		reply = *r
+	}
 	if err := s.consumer.jetStream.conn.PublishRequest(subject, reply, reqJSON); err != nil {
 		return err
 	}
@@ -1002,6 +1593,10 @@ func (consumeOpts *consumeOpts) setDefaults(ordered bool) error {
 		}
 	}
 
+	if consumeOpts.MaxAckPending > 0 {
+		// never request more messages than can be pending acknowledgement
+		consumeOpts.MaxMessages = min(consumeOpts.MaxMessages, consumeOpts.MaxAckPending)
+	}
 	if consumeOpts.ThresholdMessages == 0 {
 		consumeOpts.ThresholdMessages = int(math.Ceil(float64(consumeOpts.MaxMessages) / 2))
 	}
@@ -1022,7 +1617,10 @@ func (consumeOpts *consumeOpts) setDefaults(ordered bool) error {
 		}
 	}
 	if consumeOpts.Heartbeat > consumeOpts.Expires/2 {
-		return errors.New("the value of Heartbeat must be less than 50%% of expiry")
+		return fmt.Errorf("heartbeat (%v) must be at most half of the expiry (%v)", consumeOpts.Heartbeat, consumeOpts.Expires)
+	}
+	if ordered && consumeOpts.DurableName != "" {
+		return errors.New("durable name cannot be used with ordered consumer")
 	}
 	return nil
 }
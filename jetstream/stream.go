@@ -18,6 +18,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
 	"strconv"
 	"time"
 
@@ -59,6 +60,12 @@ type (
 		// is overwritten with random data. As a result, this operation is slower
 		// than DeleteMsg.
 		SecureDeleteMsg(ctx context.Context, seq uint64) error
+
+		// ListSubjects returns a SubjectsLister enabling iterating over
+		// the number of messages stored on each subject matching the
+		// given filter. Subjects are fetched using multiple stream info
+		// requests, one page at a time.
+		ListSubjects(ctx context.Context, filter string) SubjectsLister
 	}
 
 	// ConsumerManager provides CRUD API for managing consumers. It is
@@ -131,6 +138,33 @@ type (
 		apiPaged
 		DeletedDetails bool   `json:"deleted_details,omitempty"`
 		SubjectFilter  string `json:"subjects_filter,omitempty"`
+
+		// paged is set if only a single page of subjects should be fetched
+		paged bool
+	}
+
+	// SubjectCount contains the number of messages stored on a subject.
+	SubjectCount struct {
+		Subject string
+		Msgs    uint64
+	}
+
+	// SubjectsLister is used to iterate over a channel of subject counts.
+	// Err method can be used to check for errors encountered during iteration.
+	// Subjects channel is always closed and therefore can be used in a range loop.
+	SubjectsLister interface {
+		Subjects() <-chan SubjectCount
+		Err() error
+	}
+
+	subjectsLister struct {
+		stream   *stream
+		filter   string
+		offset   int
+		pageInfo *apiPaged
+
+		subjects chan SubjectCount
+		err      error
 	}
 
 	consumerInfoResponse struct {
@@ -320,7 +354,7 @@ func (s *stream) Info(ctx context.Context, opts ...StreamInfoOpt) (*StreamInfo,
 	var info *StreamInfo
 	for {
 		if infoReq != nil {
-			if infoReq.SubjectFilter != "" {
+			if infoReq.SubjectFilter != "" && !infoReq.paged {
 				if subjectMap == nil {
 					subjectMap = make(map[string]uint64)
 				}
@@ -342,6 +376,15 @@ func (s *stream) Info(ctx context.Context, opts ...StreamInfoOpt) (*StreamInfo,
 			return nil, resp.Error
 		}
 		info = resp.StreamInfo
+		if infoReq != nil && infoReq.paged {
+			// return a single page of subjects, without caching them
+			subjects := info.State.Subjects
+			info.State.Subjects = nil
+			cached := *info
+			s.info = &cached
+			info.State.Subjects = subjects
+			break
+		}
 		var total int
 		if resp.Total != 0 {
 			total = resp.Total
@@ -365,6 +408,100 @@ func (s *stream) Info(ctx context.Context, opts ...StreamInfoOpt) (*StreamInfo,
 	return info, nil
 }
 
+// ListSubjects returns a SubjectsLister enabling iterating over
+// the number of messages stored on each subject matching the
+// given filter. Subjects are fetched using multiple stream info
+// requests, one page at a time.
+func (s *stream) ListSubjects(ctx context.Context, filter string) SubjectsLister {
+	if filter == "" {
+		filter = ">"
+	}
+	l := &subjectsLister{
+		stream:   s,
+		filter:   filter,
+		subjects: make(chan SubjectCount),
+	}
+	go func() {
+		defer close(l.subjects)
+		ctx, cancel := wrapContextWithoutDeadline(ctx)
+		if cancel != nil {
+			defer cancel()
+		}
+		for {
+			page, err := l.subjectsPage(ctx)
+			if err != nil && !errors.Is(err, ErrEndOfData) {
+				l.err = err
+				return
+			}
+			for _, subject := range page {
+				select {
+				case l.subjects <- subject:
+				case <-ctx.Done():
+					l.err = ctx.Err()
+					return
+				}
+			}
+			if errors.Is(err, ErrEndOfData) {
+				return
+			}
+		}
+	}()
+
+	return l
+}
+
+func (l *subjectsLister) Subjects() <-chan SubjectCount {
+	return l.subjects
+}
+
+func (l *subjectsLister) Err() error {
+	return l.err
+}
+
+// subjectsPage fetches the next page of subject counts
+func (l *subjectsLister) subjectsPage(ctx context.Context) ([]SubjectCount, error) {
+	if l.pageInfo != nil && l.offset >= l.pageInfo.Total {
+		return nil, ErrEndOfData
+	}
+
+	req, err := json.Marshal(&streamInfoRequest{
+		apiPaged:      apiPaged{Offset: l.offset},
+		SubjectFilter: l.filter,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	infoSubject := apiSubj(l.stream.jetStream.apiPrefix, fmt.Sprintf(apiStreamInfoT, l.stream.name))
+	var resp streamInfoResponse
+	if _, err = l.stream.jetStream.apiRequestJSON(ctx, infoSubject, &resp, req); err != nil {
+		return nil, err
+	}
+	if resp.Error != nil {
+		if resp.Error.ErrorCode == JSErrCodeStreamNotFound {
+			return nil, ErrStreamNotFound
+		}
+		return nil, resp.Error
+	}
+
+	subjects := make([]SubjectCount, 0, len(resp.State.Subjects))
+	for subj, msgs := range resp.State.Subjects {
+		subjects = append(subjects, SubjectCount{Subject: subj, Msgs: msgs})
+	}
+	// the server sorts subjects when paging, keep the same order
+	sort.Slice(subjects, func(i, j int) bool {
+		return subjects[i].Subject < subjects[j].Subject
+	})
+
+	l.pageInfo = &resp.apiPaged
+	l.offset += len(subjects)
+	if len(subjects) == 0 {
+		// guard against looping forever if the server returns an empty page
+		return nil, ErrEndOfData
+	}
+	return subjects, nil
+}
+
 // CachedInfo returns ConsumerInfo currently cached on this stream.
 // This method does not perform any network requests. The cached
 // StreamInfo is updated on every call to Info and Update.
@@ -0,0 +1,78 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func BenchmarkConsumeAck(b *testing.B) {
+	for _, bm := range []struct {
+		name   string
+		policy jetstream.AckPolicy
+		opts   []jetstream.PullConsumeOpt
+	}{
+		{"individual acks", jetstream.AckExplicitPolicy, nil},
+		{"batched acks", jetstream.AckAllPolicy, []jetstream.PullConsumeOpt{jetstream.WithConsumeAckBatch(100, 50*time.Millisecond)}},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			srv := RunBasicJetStreamServer()
+			defer shutdownJSServerAndRemoveStorage(b, srv)
+			nc, err := nats.Connect(srv.ClientURL())
+			if err != nil {
+				b.Fatalf("Unexpected error: %v", err)
+			}
+			defer nc.Close()
+			js, err := jetstream.New(nc)
+			if err != nil {
+				b.Fatalf("Unexpected error: %v", err)
+			}
+			ctx := context.Background()
+			s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}})
+			if err != nil {
+				b.Fatalf("Unexpected error: %v", err)
+			}
+			c, err := s.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{AckPolicy: bm.policy})
+			if err != nil {
+				b.Fatalf("Unexpected error: %v", err)
+			}
+			for i := 0; i < b.N; i++ {
+				if _, err := js.PublishAsync("FOO.A", []byte("hello")); err != nil {
+					b.Fatalf("Unexpected error: %v", err)
+				}
+			}
+			<-js.PublishAsyncComplete()
+
+			wg := sync.WaitGroup{}
+			wg.Add(b.N)
+			b.ResetTimer()
+			cc, err := c.Consume(func(msg jetstream.Msg) {
+				msg.Ack()
+				wg.Done()
+			}, bm.opts...)
+			if err != nil {
+				b.Fatalf("Unexpected error: %v", err)
+			}
+			wg.Wait()
+			b.StopTimer()
+			cc.Stop()
+		})
+	}
+}
@@ -135,7 +135,7 @@ func createConfFile(t *testing.T, content []byte) string {
 	return fName
 }
 
-func shutdownJSServerAndRemoveStorage(t *testing.T, s *server.Server) {
+func shutdownJSServerAndRemoveStorage(t testing.TB, s *server.Server) {
 	t.Helper()
 	var sd string
 	if config := s.JetStreamConfig(); config != nil {
@@ -337,3 +337,14 @@ func checkFor(t *testing.T, totalWait, sleepDur time.Duration, f func() error) {
 		t.Fatal(err.Error())
 	}
 }
+
+func serverVersionAtLeast(major, minor, update int) error {
+	var (
+		ma, mi, up int
+	)
+	fmt.Sscanf(server.VERSION, "%d.%d.%d", &ma, &mi, &up)
+	if ma > major || (ma == major && mi > minor) || (ma == major && mi == minor && up >= update) {
+		return nil
+	}
+	return fmt.Errorf("Server version is %v, requires %d.%d.%d+", server.VERSION, major, minor, update)
+}
@@ -164,6 +164,26 @@ func TestNewWithDomain(t *testing.T) {
 	})
 }
 
+func TestNewWithSubjectPrefix(t *testing.T) {
+	srv := RunBasicJetStreamServer()
+	defer shutdownJSServerAndRemoveStorage(t, srv)
+	nc, err := nats.Connect(srv.ClientURL(), nats.SubjectPrefix("tenant"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer nc.Close()
+
+	if _, err := jetstream.New(nc); !errors.Is(err, jetstream.ErrSubjectPrefixNotSupported) {
+		t.Fatalf("Expected error: %v; got: %v", jetstream.ErrSubjectPrefixNotSupported, err)
+	}
+	if _, err := jetstream.NewWithAPIPrefix(nc, "$JS.API"); !errors.Is(err, jetstream.ErrSubjectPrefixNotSupported) {
+		t.Fatalf("Expected error: %v; got: %v", jetstream.ErrSubjectPrefixNotSupported, err)
+	}
+	if _, err := jetstream.NewWithDomain(nc, "ABC"); !errors.Is(err, jetstream.ErrSubjectPrefixNotSupported) {
+		t.Fatalf("Expected error: %v; got: %v", jetstream.ErrSubjectPrefixNotSupported, err)
+	}
+}
+
 func TestWithClientTrace(t *testing.T) {
 	srv := RunBasicJetStreamServer()
 	defer shutdownJSServerAndRemoveStorage(t, srv)
@@ -1650,6 +1670,90 @@ func TestJetStream_DeleteConsumer(t *testing.T) {
 	}
 }
 
+func TestJetStream_ConsumeSubject(t *testing.T) {
+	srv := RunBasicJetStreamServer()
+	defer shutdownJSServerAndRemoveStorage(t, srv)
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer nc.Close()
+
+	js, err := jetstream.New(nc)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ctx := context.Background()
+	s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, err := js.ConsumeSubject(ctx, "foo.1", "FOO.A", func(jetstream.Msg) {}); !errors.Is(err, jetstream.ErrInvalidStreamName) {
+		t.Fatalf("Expected error: %v; got: %v", jetstream.ErrInvalidStreamName, err)
+	}
+	if _, err := js.ConsumeSubject(ctx, "foo", "", func(jetstream.Msg) {}); !errors.Is(err, jetstream.ErrInvalidOption) {
+		t.Fatalf("Expected error: %v; got: %v", jetstream.ErrInvalidOption, err)
+	}
+
+	// Published before the consumer is created, not delivered.
+	if _, err := js.Publish(ctx, "FOO.A", []byte("old")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	msgs := make(chan jetstream.Msg, 10)
+	cc, err := js.ConsumeSubject(ctx, "foo", "FOO.A", func(msg jetstream.Msg) {
+		msgs <- msg
+		msg.Ack()
+	}, jetstream.PullMaxMessages(5))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	consumerCount := func() int {
+		var count int
+		names := s.ConsumerNames(ctx)
+		for range names.Name() {
+			count++
+		}
+		if names.Err() != nil {
+			t.Fatalf("Unexpected error: %v", names.Err())
+		}
+		return count
+	}
+	if n := consumerCount(); n != 1 {
+		t.Fatalf("Expected 1 consumer; got: %d", n)
+	}
+
+	for _, subj := range []string{"FOO.A", "FOO.B", "FOO.A"} {
+		if _, err := js.Publish(ctx, subj, []byte(subj)); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case msg := <-msgs:
+			if msg.Subject() != "FOO.A" || string(msg.Data()) != "FOO.A" {
+				t.Fatalf("Unexpected message: %s: %q", msg.Subject(), msg.Data())
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timeout waiting for messages")
+		}
+	}
+	select {
+	case msg := <-msgs:
+		t.Fatalf("Unexpected message: %s: %q", msg.Subject(), msg.Data())
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	cc.Stop()
+	checkFor(t, 2*time.Second, 50*time.Millisecond, func() error {
+		if n := consumerCount(); n != 0 {
+			return fmt.Errorf("expected ephemeral consumer to be deleted; got %d consumers", n)
+		}
+		return nil
+	})
+}
+
 func TestStreamNameBySubject(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -402,4 +402,112 @@ func TestAckVariants(t *testing.T) {
 			t.Fatalf("Invalid ack body: %q", string(ack.Data))
 		}
 	})
+	t.Run("nak or term, dead letter subject without stream", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv, nc, js, c := setup(ctx, t)
+		defer shutdownJSServerAndRemoveStorage(t, srv)
+		defer nc.Close()
+
+		if _, err := js.Publish(ctx, "FOO.1", []byte("msg")); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		msg, err := c.Next()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		sub, err := nc.SubscribeSync(msg.Reply())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := msg.NakOrTerm(1, jetstream.WithNakDeadLetter("DLQ")); err == nil {
+			t.Fatalf("Expected error publishing to dead letter subject")
+		}
+		// the message is nacked rather than terminated
+		ack, err := sub.NextMsgWithContext(ctx)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if string(ack.Data) != "-NAK" {
+			t.Fatalf("Invalid ack body; want: %q; got: %q", "-NAK", string(ack.Data))
+		}
+	})
+
+	t.Run("nak or term", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv, nc, js, c := setup(ctx, t)
+		defer shutdownJSServerAndRemoveStorage(t, srv)
+		defer nc.Close()
+
+		if _, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "dlq", Subjects: []string{"DLQ"}}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		dlq, err := nc.SubscribeSync("DLQ")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := js.Publish(ctx, "FOO.1", []byte("msg")); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		// simulate a handler failing to process the message each time
+		for i := 1; i <= 3; i++ {
+			msg, err := c.Next()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			meta, err := msg.Metadata()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if meta.NumDelivered != uint64(i) {
+				t.Fatalf("Expected delivery %d; got: %d", i, meta.NumDelivered)
+			}
+			sub, err := nc.SubscribeSync(msg.Reply())
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if err := msg.NakOrTerm(3, jetstream.WithNakDeadLetter("DLQ")); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			ack, err := sub.NextMsgWithContext(ctx)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			expected := "-NAK"
+			if i == 3 {
+				expected = "+TERM max deliveries reached"
+			}
+			if string(ack.Data) != expected {
+				t.Fatalf("Invalid ack body; want: %q; got: %q", expected, string(ack.Data))
+			}
+			sub.Unsubscribe()
+		}
+
+		dead, err := dlq.NextMsgWithContext(ctx)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if string(dead.Data) != "msg" || dead.Header.Get(jetstream.DeadLetterSubjectHeader) != "FOO.1" {
+			t.Fatalf("Invalid dead letter message: %+v", dead)
+		}
+		if _, err := c.Next(jetstream.FetchMaxWait(200 * time.Millisecond)); !errors.Is(err, nats.ErrTimeout) {
+			t.Fatalf("Expected message to be terminated; got: %v", err)
+		}
+
+		if _, err := js.Publish(ctx, "FOO.1", []byte("msg")); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		msg, err := c.Next()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := msg.NakOrTerm(0); !errors.Is(err, jetstream.ErrInvalidOption) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrInvalidOption, err)
+		}
+		if err := msg.NakOrTerm(3, jetstream.WithNakDelay(0)); !errors.Is(err, jetstream.ErrInvalidOption) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrInvalidOption, err)
+		}
+	})
 }
@@ -86,6 +86,72 @@ func TestOrderedConsumerConsume(t *testing.T) {
 		l.Stop()
 	})
 
+	t.Run("pause and resume", func(t *testing.T) {
+		srv := RunBasicJetStreamServer()
+		defer shutdownJSServerAndRemoveStorage(t, srv)
+		nc, err := nats.Connect(srv.ClientURL())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		js, err := jetstream.New(nc)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer nc.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+		s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		c, err := s.OrderedConsumer(ctx, jetstream.OrderedConsumerConfig{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		received := make(chan jetstream.Msg, len(testMsgs))
+		errs := make(chan error, 10)
+		cc, err := c.Consume(func(msg jetstream.Msg) {
+			received <- msg
+		}, jetstream.PullExpiry(time.Second), jetstream.PullHeartbeat(200*time.Millisecond),
+			jetstream.ConsumeErrHandler(func(_ jetstream.ConsumeContext, err error) {
+				errs <- err
+			}))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer cc.Stop()
+
+		cc.Pause()
+		if !cc.Paused() {
+			t.Fatalf("Expected consume context to be paused")
+		}
+		publishTestMsgs(t, js)
+		// no messages are passed and the missing heartbeats
+		// do not reset the consumer while paused
+		select {
+		case msg := <-received:
+			t.Fatalf("Unexpected message received while paused: %s", msg.Data())
+		case err := <-errs:
+			t.Fatalf("Unexpected error while paused: %v", err)
+		case <-time.After(1500 * time.Millisecond):
+		}
+
+		cc.Resume()
+		for i := range testMsgs {
+			select {
+			case msg := <-received:
+				if string(msg.Data()) != testMsgs[i] {
+					t.Fatalf("Invalid message; want: %s; got: %s", testMsgs[i], msg.Data())
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Timeout waiting for messages")
+			}
+		}
+	})
+
 	t.Run("reset consumer before receiving any messages", func(t *testing.T) {
 		srv := RunBasicJetStreamServer()
 		defer shutdownJSServerAndRemoveStorage(t, srv)
@@ -522,6 +522,45 @@ func TestPublishMsg(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "header injection",
+			msgs: []publishConfig{
+				{
+					msg: &nats.Msg{
+						Data:    []byte("msg 1"),
+						Subject: "FOO.1",
+						Header:  nats.Header{"X-Value": []string{"a\r\nPUB FOO.2 1\r\nx"}},
+					},
+					withError: func(t *testing.T, err error) {
+						if !errors.Is(err, nats.ErrInvalidHeader) {
+							t.Fatalf("Expected error: %v; got: %v", nats.ErrInvalidHeader, err)
+						}
+					},
+				},
+				{
+					msg: &nats.Msg{
+						Data:    []byte("msg 2"),
+						Subject: "FOO.1",
+					},
+					opts: []jetstream.PublishOpt{jetstream.WithMsgID("a\r\nb")},
+					withError: func(t *testing.T, err error) {
+						if !errors.Is(err, nats.ErrInvalidHeader) {
+							t.Fatalf("Expected error: %v; got: %v", nats.ErrInvalidHeader, err)
+						}
+					},
+				},
+				{
+					msg: &nats.Msg{
+						Data:    []byte("msg 3"),
+						Subject: "FOO.1",
+					},
+					expectedAck: jetstream.PubAck{
+						Stream:   "foo",
+						Sequence: 1,
+					},
+				},
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -1399,6 +1438,116 @@ func TestPublishAsyncResetPendingOnReconnect(t *testing.T) {
 	}
 }
 
+func TestPublishAsyncDedupWindow(t *testing.T) {
+	s := RunBasicJetStreamServer()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer nc.Close()
+
+	js, err := jetstream.New(nc, jetstream.WithPublishAsyncDedupWindow(time.Minute))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, id := range []string{"1", "2"} {
+		if _, err := js.PublishAsync("FOO.A", []byte("hello"), jetstream.WithMsgID(id)); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	select {
+	case <-js.PublishAsyncComplete():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Did not receive completion signal")
+	}
+
+	s = restartBasicJSServer(t, s)
+	defer shutdownJSServerAndRemoveStorage(t, s)
+
+	// Retrying already acked messages after the reconnect does not send them.
+	outMsgs := nc.Stats().OutMsgs
+	for _, id := range []string{"1", "2"} {
+		paf, err := js.PublishAsync("FOO.A", []byte("hello"), jetstream.WithMsgID(id))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		select {
+		case ack := <-paf.Ok():
+			if !ack.Duplicate {
+				t.Fatalf("Expected ack to be marked as duplicate")
+			}
+			if ack.Stream != "foo" {
+				t.Fatalf("Invalid stream name on ack: %q", ack.Stream)
+			}
+		case err := <-paf.Err():
+			t.Fatalf("Unexpected error: %v", err)
+		case <-time.After(time.Second):
+			t.Fatalf("Did not receive ack")
+		}
+	}
+	if sent := nc.Stats().OutMsgs - outMsgs; sent != 0 {
+		t.Fatalf("Expected no messages to be sent; got: %d", sent)
+	}
+
+	// A new message ID is still published.
+	paf, err := js.PublishAsync("FOO.A", []byte("hello"), jetstream.WithMsgID("3"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	select {
+	case ack := <-paf.Ok():
+		if ack.Duplicate {
+			t.Fatalf("Expected ack not to be marked as duplicate")
+		}
+	case err := <-paf.Err():
+		t.Fatalf("Unexpected error: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Did not receive ack")
+	}
+
+	// The same message ID on a subject bound to another stream is published.
+	if _, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "bar", Subjects: []string{"BAR.*"}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	paf, err = js.PublishAsync("BAR.A", []byte("hello"), jetstream.WithMsgID("1"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	select {
+	case ack := <-paf.Ok():
+		if ack.Duplicate {
+			t.Fatalf("Expected ack not to be marked as duplicate")
+		}
+		if ack.Stream != "bar" {
+			t.Fatalf("Invalid stream name on ack: %q", ack.Stream)
+		}
+	case err := <-paf.Err():
+		t.Fatalf("Unexpected error: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Did not receive ack")
+	}
+
+	info, err := stream.Info(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if info.State.Msgs != 3 {
+		t.Fatalf("Expected 3 messages in the stream; got: %d", info.State.Msgs)
+	}
+
+	if _, err := jetstream.New(nc, jetstream.WithPublishAsyncDedupWindow(-1)); !errors.Is(err, jetstream.ErrInvalidOption) {
+		t.Fatalf("Expected error: %v; got: %v", jetstream.ErrInvalidOption, err)
+	}
+}
+
 func TestPublishAsyncRetry(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -17,7 +17,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"reflect"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -1651,6 +1654,40 @@ func TestPullConsumerMessages(t *testing.T) {
 		}
 	})
 
+	t.Run("with heartbeat too large for expiry", func(t *testing.T) {
+		srv := RunBasicJetStreamServer()
+		defer shutdownJSServerAndRemoveStorage(t, srv)
+		nc, err := nats.Connect(srv.ClientURL())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		js, err := jetstream.New(nc)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer nc.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		c, err := s.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{AckPolicy: jetstream.AckExplicitPolicy})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		_, err = c.Messages(jetstream.PullExpiry(5*time.Second), jetstream.PullHeartbeat(4*time.Second))
+		if !errors.Is(err, jetstream.ErrInvalidOption) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrInvalidOption, err)
+		}
+		if !strings.Contains(err.Error(), "heartbeat (4s) must be at most half of the expiry (5s)") {
+			t.Fatalf("Unexpected error message: %v", err)
+		}
+	})
+
 	t.Run("with server restart", func(t *testing.T) {
 		srv := RunBasicJetStreamServer()
 		nc, err := nats.Connect(srv.ClientURL())
@@ -1899,6 +1936,67 @@ func TestPullConsumerMessages(t *testing.T) {
 			t.Fatalf("Unexpected received message count after drain; want %d; got %d", len(testMsgs), len(msgs))
 		}
 	})
+
+	t.Run("stop and drain with active consume contexts", func(t *testing.T) {
+		srv := RunBasicJetStreamServer()
+		defer shutdownJSServerAndRemoveStorage(t, srv)
+		nc, err := nats.Connect(srv.ClientURL())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		js, err := jetstream.New(nc)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer nc.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		c, err := s.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{AckPolicy: jetstream.AckExplicitPolicy})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		stopped, err := c.Messages()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		drained, err := c.Messages()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		infos := js.ActiveConsumeContexts()
+		if len(infos) != 2 {
+			t.Fatalf("Expected 2 active consume contexts; got %d", len(infos))
+		}
+		for _, info := range infos {
+			if !info.Iterator {
+				t.Fatalf("Expected iterator consume context: %+v", info)
+			}
+			if info.AckPending != 0 {
+				t.Fatalf("Invalid number of ack pending messages; want: 0; got: %d", info.AckPending)
+			}
+		}
+
+		stopped.Stop()
+		drained.Drain()
+		if _, err := drained.Next(); !errors.Is(err, jetstream.ErrMsgIteratorClosed) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrMsgIteratorClosed, err)
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for len(js.ActiveConsumeContexts()) != 0 {
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected no active consume contexts; got %d", len(js.ActiveConsumeContexts()))
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
 }
 
 func TestPullConsumerConsume(t *testing.T) {
@@ -2488,6 +2586,40 @@ func TestPullConsumerConsume(t *testing.T) {
 		}
 	})
 
+	t.Run("with heartbeat too large for expiry", func(t *testing.T) {
+		srv := RunBasicJetStreamServer()
+		defer shutdownJSServerAndRemoveStorage(t, srv)
+		nc, err := nats.Connect(srv.ClientURL())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		js, err := jetstream.New(nc)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer nc.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		c, err := s.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{AckPolicy: jetstream.AckExplicitPolicy})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		_, err = c.Consume(func(_ jetstream.Msg) {}, jetstream.PullExpiry(5*time.Second), jetstream.PullHeartbeat(4*time.Second))
+		if !errors.Is(err, jetstream.ErrInvalidOption) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrInvalidOption, err)
+		}
+		if !strings.Contains(err.Error(), "heartbeat (4s) must be at most half of the expiry (5s)") {
+			t.Fatalf("Unexpected error message: %v", err)
+		}
+	})
+
 	t.Run("with idle heartbeat", func(t *testing.T) {
 		srv := RunBasicJetStreamServer()
 		defer shutdownJSServerAndRemoveStorage(t, srv)
@@ -2582,6 +2714,110 @@ func TestPullConsumerConsume(t *testing.T) {
 		wg.Wait()
 	})
 
+	t.Run("with reconnect and unacked buffered messages", func(t *testing.T) {
+		srv := RunBasicJetStreamServer()
+		reconnected := make(chan struct{}, 1)
+		nc, err := nats.Connect(srv.ClientURL(), nats.ReconnectHandler(func(_ *nats.Conn) {
+			reconnected <- struct{}{}
+		}))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		js, err := jetstream.New(nc)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer nc.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		c, err := s.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{
+			Durable:   "cons",
+			AckPolicy: jetstream.AckExplicitPolicy,
+			// discarded messages are nacked, so they are redelivered
+			// well before AckWait expires
+			AckWait: 30 * time.Second,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		publishTestMsgs(t, js)
+
+		type delivery struct {
+			seq          uint64
+			numDelivered uint64
+		}
+		var mu sync.Mutex
+		handled := make(map[delivery]int)
+		acked := make(map[uint64]bool)
+		release := make(chan struct{})
+		first := true
+		cc, err := c.Consume(func(msg jetstream.Msg) {
+			mu.Lock()
+			block := first
+			first = false
+			mu.Unlock()
+			// Block the handler on the first message, so that the
+			// remaining ones are buffered when the connection is lost.
+			if block {
+				<-release
+			}
+			meta, err := msg.Metadata()
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+				return
+			}
+			mu.Lock()
+			handled[delivery{meta.Sequence.Stream, meta.NumDelivered}]++
+			if meta.Sequence.Stream > 1 && meta.NumDelivered == 1 {
+				t.Errorf("Message %d buffered before the reconnect should not be handled", meta.Sequence.Stream)
+			}
+			mu.Unlock()
+			if err := msg.DoubleAck(context.Background()); err == nil {
+				mu.Lock()
+				acked[meta.Sequence.Stream] = true
+				mu.Unlock()
+			}
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer cc.Stop()
+		time.Sleep(100 * time.Millisecond)
+
+		srv = restartBasicJSServer(t, srv)
+		defer shutdownJSServerAndRemoveStorage(t, srv)
+		select {
+		case <-reconnected:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timeout waiting for reconnect")
+		}
+		close(release)
+
+		checkFor(t, 5*time.Second, 100*time.Millisecond, func() error {
+			mu.Lock()
+			defer mu.Unlock()
+			for seq := uint64(2); seq <= uint64(len(testMsgs)); seq++ {
+				if !acked[seq] {
+					return fmt.Errorf("message %d not acked", seq)
+				}
+			}
+			return nil
+		})
+		mu.Lock()
+		defer mu.Unlock()
+		for d, n := range handled {
+			if n != 1 {
+				t.Fatalf("Message %d handled %d times for delivery %d", d.seq, n, d.numDelivered)
+			}
+		}
+	})
+
 	t.Run("no messages received after stop", func(t *testing.T) {
 		srv := RunBasicJetStreamServer()
 		defer shutdownJSServerAndRemoveStorage(t, srv)
@@ -2817,6 +3053,1481 @@ func TestPullConsumerConsume(t *testing.T) {
 			t.Fatalf("Timeout waiting for consume to be closed")
 		}
 	})
+
+	t.Run("with dead letter subject", func(t *testing.T) {
+		srv := RunBasicJetStreamServer()
+		defer shutdownJSServerAndRemoveStorage(t, srv)
+		nc, err := nats.Connect(srv.ClientURL())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		js, err := jetstream.New(nc)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer nc.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		c, err := s.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{
+			AckPolicy:  jetstream.AckExplicitPolicy,
+			MaxDeliver: 3,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "dlq", Subjects: []string{"DLQ"}}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		dlq, err := nc.SubscribeSync("DLQ")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := js.PublishMsg(ctx, &nats.Msg{
+			Subject: testSubject,
+			Data:    []byte("poison"),
+			Header:  nats.Header{"X-Custom": []string{"value"}},
+		}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		deliveries := make(chan uint64, 10)
+		cc, err := c.Consume(func(msg jetstream.Msg) {
+			meta, err := msg.Metadata()
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+				return
+			}
+			deliveries <- meta.NumDelivered
+			if err := msg.Nak(); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		}, jetstream.WithConsumeDeadLetter("DLQ"))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer cc.Stop()
+
+		dlqMsg, err := dlq.NextMsg(5 * time.Second)
+		if err != nil {
+			t.Fatalf("Expected message on dead letter subject: %v", err)
+		}
+		if string(dlqMsg.Data) != "poison" {
+			t.Fatalf("Invalid message data; want: %q; got: %q", "poison", string(dlqMsg.Data))
+		}
+		if dlqMsg.Header.Get("X-Custom") != "value" {
+			t.Fatalf("Expected original headers to be preserved; got: %v", dlqMsg.Header)
+		}
+		if dlqMsg.Header.Get(jetstream.DeadLetterSubjectHeader) != testSubject {
+			t.Fatalf("Invalid original subject header; want: %q; got: %q", testSubject, dlqMsg.Header.Get(jetstream.DeadLetterSubjectHeader))
+		}
+		if dlqMsg.Header.Get(jetstream.DeadLetterReasonHeader) == "" {
+			t.Fatalf("Expected dead letter reason header to be set")
+		}
+
+		// make sure the message is not redelivered after being terminated
+		time.Sleep(500 * time.Millisecond)
+		if len(deliveries) != 3 {
+			t.Fatalf("Unexpected number of deliveries; want: 3; got: %d", len(deliveries))
+		}
+		info, err := c.Info(ctx)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if info.NumAckPending != 0 {
+			t.Fatalf("Expected no pending acks; got: %d", info.NumAckPending)
+		}
+		if _, err := dlq.NextMsg(100 * time.Millisecond); err == nil {
+			t.Fatalf("Expected only a single message on dead letter subject")
+		}
+	})
+
+	t.Run("dead letter publish failure", func(t *testing.T) {
+		srv := RunBasicJetStreamServer()
+		defer shutdownJSServerAndRemoveStorage(t, srv)
+		nc, err := nats.Connect(srv.ClientURL())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		js, err := jetstream.New(nc)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer nc.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		c, err := s.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{
+			AckPolicy:  jetstream.AckExplicitPolicy,
+			MaxDeliver: 1,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := js.Publish(ctx, testSubject, []byte("poison")); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		// the dead letter subject is not bound to a stream yet
+		msgs := make(chan jetstream.Msg, 1)
+		errs := make(chan error, 1)
+		cc, err := c.Consume(func(msg jetstream.Msg) {
+			errs <- msg.Nak()
+			msgs <- msg
+		}, jetstream.WithConsumeDeadLetter("DLQ"))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer cc.Stop()
+
+		var msg jetstream.Msg
+		select {
+		case err := <-errs:
+			if err == nil {
+				t.Fatalf("Expected error routing message to dead letter subject")
+			}
+			msg = <-msgs
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timeout waiting for message")
+		}
+
+		// the message is left unacknowledged, so routing it can be retried
+		if _, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "dlq", Subjects: []string{"DLQ"}}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		dlq, err := nc.SubscribeSync("DLQ")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := msg.Nak(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		dlqMsg, err := dlq.NextMsg(5 * time.Second)
+		if err != nil {
+			t.Fatalf("Expected message on dead letter subject: %v", err)
+		}
+		if string(dlqMsg.Data) != "poison" {
+			t.Fatalf("Invalid message data; want: %q; got: %q", "poison", string(dlqMsg.Data))
+		}
+	})
+
+	t.Run("with invalid dead letter subject", func(t *testing.T) {
+		srv := RunBasicJetStreamServer()
+		defer shutdownJSServerAndRemoveStorage(t, srv)
+		nc, err := nats.Connect(srv.ClientURL())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		js, err := jetstream.New(nc)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer nc.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		c, err := s.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{AckPolicy: jetstream.AckExplicitPolicy})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		_, err = c.Consume(func(msg jetstream.Msg) {}, jetstream.WithConsumeDeadLetter(""))
+		if !errors.Is(err, jetstream.ErrInvalidOption) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrInvalidOption, err)
+		}
+	})
+
+	t.Run("with ack wait extension", func(t *testing.T) {
+		srv := RunBasicJetStreamServer()
+		defer shutdownJSServerAndRemoveStorage(t, srv)
+		nc, err := nats.Connect(srv.ClientURL())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		js, err := jetstream.New(nc)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer nc.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		c, err := s.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{
+			AckPolicy: jetstream.AckExplicitPolicy,
+			AckWait:   time.Second,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := js.Publish(ctx, testSubject, []byte("slow")); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		deliveries := make(chan uint64, 10)
+		cc, err := c.Consume(func(msg jetstream.Msg) {
+			meta, err := msg.Metadata()
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+				return
+			}
+			deliveries <- meta.NumDelivered
+			// process the message for longer than AckWait
+			time.Sleep(2500 * time.Millisecond)
+			if err := msg.Ack(); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		}, jetstream.WithConsumeAckWaitExtension(300*time.Millisecond))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer cc.Stop()
+
+		time.Sleep(4 * time.Second)
+		if len(deliveries) != 1 {
+			t.Fatalf("Unexpected number of deliveries; want: 1; got: %d", len(deliveries))
+		}
+		if numDelivered := <-deliveries; numDelivered != 1 {
+			t.Fatalf("Expected message not to be redelivered; got delivery count: %d", numDelivered)
+		}
+		info, err := c.Info(ctx)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if info.NumAckPending != 0 {
+			t.Fatalf("Expected no pending acks; got: %d", info.NumAckPending)
+		}
+	})
+
+	t.Run("with invalid ack wait extension", func(t *testing.T) {
+		srv := RunBasicJetStreamServer()
+		defer shutdownJSServerAndRemoveStorage(t, srv)
+		nc, err := nats.Connect(srv.ClientURL())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		js, err := jetstream.New(nc)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer nc.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		c, err := s.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{AckPolicy: jetstream.AckExplicitPolicy})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		_, err = c.Consume(func(msg jetstream.Msg) {}, jetstream.WithConsumeAckWaitExtension(0))
+		if !errors.Is(err, jetstream.ErrInvalidOption) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrInvalidOption, err)
+		}
+	})
+
+	t.Run("with ack batch", func(t *testing.T) {
+		srv := RunBasicJetStreamServer()
+		defer shutdownJSServerAndRemoveStorage(t, srv)
+		nc, err := nats.Connect(srv.ClientURL())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		js, err := jetstream.New(nc)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer nc.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		c, err := s.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{AckPolicy: jetstream.AckAllPolicy})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		for i := 0; i < 25; i++ {
+			if _, err := js.Publish(ctx, testSubject, []byte(fmt.Sprintf("msg %d", i))); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+
+		// count acks sent to the server
+		var acks atomic.Int32
+		ackSub, err := nc.Subscribe("$JS.ACK.foo.>", func(_ *nats.Msg) {
+			acks.Add(1)
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer ackSub.Unsubscribe()
+
+		wg := sync.WaitGroup{}
+		wg.Add(25)
+		cc, err := c.Consume(func(msg jetstream.Msg) {
+			if err := msg.Ack(); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			wg.Done()
+		}, jetstream.WithConsumeAckBatch(10, 100*time.Millisecond))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer cc.Stop()
+		wg.Wait()
+
+		// the remaining 5 messages are acked after max delay
+		time.Sleep(300 * time.Millisecond)
+		info, err := c.Info(ctx)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if info.NumAckPending != 0 {
+			t.Fatalf("Expected no pending acks; got: %d", info.NumAckPending)
+		}
+		if info.AckFloor.Stream != 25 {
+			t.Fatalf("Invalid ack floor; want: 25; got: %d", info.AckFloor.Stream)
+		}
+		if n := acks.Load(); n != 3 {
+			t.Fatalf("Unexpected number of acks sent; want: 3; got: %d", n)
+		}
+	})
+
+	t.Run("with ack batch, out of order completion", func(t *testing.T) {
+		srv := RunBasicJetStreamServer()
+		defer shutdownJSServerAndRemoveStorage(t, srv)
+		nc, err := nats.Connect(srv.ClientURL())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		js, err := jetstream.New(nc)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer nc.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		c, err := s.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{AckPolicy: jetstream.AckAllPolicy})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		for i := 0; i < 5; i++ {
+			if _, err := js.Publish(ctx, testSubject, []byte(fmt.Sprintf("msg %d", i))); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+
+		// hold the first message and ack all others
+		msgs := make(chan jetstream.Msg, 5)
+		cc, err := c.Consume(func(msg jetstream.Msg) {
+			meta, err := msg.Metadata()
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+				return
+			}
+			if meta.Sequence.Stream != 1 {
+				if err := msg.Ack(); err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+			}
+			msgs <- msg
+		}, jetstream.WithConsumeAckBatch(2, 50*time.Millisecond))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer cc.Stop()
+		var first jetstream.Msg
+		for i := 0; i < 5; i++ {
+			select {
+			case msg := <-msgs:
+				if first == nil {
+					first = msg
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Timeout waiting for messages")
+			}
+		}
+		time.Sleep(200 * time.Millisecond)
+		info, err := c.Info(ctx)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if info.AckFloor.Stream != 0 {
+			t.Fatalf("Expected ack floor not to advance past unacked message; got: %d", info.AckFloor.Stream)
+		}
+
+		if err := first.Ack(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		time.Sleep(200 * time.Millisecond)
+		info, err = c.Info(ctx)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if info.AckFloor.Stream != 5 {
+			t.Fatalf("Invalid ack floor; want: 5; got: %d", info.AckFloor.Stream)
+		}
+	})
+
+	t.Run("with ack batch, invalid ack policy", func(t *testing.T) {
+		srv := RunBasicJetStreamServer()
+		defer shutdownJSServerAndRemoveStorage(t, srv)
+		nc, err := nats.Connect(srv.ClientURL())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		js, err := jetstream.New(nc)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer nc.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		c, err := s.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{AckPolicy: jetstream.AckExplicitPolicy})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		_, err = c.Consume(func(msg jetstream.Msg) {}, jetstream.WithConsumeAckBatch(10, time.Second))
+		if !errors.Is(err, jetstream.ErrInvalidOption) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrInvalidOption, err)
+		}
+		_, err = c.Consume(func(msg jetstream.Msg) {}, jetstream.WithConsumeAckBatch(0, time.Second))
+		if !errors.Is(err, jetstream.ErrInvalidOption) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrInvalidOption, err)
+		}
+	})
+
+	t.Run("with connection drain", func(t *testing.T) {
+		srv := RunBasicJetStreamServer()
+		defer shutdownJSServerAndRemoveStorage(t, srv)
+		nc, err := nats.Connect(srv.ClientURL())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		js, err := jetstream.New(nc)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer nc.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		c, err := s.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{Durable: "cons", AckPolicy: jetstream.AckAllPolicy})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		for i := 0; i < 100; i++ {
+			if _, err := js.Publish(ctx, testSubject, []byte(fmt.Sprintf("msg %d", i))); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+
+		var handled atomic.Int32
+		started := make(chan struct{})
+		cc, err := c.Consume(func(msg jetstream.Msg) {
+			if handled.Add(1) == 1 {
+				close(started)
+			}
+			time.Sleep(5 * time.Millisecond)
+			msg.Ack()
+		}, jetstream.PullMaxMessages(20), jetstream.WithConsumeAckBatch(50, time.Minute))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		<-started
+		closed := make(chan struct{})
+		nc.SetClosedHandler(func(_ *nats.Conn) {
+			close(closed)
+		})
+		if err := nc.Drain(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		select {
+		case <-closed:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timeout waiting for connection to be closed")
+		}
+		select {
+		case <-cc.Closed():
+		case <-time.After(time.Second):
+			t.Fatalf("Expected consume context to be closed")
+		}
+
+		// all messages processed by the handler are acked and no more
+		// messages are pending acknowledgement
+		nc2, err := nats.Connect(srv.ClientURL())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer nc2.Close()
+		js2, err := jetstream.New(nc2)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		c2, err := js2.Consumer(ctx, "foo", "cons")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		info, err := c2.Info(ctx)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		n := handled.Load()
+		if n == 100 {
+			t.Fatalf("Expected consume to stop before processing all messages")
+		}
+		if info.AckFloor.Stream != uint64(n) {
+			t.Fatalf("Invalid ack floor; want: %d; got: %d", n, info.AckFloor.Stream)
+		}
+		if info.NumAckPending != 0 {
+			t.Fatalf("Expected no pending acks; got: %d", info.NumAckPending)
+		}
+	})
+
+	t.Run("with priority", func(t *testing.T) {
+		// Prioritized priority groups require nats-server 2.12.
+		if err := serverVersionAtLeast(2, 12, 0); err != nil {
+			t.Skip(err.Error())
+		}
+		srv := RunBasicJetStreamServer()
+		defer shutdownJSServerAndRemoveStorage(t, srv)
+		nc, err := nats.Connect(srv.ClientURL())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		js, err := jetstream.New(nc)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer nc.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		c, err := s.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{
+			AckPolicy:      jetstream.AckExplicitPolicy,
+			PriorityPolicy: jetstream.PriorityPrioritized,
+			PriorityGroups: []string{"A"},
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		var high, low atomic.Int32
+		wg := sync.WaitGroup{}
+		wg.Add(10)
+		backfill, err := c.Consume(func(msg jetstream.Msg) {
+			low.Add(1)
+			msg.Ack()
+			wg.Done()
+		}, jetstream.WithConsumePriority("A", 5))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer backfill.Stop()
+		critical, err := c.Consume(func(msg jetstream.Msg) {
+			high.Add(1)
+			msg.Ack()
+			wg.Done()
+		}, jetstream.WithConsumePriority("A", 0))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer critical.Stop()
+
+		// make sure both pull requests are waiting before publishing
+		checkFor(t, 2*time.Second, 10*time.Millisecond, func() error {
+			info, err := c.Info(ctx)
+			if err != nil {
+				return err
+			}
+			if info.NumWaiting != 2 {
+				return fmt.Errorf("Expected 2 waiting pull requests; got: %d", info.NumWaiting)
+			}
+			return nil
+		})
+		for i := 0; i < 10; i++ {
+			if _, err := js.Publish(ctx, testSubject, []byte(fmt.Sprintf("msg %d", i))); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+		wg.Wait()
+		if high.Load() != 10 || low.Load() != 0 {
+			t.Fatalf("Expected all messages on the highest priority; got high: %d, low: %d", high.Load(), low.Load())
+		}
+	})
+
+	t.Run("with priority, invalid options", func(t *testing.T) {
+		srv := RunBasicJetStreamServer()
+		defer shutdownJSServerAndRemoveStorage(t, srv)
+		nc, err := nats.Connect(srv.ClientURL())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		js, err := jetstream.New(nc)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer nc.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		c, err := s.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{AckPolicy: jetstream.AckExplicitPolicy})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		_, err = c.Consume(func(msg jetstream.Msg) {}, jetstream.WithConsumePriority("", 0))
+		if !errors.Is(err, jetstream.ErrInvalidOption) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrInvalidOption, err)
+		}
+		_, err = c.Consume(func(msg jetstream.Msg) {}, jetstream.WithConsumePriority("A", 10))
+		if !errors.Is(err, jetstream.ErrInvalidOption) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrInvalidOption, err)
+		}
+	})
+
+	t.Run("with max ack pending", func(t *testing.T) {
+		srv := RunBasicJetStreamServer()
+		defer shutdownJSServerAndRemoveStorage(t, srv)
+		nc, err := nats.Connect(srv.ClientURL())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		js, err := jetstream.New(nc)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer nc.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		c, err := s.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{AckPolicy: jetstream.AckExplicitPolicy})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		for i := 0; i < 100; i++ {
+			if _, err := js.Publish(ctx, "FOO.A", []byte(fmt.Sprintf("msg %d", i))); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+
+		// ack messages slowly, from outside of the handler
+		toAck := make(chan jetstream.Msg, 100)
+		var maxPending int
+		cc, err := c.Consume(func(msg jetstream.Msg) {
+			toAck <- msg
+		}, jetstream.WithConsumeMaxAckPending(10))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer cc.Stop()
+
+		for i := 0; i < 100; i++ {
+			select {
+			case msg := <-toAck:
+				maxPending = max(maxPending, cc.NumAckPending())
+				time.Sleep(5 * time.Millisecond)
+				if err := msg.Ack(); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Timeout waiting for messages; received: %d", i)
+			}
+		}
+		if maxPending > 10 {
+			t.Fatalf("Expected at most 10 unacked messages; got: %d", maxPending)
+		}
+		if pending := cc.NumAckPending(); pending != 0 {
+			t.Fatalf("Expected no unacked messages; got: %d", pending)
+		}
+	})
+
+	t.Run("with max ack pending, unacked messages", func(t *testing.T) {
+		srv := RunBasicJetStreamServer()
+		defer shutdownJSServerAndRemoveStorage(t, srv)
+		nc, err := nats.Connect(srv.ClientURL())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		js, err := jetstream.New(nc)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer nc.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		c, err := s.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{
+			AckPolicy:  jetstream.AckExplicitPolicy,
+			AckWait:    300 * time.Millisecond,
+			MaxDeliver: 1,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		for i := 0; i < 20; i++ {
+			if _, err := js.Publish(ctx, "FOO.A", []byte(fmt.Sprintf("msg %d", i))); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+
+		// messages are never acked, so the window is only freed
+		// once their ack wait expires
+		msgs := make(chan jetstream.Msg, 20)
+		cc, err := c.Consume(func(msg jetstream.Msg) {
+			msgs <- msg
+		}, jetstream.WithConsumeMaxAckPending(5))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer cc.Stop()
+
+		for i := 0; i < 20; i++ {
+			select {
+			case <-msgs:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Timeout waiting for messages; received: %d", i)
+			}
+		}
+		checkFor(t, 2*time.Second, 50*time.Millisecond, func() error {
+			if pending := cc.NumAckPending(); pending != 0 {
+				return fmt.Errorf("expected no unacked messages; got: %d", pending)
+			}
+			return nil
+		})
+	})
+
+	t.Run("with max ack pending, ack all", func(t *testing.T) {
+		srv := RunBasicJetStreamServer()
+		defer shutdownJSServerAndRemoveStorage(t, srv)
+		nc, err := nats.Connect(srv.ClientURL())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		js, err := jetstream.New(nc)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer nc.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		c, err := s.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{AckPolicy: jetstream.AckAllPolicy})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		for i := 0; i < 20; i++ {
+			if _, err := js.Publish(ctx, "FOO.A", []byte(fmt.Sprintf("msg %d", i))); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+
+		// only every 5th message is acked, acknowledging the previous ones
+		msgs := make(chan jetstream.Msg, 20)
+		cc, err := c.Consume(func(msg jetstream.Msg) {
+			msgs <- msg
+		}, jetstream.WithConsumeMaxAckPending(5))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer cc.Stop()
+
+		for i := 0; i < 20; i++ {
+			select {
+			case msg := <-msgs:
+				if (i+1)%5 != 0 {
+					continue
+				}
+				if err := msg.Ack(); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Timeout waiting for messages; received: %d", i)
+			}
+		}
+		if pending := cc.NumAckPending(); pending != 0 {
+			t.Fatalf("Expected no unacked messages; got: %d", pending)
+		}
+	})
+
+	t.Run("with max ack pending, invalid options", func(t *testing.T) {
+		srv := RunBasicJetStreamServer()
+		defer shutdownJSServerAndRemoveStorage(t, srv)
+		nc, err := nats.Connect(srv.ClientURL())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		js, err := jetstream.New(nc)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer nc.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		c, err := s.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{AckPolicy: jetstream.AckExplicitPolicy})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		_, err = c.Consume(func(msg jetstream.Msg) {}, jetstream.WithConsumeMaxAckPending(0))
+		if !errors.Is(err, jetstream.ErrInvalidOption) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrInvalidOption, err)
+		}
+		c, err = s.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{Durable: "none", AckPolicy: jetstream.AckNonePolicy})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		_, err = c.Consume(func(msg jetstream.Msg) {}, jetstream.WithConsumeMaxAckPending(10))
+		if !errors.Is(err, jetstream.ErrInvalidOption) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrInvalidOption, err)
+		}
+	})
+
+	t.Run("with ordered delivery", func(t *testing.T) {
+		srv := RunBasicJetStreamServer()
+		defer shutdownJSServerAndRemoveStorage(t, srv)
+		nc, err := nats.Connect(srv.ClientURL())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		js, err := jetstream.New(nc)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer nc.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		c, err := s.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{AckPolicy: jetstream.AckExplicitPolicy})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		for i := 0; i < 100; i++ {
+			if _, err := js.Publish(ctx, "FOO.A", []byte(fmt.Sprintf("msg %d", i))); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+
+		// the first message is nacked, its redelivery has to be
+		// handled before any subsequent message
+		seqs := make(chan uint64, 200)
+		var nacked bool
+		cc, err := c.Consume(func(msg jetstream.Msg) {
+			meta, err := msg.Metadata()
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+				return
+			}
+			seqs <- meta.Sequence.Stream
+			if !nacked {
+				nacked = true
+				msg.Nak()
+				return
+			}
+			msg.Ack()
+		}, jetstream.WithConsumeOrdered(), jetstream.WithConsumeMaxAckPending(1), jetstream.PullMaxMessages(10))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer cc.Stop()
+
+		var last uint64
+		for i := 0; i < 101; i++ {
+			select {
+			case seq := <-seqs:
+				if i == 1 && seq == last {
+					// redelivery of the nacked message
+					continue
+				}
+				if seq <= last {
+					t.Fatalf("Expected stream sequence greater than %d; got: %d", last, seq)
+				}
+				last = seq
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Timeout waiting for messages; received: %d", i)
+			}
+		}
+		if last != 100 {
+			t.Fatalf("Expected last stream sequence to be 100; got: %d", last)
+		}
+	})
+
+	t.Run("with ordered delivery, out of order redelivery", func(t *testing.T) {
+		srv := RunBasicJetStreamServer()
+		defer shutdownJSServerAndRemoveStorage(t, srv)
+		nc, err := nats.Connect(srv.ClientURL())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		js, err := jetstream.New(nc)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer nc.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		c, err := s.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{AckPolicy: jetstream.AckExplicitPolicy})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		for i := 0; i < 10; i++ {
+			if _, err := js.Publish(ctx, "FOO.A", []byte(fmt.Sprintf("msg %d", i))); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+
+		// nacking the first message makes the server redeliver it after
+		// subsequent messages were handled
+		var handled []uint64
+		errs := make(chan error, 1)
+		cc, err := c.Consume(func(msg jetstream.Msg) {
+			meta, err := msg.Metadata()
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+				return
+			}
+			handled = append(handled, meta.Sequence.Stream)
+			if meta.Sequence.Stream == 1 {
+				msg.Nak()
+				return
+			}
+			msg.Ack()
+		}, jetstream.WithConsumeOrdered(), jetstream.ConsumeErrHandler(func(_ jetstream.ConsumeContext, err error) {
+			errs <- err
+		}))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer cc.Stop()
+
+		select {
+		case err := <-errs:
+			if !errors.Is(err, jetstream.ErrConsumeOutOfOrder) {
+				t.Fatalf("Expected error: %v; got: %v", jetstream.ErrConsumeOutOfOrder, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timeout waiting for out of order error")
+		}
+		select {
+		case <-cc.Closed():
+		case <-time.After(5 * time.Second):
+			t.Fatal("Consume context not closed")
+		}
+		for i, seq := range handled {
+			if seq != uint64(i+1) {
+				t.Fatalf("Expected stream sequence %d; got: %d", i+1, seq)
+			}
+		}
+	})
+
+	t.Run("promote to durable", func(t *testing.T) {
+		srv := RunBasicJetStreamServer()
+		defer shutdownJSServerAndRemoveStorage(t, srv)
+		nc, err := nats.Connect(srv.ClientURL())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		js, err := jetstream.New(nc)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer nc.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		c, err := s.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{AckPolicy: jetstream.AckExplicitPolicy})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		ephemeral := c.CachedInfo().Name
+
+		received := make(chan uint64, 20)
+		handler := func(msg jetstream.Msg) {
+			meta, err := msg.Metadata()
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+				return
+			}
+			if err := msg.DoubleAck(ctx); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+				return
+			}
+			received <- meta.Sequence.Stream
+		}
+		expectSeqs := func(from, to uint64) {
+			t.Helper()
+			for seq := from; seq <= to; seq++ {
+				select {
+				case got := <-received:
+					if got != seq {
+						t.Fatalf("Expected stream sequence %d; got: %d", seq, got)
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatalf("Timeout waiting for message %d", seq)
+				}
+			}
+		}
+		publish := func(n int) {
+			t.Helper()
+			for i := 0; i < n; i++ {
+				if _, err := js.Publish(ctx, "FOO.A", []byte("msg")); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			}
+		}
+
+		cc, err := c.Consume(handler, jetstream.WithConsumeDurableName("dur"))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		publish(5)
+		expectSeqs(1, 5)
+
+		cc, err = cc.Promote(ctx)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		publish(5)
+		expectSeqs(6, 10)
+		cc.Stop()
+
+		if _, err := s.Consumer(ctx, ephemeral); !errors.Is(err, jetstream.ErrConsumerNotFound) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrConsumerNotFound, err)
+		}
+
+		// reconnect to the durable by name and continue where it left off
+		publish(5)
+		durable, err := s.Consumer(ctx, "dur")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if durable.CachedInfo().Config.Durable != "dur" {
+			t.Fatalf("Expected durable consumer; got: %+v", durable.CachedInfo().Config)
+		}
+		cc, err = durable.Consume(handler)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer cc.Stop()
+		expectSeqs(11, 15)
+	})
+
+	t.Run("promote to durable, invalid options", func(t *testing.T) {
+		srv := RunBasicJetStreamServer()
+		defer shutdownJSServerAndRemoveStorage(t, srv)
+		nc, err := nats.Connect(srv.ClientURL())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		js, err := jetstream.New(nc)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer nc.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		c, err := s.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{AckPolicy: jetstream.AckExplicitPolicy})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		_, err = c.Consume(func(msg jetstream.Msg) {}, jetstream.WithConsumeDurableName("a.b"))
+		if !errors.Is(err, jetstream.ErrInvalidOption) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrInvalidOption, err)
+		}
+		cc, err := c.Consume(func(msg jetstream.Msg) {})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer cc.Stop()
+		if _, err := cc.Promote(ctx); !errors.Is(err, jetstream.ErrInvalidOption) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrInvalidOption, err)
+		}
+		c, err = s.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{Durable: "dur", AckPolicy: jetstream.AckExplicitPolicy})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		_, err = c.Consume(func(msg jetstream.Msg) {}, jetstream.WithConsumeDurableName("other"))
+		if !errors.Is(err, jetstream.ErrInvalidOption) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrInvalidOption, err)
+		}
+	})
+	t.Run("pause and resume", func(t *testing.T) {
+		srv := RunBasicJetStreamServer()
+		defer shutdownJSServerAndRemoveStorage(t, srv)
+		nc, err := nats.Connect(srv.ClientURL())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		js, err := jetstream.New(nc)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer nc.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		c, err := s.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{AckPolicy: jetstream.AckExplicitPolicy})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		received := make(chan jetstream.Msg, 2*len(testMsgs))
+		cc, err := c.Consume(func(msg jetstream.Msg) {
+			received <- msg
+			msg.Ack()
+		}, jetstream.PullExpiry(time.Second))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer cc.Stop()
+
+		receive := func(t *testing.T, n int) []string {
+			t.Helper()
+			data := make([]string, 0, n)
+			for i := 0; i < n; i++ {
+				select {
+				case msg := <-received:
+					data = append(data, string(msg.Data()))
+				case <-time.After(5 * time.Second):
+					t.Fatalf("Timeout waiting for messages; got %d of %d", i, n)
+				}
+			}
+			return data
+		}
+
+		publishTestMsgs(t, js)
+		receive(t, len(testMsgs))
+
+		cc.Pause()
+		if !cc.Paused() {
+			t.Fatalf("Expected consume context to be paused")
+		}
+		publishTestMsgs(t, js)
+		// wait for pull requests to expire as well
+		select {
+		case msg := <-received:
+			t.Fatalf("Unexpected message received while paused: %s", msg.Data())
+		case <-time.After(1500 * time.Millisecond):
+		}
+
+		cc.Resume()
+		if cc.Paused() {
+			t.Fatalf("Expected consume context not to be paused")
+		}
+		data := receive(t, len(testMsgs))
+		if !reflect.DeepEqual(data, testMsgs) {
+			t.Fatalf("Invalid messages received after resume; want: %v; got: %v", testMsgs, data)
+		}
+		select {
+		case msg := <-received:
+			t.Fatalf("Unexpected message: %s", msg.Data())
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+
+	t.Run("pause does not block shared dispatcher", func(t *testing.T) {
+		srv := RunBasicJetStreamServer()
+		defer shutdownJSServerAndRemoveStorage(t, srv)
+		nc, err := nats.Connect(srv.ClientURL(), nats.SharedDispatcher(1))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		js, err := jetstream.New(nc)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer nc.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		c, err := s.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{AckPolicy: jetstream.AckExplicitPolicy})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		received := make(chan jetstream.Msg, len(testMsgs))
+		cc, err := c.Consume(func(msg jetstream.Msg) {
+			received <- msg
+			msg.Ack()
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer cc.Stop()
+		cc.Pause()
+		publishTestMsgs(t, js)
+
+		// messages held by the paused consume context do not
+		// occupy the only dispatcher worker
+		core := make(chan *nats.Msg, 1)
+		if _, err := nc.Subscribe("bar", func(msg *nats.Msg) {
+			core <- msg
+		}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := nc.Publish("bar", []byte("hello")); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		select {
+		case <-core:
+		case <-time.After(time.Second):
+			t.Fatalf("Timeout waiting for message on core subscription")
+		}
+		select {
+		case msg := <-received:
+			t.Fatalf("Unexpected message received while paused: %s", msg.Data())
+		default:
+		}
+
+		cc.Resume()
+		for i := range testMsgs {
+			select {
+			case msg := <-received:
+				if string(msg.Data()) != testMsgs[i] {
+					t.Fatalf("Invalid message; want: %s; got: %s", testMsgs[i], msg.Data())
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Timeout waiting for messages")
+			}
+		}
+	})
+
+	t.Run("no ack pending with ack none policy", func(t *testing.T) {
+		srv := RunBasicJetStreamServer()
+		defer shutdownJSServerAndRemoveStorage(t, srv)
+		nc, err := nats.Connect(srv.ClientURL())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		js, err := jetstream.New(nc)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer nc.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		c, err := s.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{AckPolicy: jetstream.AckNonePolicy})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		received := make(chan jetstream.Msg, len(testMsgs))
+		cc, err := c.Consume(func(msg jetstream.Msg) {
+			received <- msg
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer cc.Stop()
+
+		publishTestMsgs(t, js)
+		for range testMsgs {
+			select {
+			case <-received:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Timeout waiting for messages")
+			}
+		}
+
+		if n := cc.NumAckPending(); n != 0 {
+			t.Fatalf("Expected no ack pending messages; got: %d", n)
+		}
+		infos := js.ActiveConsumeContexts()
+		if len(infos) != 1 {
+			t.Fatalf("Expected 1 active consume context; got %d", len(infos))
+		}
+		if infos[0].AckPending != 0 {
+			t.Fatalf("Expected no ack pending messages; got: %d", infos[0].AckPending)
+		}
+	})
+
+	t.Run("active consume contexts", func(t *testing.T) {
+		srv := RunBasicJetStreamServer()
+		defer shutdownJSServerAndRemoveStorage(t, srv)
+		nc, err := nats.Connect(srv.ClientURL())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		js, err := jetstream.New(nc)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer nc.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		c1, err := s.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{Durable: "c1", AckPolicy: jetstream.AckExplicitPolicy})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		c2, err := s.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{Durable: "c2", AckPolicy: jetstream.AckExplicitPolicy})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if infos := js.ActiveConsumeContexts(); len(infos) != 0 {
+			t.Fatalf("Expected no active consume contexts; got %d", len(infos))
+		}
+
+		received := make(chan jetstream.Msg, len(testMsgs))
+		cc, err := c1.Consume(func(msg jetstream.Msg) {
+			received <- msg
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer cc.Stop()
+		it, err := c2.Messages()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer it.Stop()
+
+		publishTestMsgs(t, js)
+		for range testMsgs {
+			select {
+			case <-received:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Timeout waiting for messages")
+			}
+		}
+
+		infos := js.ActiveConsumeContexts()
+		if len(infos) != 2 {
+			t.Fatalf("Expected 2 active consume contexts; got %d", len(infos))
+		}
+		byConsumer := make(map[string]jetstream.ConsumeContextInfo)
+		for _, info := range infos {
+			if info.ID == "" {
+				t.Fatalf("Expected consume context ID to be set")
+			}
+			if info.Stream != "foo" {
+				t.Fatalf("Invalid stream name; want: foo; got: %s", info.Stream)
+			}
+			if !info.Running {
+				t.Fatalf("Expected consume context to be running")
+			}
+			if info.LastError != nil {
+				t.Fatalf("Unexpected error: %v", info.LastError)
+			}
+			byConsumer[info.Consumer] = info
+		}
+		if info, ok := byConsumer["c1"]; !ok || info.Iterator {
+			t.Fatalf("Invalid consume context info for c1: %+v", info)
+		} else if info.AckPending != len(testMsgs) {
+			t.Fatalf("Invalid number of ack pending messages; want: %d; got: %d", len(testMsgs), info.AckPending)
+		}
+		if info, ok := byConsumer["c2"]; !ok || !info.Iterator {
+			t.Fatalf("Invalid consume context info for c2: %+v", info)
+		}
+
+		cc.Stop()
+		select {
+		case <-cc.Closed():
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timeout waiting for consume context to be closed")
+		}
+		infos = js.ActiveConsumeContexts()
+		if len(infos) != 1 || infos[0].Consumer != "c2" {
+			t.Fatalf("Expected only c2 consume context to be active; got %+v", infos)
+		}
+	})
 }
 
 func TestPullConsumerConsume_WithCluster(t *testing.T) {
@@ -660,6 +660,34 @@ func TestSubjectsFilterPaging(t *testing.T) {
 	if len(cInfo.State.Subjects) != 0 {
 		t.Fatalf("Unexpected number of subjects; want: 0; got: %d", len(cInfo.State.Subjects))
 	}
+
+	// fetch a single page, starting at an offset
+	info, err = s.Info(context.Background(), jetstream.WithSubjectFilter("FOO.*"), jetstream.WithSubjectsPagination(100000))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(info.State.Subjects) != 10000 {
+		t.Fatalf("Unexpected number of subjects; want: 10000; got: %d", len(info.State.Subjects))
+	}
+	if _, err := s.Info(context.Background(), jetstream.WithSubjectsPagination(-1)); !errors.Is(err, jetstream.ErrInvalidOption) {
+		t.Fatalf("Expected error: %v; got: %v", jetstream.ErrInvalidOption, err)
+	}
+
+	// iterate over all pages
+	subjects := make(map[string]struct{})
+	lister := s.ListSubjects(context.Background(), "FOO.*")
+	for subject := range lister.Subjects() {
+		if subject.Msgs != 1 {
+			t.Fatalf("Unexpected number of messages on subject %q; want: 1; got: %d", subject.Subject, subject.Msgs)
+		}
+		subjects[subject.Subject] = struct{}{}
+	}
+	if err := lister.Err(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(subjects) != 110000 {
+		t.Fatalf("Unexpected number of subjects; want: 110000; got: %d", len(subjects))
+	}
 }
 
 func TestStreamCachedInfo(t *testing.T) {
@@ -1397,6 +1425,17 @@ func TestPurgeStream(t *testing.T) {
 			expectedSeq: []uint64{1, 3, 5, 6, 7, 8, 9, 10},
 			timeout:     5 * time.Second,
 		},
+		{
+			name:        "purge with wildcard filter and keep",
+			opts:        []jetstream.StreamPurgeOpt{jetstream.WithPurgeSubject("FOO.*"), jetstream.WithPurgeKeep(3)},
+			expectedSeq: []uint64{8, 9, 10},
+			timeout:     5 * time.Second,
+		},
+		{
+			name:      "with invalid purge subject",
+			opts:      []jetstream.StreamPurgeOpt{jetstream.WithPurgeSubject("FOO 2"), jetstream.WithPurgeKeep(3)},
+			withError: jetstream.ErrInvalidOption,
+		},
 		{
 			name:      "with sequence and keep",
 			opts:      []jetstream.StreamPurgeOpt{jetstream.WithPurgeSequence(5), jetstream.WithPurgeKeep(3)},
@@ -1483,3 +1522,63 @@ func TestPurgeStream(t *testing.T) {
 		})
 	}
 }
+
+func TestPurgeStreamKeepPerSubject(t *testing.T) {
+	srv := RunBasicJetStreamServer()
+	defer shutdownJSServerAndRemoveStorage(t, srv)
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	js, err := jetstream.New(nc)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer nc.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	subjects := []string{"FOO.1", "FOO.2", "FOO.3"}
+	for i := 0; i < 5; i++ {
+		for _, subj := range subjects {
+			if _, err := js.Publish(ctx, subj, []byte(fmt.Sprintf("msg %d on %s", i, subj))); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+	}
+
+	// keep is scoped to the purge subject, so purging
+	// each subject separately keeps 2 messages per subject
+	for _, subj := range subjects[:2] {
+		if err := s.Purge(ctx, jetstream.WithPurgeSubject(subj), jetstream.WithPurgeKeep(2)); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	info, err := s.Info(ctx, jetstream.WithSubjectFilter("FOO.*"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]uint64{"FOO.1": 2, "FOO.2": 2, "FOO.3": 5}
+	if !reflect.DeepEqual(info.State.Subjects, expected) {
+		t.Fatalf("Invalid retained messages per subject; want: %v; got: %v", expected, info.State.Subjects)
+	}
+
+	// with a wildcard purge subject, keep applies to all
+	// matching messages together and not to each subject
+	if err := s.Purge(ctx, jetstream.WithPurgeSubject("FOO.*"), jetstream.WithPurgeKeep(2)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	info, err = s.Info(ctx, jetstream.WithSubjectFilter("FOO.*"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected = map[string]uint64{"FOO.2": 1, "FOO.3": 1}
+	if !reflect.DeepEqual(info.State.Subjects, expected) {
+		t.Fatalf("Invalid retained messages per subject; want: %v; got: %v", expected, info.State.Subjects)
+	}
+}
@@ -305,6 +305,9 @@ const (
 // simplified API. Please refer to the `jetstream` package.
 // See: https://github.com/nats-io/nats.go/blob/main/jetstream/README.md
 func (nc *Conn) JetStream(opts ...JSOpt) (JetStreamContext, error) {
+	if nc.Opts.SubjectPrefix != _EMPTY_ {
+		return nil, ErrSubjectPrefixNotSupported
+	}
 	js := &js{
 		nc: nc,
 		opts: &jsOpts{
@@ -83,6 +83,9 @@ var (
 	// ErrConsumerNotActive is an error returned when consumer is not active.
 	ErrConsumerNotActive JetStreamError = &jsError{message: "consumer not active"}
 
+	// ErrSubjectPrefixNotSupported is returned when creating a JetStream context on a connection configured with SubjectPrefix.
+	ErrSubjectPrefixNotSupported JetStreamError = &jsError{message: "jetstream is not supported on connections with a subject prefix"}
+
 	// ErrInvalidJSAck is returned when JetStream ack from message publish is invalid.
 	ErrInvalidJSAck JetStreamError = &jsError{message: "invalid jetstream publish response"}
 
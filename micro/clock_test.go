@@ -0,0 +1,85 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package micro
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+type fakeClock struct {
+	sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.Lock()
+	c.now = c.now.Add(d)
+	c.Unlock()
+}
+
+func TestStatsWithClock(t *testing.T) {
+	clk := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	svc := &service{
+		Config:  Config{Name: "test_service", Version: "0.1.0", clock: clk},
+		started: clk.Now(),
+	}
+	// each request takes 10ms, 20ms, 30ms...
+	var handled int
+	var handler Handler = HandlerFunc(func(req Request) {
+		handled++
+		clk.advance(time.Duration(handled) * 10 * time.Millisecond)
+	})
+	endpoint := &Endpoint{Name: "test", service: svc}
+	endpoint.handler.Store(&handler)
+	svc.endpoints = append(svc.endpoints, endpoint)
+
+	for i := 0; i < 3; i++ {
+		svc.reqHandler(endpoint, &request{msg: &nats.Msg{Subject: "test"}})
+	}
+	clk.advance(time.Minute)
+
+	stats := svc.Stats()
+	if len(stats.Endpoints) != 1 {
+		t.Fatalf("Expected 1 endpoint; got: %d", len(stats.Endpoints))
+	}
+	ep := stats.Endpoints[0]
+	if ep.NumRequests != 3 {
+		t.Fatalf("Invalid number of requests; want: 3; got: %d", ep.NumRequests)
+	}
+	if ep.ProcessingTime != 60*time.Millisecond {
+		t.Fatalf("Invalid processing time; want: %v; got: %v", 60*time.Millisecond, ep.ProcessingTime)
+	}
+	if ep.AverageProcessingTime != 20*time.Millisecond {
+		t.Fatalf("Invalid average processing time; want: %v; got: %v", 20*time.Millisecond, ep.AverageProcessingTime)
+	}
+	if want := time.Minute + 60*time.Millisecond; stats.Uptime != want {
+		t.Fatalf("Invalid uptime; want: %v; got: %v", want, stats.Uptime)
+	}
+
+	svc.Reset()
+	clk.advance(time.Second)
+	if stats := svc.Stats(); stats.Uptime != time.Second {
+		t.Fatalf("Invalid uptime after reset; want: %v; got: %v", time.Second, stats.Uptime)
+	}
+}
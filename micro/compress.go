@@ -0,0 +1,104 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package micro
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Response compression headers
+const (
+	// AcceptEncodingHeader is set on requests by clients able to decode
+	// compressed responses, e.g. to "gzip".
+	AcceptEncodingHeader = "Accept-Encoding"
+
+	// ContentEncodingHeader is set on compressed responses.
+	ContentEncodingHeader = "Content-Encoding"
+
+	gzipEncoding = "gzip"
+)
+
+// acceptsGzip reports whether the request headers allow a gzip
+// compressed response.
+func acceptsGzip(h nats.Header) bool {
+	for _, value := range h.Values(AcceptEncodingHeader) {
+		for _, encoding := range strings.Split(value, ",") {
+			name, params, _ := strings.Cut(encoding, ";")
+			if !strings.EqualFold(strings.TrimSpace(name), gzipEncoding) {
+				continue
+			}
+			// "gzip;q=0" explicitly refuses gzip
+			if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+				weight, err := strconv.ParseFloat(q, 64)
+				return err == nil && weight > 0
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// compressResponse gzips the response payload if the request accepts it
+// and the payload is at least minSize bytes long.
+func compressResponse(req *nats.Msg, resp *nats.Msg, minSize int) error {
+	if minSize <= 0 || len(resp.Data) < minSize || !acceptsGzip(req.Header) {
+		return nil
+	}
+	// already encoded by the handler
+	if resp.Header.Get(ContentEncodingHeader) != "" {
+		return nil
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(resp.Data); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	// headers set using WithHeaders may be shared with the caller
+	header := make(nats.Header, len(resp.Header)+1)
+	for k, v := range resp.Header {
+		header[k] = v
+	}
+	header.Set(ContentEncodingHeader, gzipEncoding)
+	resp.Header = header
+	resp.Data = buf.Bytes()
+	return nil
+}
+
+// DecompressResponse returns the payload of a service response,
+// decompressing it if the service compressed it, see [Config.CompressionThreshold].
+// Requests should set the [AcceptEncodingHeader] header to "gzip" to
+// receive compressed responses.
+func DecompressResponse(msg *nats.Msg) ([]byte, error) {
+	if msg == nil {
+		return nil, nil
+	}
+	if !strings.EqualFold(msg.Header.Get(ContentEncodingHeader), gzipEncoding) {
+		return msg.Data, nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(msg.Data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
@@ -0,0 +1,208 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package micro
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// DefaultDiscoveryWait is the time Discovery waits for responses
+// if the provided context has no deadline.
+const DefaultDiscoveryWait = time.Second
+
+// Discovery queries the monitoring endpoints of all instances of
+// services, gathering the responses which arrive before the context
+// deadline.
+type Discovery struct {
+	nc *nats.Conn
+}
+
+// NewDiscovery creates a [Discovery] using the provided connection.
+func NewDiscovery(nc *nats.Conn) *Discovery {
+	return &Discovery{nc: nc}
+}
+
+// Health returns the health status of each instance of the service with
+// the provided name (or of all services if name is empty), sorted by
+// service name and ID.
+//
+// Instances responding to PING but not to HEALTH before the context is
+// done are reported with [HealthStatusUnknown]. If the context has no
+// deadline, responses are gathered for [DefaultDiscoveryWait].
+func (d *Discovery) Health(ctx context.Context, name string) ([]HealthStatus, error) {
+	pings := make(map[string]ServiceIdentity)
+	statuses := make(map[string]HealthStatus)
+	err := d.gather(ctx, name, map[Verb]func([]byte) error{
+		PingVerb: func(data []byte) error {
+			var ping Ping
+			if err := json.Unmarshal(data, &ping); err != nil {
+				return err
+			}
+			pings[ping.ID] = ping.ServiceIdentity
+			return nil
+		},
+		HealthVerb: func(data []byte) error {
+			var status HealthStatus
+			if err := json.Unmarshal(data, &status); err != nil {
+				return err
+			}
+			statuses[status.ID] = status
+			return nil
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for id, identity := range pings {
+		if _, ok := statuses[id]; !ok {
+			statuses[id] = HealthStatus{
+				ServiceIdentity: identity,
+				Type:            HealthResponseType,
+				Status:          HealthStatusUnknown,
+			}
+		}
+	}
+	return sortByIdentity(statuses, func(s HealthStatus) ServiceIdentity { return s.ServiceIdentity }), nil
+}
+
+// Info returns the info of each instance of the service with the provided
+// name (or of all services if name is empty), sorted by service name and ID.
+// If the context has no deadline, responses are gathered for
+// [DefaultDiscoveryWait].
+func (d *Discovery) Info(ctx context.Context, name string) ([]Info, error) {
+	return discover(ctx, d, InfoVerb, name, func(i Info) ServiceIdentity { return i.ServiceIdentity })
+}
+
+// ListAll returns the info of each instance of all services, regardless
+// of their name, sorted by service name and ID. It can be used to build an
+// inventory of the services available on the system. Responses are
+// de-duplicated by service ID. Services spreading their responses using
+// [Config.MonitoringResponseJitter] are only listed if the context
+// deadline exceeds the jitter. If the context has no deadline, responses
+// are gathered for [DefaultDiscoveryWait].
+func (d *Discovery) ListAll(ctx context.Context) ([]Info, error) {
+	return d.Info(ctx, "")
+}
+
+// Stats returns the stats of each instance of the service with the provided
+// name (or of all services if name is empty), sorted by service name and ID.
+// [Stats.Uptime] can be used to spot instances which were restarted, or
+// have not been redeployed. If the context has no deadline, responses are
+// gathered for [DefaultDiscoveryWait].
+func (d *Discovery) Stats(ctx context.Context, name string) ([]Stats, error) {
+	return discover(ctx, d, StatsVerb, name, func(s Stats) ServiceIdentity { return s.ServiceIdentity })
+}
+
+// VersionReport returns the number of responding instances of the service
+// with the provided name (or of all services if name is empty) per version.
+// It can be used to verify that a deployment has been rolled out to all
+// instances. If the context has no deadline, responses are gathered for
+// [DefaultDiscoveryWait].
+func (d *Discovery) VersionReport(ctx context.Context, name string) (map[string]int, error) {
+	pings, err := discover(ctx, d, PingVerb, name, func(p Ping) ServiceIdentity { return p.ServiceIdentity })
+	if err != nil {
+		return nil, err
+	}
+	versions := make(map[string]int)
+	for _, ping := range pings {
+		versions[ping.Version]++
+	}
+	return versions, nil
+}
+
+// discover gathers the responses to the verb, keeping a single
+// response per service instance.
+func discover[T any](ctx context.Context, d *Discovery, verb Verb, name string, identity func(T) ServiceIdentity) ([]T, error) {
+	responses := make(map[string]T)
+	err := d.gather(ctx, name, map[Verb]func([]byte) error{
+		verb: func(data []byte) error {
+			var resp T
+			if err := json.Unmarshal(data, &resp); err != nil {
+				return err
+			}
+			responses[identity(resp).ID] = resp
+			return nil
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sortByIdentity(responses, identity), nil
+}
+
+func sortByIdentity[T any](responses map[string]T, identity func(T) ServiceIdentity) []T {
+	res := make([]T, 0, len(responses))
+	for _, resp := range responses {
+		res = append(res, resp)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		a, b := identity(res[i]), identity(res[j])
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.ID < b.ID
+	})
+	return res
+}
+
+// gather sends a request on the control subject of each verb and passes
+// the responses to the verb handler until the context is done.
+// Responses which cannot be decoded are skipped.
+func (d *Discovery) gather(ctx context.Context, name string, handlers map[Verb]func([]byte) error) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultDiscoveryWait)
+		defer cancel()
+	}
+
+	inbox := d.nc.NewInbox()
+	sub, err := d.nc.SubscribeSync(inbox + ".*")
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+
+	replies := make(map[string]func([]byte) error, len(handlers))
+	for verb, handler := range handlers {
+		subject, err := ControlSubject(verb, name, "")
+		if err != nil {
+			return err
+		}
+		reply := inbox + "." + verb.String()
+		replies[reply] = handler
+		if err := d.nc.PublishRequest(subject, reply, nil); err != nil {
+			return err
+		}
+	}
+
+	for {
+		msg, err := sub.NextMsgWithContext(ctx)
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+				return nil
+			}
+			return err
+		}
+		if handler, ok := replies[msg.Subject]; ok {
+			_ = handler(msg.Data)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package httpmonitor exposes the monitoring endpoints of a [micro.Service]
+// over HTTP, for monitoring stacks which do not speak NATS.
+package httpmonitor
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/nats-io/nats.go/micro"
+)
+
+// HTTPMonitor serves the PING, INFO and STATS responses of a service
+// on the /ping, /info and /stats HTTP paths. The responses have the same
+// JSON format as the ones sent over NATS and are computed from the live
+// service on each request.
+type HTTPMonitor struct {
+	server   *http.Server
+	listener net.Listener
+}
+
+// Handler returns an [http.Handler] serving the /ping, /info and /stats
+// monitoring endpoints of the service. It can be used to mount the
+// endpoints on an existing HTTP server.
+// Once the service is stopped, requests are answered with
+// 503 Service Unavailable.
+func Handler(svc micro.Service) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ping", monitorHandler(svc, func() any {
+		return micro.Ping{
+			ServiceIdentity: svc.Info().ServiceIdentity,
+			Type:            micro.PingResponseType,
+		}
+	}))
+	mux.HandleFunc("/info", monitorHandler(svc, func() any {
+		return svc.Info()
+	}))
+	mux.HandleFunc("/stats", monitorHandler(svc, func() any {
+		return svc.Stats()
+	}))
+	return mux
+}
+
+// Start starts an HTTP server listening on addr (e.g. ":8080"),
+// serving the monitoring endpoints of the service.
+func Start(svc micro.Service, addr string) (*HTTPMonitor, error) {
+	if svc == nil {
+		return nil, errors.New("httpmonitor: service is required")
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	m := &HTTPMonitor{
+		server:   &http.Server{Handler: Handler(svc)},
+		listener: ln,
+	}
+	go m.server.Serve(ln)
+	return m, nil
+}
+
+// Addr returns the address the HTTP server is listening on.
+func (m *HTTPMonitor) Addr() string {
+	return m.listener.Addr().String()
+}
+
+// Close stops the HTTP server. It does not stop the service.
+func (m *HTTPMonitor) Close() error {
+	return m.server.Close()
+}
+
+func monitorHandler(svc micro.Service, response func() any) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		if svc.Stopped() {
+			http.Error(w, "service is stopped", http.StatusServiceUnavailable)
+			return
+		}
+		data, err := json.Marshal(response())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	}
+}
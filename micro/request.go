@@ -18,6 +18,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sync"
 
 	"github.com/nats-io/nats.go"
 )
@@ -33,6 +34,16 @@ type (
 	// on a separate type.
 	HandlerFunc func(Request)
 
+	// HandlerFuncE is a request handler returning an error, which can be
+	// registered using [Service.AddEndpointE] and [Group.AddEndpointE].
+	// If the handler returns an error without having responded, it is sent
+	// as an error response: a [*ServiceError] is sent with its code,
+	// description and data, while other errors are sent with code "500".
+	// If the handler returns nil without having responded, an error
+	// response with code "500" and [ErrNoResponse] as description is sent,
+	// so that the requester does not wait for a response until it times out.
+	HandlerFuncE func(Request) error
+
 	// Request represents service request available in the service handler.
 	// It exposes methods to respond to the request, as well as
 	// getting the request data and headers.
@@ -63,6 +74,46 @@ type (
 		Reply() string
 	}
 
+	// RespondToRequest is implemented by the requests passed to endpoint
+	// handlers. It is not part of [Request], so that custom Request
+	// implementations do not have to implement it.
+	RespondToRequest interface {
+		Request
+
+		// RespondTo sends the response for the request and publishes
+		// a copy of it on each of the given subjects, e.g. to mirror
+		// responses to an audit subject.
+		// Additional headers can be passed using [WithHeaders] option.
+		RespondTo([]string, []byte, ...RespondOpt) error
+	}
+
+	// ConnectionRequest is implemented by the requests passed to endpoint
+	// handlers. It is not part of [Request], so that custom Request
+	// implementations do not have to implement it.
+	ConnectionRequest interface {
+		Request
+
+		// Connection returns the NATS connection of the service, e.g. to
+		// publish events or send requests while handling the request.
+		// Responding through the connection directly bypasses the
+		// endpoint stats and should be avoided; use Respond instead.
+		Connection() *nats.Conn
+	}
+
+	// ContextRequest is implemented by the requests passed to endpoint
+	// handlers. It is not part of [Request], so that custom Request
+	// implementations, e.g. used to test handlers, do not have to
+	// implement it.
+	ContextRequest interface {
+		Request
+
+		// Context returns the context of the request. If the endpoint has
+		// a handler timeout, the context has the corresponding deadline
+		// and is canceled once the timeout expires or the handler returns.
+		// Otherwise, the background context is returned.
+		Context() context.Context
+	}
+
 	// Headers is a wrapper around [*nats.Header]
 	Headers nats.Header
 
@@ -72,12 +123,35 @@ type (
 	// request is a default implementation of Request interface
 	request struct {
 		msg          *nats.Msg
+		nc           *nats.Conn
 		respondError error
+		jsonEncoder  func(any) ([]byte, error)
+		// number of copies of the response published by RespondTo
+		extraResponses int
+		// responded is set once a response was sent
+		responded bool
+		// deadline is set if the endpoint handler has a timeout
+		deadline *handlerDeadline
+		// ctx is set if the endpoint handler has a timeout
+		ctx context.Context
+		// compressMin is the minimum size of compressed responses,
+		// compression is disabled if 0
+		compressMin int
+	}
+
+	// handlerDeadline prevents a handler from responding to a request
+	// after its timeout expired and an error response was sent.
+	handlerDeadline struct {
+		sync.Mutex
+		expired bool
 	}
 
-	serviceError struct {
+	// ServiceError is an error response sent by a service, carrying
+	// an error code and description, as well as the optional response payload.
+	ServiceError struct {
 		Code        string `json:"code"`
 		Description string `json:"description"`
+		Data        []byte `json:"data,omitempty"`
 	}
 )
 
@@ -85,12 +159,41 @@ var (
 	ErrRespond         = errors.New("NATS error when sending response")
 	ErrMarshalResponse = errors.New("marshaling response")
 	ErrArgRequired     = errors.New("argument required")
+	ErrHandlerTimeout  = errors.New("handler timeout")
+	ErrNoResponse      = errors.New("handler did not respond")
 )
 
 func (fn HandlerFunc) Handle(req Request) {
 	fn(req)
 }
 
+func (fn HandlerFuncE) Handle(req Request) {
+	err := fn(req)
+	r, ok := req.(*request)
+	if ok && r.handled() {
+		return
+	}
+	if err == nil {
+		// responses cannot be detected for custom requests
+		if !ok {
+			return
+		}
+		err = ErrNoResponse
+	}
+	svcErr := &ServiceError{Code: "500", Description: err.Error()}
+	var target *ServiceError
+	if errors.As(err, &target) {
+		svcErr.Data = target.Data
+		if target.Code != "" {
+			svcErr.Code = target.Code
+		}
+		if target.Description != "" {
+			svcErr.Description = target.Description
+		}
+	}
+	req.Error(svcErr.Code, svcErr.Description, svcErr.Data)
+}
+
 // ContextHandler is a helper function used to utilize [context.Context]
 // in request handlers.
 func ContextHandler(ctx context.Context, handler func(context.Context, Request)) Handler {
@@ -99,28 +202,106 @@ func ContextHandler(ctx context.Context, handler func(context.Context, Request))
 	})
 }
 
+// guard locks the handler deadline, if set, for the duration of a response.
+// It returns ErrHandlerTimeout if the handler timeout already expired.
+func (r *request) guard() (func(), error) {
+	if r.deadline == nil {
+		return func() {}, nil
+	}
+	r.deadline.Lock()
+	if r.deadline.expired {
+		r.deadline.Unlock()
+		return nil, ErrHandlerTimeout
+	}
+	return r.deadline.Unlock, nil
+}
+
+// handled reports whether a response was sent for the request, or failed
+// to be sent, either by the handler or once its timeout expired.
+func (r *request) handled() bool {
+	if r.deadline != nil {
+		r.deadline.Lock()
+		defer r.deadline.Unlock()
+	}
+	return r.responded || r.respondError != nil
+}
+
 // Respond sends the response for the request.
 // Additional headers can be passed using [WithHeaders] option.
 func (r *request) Respond(response []byte, opts ...RespondOpt) error {
+	unlock, err := r.guard()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return r.respond(response, opts...)
+}
+
+func (r *request) respond(response []byte, opts ...RespondOpt) error {
 	respMsg := &nats.Msg{
 		Data: response,
 	}
 	for _, opt := range opts {
 		opt(respMsg)
 	}
+	if err := compressResponse(r.msg, respMsg, r.compressMin); err != nil {
+		r.respondError = fmt.Errorf("%w: %w", ErrRespond, err)
+		return r.respondError
+	}
 
 	if err := r.msg.RespondMsg(respMsg); err != nil {
-		r.respondError = fmt.Errorf("%w: %s", ErrRespond, err)
+		r.respondError = fmt.Errorf("%w: %w", ErrRespond, err)
 		return r.respondError
 	}
+	r.responded = true
 
 	return nil
 }
 
+// RespondTo sends the response for the request and publishes
+// a copy of it on each of the given subjects, e.g. to mirror
+// responses to an audit subject.
+// Only the response to the request reply subject is accounted for in
+// endpoint request and error stats. Copies are counted separately in
+// [EndpointStats.NumExtraResponses] and failing to publish them does not
+// mark the request as failed.
+// Additional headers can be passed using [WithHeaders] option.
+func (r *request) RespondTo(subjects []string, response []byte, opts ...RespondOpt) error {
+	unlock, err := r.guard()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := r.respond(response, opts...); err != nil {
+		return err
+	}
+	var errs []error
+	for _, subject := range subjects {
+		msg := &nats.Msg{
+			Subject: subject,
+			Data:    response,
+		}
+		for _, opt := range opts {
+			opt(msg)
+		}
+		if err := r.nc.PublishMsg(msg); err != nil {
+			errs = append(errs, fmt.Errorf("%w: %q: %w", ErrRespond, subject, err))
+			continue
+		}
+		r.extraResponses++
+	}
+	return errors.Join(errs...)
+}
+
 // RespondJSON marshals the given response value and responds to the request.
+// The endpoint's encoder set with [WithEndpointJSONEncoder] is used if present.
 // Additional headers can be passed using [WithHeaders] option.
 func (r *request) RespondJSON(response any, opts ...RespondOpt) error {
-	resp, err := json.Marshal(response)
+	encode := json.Marshal
+	if r.jsonEncoder != nil {
+		encode = r.jsonEncoder
+	}
+	resp, err := encode(response)
 	if err != nil {
 		return ErrMarshalResponse
 	}
@@ -131,6 +312,15 @@ func (r *request) RespondJSON(response any, opts ...RespondOpt) error {
 // A response error should be set containing an error code and description.
 // Optionally, data can be set as response payload.
 func (r *request) Error(code, description string, data []byte, opts ...RespondOpt) error {
+	unlock, err := r.guard()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return r.error(code, description, data, opts...)
+}
+
+func (r *request) error(code, description string, data []byte, opts ...RespondOpt) error {
 	if code == "" {
 		return fmt.Errorf("%w: error code", ErrArgRequired)
 	}
@@ -152,7 +342,7 @@ func (r *request) Error(code, description string, data []byte, opts ...RespondOp
 		r.respondError = err
 		return err
 	}
-	r.respondError = &serviceError{
+	r.respondError = &ServiceError{
 		Code:        code,
 		Description: description,
 	}
@@ -194,6 +384,20 @@ func (r *request) Reply() string {
 	return r.msg.Reply
 }
 
+// Connection returns the NATS connection of the service.
+func (r *request) Connection() *nats.Conn {
+	return r.nc
+}
+
+// Context returns the context of the request, which is canceled
+// once the handler timeout expires.
+func (r *request) Context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
 // Get gets the first value associated with the given key.
 // It is case-sensitive.
 func (h Headers) Get(key string) string {
@@ -206,6 +410,24 @@ func (h Headers) Values(key string) []string {
 	return nats.Header(h).Values(key)
 }
 
-func (e *serviceError) Error() string {
+// ParseError returns the [ServiceError] carried by a service response,
+// using the [ErrorCodeHeader] and [ErrorHeader] headers and the response payload.
+// It returns false if the message is not an error response.
+func ParseError(msg *nats.Msg) (*ServiceError, bool) {
+	if msg == nil {
+		return nil, false
+	}
+	code := msg.Header.Get(ErrorCodeHeader)
+	if code == "" {
+		return nil, false
+	}
+	return &ServiceError{
+		Code:        code,
+		Description: msg.Header.Get(ErrorHeader),
+		Data:        msg.Data,
+	}, true
+}
+
+func (e *ServiceError) Error() string {
 	return fmt.Sprintf("%s:%s", e.Code, e.Description)
 }
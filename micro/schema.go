@@ -0,0 +1,357 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package micro
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// jsonSchema is a compiled JSON Schema used to validate request payloads.
+// It supports the commonly used validation keywords: type, enum, const,
+// properties, required, additionalProperties, items, minItems, maxItems,
+// minLength, maxLength, pattern, minimum, maximum, exclusiveMinimum,
+// exclusiveMaximum, allOf, anyOf, oneOf and not. Annotations such as
+// title, description or format are ignored, while references are not
+// supported.
+type jsonSchema struct {
+	// set for boolean schemas
+	always *bool
+
+	types                []string
+	enum                 []any
+	constValue           any
+	hasConst             bool
+	properties           map[string]*jsonSchema
+	required             []string
+	additionalProperties *jsonSchema
+	items                *jsonSchema
+	minItems, maxItems   *int
+	minLength, maxLength *int
+	pattern              *regexp.Regexp
+	minimum, maximum     *float64
+	exclusiveMinimum     *float64
+	exclusiveMaximum     *float64
+	allOf, anyOf, oneOf  []*jsonSchema
+	not                  *jsonSchema
+}
+
+type rawJSONSchema struct {
+	Ref                  string                     `json:"$ref"`
+	Type                 json.RawMessage            `json:"type"`
+	Enum                 []any                      `json:"enum"`
+	Const                json.RawMessage            `json:"const"`
+	Properties           map[string]json.RawMessage `json:"properties"`
+	Required             []string                   `json:"required"`
+	AdditionalProperties json.RawMessage            `json:"additionalProperties"`
+	Items                json.RawMessage            `json:"items"`
+	MinItems             *int                       `json:"minItems"`
+	MaxItems             *int                       `json:"maxItems"`
+	MinLength            *int                       `json:"minLength"`
+	MaxLength            *int                       `json:"maxLength"`
+	Pattern              *string                    `json:"pattern"`
+	Minimum              *float64                   `json:"minimum"`
+	Maximum              *float64                   `json:"maximum"`
+	ExclusiveMinimum     *float64                   `json:"exclusiveMinimum"`
+	ExclusiveMaximum     *float64                   `json:"exclusiveMaximum"`
+	AllOf                []json.RawMessage          `json:"allOf"`
+	AnyOf                []json.RawMessage          `json:"anyOf"`
+	OneOf                []json.RawMessage          `json:"oneOf"`
+	Not                  json.RawMessage            `json:"not"`
+}
+
+var schemaTypes = map[string]struct{}{
+	"null": {}, "boolean": {}, "object": {}, "array": {}, "number": {}, "integer": {}, "string": {},
+}
+
+func compileSchema(data []byte) (*jsonSchema, error) {
+	data = bytes.TrimSpace(data)
+	switch string(data) {
+	case "true", "false":
+		always := string(data) == "true"
+		return &jsonSchema{always: &always}, nil
+	}
+	var raw rawJSONSchema
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	if raw.Ref != "" {
+		return nil, errors.New("$ref is not supported")
+	}
+
+	s := &jsonSchema{
+		enum:             raw.Enum,
+		required:         raw.Required,
+		minItems:         raw.MinItems,
+		maxItems:         raw.MaxItems,
+		minLength:        raw.MinLength,
+		maxLength:        raw.MaxLength,
+		minimum:          raw.Minimum,
+		maximum:          raw.Maximum,
+		exclusiveMinimum: raw.ExclusiveMinimum,
+		exclusiveMaximum: raw.ExclusiveMaximum,
+	}
+	if len(raw.Type) > 0 {
+		if err := json.Unmarshal(raw.Type, &s.types); err != nil {
+			var t string
+			if err := json.Unmarshal(raw.Type, &t); err != nil {
+				return nil, errors.New("type has to be a string or an array of strings")
+			}
+			s.types = []string{t}
+		}
+		for _, t := range s.types {
+			if _, ok := schemaTypes[t]; !ok {
+				return nil, fmt.Errorf("unknown type %q", t)
+			}
+		}
+	}
+	if len(raw.Const) > 0 {
+		if err := json.Unmarshal(raw.Const, &s.constValue); err != nil {
+			return nil, err
+		}
+		s.hasConst = true
+	}
+	if raw.Pattern != nil {
+		pattern, err := regexp.Compile(*raw.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern: %w", err)
+		}
+		s.pattern = pattern
+	}
+
+	var err error
+	if len(raw.Properties) > 0 {
+		s.properties = make(map[string]*jsonSchema, len(raw.Properties))
+		for name, prop := range raw.Properties {
+			if s.properties[name], err = compileSchema(prop); err != nil {
+				return nil, fmt.Errorf("properties.%s: %w", name, err)
+			}
+		}
+	}
+	if len(raw.AdditionalProperties) > 0 {
+		if s.additionalProperties, err = compileSchema(raw.AdditionalProperties); err != nil {
+			return nil, fmt.Errorf("additionalProperties: %w", err)
+		}
+	}
+	if len(raw.Items) > 0 {
+		if s.items, err = compileSchema(raw.Items); err != nil {
+			return nil, fmt.Errorf("items: %w", err)
+		}
+	}
+	if len(raw.Not) > 0 {
+		if s.not, err = compileSchema(raw.Not); err != nil {
+			return nil, fmt.Errorf("not: %w", err)
+		}
+	}
+	for _, list := range []struct {
+		name string
+		raw  []json.RawMessage
+		dst  *[]*jsonSchema
+	}{
+		{"allOf", raw.AllOf, &s.allOf},
+		{"anyOf", raw.AnyOf, &s.anyOf},
+		{"oneOf", raw.OneOf, &s.oneOf},
+	} {
+		for i, sub := range list.raw {
+			compiled, err := compileSchema(sub)
+			if err != nil {
+				return nil, fmt.Errorf("%s[%d]: %w", list.name, i, err)
+			}
+			*list.dst = append(*list.dst, compiled)
+		}
+	}
+	return s, nil
+}
+
+// validate validates a JSON document against the schema.
+func (s *jsonSchema) validate(data []byte) error {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	return s.validateValue("$", v)
+}
+
+func (s *jsonSchema) validateValue(path string, v any) error {
+	if s.always != nil {
+		if !*s.always {
+			return fmt.Errorf("%s: not allowed", path)
+		}
+		return nil
+	}
+	if len(s.types) > 0 && !s.matchesType(v) {
+		return fmt.Errorf("%s: expected %s, got %s", path, strings.Join(s.types, " or "), jsonType(v))
+	}
+	if s.enum != nil {
+		var found bool
+		for _, e := range s.enum {
+			if reflect.DeepEqual(e, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: value is not one of the allowed values", path)
+		}
+	}
+	if s.hasConst && !reflect.DeepEqual(s.constValue, v) {
+		return fmt.Errorf("%s: value does not match the expected constant", path)
+	}
+
+	switch val := v.(type) {
+	case map[string]any:
+		if err := s.validateObject(path, val); err != nil {
+			return err
+		}
+	case []any:
+		if s.minItems != nil && len(val) < *s.minItems {
+			return fmt.Errorf("%s: expected at least %d items, got %d", path, *s.minItems, len(val))
+		}
+		if s.maxItems != nil && len(val) > *s.maxItems {
+			return fmt.Errorf("%s: expected at most %d items, got %d", path, *s.maxItems, len(val))
+		}
+		if s.items != nil {
+			for i, item := range val {
+				if err := s.items.validateValue(fmt.Sprintf("%s[%d]", path, i), item); err != nil {
+					return err
+				}
+			}
+		}
+	case string:
+		length := utf8.RuneCountInString(val)
+		if s.minLength != nil && length < *s.minLength {
+			return fmt.Errorf("%s: expected at least %d characters, got %d", path, *s.minLength, length)
+		}
+		if s.maxLength != nil && length > *s.maxLength {
+			return fmt.Errorf("%s: expected at most %d characters, got %d", path, *s.maxLength, length)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(val) {
+			return fmt.Errorf("%s: value does not match pattern %q", path, s.pattern)
+		}
+	case float64:
+		if s.minimum != nil && val < *s.minimum {
+			return fmt.Errorf("%s: expected a value >= %v, got %v", path, *s.minimum, val)
+		}
+		if s.maximum != nil && val > *s.maximum {
+			return fmt.Errorf("%s: expected a value <= %v, got %v", path, *s.maximum, val)
+		}
+		if s.exclusiveMinimum != nil && val <= *s.exclusiveMinimum {
+			return fmt.Errorf("%s: expected a value > %v, got %v", path, *s.exclusiveMinimum, val)
+		}
+		if s.exclusiveMaximum != nil && val >= *s.exclusiveMaximum {
+			return fmt.Errorf("%s: expected a value < %v, got %v", path, *s.exclusiveMaximum, val)
+		}
+	}
+
+	for _, sub := range s.allOf {
+		if err := sub.validateValue(path, v); err != nil {
+			return err
+		}
+	}
+	if len(s.anyOf) > 0 {
+		var matched bool
+		for _, sub := range s.anyOf {
+			if sub.validateValue(path, v) == nil {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s: value does not match any of the allowed schemas", path)
+		}
+	}
+	if len(s.oneOf) > 0 {
+		var matched int
+		for _, sub := range s.oneOf {
+			if sub.validateValue(path, v) == nil {
+				matched++
+			}
+		}
+		if matched != 1 {
+			return fmt.Errorf("%s: value has to match exactly one schema, matched %d", path, matched)
+		}
+	}
+	if s.not != nil && s.not.validateValue(path, v) == nil {
+		return fmt.Errorf("%s: value matches a disallowed schema", path)
+	}
+	return nil
+}
+
+func (s *jsonSchema) validateObject(path string, obj map[string]any) error {
+	for _, name := range s.required {
+		if _, ok := obj[name]; !ok {
+			return fmt.Errorf("%s: missing required property %q", path, name)
+		}
+	}
+	// validate properties in a stable order, reporting the same error
+	// for the same document
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		propPath := path + "." + name
+		if prop, ok := s.properties[name]; ok {
+			if err := prop.validateValue(propPath, obj[name]); err != nil {
+				return err
+			}
+		} else if s.additionalProperties != nil {
+			if err := s.additionalProperties.validateValue(propPath, obj[name]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *jsonSchema) matchesType(v any) bool {
+	actual := jsonType(v)
+	for _, t := range s.types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonType(v any) string {
+	switch val := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case float64:
+		if val == math.Trunc(val) && !math.IsInf(val, 0) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
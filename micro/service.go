@@ -14,12 +14,16 @@
 package micro
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math/rand"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/nats-io/nats.go"
@@ -37,6 +41,10 @@ type (
 		// AddEndpoint registers endpoint with given name on a specific subject.
 		AddEndpoint(string, Handler, ...EndpointOpt) error
 
+		// AddEndpointE registers endpoint with given name using a handler
+		// returning an error, see [HandlerFuncE].
+		AddEndpointE(string, HandlerFuncE, ...EndpointOpt) error
+
 		// AddGroup returns a Group interface, allowing for more complex endpoint topologies.
 		// A group can be used to register endpoints with given prefix.
 		AddGroup(string, ...GroupOpt) Group
@@ -47,6 +55,9 @@ type (
 		// Stats returns statistics for the service endpoint and all monitoring endpoints.
 		Stats() Stats
 
+		// Endpoint returns the first endpoint registered with the given name.
+		Endpoint(string) (*Endpoint, bool)
+
 		// Reset resets all statistics (for all endpoints) on a service instance.
 		Reset()
 
@@ -55,6 +66,15 @@ type (
 
 		// Stopped informs whether [Stop] was executed on the service.
 		Stopped() bool
+
+		// InFlight returns the number of requests currently being handled
+		// by the service endpoints.
+		InFlight() int
+
+		// Reconfigure replaces the service version, description, metadata
+		// and endpoints with the ones from the given config, keeping
+		// unchanged endpoints serving.
+		Reconfigure(Config) error
 	}
 
 	// Group allows for grouping endpoints on a service.
@@ -68,27 +88,65 @@ type (
 		// AddEndpoint registers new endpoints on a service.
 		// The endpoint's subject will be prefixed with the group prefix.
 		AddEndpoint(string, Handler, ...EndpointOpt) error
+
+		// AddEndpointE registers new endpoints on a service using a handler
+		// returning an error, see [HandlerFuncE].
+		// The endpoint's subject will be prefixed with the group prefix.
+		AddEndpointE(string, HandlerFuncE, ...EndpointOpt) error
 	}
 
 	EndpointOpt func(*endpointOpts) error
 	GroupOpt    func(*groupOpts)
 
 	endpointOpts struct {
-		subject    string
-		metadata   map[string]string
-		queueGroup string
+		subject     string
+		metadata    map[string]string
+		queueGroup  string
+		jsonEncoder func(any) ([]byte, error)
+		validator   RequestValidator
+		schema      *jsonSchema
+		timeout     time.Duration
+		advertised  time.Duration
+		logSampling float64
+		compression *int
 	}
 
 	groupOpts struct {
 		queueGroup string
+		metadata   map[string]string
 	}
 
 	// ErrHandler is a function used to configure a custom error handler for a service,
 	ErrHandler func(Service, *NATSError)
 
+	// RequestValidator is a function used to validate requests before they
+	// are passed to the endpoint handler. A non-nil error is sent to the
+	// client instead of invoking the handler.
+	RequestValidator func(Request) *ServiceError
+
 	// DoneHandler is a function used to configure a custom done handler for a service.
 	DoneHandler func(Service)
 
+	// DrainProgressHandler is a function invoked when a service starts
+	// draining and then each time a request in flight completes, with the
+	// number of requests still in flight.
+	DrainProgressHandler func(Service, int)
+
+	// RequestObserver is a function invoked after an endpoint handled a
+	// request, subject to the endpoint log sampling (see
+	// [WithEndpointLogSampling]). It is invoked synchronously by the
+	// endpoint, and should not block.
+	RequestObserver func(Service, RequestLog)
+
+	// RequestLog describes a request handled by an endpoint.
+	RequestLog struct {
+		Endpoint       string
+		Subject        string
+		ProcessingTime time.Duration
+		// Err is set if an error response was sent.
+		Err error
+	}
+
 	// StatsHandler is a function used to configure a custom STATS endpoint.
 	// It should return a value which can be serialized to JSON.
 	StatsHandler func(*Endpoint) any
@@ -107,7 +165,12 @@ type (
 		ServiceIdentity
 		Type      string           `json:"type"`
 		Started   time.Time        `json:"started"`
+		Uptime    time.Duration    `json:"uptime"`
 		Endpoints []*EndpointStats `json:"endpoints"`
+		Groups    []*GroupStats    `json:"groups,omitempty"`
+		// NumUnmatched is the number of requests handled by
+		// [Config.DefaultHandler].
+		NumUnmatched int `json:"num_unmatched,omitempty"`
 	}
 
 	// EndpointStats contains stats for a specific endpoint.
@@ -118,17 +181,49 @@ type (
 		NumRequests           int             `json:"num_requests"`
 		NumErrors             int             `json:"num_errors"`
 		LastError             string          `json:"last_error"`
+		LastErrorTime         time.Time       `json:"last_error_time"`
+		NumExtraResponses     int             `json:"num_extra_responses,omitempty"`
+		NumTimeouts           int             `json:"num_timeouts,omitempty"`
+		Drained               bool            `json:"drained,omitempty"`
 		ProcessingTime        time.Duration   `json:"processing_time"`
 		AverageProcessingTime time.Duration   `json:"average_processing_time"`
 		Data                  json.RawMessage `json:"data,omitempty"`
 	}
 
+	// GroupStats contains stats aggregated over all endpoints registered
+	// within a group, including endpoints of its nested groups.
+	GroupStats struct {
+		Name                  string        `json:"name"`
+		NumEndpoints          int           `json:"num_endpoints"`
+		NumRequests           int           `json:"num_requests"`
+		NumErrors             int           `json:"num_errors"`
+		ProcessingTime        time.Duration `json:"processing_time"`
+		AverageProcessingTime time.Duration `json:"average_processing_time"`
+	}
+
 	// Ping is the response type for PING monitoring endpoint.
 	Ping struct {
 		ServiceIdentity
 		Type string `json:"type"`
 	}
 
+	// HealthStatus is the response type for HEALTH monitoring endpoint.
+	HealthStatus struct {
+		ServiceIdentity
+		Type string `json:"type"`
+
+		// Status is one of [HealthStatusOK], [HealthStatusDegraded] or
+		// [HealthStatusUnknown].
+		Status string `json:"status"`
+
+		// Error is the error returned by the health check, if any.
+		Error string `json:"error,omitempty"`
+	}
+
+	// HealthCheck is a user-defined function reporting the health of
+	// the service. Returning an error marks the service as degraded.
+	HealthCheck func() error
+
 	// Info is the basic information about a service type.
 	Info struct {
 		ServiceIdentity
@@ -142,6 +237,11 @@ type (
 		Subject    string            `json:"subject"`
 		QueueGroup string            `json:"queue_group"`
 		Metadata   map[string]string `json:"metadata"`
+		Drained    bool              `json:"drained,omitempty"`
+		// Timeout is the maximum processing time of a request advertised
+		// by the endpoint, see [WithEndpointTimeout]. Clients can use it
+		// to set the timeout of their requests.
+		Timeout time.Duration `json:"timeout,omitempty"`
 	}
 
 	// Endpoint manages a service endpoint.
@@ -153,12 +253,30 @@ type (
 
 		stats        EndpointStats
 		subscription *nats.Subscription
+		handler      atomic.Pointer[Handler]
+		jsonEncoder  func(any) ([]byte, error)
+		validator    RequestValidator
+		schema       *jsonSchema
+		timeout      time.Duration
+		advertised   time.Duration
+		groups       []string
+		drained      bool
+		logSampling  float64
+		logCount     atomic.Uint64
+		compressMin  int
+
+		// configured is set for endpoints registered from the service
+		// Config, which are the ones updated by Reconfigure.
+		configured bool
 	}
 
 	group struct {
 		service    *service
 		prefix     string
 		queueGroup string
+		metadata   map[string]string
+		// groups holds the prefixes of this group and all its parents.
+		groups []string
 	}
 
 	// Verb represents a name of the monitoring service.
@@ -174,6 +292,11 @@ type (
 		// Service.AddGroup and Service.AddEndpoint methods.
 		Endpoint *EndpointConfig `json:"endpoint"`
 
+		// Endpoints is an optional set of additional endpoint configurations,
+		// keyed by endpoint name. If not set, the endpoint subject is the
+		// endpoint name.
+		Endpoints map[string]EndpointConfig `json:"endpoints,omitempty"`
+
 		// Version is a SemVer compatible version string.
 		Version string `json:"version"`
 
@@ -186,15 +309,96 @@ type (
 		// QueueGroup can be used to override the default queue group name.
 		QueueGroup string `json:"queue_group"`
 
+		// ServiceQueueGroup makes the default queue group name derive from
+		// the service name ("q.<name>") instead of [DefaultQueueGroup], so
+		// that unrelated services sharing a subject do not load-balance
+		// requests together. QueueGroup and the group and endpoint queue
+		// group options still take precedence.
+		ServiceQueueGroup bool `json:"service_queue_group,omitempty"`
+
 		// StatsHandler is a user-defined custom function.
 		// used to calculate additional service stats.
 		StatsHandler StatsHandler
 
+		// GroupStats enables stats aggregated per group (see [Service.AddGroup])
+		// in [Stats] responses, in addition to the per-endpoint stats.
+		GroupStats bool `json:"group_stats,omitempty"`
+
+		// MonitoringResponseJitter is the upper bound of a random delay
+		// applied to responses to PING, INFO and STATS requests which are
+		// not targeted at this service instance by ID, so that the
+		// responses of many instances are spread over time.
+		MonitoringResponseJitter time.Duration `json:"monitoring_response_jitter,omitempty"`
+
+		// StatsPushSubject is the subject on which the service publishes
+		// its [Stats] every StatsPushInterval, for push-based metrics
+		// collection.
+		StatsPushSubject string `json:"stats_push_subject,omitempty"`
+
+		// StatsPushInterval is the interval at which stats are published
+		// on StatsPushSubject. Publishing stops when the service is
+		// stopped. Zero (the default) disables it.
+		StatsPushInterval time.Duration `json:"stats_push_interval,omitempty"`
+
+		// SubjectTransformer, if set, maps the subject of each endpoint to
+		// the subject its subscription is created on, e.g. to apply a
+		// tenant prefix. The endpoint subject is still the one advertised
+		// in INFO and STATS responses.
+		SubjectTransformer func(endpointSubject string) (subscribeSubject string)
+
+		// CompressionThreshold enables gzip compression of responses of at
+		// least this many bytes, sent using [Request.Respond] or
+		// [Request.RespondJSON], for requests setting the
+		// [AcceptEncodingHeader] header to "gzip". Compressed responses
+		// have the [ContentEncodingHeader] header set and can be decoded
+		// using [DecompressResponse]. Compression is disabled if 0, and can
+		// be configured per endpoint using [WithEndpointCompression].
+		CompressionThreshold int `json:"compression_threshold,omitempty"`
+
+		// DefaultHandler, if set, handles requests received on
+		// DefaultSubject which do not match the subject of any endpoint,
+		// e.g. to consistently respond to unknown methods with a "404"
+		// error. Such requests are counted in [Stats.NumUnmatched].
+		DefaultHandler Handler
+
+		// DefaultSubject is the catch-all subject, usually containing
+		// wildcards, on which DefaultHandler receives requests. It is
+		// required if DefaultHandler is set.
+		DefaultSubject string `json:"default_subject,omitempty"`
+
+		// HealthCheck is invoked on each HEALTH request. If not set,
+		// the service always reports [HealthStatusOK].
+		HealthCheck HealthCheck
+
 		// DoneHandler is invoked when all service subscription are stopped.
 		DoneHandler DoneHandler
 
+		// DrainProgressHandler is invoked while the service is drained
+		// using [ServiceSet.DrainWithTimeout], reporting the number of
+		// requests still in flight as it decreases.
+		DrainProgressHandler DrainProgressHandler
+
+		// RequestObserver is invoked after requests are handled by
+		// endpoints, e.g. to log them. Requests resulting in an error are
+		// always reported, other requests are sampled according to
+		// [WithEndpointLogSampling].
+		RequestObserver RequestObserver
+
 		// ErrorHandler is invoked on any nats-related service error.
 		ErrorHandler ErrHandler
+
+		// Validator is invoked before the handler of every endpoint
+		// which does not set its own validator using [WithEndpointValidator].
+		Validator RequestValidator
+
+		// Context can be used to bind the service lifecycle to a parent
+		// context. Once the context is done, the service is stopped as if
+		// [Service.Stop] was called, invoking DoneHandler.
+		Context context.Context `json:"-"`
+
+		// clock is used to measure uptime and processing times.
+		// It is only set in tests and defaults to the system clock.
+		clock clock
 	}
 
 	EndpointConfig struct {
@@ -227,6 +431,7 @@ type (
 		Config
 
 		m            sync.Mutex
+		reconfigure  sync.Mutex
 		id           string
 		endpoints    []*Endpoint
 		verbSubs     map[string]*nats.Subscription
@@ -234,6 +439,13 @@ type (
 		nc           *nats.Conn
 		natsHandlers handlers
 		stopped      bool
+		// done is closed when the service is stopped
+		done chan struct{}
+		// numUnmatched is the number of requests handled by DefaultHandler
+		numUnmatched int
+		// inFlight is the number of requests being handled by endpoints
+		inFlight atomic.Int64
+		draining atomic.Bool
 
 		asyncDispatcher asyncCallbacksHandler
 	}
@@ -260,6 +472,12 @@ const (
 const (
 	ErrorHeader     = "Nats-Service-Error"
 	ErrorCodeHeader = "Nats-Service-Error-Code"
+
+	// StatsResetEndpointHeader can be set on a STATS request targeting a
+	// service instance by ID to reset the stats of the endpoints with the
+	// given name, once the stats included in the response are collected.
+	// It is ignored on STATS requests sent to all instances.
+	StatsResetEndpointHeader = "Nats-Service-Reset-Endpoint"
 )
 
 // Verbs being used to set up a specific control subject.
@@ -267,12 +485,24 @@ const (
 	PingVerb Verb = iota
 	StatsVerb
 	InfoVerb
+	HealthVerb
 )
 
 const (
-	InfoResponseType  = "io.nats.micro.v1.info_response"
-	PingResponseType  = "io.nats.micro.v1.ping_response"
-	StatsResponseType = "io.nats.micro.v1.stats_response"
+	InfoResponseType   = "io.nats.micro.v1.info_response"
+	PingResponseType   = "io.nats.micro.v1.ping_response"
+	StatsResponseType  = "io.nats.micro.v1.stats_response"
+	HealthResponseType = "io.nats.micro.v1.health_response"
+)
+
+// Statuses reported in [HealthStatus].
+const (
+	HealthStatusOK       = "ok"
+	HealthStatusDegraded = "degraded"
+
+	// HealthStatusUnknown is reported by [Discovery.Health] for instances
+	// which responded to PING but not to HEALTH.
+	HealthStatusUnknown = "unknown"
 )
 
 var (
@@ -287,11 +517,14 @@ var (
 	// ErrConfigValidation is returned when service configuration is invalid
 	ErrConfigValidation = errors.New("validation")
 
-	// ErrVerbNotSupported is returned when invalid [Verb] is used (PING, INFO, STATS)
+	// ErrVerbNotSupported is returned when invalid [Verb] is used (PING, INFO, STATS, HEALTH)
 	ErrVerbNotSupported = errors.New("unsupported verb")
 
 	// ErrServiceNameRequired is returned when attempting to generate control subject with ID but empty name
 	ErrServiceNameRequired = errors.New("service name is required to generate ID control subject")
+
+	// ErrServiceStopped is returned when attempting to reconfigure a stopped service
+	ErrServiceStopped = errors.New("service is stopped")
 )
 
 func (s Verb) String() string {
@@ -302,13 +535,15 @@ func (s Verb) String() string {
 		return "STATS"
 	case InfoVerb:
 		return "INFO"
+	case HealthVerb:
+		return "HEALTH"
 	default:
 		return ""
 	}
 }
 
 // AddService adds a microservice.
-// It will enable internal common services (PING, STATS and INFO).
+// It will enable internal common services (PING, STATS, INFO and HEALTH).
 // Request handlers have to be registered separately using Service.AddEndpoint.
 // A service name, version and Endpoint configuration are required to add a service.
 // AddService returns a [Service] interface, allowing service management.
@@ -321,6 +556,9 @@ func AddService(nc *nats.Conn, config Config) (Service, error) {
 	if config.Metadata == nil {
 		config.Metadata = map[string]string{}
 	}
+	if config.clock == nil {
+		config.clock = systemClock{}
+	}
 
 	id := nuid.Next()
 	svc := &service{
@@ -332,6 +570,7 @@ func AddService(nc *nats.Conn, config Config) (Service, error) {
 		},
 		verbSubs:  make(map[string]*nats.Subscription),
 		endpoints: make([]*Endpoint, 0),
+		done:      make(chan struct{}),
 	}
 
 	// Add connection event (closed, error) wrapper handlers. If the service has
@@ -340,30 +579,24 @@ func AddService(nc *nats.Conn, config Config) (Service, error) {
 	go svc.asyncDispatcher.run()
 	svc.wrapConnectionEventCallbacks()
 
-	if config.Endpoint != nil {
-		opts := []EndpointOpt{WithEndpointSubject(config.Endpoint.Subject)}
-		if config.Endpoint.Metadata != nil {
-			opts = append(opts, WithEndpointMetadata(config.Endpoint.Metadata))
-		}
-		if config.Endpoint.QueueGroup != "" {
-			opts = append(opts, WithEndpointQueueGroup(config.Endpoint.QueueGroup))
-		} else if config.QueueGroup != "" {
-			opts = append(opts, WithEndpointQueueGroup(config.QueueGroup))
-		}
-		if err := svc.AddEndpoint("default", config.Endpoint.Handler, opts...); err != nil {
+	for _, name := range config.endpointNames() {
+		cfg := config.endpointConfig(name)
+		cfg.QueueGroup = queueGroupName(cfg.QueueGroup, config.queueGroup())
+		if _, err := svc.addConfigEndpoint(name, cfg, endpointOpts{logSampling: 1}, nil); err != nil {
 			return nil, err
 		}
 	}
 
-	// Setup internal subscriptions.
-	pingResponse := Ping{
-		ServiceIdentity: svc.serviceIdentity(),
-		Type:            PingResponseType,
+	if config.DefaultHandler != nil {
+		if err := svc.addDefaultHandler(); err != nil {
+			svc.asyncDispatcher.close()
+			return nil, err
+		}
 	}
 
-	handleVerb := func(verb Verb, valuef func() any) func(req Request) {
+	handleVerb := func(verb Verb, valuef func(Request) any) func(req Request) {
 		return func(req Request) {
-			response, _ := json.Marshal(valuef())
+			response, _ := json.Marshal(valuef(req))
 			if err := req.Respond(response); err != nil {
 				if err := req.Error("500", fmt.Sprintf("Error handling %s request: %s", verb, err), nil); err != nil && config.ErrorHandler != nil {
 					svc.asyncDispatcher.push(func() { config.ErrorHandler(svc, &NATSError{req.Subject(), err.Error()}) })
@@ -372,10 +605,11 @@ func AddService(nc *nats.Conn, config Config) (Service, error) {
 		}
 	}
 
-	for verb, source := range map[Verb]func() any{
-		InfoVerb:  func() any { return svc.Info() },
-		PingVerb:  func() any { return pingResponse },
-		StatsVerb: func() any { return svc.Stats() },
+	for verb, source := range map[Verb]func(Request) any{
+		InfoVerb:   func(Request) any { return svc.Info() },
+		PingVerb:   func(Request) any { return svc.ping() },
+		StatsVerb:  func(req Request) any { return svc.statsAndReset(req) },
+		HealthVerb: func(Request) any { return svc.health() },
 	} {
 		handler := handleVerb(verb, source)
 		if err := svc.addVerbHandlers(nc, verb, handler); err != nil {
@@ -384,55 +618,196 @@ func AddService(nc *nats.Conn, config Config) (Service, error) {
 		}
 	}
 
-	svc.started = time.Now().UTC()
+	svc.started = svc.clock.Now().UTC()
+	if config.Context != nil {
+		go svc.stopOnContextDone(config.Context)
+	}
+	if config.StatsPushInterval > 0 {
+		go svc.pushStats(config.StatsPushSubject, config.StatsPushInterval)
+	}
 	return svc, nil
 }
 
+// addDefaultHandler subscribes to the default subject, passing requests
+// which do not match the subject of any endpoint to the default handler.
+// Requests matching an endpoint are ignored, as they are also received by
+// the endpoint subscription.
+func (s *service) addDefaultHandler() error {
+	subject := s.DefaultSubject
+	if s.SubjectTransformer != nil {
+		subject = s.SubjectTransformer(subject)
+		if subject == "" || !subjectRegexp.MatchString(subject) {
+			return fmt.Errorf("%w: invalid transformed default subject %q", ErrConfigValidation, subject)
+		}
+	}
+	// The server picks a single member of a queue group among all matching
+	// subscriptions, regardless of their subject, so a separate queue group
+	// is used to also receive requests handled by endpoints.
+	queueGroup := queueGroupName("", s.Config.queueGroup()) + "_default"
+	sub, err := s.nc.QueueSubscribe(subject, queueGroup, func(m *nats.Msg) {
+		s.m.Lock()
+		for _, e := range s.endpoints {
+			if matchEndpointSubject(e.subscription.Subject, m.Subject) {
+				s.m.Unlock()
+				return
+			}
+		}
+		s.numUnmatched++
+		s.m.Unlock()
+		s.DefaultHandler.Handle(&request{msg: m, nc: s.nc})
+	})
+	if err != nil {
+		return err
+	}
+	s.m.Lock()
+	s.verbSubs["default"] = sub
+	s.m.Unlock()
+	return nil
+}
+
+// pushStats publishes the service stats on subject every interval.
+// It returns when the service is stopped.
+func (s *service) pushStats(subject string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			stats, _ := json.Marshal(s.Stats())
+			if err := s.nc.Publish(subject, stats); err != nil && s.Config.ErrorHandler != nil {
+				s.m.Lock()
+				// the dispatcher is closed once the service is stopped
+				if !s.stopped {
+					s.asyncDispatcher.push(func() { s.Config.ErrorHandler(s, &NATSError{subject, err.Error()}) })
+				}
+				s.m.Unlock()
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// stopOnContextDone stops the service once the context is done.
+// It returns when the service is stopped.
+func (s *service) stopOnContextDone(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+		if err := s.Stop(); err != nil && s.Config.ErrorHandler != nil {
+			s.Config.ErrorHandler(s, &NATSError{Description: fmt.Sprintf("stopping service: %s", err)})
+		}
+	case <-s.done:
+	}
+}
+
+// AddEndpointE registers endpoint with given name using a handler
+// returning an error.
+func (s *service) AddEndpointE(name string, handler HandlerFuncE, opts ...EndpointOpt) error {
+	return s.AddEndpoint(name, handler, opts...)
+}
+
 func (s *service) AddEndpoint(name string, handler Handler, opts ...EndpointOpt) error {
-	var options endpointOpts
+	options := endpointOpts{logSampling: 1}
 	for _, opt := range opts {
 		if err := opt(&options); err != nil {
 			return err
 		}
 	}
-	subject := name
-	if options.subject != "" {
-		subject = options.subject
+	if options.subject == "" {
+		options.subject = name
 	}
-	queueGroup := queueGroupName(options.queueGroup, s.Config.QueueGroup)
-	return addEndpoint(s, name, subject, handler, options.metadata, queueGroup)
+	options.queueGroup = queueGroupName(options.queueGroup, s.Config.queueGroup())
+	_, err := addEndpoint(s, name, handler, options, nil)
+	return err
 }
 
-func addEndpoint(s *service, name, subject string, handler Handler, metadata map[string]string, queueGroup string) error {
-	if !nameRegexp.MatchString(name) {
-		return fmt.Errorf("%w: invalid endpoint name", ErrConfigValidation)
+// addConfigEndpoint registers an endpoint of the service Config, using the
+// subject, resolved queue group and metadata of cfg and the other options
+// of opts.
+func (s *service) addConfigEndpoint(name string, cfg EndpointConfig, opts endpointOpts, groups []string) (*Endpoint, error) {
+	opts.subject = cfg.Subject
+	if opts.subject == "" {
+		opts.subject = name
+	}
+	opts.queueGroup = cfg.QueueGroup
+	opts.metadata = cfg.Metadata
+	e, err := addEndpoint(s, name, cfg.Handler, opts, groups)
+	if err != nil {
+		return nil, err
 	}
-	if !subjectRegexp.MatchString(subject) {
-		return fmt.Errorf("%w: invalid endpoint subject", ErrConfigValidation)
+	s.m.Lock()
+	e.configured = true
+	s.m.Unlock()
+	return e, nil
+}
+
+// options returns the options the endpoint was registered with, other than
+// its subject, queue group and metadata.
+func (e *Endpoint) options() endpointOpts {
+	compressMin := e.compressMin
+	return endpointOpts{
+		jsonEncoder: e.jsonEncoder,
+		validator:   e.validator,
+		schema:      e.schema,
+		timeout:     e.timeout,
+		advertised:  e.advertised,
+		logSampling: e.logSampling,
+		compression: &compressMin,
 	}
-	if !subjectRegexp.MatchString(queueGroup) {
-		return fmt.Errorf("%w: invalid endpoint queue group", ErrConfigValidation)
+}
+
+// compressMin returns the compression threshold of an endpoint.
+func (s *service) compressMin(options endpointOpts) int {
+	if options.compression != nil {
+		return *options.compression
+	}
+	return s.Config.CompressionThreshold
+}
+
+// addEndpoint registers an endpoint using the subject, queue group and
+// metadata of opts as is, so they have to be resolved by the caller.
+func addEndpoint(s *service, name string, handler Handler, opts endpointOpts, groups []string) (*Endpoint, error) {
+	subject, queueGroup := opts.subject, opts.queueGroup
+	if errs := endpointValidationErrors(name, subject, queueGroup, s.SubjectTransformer); len(errs) > 0 {
+		return nil, errs[0]
+	}
+	subscribeSubject := subject
+	if s.SubjectTransformer != nil {
+		subscribeSubject = s.SubjectTransformer(subject)
 	}
 	endpoint := &Endpoint{
 		service: s,
 		EndpointConfig: EndpointConfig{
 			Subject:    subject,
 			Handler:    handler,
-			Metadata:   metadata,
+			Metadata:   opts.metadata,
 			QueueGroup: queueGroup,
 		},
-		Name: name,
-	}
+		Name:        name,
+		jsonEncoder: opts.jsonEncoder,
+		validator:   opts.validator,
+		schema:      opts.schema,
+		timeout:     opts.timeout,
+		advertised:  opts.advertised,
+		groups:      groups,
+		logSampling: opts.logSampling,
+		compressMin: s.compressMin(opts),
+	}
+	endpoint.handler.Store(&handler)
 
 	sub, err := s.nc.QueueSubscribe(
-		subject,
+		subscribeSubject,
 		queueGroup,
 		func(m *nats.Msg) {
-			s.reqHandler(endpoint, &request{msg: m})
+			// Requests targeted at another queue group are handled by its members.
+			if group := m.Header.Get(nats.RequestGroupHeader); group != "" && group != queueGroup {
+				return
+			}
+			s.reqHandler(endpoint, &request{msg: m, nc: s.nc, jsonEncoder: endpoint.jsonEncoder, compressMin: endpoint.compressMin})
 		},
 	)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	s.m.Lock()
 	endpoint.subscription = sub
@@ -443,7 +818,47 @@ func addEndpoint(s *service, name, subject string, handler Handler, metadata map
 		QueueGroup: queueGroup,
 	}
 	s.m.Unlock()
-	return nil
+	return endpoint, nil
+}
+
+// endpointValidationErrors returns all the problems with the name, subject
+// and queue group of an endpoint.
+func endpointValidationErrors(name, subject, queueGroup string, transformer func(string) string) []error {
+	var errs []error
+	if !nameRegexp.MatchString(name) {
+		errs = append(errs, fmt.Errorf("%w: invalid endpoint name", ErrConfigValidation))
+	}
+	if !subjectRegexp.MatchString(subject) {
+		errs = append(errs, fmt.Errorf("%w: invalid endpoint subject", ErrConfigValidation))
+	} else if transformer != nil {
+		if transformed := transformer(subject); transformed == "" || !subjectRegexp.MatchString(transformed) {
+			errs = append(errs, fmt.Errorf("%w: invalid transformed endpoint subject %q", ErrConfigValidation, transformed))
+		}
+	}
+	if !subjectRegexp.MatchString(queueGroup) {
+		errs = append(errs, fmt.Errorf("%w: invalid endpoint queue group", ErrConfigValidation))
+	}
+	return errs
+}
+
+// ValidateConfig performs the validation of cfg done by [AddService],
+// including the endpoints set in the config, without requiring a
+// connection. All problems found are returned, joined using [errors.Join],
+// each of them wrapping [ErrConfigValidation].
+func ValidateConfig(cfg Config) error {
+	errs := cfg.validationErrors()
+	for _, name := range cfg.endpointNames() {
+		ep := cfg.endpointConfig(name)
+		subject := ep.Subject
+		if subject == "" {
+			subject = name
+		}
+		queueGroup := queueGroupName(ep.QueueGroup, cfg.queueGroup())
+		for _, err := range endpointValidationErrors(name, subject, queueGroup, cfg.SubjectTransformer) {
+			errs = append(errs, fmt.Errorf("endpoint %q: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
 }
 
 func (s *service) AddGroup(name string, opts ...GroupOpt) Group {
@@ -451,11 +866,17 @@ func (s *service) AddGroup(name string, opts ...GroupOpt) Group {
 	for _, opt := range opts {
 		opt(&o)
 	}
-	queueGroup := queueGroupName(o.queueGroup, s.Config.QueueGroup)
+	queueGroup := queueGroupName(o.queueGroup, s.Config.queueGroup())
+	var groups []string
+	if name != "" {
+		groups = []string{name}
+	}
 	return &group{
 		service:    s,
 		prefix:     name,
 		queueGroup: queueGroup,
+		metadata:   mergeMetadata(nil, o.metadata),
+		groups:     groups,
 	}
 }
 
@@ -480,17 +901,47 @@ func (ac *asyncCallbacksHandler) close() {
 }
 
 func (c *Config) valid() error {
+	if errs := c.validationErrors(); len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// validationErrors returns all the problems found in the config, in the
+// order they are checked. Endpoints are checked when they are added.
+func (c *Config) validationErrors() []error {
+	var errs []error
 	if !nameRegexp.MatchString(c.Name) {
-		return fmt.Errorf("%w: service name: name should not be empty and should consist of alphanumerical characters, dashes and underscores", ErrConfigValidation)
+		errs = append(errs, fmt.Errorf("%w: service name: name should not be empty and should consist of alphanumerical characters, dashes and underscores", ErrConfigValidation))
 	}
 	if !semVerRegexp.MatchString(c.Version) {
-		return fmt.Errorf("%w: version: version should not be empty should match the SemVer format", ErrConfigValidation)
+		errs = append(errs, fmt.Errorf("%w: version: version should not be empty should match the SemVer format", ErrConfigValidation))
 	}
 	if c.QueueGroup != "" && !subjectRegexp.MatchString(c.QueueGroup) {
-		return fmt.Errorf("%w: queue group: invalid queue group name", ErrConfigValidation)
+		errs = append(errs, fmt.Errorf("%w: queue group: invalid queue group name", ErrConfigValidation))
 	}
-
-	return nil
+	if _, ok := c.Endpoints["default"]; ok && c.Endpoint != nil {
+		errs = append(errs, fmt.Errorf("%w: endpoints: %q endpoint is already configured by Endpoint", ErrConfigValidation, "default"))
+	}
+	if c.MonitoringResponseJitter < 0 {
+		errs = append(errs, fmt.Errorf("%w: monitoring response jitter: jitter cannot be negative", ErrConfigValidation))
+	}
+	if c.DefaultHandler != nil && (c.DefaultSubject == "" || !subjectRegexp.MatchString(c.DefaultSubject)) {
+		errs = append(errs, fmt.Errorf("%w: default subject: invalid subject", ErrConfigValidation))
+	}
+	if c.DefaultSubject != "" && c.DefaultHandler == nil {
+		errs = append(errs, fmt.Errorf("%w: default handler: handler is required with a default subject", ErrConfigValidation))
+	}
+	if c.CompressionThreshold < 0 {
+		errs = append(errs, fmt.Errorf("%w: compression threshold: threshold cannot be negative", ErrConfigValidation))
+	}
+	if c.StatsPushInterval < 0 {
+		errs = append(errs, fmt.Errorf("%w: stats push interval: interval cannot be negative", ErrConfigValidation))
+	}
+	if c.StatsPushInterval > 0 && (c.StatsPushSubject == "" || strings.ContainsAny(c.StatsPushSubject, " *>")) {
+		errs = append(errs, fmt.Errorf("%w: stats push subject: invalid subject", ErrConfigValidation))
+	}
+	return errs
 }
 
 func (s *service) wrapConnectionEventCallbacks() {
@@ -530,8 +981,14 @@ func (s *service) wrapConnectionEventCallbacks() {
 			if endpoint != nil {
 				endpoint.stats.NumErrors++
 				endpoint.stats.LastError = err.Error()
+				endpoint.stats.LastErrorTime = s.clock.Now()
 			}
 			s.m.Unlock()
+			// A single endpoint not being permitted should not stop the service.
+			if errors.Is(err, nats.ErrPermissionViolation) {
+				s.natsHandlers.asyncErr(c, sub, err)
+				return
+			}
 			if stopErr := s.Stop(); stopErr != nil {
 				s.natsHandlers.asyncErr(c, sub, errors.Join(err, fmt.Errorf("stopping service: %w", stopErr)))
 			} else {
@@ -557,8 +1014,13 @@ func (s *service) wrapConnectionEventCallbacks() {
 			if endpoint != nil {
 				endpoint.stats.NumErrors++
 				endpoint.stats.LastError = err.Error()
+				endpoint.stats.LastErrorTime = s.clock.Now()
 			}
 			s.m.Unlock()
+			// A single endpoint not being permitted should not stop the service.
+			if errors.Is(err, nats.ErrPermissionViolation) {
+				return
+			}
 			s.Stop()
 		})
 	}
@@ -578,7 +1040,7 @@ func (s *service) matchSubscriptionSubject(subj string) (*Endpoint, bool) {
 		}
 	}
 	for _, e := range s.endpoints {
-		if matchEndpointSubject(e.Subject, subj) {
+		if matchEndpointSubject(e.subscription.Subject, subj) {
 			return e, true
 		}
 	}
@@ -628,8 +1090,23 @@ func (s *service) addInternalHandler(nc *nats.Conn, verb Verb, kind, id, name st
 		return err
 	}
 
+	jitter := s.Config.MonitoringResponseJitter
 	s.verbSubs[name], err = nc.Subscribe(subj, func(msg *nats.Msg) {
-		handler(&request{msg: msg})
+		req := &request{msg: msg, nc: nc}
+		// Only broadcast requests are delayed, without
+		// blocking the delivery of subsequent requests.
+		if id != "" || jitter <= 0 {
+			handler(req)
+			return
+		}
+		time.AfterFunc(time.Duration(rand.Int63n(int64(jitter))), func() {
+			s.m.Lock()
+			stopped := s.stopped
+			s.m.Unlock()
+			if !stopped {
+				handler(req)
+			}
+		})
 	})
 	if err != nil {
 		if stopErr := s.Stop(); stopErr != nil {
@@ -640,21 +1117,114 @@ func (s *service) addInternalHandler(nc *nats.Conn, verb Verb, kind, id, name st
 	return nil
 }
 
-// reqHandler invokes the service request handler and modifies service stats
+// reqHandler validates the request, invokes the service request handler
+// and modifies service stats
 func (s *service) reqHandler(endpoint *Endpoint, req *request) {
-	start := time.Now()
-	endpoint.Handler.Handle(req)
+	s.inFlight.Add(1)
+	defer s.requestDone()
+	start := s.clock.Now()
+	validator := endpoint.validator
+	if validator == nil {
+		validator = s.Config.Validator
+	}
+	var validationErr *ServiceError
+	var timedOut bool
+	if validator != nil {
+		validationErr = validator(req)
+	}
+	if validationErr == nil && endpoint.schema != nil {
+		if err := endpoint.schema.validate(req.Data()); err != nil {
+			validationErr = &ServiceError{Code: "400", Description: "request validation failed", Data: []byte(err.Error())}
+		}
+	}
+	if validationErr != nil {
+		if err := req.Error(validationErr.Code, validationErr.Description, validationErr.Data); err != nil && req.respondError == nil {
+			req.respondError = err
+		}
+	} else if endpoint.timeout > 0 {
+		timedOut = s.handleWithTimeout(endpoint, req)
+	} else {
+		(*endpoint.handler.Load()).Handle(req)
+	}
+	processingTime := s.clock.Now().Sub(start)
 	s.m.Lock()
 	endpoint.stats.NumRequests++
-	endpoint.stats.ProcessingTime += time.Since(start)
+	endpoint.stats.ProcessingTime += processingTime
 	avgProcessingTime := endpoint.stats.ProcessingTime.Nanoseconds() / int64(endpoint.stats.NumRequests)
 	endpoint.stats.AverageProcessingTime = time.Duration(avgProcessingTime)
+	endpoint.stats.NumExtraResponses += req.extraResponses
+	if timedOut {
+		endpoint.stats.NumTimeouts++
+	}
 
 	if req.respondError != nil {
 		endpoint.stats.NumErrors++
 		endpoint.stats.LastError = req.respondError.Error()
+		endpoint.stats.LastErrorTime = s.clock.Now()
 	}
 	s.m.Unlock()
+
+	if s.Config.RequestObserver != nil && (req.respondError != nil || endpoint.sampled()) {
+		s.Config.RequestObserver(s, RequestLog{
+			Endpoint:       endpoint.Name,
+			Subject:        req.Subject(),
+			ProcessingTime: processingTime,
+			Err:            req.respondError,
+		})
+	}
+}
+
+// requestDone marks a request as no longer in flight, reporting drain
+// progress if the service is being drained.
+func (s *service) requestDone() {
+	n := int(s.inFlight.Add(-1))
+	if !s.draining.Load() || s.DrainProgressHandler == nil {
+		return
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	// the dispatcher is closed once the service is stopped
+	if !s.stopped {
+		s.asyncDispatcher.push(func() { s.DrainProgressHandler(s, n) })
+	}
+}
+
+// handleWithTimeout invokes the endpoint handler and waits for it to return
+// for up to the endpoint handler timeout. If the handler has not responded
+// by then, the request context is canceled, a "504" error response is sent
+// on its behalf and any later response from the handler fails with
+// [ErrHandlerTimeout].
+// It reports whether the handler timed out.
+func (s *service) handleWithTimeout(endpoint *Endpoint, req *request) bool {
+	req.deadline = &handlerDeadline{}
+	ctx, cancel := context.WithTimeout(context.Background(), endpoint.timeout)
+	defer cancel()
+	req.ctx = ctx
+	handler := *endpoint.handler.Load()
+	done := make(chan struct{})
+	// A handler which does not return is abandoned, not stopped,
+	// but can observe the cancellation through the request context.
+	go func() {
+		defer close(done)
+		handler.Handle(req)
+	}()
+
+	select {
+	case <-done:
+		return false
+	case <-ctx.Done():
+	}
+
+	req.deadline.Lock()
+	defer req.deadline.Unlock()
+	req.deadline.expired = true
+	if req.responded || req.respondError != nil {
+		return false
+	}
+	if err := req.error("504", "handler timeout", nil); err != nil {
+		req.respondError = err
+	}
+	return true
 }
 
 // Stop drains the endpoint subscriptions and marks the service as stopped.
@@ -664,7 +1234,9 @@ func (s *service) Stop() error {
 	if s.stopped {
 		return nil
 	}
-	for _, e := range s.endpoints {
+	// stopping an endpoint removes it from s.endpoints
+	endpoints := append([]*Endpoint(nil), s.endpoints...)
+	for _, e := range endpoints {
 		if err := e.stop(); err != nil {
 			return err
 		}
@@ -681,6 +1253,7 @@ func (s *service) Stop() error {
 	}
 	unwrapConnectionEventCallbacks(s.nc, s.natsHandlers)
 	s.stopped = true
+	close(s.done)
 	if s.DoneHandler != nil {
 		s.asyncDispatcher.push(func() { s.DoneHandler(s) })
 	}
@@ -688,6 +1261,162 @@ func (s *service) Stop() error {
 	return nil
 }
 
+// Reconfigure replaces the service version, description, metadata, queue
+// group and endpoints with the ones from cfg, preserving the service
+// identity. Endpoints of cfg (Endpoint, registered as "default", and
+// Endpoints) are matched by name with the endpoints registered from the
+// service config: new endpoints are added, endpoints missing from cfg are
+// stopped, and the handler and metadata of the others are updated in place.
+// Endpoints added using [Service.AddEndpoint] or [Service.AddGroup] are not
+// affected. Endpoints whose subject or queue group changed are subscribed
+// again before the previous subscription is drained, so that no requests
+// are missed. Endpoints options such as the validator or JSON encoder are
+// preserved.
+//
+// The service name cannot be changed. Endpoint handlers are taken from cfg,
+// but all config fields other than the ones listed above are kept from the
+// original config, including DoneHandler, ErrorHandler, StatsHandler and
+// Context. cfg is validated first, and the service is not modified if it is
+// invalid or if subscribing any of its endpoints fails.
+func (s *service) Reconfigure(cfg Config) error {
+	// Endpoints are subscribed using the subject transformer of the service.
+	cfg.SubjectTransformer = s.Config.SubjectTransformer
+	if err := ValidateConfig(cfg); err != nil {
+		return err
+	}
+	if cfg.Name != s.Config.Name {
+		return fmt.Errorf("%w: service name cannot be changed", ErrConfigValidation)
+	}
+	names := cfg.endpointNames()
+	configs := make([]EndpointConfig, 0, len(names))
+	for _, name := range names {
+		ec := cfg.endpointConfig(name)
+		if ec.Handler == nil {
+			return fmt.Errorf("%w: endpoint %q handler cannot be nil", ErrConfigValidation, name)
+		}
+		if ec.Subject == "" {
+			ec.Subject = name
+		}
+		ec.QueueGroup = queueGroupName(ec.QueueGroup, cfg.queueGroup())
+		configs = append(configs, ec)
+	}
+
+	s.reconfigure.Lock()
+	defer s.reconfigure.Unlock()
+
+	s.m.Lock()
+	if s.stopped {
+		s.m.Unlock()
+		return ErrServiceStopped
+	}
+	current := make(map[string]*Endpoint, len(s.endpoints))
+	for _, e := range s.endpoints {
+		if _, ok := current[e.Name]; !ok && e.configured && !e.drained {
+			current[e.Name] = e
+		}
+	}
+	s.m.Unlock()
+
+	// All new subscriptions are created before any endpoint is modified,
+	// so that the service is left unchanged if one of them fails.
+	var unchanged, added, replaced []*Endpoint
+	for i, name := range names {
+		ec := configs[i]
+		e, ok := current[name]
+		delete(current, name)
+		if ok && e.Subject == ec.Subject && e.QueueGroup == ec.QueueGroup {
+			unchanged = append(unchanged, e)
+			continue
+		}
+		opts := endpointOpts{logSampling: 1}
+		var groups []string
+		if ok {
+			opts, groups = e.options(), e.groups
+			replaced = append(replaced, e)
+		}
+		newEndpoint, err := s.addConfigEndpoint(name, ec, opts, groups)
+		if err != nil {
+			s.m.Lock()
+			for _, e := range added {
+				e.stop()
+			}
+			s.m.Unlock()
+			return err
+		}
+		added = append(added, newEndpoint)
+	}
+	for _, e := range current {
+		replaced = append(replaced, e)
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	for _, e := range unchanged {
+		ec := cfg.endpointConfig(e.Name)
+		handler := ec.Handler
+		e.handler.Store(&handler)
+		e.Handler = handler
+		e.Metadata = ec.Metadata
+	}
+	var errs []error
+	for _, e := range replaced {
+		if err := e.stop(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if cfg.Metadata == nil {
+		cfg.Metadata = map[string]string{}
+	}
+	s.Config.Endpoint = cfg.Endpoint
+	s.Config.Endpoints = cfg.Endpoints
+	s.Config.Version = cfg.Version
+	s.Config.Description = cfg.Description
+	s.Config.Metadata = cfg.Metadata
+	s.Config.QueueGroup = cfg.QueueGroup
+	s.Config.ServiceQueueGroup = cfg.ServiceQueueGroup
+	return errors.Join(errs...)
+}
+
+// queueGroup returns the queue group inherited by the service groups and
+// endpoints, or an empty string if [DefaultQueueGroup] should be used.
+func (c *Config) queueGroup() string {
+	if c.QueueGroup == "" && c.ServiceQueueGroup {
+		return DefaultQueueGroup + "." + c.Name
+	}
+	return c.QueueGroup
+}
+
+// endpointNames returns the names of the endpoints configured in c,
+// in the order they are added.
+func (c *Config) endpointNames() []string {
+	names := make([]string, 0, len(c.Endpoints))
+	for name := range c.Endpoints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if c.Endpoint != nil {
+		names = append([]string{"default"}, names...)
+	}
+	return names
+}
+
+// endpointConfig returns the configuration of the named endpoint.
+func (c *Config) endpointConfig(name string) EndpointConfig {
+	if name == "default" && c.Endpoint != nil {
+		return *c.Endpoint
+	}
+	return c.Endpoints[name]
+}
+
+func (s *service) ping() Ping {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return Ping{
+		ServiceIdentity: s.serviceIdentity(),
+		Type:            PingResponseType,
+	}
+}
+
 func (s *service) serviceIdentity() ServiceIdentity {
 	return ServiceIdentity{
 		Name:     s.Config.Name,
@@ -697,6 +1426,25 @@ func (s *service) serviceIdentity() ServiceIdentity {
 	}
 }
 
+func (s *service) health() HealthStatus {
+	s.m.Lock()
+	status := HealthStatus{
+		ServiceIdentity: s.serviceIdentity(),
+		Type:            HealthResponseType,
+		Status:          HealthStatusOK,
+	}
+	check := s.Config.HealthCheck
+	s.m.Unlock()
+
+	if check != nil {
+		if err := check(); err != nil {
+			status.Status = HealthStatusDegraded
+			status.Error = err.Error()
+		}
+	}
+	return status
+}
+
 // Info returns information about the service
 func (s *service) Info() Info {
 	s.m.Lock()
@@ -709,6 +1457,8 @@ func (s *service) Info() Info {
 			Subject:    e.Subject,
 			QueueGroup: e.QueueGroup,
 			Metadata:   e.Metadata,
+			Drained:    e.drained,
+			Timeout:    e.advertisedTimeout(),
 		})
 	}
 
@@ -730,6 +1480,8 @@ func (s *service) Stats() Stats {
 		Endpoints:       make([]*EndpointStats, 0),
 		Type:            StatsResponseType,
 		Started:         s.started,
+		Uptime:          s.clock.Now().Sub(s.started),
+		NumUnmatched:    s.numUnmatched,
 	}
 	for _, endpoint := range s.endpoints {
 		endpointStats := &EndpointStats{
@@ -739,6 +1491,10 @@ func (s *service) Stats() Stats {
 			NumRequests:           endpoint.stats.NumRequests,
 			NumErrors:             endpoint.stats.NumErrors,
 			LastError:             endpoint.stats.LastError,
+			LastErrorTime:         endpoint.stats.LastErrorTime,
+			NumExtraResponses:     endpoint.stats.NumExtraResponses,
+			NumTimeouts:           endpoint.stats.NumTimeouts,
+			Drained:               endpoint.drained,
 			ProcessingTime:        endpoint.stats.ProcessingTime,
 			AverageProcessingTime: endpoint.stats.AverageProcessingTime,
 		}
@@ -748,19 +1504,99 @@ func (s *service) Stats() Stats {
 		}
 		stats.Endpoints = append(stats.Endpoints, endpointStats)
 	}
+	if s.Config.GroupStats {
+		stats.Groups = s.groupStats()
+	}
 	return stats
 }
 
+// groupStats aggregates endpoint stats for each group, sorted by group name.
+// Average processing time is weighted by the number of requests handled
+// by each endpoint.
+// s.m lock should be held before calling this method
+func (s *service) groupStats() []*GroupStats {
+	groups := make(map[string]*GroupStats)
+	for _, endpoint := range s.endpoints {
+		for _, name := range endpoint.groups {
+			g, ok := groups[name]
+			if !ok {
+				g = &GroupStats{Name: name}
+				groups[name] = g
+			}
+			g.NumEndpoints++
+			g.NumRequests += endpoint.stats.NumRequests
+			g.NumErrors += endpoint.stats.NumErrors
+			g.ProcessingTime += endpoint.stats.ProcessingTime
+		}
+	}
+	res := make([]*GroupStats, 0, len(groups))
+	for _, g := range groups {
+		if g.NumRequests > 0 {
+			g.AverageProcessingTime = g.ProcessingTime / time.Duration(g.NumRequests)
+		}
+		res = append(res, g)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
 // Reset resets all statistics on a service instance.
 func (s *service) Reset() {
 	s.m.Lock()
 	for _, endpoint := range s.endpoints {
 		endpoint.reset()
 	}
-	s.started = time.Now().UTC()
+	s.numUnmatched = 0
+	s.started = s.clock.Now().UTC()
 	s.m.Unlock()
 }
 
+// statsAndReset returns the service stats and resets the stats of the
+// endpoints named in the StatsResetEndpointHeader of req, if any. Only
+// requests targeting this instance by ID reset stats, so that a single
+// request cannot reset the stats of all instances.
+func (s *service) statsAndReset(req Request) Stats {
+	stats := s.Stats()
+	name := req.Headers().Get(StatsResetEndpointHeader)
+	if name == "" || !strings.HasSuffix(req.Subject(), "."+s.id) {
+		return stats
+	}
+	s.m.Lock()
+	for _, e := range s.endpoints {
+		if e.Name == name {
+			e.reset()
+		}
+	}
+	s.m.Unlock()
+	return stats
+}
+
+// Endpoint returns the first endpoint registered with the given name.
+func (s *service) Endpoint(name string) (*Endpoint, bool) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	var drained *Endpoint
+	for _, e := range s.endpoints {
+		if e.Name != name {
+			continue
+		}
+		// prefer an endpoint re-added after being drained
+		if !e.drained {
+			return e, true
+		}
+		if drained == nil {
+			drained = e
+		}
+	}
+	return drained, drained != nil
+}
+
+// InFlight returns the number of requests currently being handled by the
+// service endpoints.
+func (s *service) InFlight() int {
+	return int(s.inFlight.Load())
+}
+
 // Stopped informs whether [Stop] was executed on the service.
 func (s *service) Stopped() bool {
 	s.m.Lock()
@@ -772,8 +1608,14 @@ func (e *NATSError) Error() string {
 	return fmt.Sprintf("%q: %s", e.Subject, e.Description)
 }
 
+// AddEndpointE registers new endpoints on a service using a handler
+// returning an error.
+func (g *group) AddEndpointE(name string, handler HandlerFuncE, opts ...EndpointOpt) error {
+	return g.AddEndpoint(name, handler, opts...)
+}
+
 func (g *group) AddEndpoint(name string, handler Handler, opts ...EndpointOpt) error {
-	var options endpointOpts
+	options := endpointOpts{logSampling: 1}
 	for _, opt := range opts {
 		if err := opt(&options); err != nil {
 			return err
@@ -783,13 +1625,31 @@ func (g *group) AddEndpoint(name string, handler Handler, opts ...EndpointOpt) e
 	if options.subject != "" {
 		subject = options.subject
 	}
-	endpointSubject := fmt.Sprintf("%s.%s", g.prefix, subject)
+	options.subject = fmt.Sprintf("%s.%s", g.prefix, subject)
 	if g.prefix == "" {
-		endpointSubject = subject
+		options.subject = subject
 	}
-	queueGroup := queueGroupName(options.queueGroup, g.queueGroup)
+	options.queueGroup = queueGroupName(options.queueGroup, g.queueGroup)
+	options.metadata = mergeMetadata(g.metadata, options.metadata)
 
-	return addEndpoint(g.service, name, endpointSubject, handler, options.metadata, queueGroup)
+	_, err := addEndpoint(g.service, name, handler, options, g.groups)
+	return err
+}
+
+// mergeMetadata returns a copy of parent metadata, overridden by child
+// metadata. It returns nil if both are empty.
+func mergeMetadata(parent, child map[string]string) map[string]string {
+	if len(parent) == 0 && len(child) == 0 {
+		return nil
+	}
+	merged := make(map[string]string, len(parent)+len(child))
+	for k, v := range parent {
+		merged[k] = v
+	}
+	for k, v := range child {
+		merged[k] = v
+	}
+	return merged
 }
 
 func queueGroupName(customQG, parentQG string) string {
@@ -819,20 +1679,28 @@ func (g *group) AddGroup(name string, opts ...GroupOpt) Group {
 		parts = append(parts, name)
 	}
 	prefix := strings.Join(parts, ".")
+	groups := g.groups
+	if name != "" {
+		groups = append(groups[:len(groups):len(groups)], prefix)
+	}
 
 	return &group{
 		service:    g.service,
 		prefix:     prefix,
 		queueGroup: queueGroup,
+		metadata:   mergeMetadata(g.metadata, o.metadata),
+		groups:     groups,
 	}
 }
 
 func (e *Endpoint) stop() error {
-	if err := e.subscription.Drain(); err != nil {
-		return fmt.Errorf("draining subscription for request handler: %w", err)
+	if !e.drained {
+		if err := e.subscription.Drain(); err != nil {
+			return fmt.Errorf("draining subscription for request handler: %w", err)
+		}
 	}
 	for i := 0; i < len(e.service.endpoints); i++ {
-		if e.service.endpoints[i].Subject == e.Subject {
+		if e.service.endpoints[i] == e {
 			if i != len(e.service.endpoints)-1 {
 				e.service.endpoints = append(e.service.endpoints[:i], e.service.endpoints[i+1:]...)
 			} else {
@@ -844,15 +1712,93 @@ func (e *Endpoint) stop() error {
 	return nil
 }
 
+// Drain stops the endpoint from receiving new requests and waits until
+// requests already being processed are completed, up to the connection's
+// drain timeout. Other endpoints and monitoring subjects are not affected.
+// The endpoint is reported as drained in [Service.Info] and [Service.Stats]
+// until the service is stopped. A new endpoint with the same name can be
+// added to resume handling requests.
+func (e *Endpoint) Drain() error {
+	e.service.m.Lock()
+	if e.drained {
+		e.service.m.Unlock()
+		return nil
+	}
+	sub := e.subscription
+	e.service.m.Unlock()
+
+	closed := sub.StatusChanged(nats.SubscriptionClosed)
+	if err := sub.Drain(); err != nil {
+		return fmt.Errorf("draining subscription for request handler: %w", err)
+	}
+	e.service.m.Lock()
+	e.drained = true
+	e.service.m.Unlock()
+
+	select {
+	case <-closed:
+	case <-time.After(e.service.nc.Opts.DrainTimeout):
+		return fmt.Errorf("draining endpoint %q: %w", e.Name, nats.ErrDrainTimeout)
+	}
+	return nil
+}
+
+// SetHandler atomically replaces the handler used by the endpoint.
+// Requests received after the swap are processed by the new handler,
+// while requests already being processed complete using the old one.
+// The endpoint subscription and stats are not affected.
+// A nil handler is ignored.
+func (e *Endpoint) SetHandler(h Handler) {
+	if h == nil {
+		return
+	}
+	e.service.m.Lock()
+	e.Handler = h
+	e.service.m.Unlock()
+	e.handler.Store(&h)
+}
+
+// sampled reports whether the next request of the endpoint should be
+// reported to the request observer, so that the fraction of reported
+// requests matches the log sampling rate.
+func (e *Endpoint) sampled() bool {
+	if e.logSampling >= 1 {
+		return true
+	}
+	if e.logSampling <= 0 {
+		return false
+	}
+	n := e.logCount.Add(1)
+	return uint64(float64(n)*e.logSampling) != uint64(float64(n-1)*e.logSampling)
+}
+
+// advertisedTimeout returns the timeout advertised in the endpoint info,
+// defaulting to the handler timeout.
+func (e *Endpoint) advertisedTimeout() time.Duration {
+	if e.advertised > 0 {
+		return e.advertised
+	}
+	return e.timeout
+}
+
+// Reset resets the stats of the endpoint. Stats of other endpoints and
+// the service start time are not affected.
+func (e *Endpoint) Reset() {
+	e.service.m.Lock()
+	e.reset()
+	e.service.m.Unlock()
+}
+
 func (e *Endpoint) reset() {
 	e.stats = EndpointStats{
-		Name:    e.stats.Name,
-		Subject: e.stats.Subject,
+		Name:       e.stats.Name,
+		Subject:    e.stats.Subject,
+		QueueGroup: e.stats.QueueGroup,
 	}
 }
 
 // ControlSubject returns monitoring subjects used by the Service.
-// Providing a verb is mandatory (it should be one of Ping, Info or Stats).
+// Providing a verb is mandatory (it should be one of Ping, Info, Stats or Health).
 // Depending on whether kind and id are provided, ControlSubject will return one of the following:
 //   - verb only: subject used to monitor all available services
 //   - verb and kind: subject used to monitor services with the provided name
@@ -895,8 +1841,119 @@ func WithEndpointQueueGroup(queueGroup string) EndpointOpt {
 	}
 }
 
+// WithEndpointJSONEncoder sets a custom encoder used by [Request.RespondJSON]
+// for requests handled by the endpoint, e.g. to disable HTML escaping or
+// to indent responses. If not set, [json.Marshal] is used.
+func WithEndpointJSONEncoder(encoder func(any) ([]byte, error)) EndpointOpt {
+	return func(e *endpointOpts) error {
+		if encoder == nil {
+			return fmt.Errorf("%w: JSON encoder cannot be nil", ErrConfigValidation)
+		}
+		e.jsonEncoder = encoder
+		return nil
+	}
+}
+
+// WithEndpointValidator sets a validator invoked before the endpoint handler,
+// overriding [Config.Validator] for this endpoint.
+func WithEndpointValidator(validator RequestValidator) EndpointOpt {
+	return func(e *endpointOpts) error {
+		if validator == nil {
+			return fmt.Errorf("%w: validator cannot be nil", ErrConfigValidation)
+		}
+		e.validator = validator
+		return nil
+	}
+}
+
+// WithEndpointRequestValidation validates the payload of each request
+// against the provided JSON Schema, after the request validator (if any).
+// Requests which do not conform are rejected with a "400" error response
+// containing the validation error as the body, without invoking the
+// handler, and are counted in [EndpointStats.NumErrors].
+// The schema is compiled once, when the option is applied. The common
+// validation keywords are supported, while references ($ref) are not.
+func WithEndpointRequestValidation(schema string) EndpointOpt {
+	return func(e *endpointOpts) error {
+		compiled, err := compileSchema([]byte(schema))
+		if err != nil {
+			return fmt.Errorf("%w: invalid request schema: %s", ErrConfigValidation, err)
+		}
+		e.schema = compiled
+		return nil
+	}
+}
+
+// WithEndpointLogSampling sets the fraction of requests handled by the
+// endpoint which are reported to the [Config.RequestObserver], between 0
+// (none) and 1 (all, the default). Requests resulting in an error are
+// always reported. Sampling is deterministic: with a rate of 0.1, every
+// 10th request is reported.
+func WithEndpointLogSampling(rate float64) EndpointOpt {
+	return func(e *endpointOpts) error {
+		if rate < 0 || rate > 1 {
+			return fmt.Errorf("%w: log sampling rate must be between 0 and 1", ErrConfigValidation)
+		}
+		e.logSampling = rate
+		return nil
+	}
+}
+
+// WithEndpointTimeout advertises the maximum time the endpoint is expected
+// to take to process a request, in [EndpointInfo.Timeout]. The value is
+// informational, clients can use it to set the timeout of their requests.
+// To also enforce it, use [WithEndpointHandlerTimeout]. If not set, the
+// handler timeout is advertised, if any.
+func WithEndpointTimeout(timeout time.Duration) EndpointOpt {
+	return func(e *endpointOpts) error {
+		if timeout <= 0 {
+			return fmt.Errorf("%w: endpoint timeout must be greater than 0", ErrConfigValidation)
+		}
+		e.advertised = timeout
+		return nil
+	}
+}
+
+// WithEndpointHandlerTimeout sets the maximum time the endpoint handler
+// is given to respond to a request. If it expires, a "504" error response
+// is sent to the requester and counted in [EndpointStats.NumTimeouts].
+// The handler is not interrupted, but its subsequent responses fail with
+// [ErrHandlerTimeout].
+func WithEndpointHandlerTimeout(timeout time.Duration) EndpointOpt {
+	return func(e *endpointOpts) error {
+		if timeout <= 0 {
+			return fmt.Errorf("%w: handler timeout must be greater than 0", ErrConfigValidation)
+		}
+		e.timeout = timeout
+		return nil
+	}
+}
+
+// WithEndpointCompression overrides [Config.CompressionThreshold] for the
+// endpoint: responses of at least minSize bytes are gzip compressed for
+// requests accepting it. Compression is disabled for the endpoint if 0.
+func WithEndpointCompression(minSize int) EndpointOpt {
+	return func(e *endpointOpts) error {
+		if minSize < 0 {
+			return fmt.Errorf("%w: compression threshold cannot be negative", ErrConfigValidation)
+		}
+		e.compression = &minSize
+		return nil
+	}
+}
+
 func WithGroupQueueGroup(queueGroup string) GroupOpt {
 	return func(g *groupOpts) {
 		g.queueGroup = queueGroup
 	}
 }
+
+// WithGroupMetadata sets metadata inherited by all endpoints registered
+// under the group and its nested groups. Metadata of nested groups and
+// endpoints is merged with the group metadata, overriding values of
+// duplicate keys.
+func WithGroupMetadata(metadata map[string]string) GroupOpt {
+	return func(g *groupOpts) {
+		g.metadata = metadata
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package micro
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+type (
+	// ServiceSet groups services running in the same process, so that they
+	// can be shut down together, e.g. when handling SIGTERM.
+	ServiceSet struct {
+		m        sync.Mutex
+		services []Service
+		results  []ServiceDrainResult
+	}
+
+	// ServiceDrainResult describes how draining a single service of a
+	// [ServiceSet] went.
+	ServiceDrainResult struct {
+		ServiceIdentity
+		// Duration is the time it took to drain the service, or the time
+		// spent waiting for it if it did not finish in time.
+		Duration time.Duration
+		// Err is set if the service could not be drained in time.
+		Err error
+	}
+)
+
+// NewServiceSet creates a set containing the given services.
+func NewServiceSet(services ...Service) *ServiceSet {
+	return &ServiceSet{services: services}
+}
+
+// Add adds services to the set.
+func (ss *ServiceSet) Add(services ...Service) {
+	ss.m.Lock()
+	defer ss.m.Unlock()
+	ss.services = append(ss.services, services...)
+}
+
+// Services returns the services of the set.
+func (ss *ServiceSet) Services() []Service {
+	ss.m.Lock()
+	defer ss.m.Unlock()
+	return append([]Service(nil), ss.services...)
+}
+
+// DrainWithTimeout drains all services of the set concurrently: the
+// services stop receiving new requests and requests already being
+// processed are given until the shared deadline to complete. All services
+// are stopped once drained or once the deadline is exceeded.
+//
+// The returned error lists every service which did not finish draining in
+// time, each wrapping [nats.ErrDrainTimeout]. Per service drain durations
+// are available through [ServiceSet.DrainResults].
+func (ss *ServiceSet) DrainWithTimeout(timeout time.Duration) error {
+	services := ss.Services()
+	deadline := time.Now().Add(timeout)
+	results := make([]ServiceDrainResult, len(services))
+
+	var wg sync.WaitGroup
+	for i, svc := range services {
+		wg.Add(1)
+		go func(i int, svc Service) {
+			defer wg.Done()
+			start := time.Now()
+			err := drainService(svc, deadline)
+			results[i] = ServiceDrainResult{
+				ServiceIdentity: svc.Info().ServiceIdentity,
+				Duration:        time.Since(start),
+				Err:             err,
+			}
+		}(i, svc)
+	}
+	wg.Wait()
+
+	ss.m.Lock()
+	ss.results = results
+	ss.m.Unlock()
+
+	var errs []error
+	for _, res := range results {
+		if res.Err != nil {
+			errs = append(errs, fmt.Errorf("service %q (%s): %w", res.Name, res.ID, res.Err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// DrainResults returns the results of the last [ServiceSet.DrainWithTimeout]
+// call, in the order services were added to the set.
+func (ss *ServiceSet) DrainResults() []ServiceDrainResult {
+	ss.m.Lock()
+	defer ss.m.Unlock()
+	return append([]ServiceDrainResult(nil), ss.results...)
+}
+
+// drainService drains svc until the deadline and then stops it.
+// Services not created by AddService are only stopped.
+func drainService(svc Service, deadline time.Time) error {
+	var drainErr error
+	if s, ok := svc.(*service); ok {
+		drainErr = s.drain(deadline)
+	}
+	if err := svc.Stop(); err != nil {
+		return errors.Join(drainErr, err)
+	}
+	return drainErr
+}
+
+// drain drains the subscriptions of all endpoints and waits until requests
+// already being processed are completed, or until the deadline.
+func (s *service) drain(deadline time.Time) error {
+	s.m.Lock()
+	if s.stopped {
+		s.m.Unlock()
+		return nil
+	}
+	s.draining.Store(true)
+	if s.DrainProgressHandler != nil {
+		inFlight := s.InFlight()
+		s.asyncDispatcher.push(func() { s.DrainProgressHandler(s, inFlight) })
+	}
+	var closed []<-chan nats.SubStatus
+	for _, e := range s.endpoints {
+		if e.drained {
+			continue
+		}
+		closed = append(closed, e.subscription.StatusChanged(nats.SubscriptionClosed))
+		if err := e.subscription.Drain(); err != nil {
+			s.m.Unlock()
+			return fmt.Errorf("draining subscription for request handler: %w", err)
+		}
+		e.drained = true
+	}
+	s.m.Unlock()
+
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	for _, ch := range closed {
+		select {
+		case <-ch:
+		case <-timer.C:
+			return nats.ErrDrainTimeout
+		}
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package micro_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/micro"
+)
+
+func TestDiscoveryHealth(t *testing.T) {
+	s := RunServerOnPort(-1)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Expected to connect to server, got %v", err)
+	}
+	defer nc.Close()
+
+	expected := make(map[string]micro.HealthStatus)
+	for i, check := range []micro.HealthCheck{
+		nil,
+		func() error { return nil },
+		func() error { return errors.New("database unavailable") },
+	} {
+		svc, err := micro.AddService(nc, micro.Config{
+			Name:        "test_service",
+			Version:     "0.1.0",
+			HealthCheck: check,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer svc.Stop()
+		status := micro.HealthStatus{
+			ServiceIdentity: svc.Info().ServiceIdentity,
+			Type:            micro.HealthResponseType,
+			Status:          micro.HealthStatusOK,
+		}
+		if i == 2 {
+			status.Status = micro.HealthStatusDegraded
+			status.Error = "database unavailable"
+		}
+		expected[status.ID] = status
+	}
+
+	other, err := micro.AddService(nc, micro.Config{Name: "other_service", Version: "0.1.0"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer other.Stop()
+
+	// instance which does not support HEALTH
+	legacy := micro.ServiceIdentity{Name: "test_service", ID: "legacy", Version: "0.0.1"}
+	sub, err := nc.Subscribe("$SRV.PING.test_service", func(msg *nats.Msg) {
+		resp, _ := json.Marshal(micro.Ping{ServiceIdentity: legacy, Type: micro.PingResponseType})
+		msg.Respond(resp)
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer sub.Unsubscribe()
+	expected[legacy.ID] = micro.HealthStatus{
+		ServiceIdentity: legacy,
+		Type:            micro.HealthResponseType,
+		Status:          micro.HealthStatusUnknown,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	statuses, err := micro.NewDiscovery(nc).Health(ctx, "test_service")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Expected Health to return once context is done, took %v", elapsed)
+	}
+	if len(statuses) != len(expected) {
+		t.Fatalf("Expected %d statuses; got: %+v", len(expected), statuses)
+	}
+	for i, status := range statuses {
+		if i > 0 && statuses[i-1].ID > status.ID {
+			t.Fatalf("Expected statuses sorted by ID; got: %+v", statuses)
+		}
+		exp, ok := expected[status.ID]
+		if !ok {
+			t.Fatalf("Unexpected status: %+v", status)
+		}
+		if status.Name != exp.Name || status.Version != exp.Version || status.Type != exp.Type ||
+			status.Status != exp.Status || status.Error != exp.Error {
+			t.Fatalf("Invalid status; want: %+v; got: %+v", exp, status)
+		}
+	}
+
+	// all services, the legacy instance only responds to PING on
+	// the subject of test_service
+	statuses, err = micro.NewDiscovery(nc).Health(context.Background(), "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(statuses) != 4 {
+		t.Fatalf("Expected 4 statuses; got: %+v", statuses)
+	}
+	if statuses[len(statuses)-1].Name != "test_service" || statuses[0].Name != "other_service" {
+		t.Fatalf("Expected statuses sorted by name; got: %+v", statuses)
+	}
+}
+
+func TestDiscoveryVersions(t *testing.T) {
+	s := RunServerOnPort(-1)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Expected to connect to server, got %v", err)
+	}
+	defer nc.Close()
+
+	for _, version := range []string{"1.0.0", "1.1.0", "1.1.0", "1.1.0"} {
+		svc, err := micro.AddService(nc, micro.Config{Name: "test_service", Version: version})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer svc.Stop()
+	}
+	other, err := micro.AddService(nc, micro.Config{Name: "other_service", Version: "2.0.0"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer other.Stop()
+
+	discovery := micro.NewDiscovery(nc)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	versions, err := discovery.VersionReport(ctx, "test_service")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := map[string]int{"1.0.0": 1, "1.1.0": 3}; !reflect.DeepEqual(versions, expected) {
+		t.Fatalf("Invalid version report; want: %v; got: %v", expected, versions)
+	}
+
+	versions, err = discovery.VersionReport(context.Background(), "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := map[string]int{"1.0.0": 1, "1.1.0": 3, "2.0.0": 1}; !reflect.DeepEqual(versions, expected) {
+		t.Fatalf("Invalid version report; want: %v; got: %v", expected, versions)
+	}
+
+	infos, err := discovery.Info(context.Background(), "test_service")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(infos) != 4 {
+		t.Fatalf("Expected 4 instances; got: %d", len(infos))
+	}
+	for i, info := range infos {
+		if info.Name != "test_service" || info.Type != micro.InfoResponseType {
+			t.Fatalf("Invalid info: %+v", info)
+		}
+		if i > 0 && infos[i-1].ID > info.ID {
+			t.Fatalf("Expected instances sorted by ID")
+		}
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	stats, err := discovery.Stats(context.Background(), "other_service")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(stats) != 1 || stats[0].ID != other.Info().ID {
+		t.Fatalf("Invalid stats: %+v", stats)
+	}
+	if stats[0].Uptime < 10*time.Millisecond || stats[0].Uptime > time.Since(stats[0].Started)+time.Second {
+		t.Fatalf("Invalid uptime: %v (started %v)", stats[0].Uptime, stats[0].Started)
+	}
+}
+
+func TestDiscoveryListAll(t *testing.T) {
+	s := RunServerOnPort(-1)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Expected to connect to server, got %v", err)
+	}
+	defer nc.Close()
+
+	expected := make(map[string]string)
+	for _, name := range []string{"service_a", "service_b", "service_b", "service_c"} {
+		svc, err := micro.AddService(nc, micro.Config{
+			Name:    name,
+			Version: "1.0.0",
+			// responses are spread, but within the discovery window
+			MonitoringResponseJitter: 50 * time.Millisecond,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer svc.Stop()
+		expected[svc.Info().ID] = name
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	infos, err := micro.NewDiscovery(nc).ListAll(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(infos) != len(expected) {
+		t.Fatalf("Expected %d instances; got: %d", len(expected), len(infos))
+	}
+	for i, info := range infos {
+		if name, ok := expected[info.ID]; !ok || info.Name != name {
+			t.Fatalf("Unexpected instance: %+v", info)
+		}
+		if i > 0 {
+			prev := infos[i-1]
+			if prev.Name > info.Name || (prev.Name == info.Name && prev.ID > info.ID) {
+				t.Fatalf("Expected instances sorted by name and ID")
+			}
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package micro_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/micro"
+	"github.com/nats-io/nats.go/micro/httpmonitor"
+)
+
+func TestHTTPMonitor(t *testing.T) {
+	s := RunServerOnPort(-1)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Expected to connect to server, got %v", err)
+	}
+	defer nc.Close()
+
+	srv, err := micro.AddService(nc, micro.Config{
+		Name:    "test_service",
+		Version: "0.1.0",
+		Endpoint: &micro.EndpointConfig{
+			Subject: "test.func",
+			Handler: micro.HandlerFunc(func(r micro.Request) {
+				r.Respond([]byte("ok"))
+			}),
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer srv.Stop()
+
+	mon, err := httpmonitor.Start(srv, "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer mon.Close()
+
+	for i := 0; i < 3; i++ {
+		if _, err := nc.Request("test.func", nil, time.Second); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	get := func(path string, v any) int {
+		t.Helper()
+		resp, err := http.Get(fmt.Sprintf("http://%s%s", mon.Addr(), path))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if resp.StatusCode == http.StatusOK {
+			if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+				t.Fatalf("Unexpected content type: %q", ct)
+			}
+			if err := json.Unmarshal(body, v); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+		return resp.StatusCode
+	}
+
+	info := srv.Info()
+
+	var ping micro.Ping
+	if code := get("/ping", &ping); code != http.StatusOK {
+		t.Fatalf("Unexpected status code: %d", code)
+	}
+	expectedPing := micro.Ping{ServiceIdentity: info.ServiceIdentity, Type: micro.PingResponseType}
+	if !reflect.DeepEqual(ping, expectedPing) {
+		t.Fatalf("Invalid ping response; want: %+v; got: %+v", expectedPing, ping)
+	}
+
+	var httpInfo micro.Info
+	if code := get("/info", &httpInfo); code != http.StatusOK {
+		t.Fatalf("Unexpected status code: %d", code)
+	}
+	if !reflect.DeepEqual(httpInfo, info) {
+		t.Fatalf("Invalid info response; want: %+v; got: %+v", info, httpInfo)
+	}
+
+	var stats micro.Stats
+	if code := get("/stats", &stats); code != http.StatusOK {
+		t.Fatalf("Unexpected status code: %d", code)
+	}
+	if stats.Type != micro.StatsResponseType || stats.ID != info.ID {
+		t.Fatalf("Invalid stats response: %+v", stats)
+	}
+	if len(stats.Endpoints) != 1 || stats.Endpoints[0].NumRequests != 3 {
+		t.Fatalf("Invalid endpoint stats: %+v", stats.Endpoints)
+	}
+
+	if code := get("/unknown", nil); code != http.StatusNotFound {
+		t.Fatalf("Unexpected status code: %d", code)
+	}
+
+	if err := srv.Stop(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if code := get("/ping", nil); code != http.StatusServiceUnavailable {
+		t.Fatalf("Unexpected status code: %d", code)
+	}
+}
@@ -21,7 +21,9 @@ import (
 	"fmt"
 	"math/rand"
 	"reflect"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -653,6 +655,91 @@ func TestErrHandlerSubjectMatch(t *testing.T) {
 	}
 }
 
+func TestEndpointPermissionViolation(t *testing.T) {
+	opts := natsserver.DefaultTestOptions
+	opts.Port = -1
+	opts.Users = []*server.User{
+		{
+			Username: "svc",
+			Password: "pwd",
+			Permissions: &server.Permissions{
+				Subscribe: &server.SubjectPermission{Deny: []string{"forbidden"}},
+			},
+		},
+	}
+	s := RunServerWithOptions(&opts)
+	defer s.Shutdown()
+
+	asyncErrs := make(chan error, 10)
+	nc, err := nats.Connect(s.ClientURL(), nats.UserInfo("svc", "pwd"),
+		nats.ErrorHandler(func(_ *nats.Conn, _ *nats.Subscription, err error) {
+			asyncErrs <- err
+		}))
+	if err != nil {
+		t.Fatalf("Expected to connect to server, got %v", err)
+	}
+	defer nc.Close()
+
+	svcErrs := make(chan *micro.NATSError, 10)
+	srv, err := micro.AddService(nc, micro.Config{
+		Name:    "test_service",
+		Version: "0.1.0",
+		ErrorHandler: func(_ micro.Service, err *micro.NATSError) {
+			svcErrs <- err
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer srv.Stop()
+
+	handler := micro.HandlerFunc(func(req micro.Request) {
+		req.Respond([]byte("ok"))
+	})
+	if err := srv.AddEndpoint("allowed", handler); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := srv.AddEndpoint("forbidden", handler); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	select {
+	case err := <-svcErrs:
+		if err.Subject != "forbidden" {
+			t.Fatalf("Invalid error subject; want: %q; got: %q", "forbidden", err.Subject)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Expected service error callback")
+	}
+	select {
+	case err := <-asyncErrs:
+		if !errors.Is(err, nats.ErrPermissionViolation) {
+			t.Fatalf("Expected error: %v; got: %v", nats.ErrPermissionViolation, err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Expected async error callback")
+	}
+
+	if srv.Stopped() {
+		t.Fatalf("Expected service not to be stopped")
+	}
+	if nc.IsClosed() {
+		t.Fatalf("Expected connection not to be closed")
+	}
+	resp, err := nc.Request("allowed", nil, time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(resp.Data) != "ok" {
+		t.Fatalf("Invalid response; want: %q; got: %q", "ok", string(resp.Data))
+	}
+	for _, stats := range srv.Stats().Endpoints {
+		if stats.Name == "forbidden" && stats.NumErrors != 1 {
+			t.Fatalf("Expected 1 error on forbidden endpoint; got: %d", stats.NumErrors)
+		}
+	}
+}
+
 func TestGroups(t *testing.T) {
 	tests := []struct {
 		name             string
@@ -752,12 +839,74 @@ func TestGroups(t *testing.T) {
 				t.Fatalf("Expected 1 registered endpoint; got: %d", len(info.Endpoints))
 			}
 			if !reflect.DeepEqual(info.Endpoints[0], test.expectedEndpoint) {
-				t.Fatalf("Invalid endpoint; want: %s, got: %s", test.expectedEndpoint, info.Endpoints[0])
+				t.Fatalf("Invalid endpoint; want: %+v, got: %+v", test.expectedEndpoint, info.Endpoints[0])
 			}
 		})
 	}
 }
 
+func TestGroupMetadata(t *testing.T) {
+	s := RunServerOnPort(-1)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Expected to connect to server, got %v", err)
+	}
+	defer nc.Close()
+
+	srv, err := micro.AddService(nc, micro.Config{
+		Name:    "test_service",
+		Version: "0.0.1",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer srv.Stop()
+
+	handler := micro.HandlerFunc(func(r micro.Request) {})
+	outer := srv.AddGroup("outer", micro.WithGroupMetadata(map[string]string{
+		"team":  "payments",
+		"tier":  "outer",
+		"owner": "alice",
+	}))
+	inner := outer.AddGroup("inner", micro.WithGroupMetadata(map[string]string{
+		"tier": "inner",
+		"zone": "eu",
+	}))
+	if err := outer.AddEndpoint("outer_endpoint", handler); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := inner.AddEndpoint("inner_endpoint", handler); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := inner.AddEndpoint("override_endpoint", handler, micro.WithEndpointMetadata(map[string]string{
+		"zone":  "us",
+		"owner": "bob",
+	})); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := srv.AddGroup("plain").AddEndpoint("plain_endpoint", handler); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := map[string]map[string]string{
+		"outer_endpoint":    {"team": "payments", "tier": "outer", "owner": "alice"},
+		"inner_endpoint":    {"team": "payments", "tier": "inner", "owner": "alice", "zone": "eu"},
+		"override_endpoint": {"team": "payments", "tier": "inner", "owner": "bob", "zone": "us"},
+		"plain_endpoint":    nil,
+	}
+	info := srv.Info()
+	if len(info.Endpoints) != len(expected) {
+		t.Fatalf("Expected %d endpoints; got: %d", len(expected), len(info.Endpoints))
+	}
+	for _, e := range info.Endpoints {
+		if !reflect.DeepEqual(e.Metadata, expected[e.Name]) {
+			t.Fatalf("Invalid metadata for endpoint %q; want: %v; got: %v", e.Name, expected[e.Name], e.Metadata)
+		}
+	}
+}
+
 func TestMonitoringHandlers(t *testing.T) {
 	s := RunServerOnPort(-1)
 	defer s.Shutdown()
@@ -1077,144 +1226,2553 @@ func TestAddEndpoint_Concurrency(t *testing.T) {
 
 }
 
-func TestServiceStats(t *testing.T) {
-	handler := func(r micro.Request) {
-		r.Respond([]byte("ok"))
+func TestEndpointSetHandler(t *testing.T) {
+	s := RunServerOnPort(-1)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Expected to connect to server, got %v", err)
+	}
+	defer nc.Close()
+
+	srv, err := micro.AddService(nc, micro.Config{
+		Name:    "test_service",
+		Version: "0.1.0",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer srv.Stop()
+
+	if err := srv.AddEndpoint("rules", micro.HandlerFunc(func(req micro.Request) {
+		req.Respond([]byte("v1"))
+	})); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, ok := srv.Endpoint("missing"); ok {
+		t.Fatalf("Expected endpoint not to be found")
+	}
+	endpoint, ok := srv.Endpoint("rules")
+	if !ok {
+		t.Fatalf("Expected endpoint to be found")
+	}
+
+	const numRequests = 200
+	responses := make(chan string, numRequests)
+	errs := make(chan error, numRequests)
+	wg := sync.WaitGroup{}
+	for i := 0; i < numRequests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := nc.Request("rules", nil, 2*time.Second)
+			if err != nil {
+				errs <- err
+				return
+			}
+			responses <- string(resp.Data)
+		}()
+		if i == numRequests/2 {
+			endpoint.SetHandler(micro.HandlerFunc(func(req micro.Request) {
+				req.Respond([]byte("v2"))
+			}))
+		}
+	}
+	wg.Wait()
+	close(errs)
+	close(responses)
+
+	for err := range errs {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(responses) != numRequests {
+		t.Fatalf("Expected %d responses; got: %d", numRequests, len(responses))
+	}
+
+	// all requests after the swap should be handled by the new handler
+	resp, err := nc.Request("rules", nil, time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(resp.Data) != "v2" {
+		t.Fatalf("Expected response from new handler; got: %q", string(resp.Data))
+	}
+
+	stats := srv.Stats()
+	if len(stats.Endpoints) != 1 {
+		t.Fatalf("Expected 1 endpoint; got: %d", len(stats.Endpoints))
+	}
+	if stats.Endpoints[0].NumRequests != numRequests+1 {
+		t.Fatalf("Expected stats to be preserved across handler swap; want: %d; got: %d", numRequests+1, stats.Endpoints[0].NumRequests)
+	}
+}
+
+func TestEndpointJSONEncoder(t *testing.T) {
+	s := RunServerOnPort(-1)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Expected to connect to server, got %v", err)
+	}
+	defer nc.Close()
+
+	srv, err := micro.AddService(nc, micro.Config{
+		Name:    "test_service",
+		Version: "0.1.0",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
 	}
+	defer srv.Stop()
+
+	encoder := func(v any) ([]byte, error) {
+		buf := &bytes.Buffer{}
+		enc := json.NewEncoder(buf)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(v); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	handler := micro.HandlerFunc(func(req micro.Request) {
+		req.RespondJSON(map[string]string{"html": "<b>bold</b>"})
+	})
+	if err := srv.AddEndpoint("custom", handler, micro.WithEndpointJSONEncoder(encoder)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := srv.AddGroup("g").AddEndpoint("custom", handler, micro.WithEndpointJSONEncoder(encoder)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := srv.AddEndpoint("default", handler); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := srv.AddEndpoint("invalid", handler, micro.WithEndpointJSONEncoder(nil)); !errors.Is(err, micro.ErrConfigValidation) {
+		t.Fatalf("Expected error: %v; got: %v", micro.ErrConfigValidation, err)
+	}
+
 	tests := []struct {
-		name          string
-		config        micro.Config
-		expectedStats map[string]any
+		subject  string
+		expected string
+	}{
+		{"custom", "{\n  \"html\": \"<b>bold</b>\"\n}\n"},
+		{"g.custom", "{\n  \"html\": \"<b>bold</b>\"\n}\n"},
+		{"default", `{"html":"\u003cb\u003ebold\u003c/b\u003e"}`},
+	}
+	for _, test := range tests {
+		t.Run(test.subject, func(t *testing.T) {
+			resp, err := nc.Request(test.subject, nil, time.Second)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(resp.Data) != test.expected {
+				t.Fatalf("Invalid response; want: %q; got: %q", test.expected, string(resp.Data))
+			}
+		})
+	}
+}
+
+func TestRequestValidator(t *testing.T) {
+	s := RunServerOnPort(-1)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Expected to connect to server, got %v", err)
+	}
+	defer nc.Close()
+
+	requireData := func(req micro.Request) *micro.ServiceError {
+		if len(req.Data()) == 0 {
+			return &micro.ServiceError{Code: "400", Description: "empty request"}
+		}
+		return nil
+	}
+	var handled atomic.Int32
+	handler := micro.HandlerFunc(func(req micro.Request) {
+		handled.Add(1)
+		req.Respond([]byte("ok"))
+	})
+
+	srv, err := micro.AddService(nc, micro.Config{
+		Name:      "test_service",
+		Version:   "0.1.0",
+		Validator: requireData,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer srv.Stop()
+
+	if err := srv.AddEndpoint("service", handler); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := srv.AddEndpoint("endpoint", handler, micro.WithEndpointValidator(func(req micro.Request) *micro.ServiceError {
+		if req.Headers().Get("Auth") == "" {
+			return &micro.ServiceError{Code: "401", Description: "unauthorized"}
+		}
+		return nil
+	})); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := srv.AddEndpoint("invalid", handler, micro.WithEndpointValidator(nil)); !errors.Is(err, micro.ErrConfigValidation) {
+		t.Fatalf("Expected error: %v; got: %v", micro.ErrConfigValidation, err)
+	}
+
+	tests := []struct {
+		name         string
+		msg          *nats.Msg
+		expectedCode string
+		expectedDesc string
 	}{
 		{
-			name: "stats handler",
-			config: micro.Config{
-				Name:    "test_service",
-				Version: "0.1.0",
-			},
+			name:         "service validator fails",
+			msg:          nats.NewMsg("service"),
+			expectedCode: "400",
+			expectedDesc: "empty request",
 		},
 		{
-			name: "with stats handler",
-			config: micro.Config{
-				Name:    "test_service",
-				Version: "0.1.0",
-				StatsHandler: func(e *micro.Endpoint) any {
-					return map[string]any{
-						"key": "val",
-					}
-				},
-			},
-			expectedStats: map[string]any{
-				"key": "val",
-			},
+			name: "service validator passes",
+			msg:  &nats.Msg{Subject: "service", Data: []byte("data")},
 		},
 		{
-			name: "with default endpoint",
-			config: micro.Config{
-				Name:    "test_service",
-				Version: "0.1.0",
-				Endpoint: &micro.EndpointConfig{
-					Subject:  "test.func",
-					Handler:  micro.HandlerFunc(handler),
-					Metadata: map[string]string{"test": "value"},
-				},
-			},
+			name:         "endpoint validator fails",
+			msg:          &nats.Msg{Subject: "endpoint", Data: []byte("data")},
+			expectedCode: "401",
+			expectedDesc: "unauthorized",
+		},
+		{
+			name: "endpoint validator overrides service validator",
+			msg:  &nats.Msg{Subject: "endpoint", Header: nats.Header{"Auth": []string{"token"}}},
 		},
 	}
-
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			s := RunServerOnPort(-1)
-			defer s.Shutdown()
-
-			nc, err := nats.Connect(s.ClientURL())
-			if err != nil {
-				t.Fatalf("Expected to connect to server, got %v", err)
-			}
-			defer nc.Close()
-
-			srv, err := micro.AddService(nc, test.config)
+			handled.Store(0)
+			resp, err := nc.RequestMsg(test.msg, time.Second)
 			if err != nil {
 				t.Fatalf("Unexpected error: %v", err)
 			}
-			if test.config.Endpoint == nil {
-				opts := []micro.EndpointOpt{micro.WithEndpointSubject("test.func")}
-				if err := srv.AddEndpoint("func", micro.HandlerFunc(handler), opts...); err != nil {
-					t.Fatalf("Unexpected error: %v", err)
-				}
+			if code := resp.Header.Get(micro.ErrorCodeHeader); code != test.expectedCode {
+				t.Fatalf("Invalid error code; want: %q; got: %q", test.expectedCode, code)
 			}
-			defer srv.Stop()
-			for i := 0; i < 10; i++ {
-				if _, err := nc.Request("test.func", []byte("msg"), time.Second); err != nil {
-					t.Fatalf("Unexpected error: %v", err)
-				}
+			if desc := resp.Header.Get(micro.ErrorHeader); desc != test.expectedDesc {
+				t.Fatalf("Invalid error description; want: %q; got: %q", test.expectedDesc, desc)
+			}
+			expectedHandled := int32(1)
+			if test.expectedCode != "" {
+				expectedHandled = 0
+			}
+			if handled.Load() != expectedHandled {
+				t.Fatalf("Expected handler to be invoked %d times; got: %d", expectedHandled, handled.Load())
 			}
+		})
+	}
+
+	stats := srv.Stats()
+	for _, e := range stats.Endpoints {
+		if e.NumRequests != 2 || e.NumErrors != 1 {
+			t.Fatalf("Invalid stats for endpoint %q; want 2 requests and 1 error; got: %+v", e.Name, e)
+		}
+	}
+	if stats.Endpoints[1].LastError != "401:unauthorized" {
+		t.Fatalf("Invalid last error: %q", stats.Endpoints[1].LastError)
+	}
+}
+
+func TestEndpointRequestValidation(t *testing.T) {
+	s := RunServerOnPort(-1)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Expected to connect to server, got %v", err)
+	}
+	defer nc.Close()
+
+	schema := `{
+		"type": "object",
+		"properties": {
+			"name": {"type": "string", "minLength": 1},
+			"count": {"type": "integer", "minimum": 1, "maximum": 10},
+			"tags": {"type": "array", "items": {"enum": ["a", "b"]}}
+		},
+		"required": ["name"],
+		"additionalProperties": false
+	}`
+	var handled atomic.Int32
+	handler := micro.HandlerFunc(func(req micro.Request) {
+		handled.Add(1)
+		req.Respond([]byte("ok"))
+	})
+
+	srv, err := micro.AddService(nc, micro.Config{
+		Name:    "test_service",
+		Version: "0.1.0",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer srv.Stop()
+
+	if err := srv.AddEndpoint("items", handler, micro.WithEndpointRequestValidation(schema)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, invalid := range []string{`{"type": 1}`, `{"type": "unknown"}`, `{"$ref": "#/definitions/a"}`, `{"pattern": "("}`, `not json`} {
+		if err := srv.AddEndpoint("invalid", handler, micro.WithEndpointRequestValidation(invalid)); !errors.Is(err, micro.ErrConfigValidation) {
+			t.Fatalf("Expected error: %v for schema %s; got: %v", micro.ErrConfigValidation, invalid, err)
+		}
+	}
+
+	tests := []struct {
+		name          string
+		data          string
+		expectedError string
+	}{
+		{
+			name: "conforming request",
+			data: `{"name": "foo", "count": 3, "tags": ["a"]}`,
+		},
+		{
+			name: "only required properties",
+			data: `{"name": "foo"}`,
+		},
+		{
+			name:          "missing required property",
+			data:          `{"count": 3}`,
+			expectedError: `$: missing required property "name"`,
+		},
+		{
+			name:          "invalid type",
+			data:          `{"name": "foo", "count": 1.5}`,
+			expectedError: "$.count: expected integer, got number",
+		},
+		{
+			name:          "value out of range",
+			data:          `{"name": "foo", "count": 11}`,
+			expectedError: "$.count: expected a value <= 10, got 11",
+		},
+		{
+			name:          "invalid array item",
+			data:          `{"name": "foo", "tags": ["a", "c"]}`,
+			expectedError: "$.tags[1]: value is not one of the allowed values",
+		},
+		{
+			name:          "additional property",
+			data:          `{"name": "foo", "other": true}`,
+			expectedError: "$.other: not allowed",
+		},
+		{
+			name:          "invalid JSON",
+			data:          `{"name"`,
+			expectedError: "invalid JSON: unexpected end of JSON input",
+		},
+	}
+	var numErrors int
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handled.Store(0)
+			resp, err := nc.Request("items", []byte(test.data), time.Second)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if test.expectedError == "" {
+				if code := resp.Header.Get(micro.ErrorCodeHeader); code != "" {
+					t.Fatalf("Unexpected error response: %s: %s", code, resp.Data)
+				}
+				if handled.Load() != 1 {
+					t.Fatalf("Expected handler to be invoked once; got: %d", handled.Load())
+				}
+				return
+			}
+			numErrors++
+			if code := resp.Header.Get(micro.ErrorCodeHeader); code != "400" {
+				t.Fatalf("Invalid error code; want: %q; got: %q", "400", code)
+			}
+			if string(resp.Data) != test.expectedError {
+				t.Fatalf("Invalid validation error; want: %q; got: %q", test.expectedError, resp.Data)
+			}
+			if handled.Load() != 0 {
+				t.Fatalf("Expected handler not to be invoked; got: %d", handled.Load())
+			}
+		})
+	}
+
+	stats := srv.Stats().Endpoints[0]
+	if stats.NumRequests != len(tests) || stats.NumErrors != numErrors {
+		t.Fatalf("Invalid stats; want %d requests and %d errors; got: %+v", len(tests), numErrors, stats)
+	}
+}
+
+func TestEndpointHandlerTimeout(t *testing.T) {
+	s := RunServerOnPort(-1)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Expected to connect to server, got %v", err)
+	}
+	defer nc.Close()
+
+	release := make(chan struct{})
+	lateErr := make(chan error, 1)
+	srv, err := micro.AddService(nc, micro.Config{
+		Name:    "test_service",
+		Version: "0.1.0",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer srv.Stop()
+
+	if err := srv.AddEndpoint("slow", micro.HandlerFunc(func(req micro.Request) {
+		<-release
+		lateErr <- req.Respond([]byte("late"))
+	}), micro.WithEndpointHandlerTimeout(50*time.Millisecond)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := srv.AddEndpoint("fast", micro.HandlerFunc(func(req micro.Request) {
+		req.Respond([]byte("ok"))
+	}), micro.WithEndpointHandlerTimeout(time.Second)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	releaseE := make(chan struct{})
+	if err := srv.AddEndpoint("slow_error", micro.HandlerFuncE(func(micro.Request) error {
+		<-releaseE
+		return errors.New("late error")
+	}), micro.WithEndpointHandlerTimeout(50*time.Millisecond)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ctxErr := make(chan error, 1)
+	if err := srv.AddEndpoint("ctx", micro.HandlerFunc(func(req micro.Request) {
+		ctx := req.(micro.ContextRequest).Context()
+		if _, ok := ctx.Deadline(); !ok {
+			ctxErr <- errors.New("expected request context to have a deadline")
+			return
+		}
+		<-ctx.Done()
+		ctxErr <- ctx.Err()
+	}), micro.WithEndpointHandlerTimeout(50*time.Millisecond)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := srv.AddEndpoint("invalid", micro.HandlerFunc(func(micro.Request) {}), micro.WithEndpointHandlerTimeout(0)); !errors.Is(err, micro.ErrConfigValidation) {
+		t.Fatalf("Expected error: %v; got: %v", micro.ErrConfigValidation, err)
+	}
+
+	// An error returned after the timeout is not sent as a second response.
+	inbox := nc.NewInbox()
+	replies, err := nc.SubscribeSync(inbox)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := nc.PublishRequest("slow_error", inbox, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp, err := replies.NextMsg(time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if code := resp.Header.Get(micro.ErrorCodeHeader); code != "504" {
+		t.Fatalf("Invalid error code; want: %q; got: %q", "504", code)
+	}
+	close(releaseE)
+	if resp, err := replies.NextMsg(100 * time.Millisecond); err == nil {
+		t.Fatalf("Unexpected response after timeout: %v", resp.Header)
+	}
+
+	// The request context is canceled once the timeout expires.
+	resp, err = nc.Request("ctx", nil, time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if code := resp.Header.Get(micro.ErrorCodeHeader); code != "504" {
+		t.Fatalf("Invalid error code; want: %q; got: %q", "504", code)
+	}
+	select {
+	case err := <-ctxErr:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Expected error: %v; got: %v", context.DeadlineExceeded, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected request context to be done")
+	}
+
+	resp, err = nc.Request("slow", nil, time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if code := resp.Header.Get(micro.ErrorCodeHeader); code != "504" {
+		t.Fatalf("Invalid error code; want: %q; got: %q", "504", code)
+	}
+	if desc := resp.Header.Get(micro.ErrorHeader); desc != "handler timeout" {
+		t.Fatalf("Invalid error description; want: %q; got: %q", "handler timeout", desc)
+	}
+
+	close(release)
+	select {
+	case err := <-lateErr:
+		if !errors.Is(err, micro.ErrHandlerTimeout) {
+			t.Fatalf("Expected error: %v; got: %v", micro.ErrHandlerTimeout, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Timeout waiting for handler to return")
+	}
+
+	resp, err = nc.Request("fast", nil, time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(resp.Data) != "ok" {
+		t.Fatalf("Invalid response; want: %q; got: %q", "ok", resp.Data)
+	}
+
+	stats := srv.Stats()
+	if e := stats.Endpoints[0]; e.NumRequests != 1 || e.NumErrors != 1 || e.NumTimeouts != 1 {
+		t.Fatalf("Invalid stats for endpoint %q; want 1 request, 1 error and 1 timeout; got: %+v", e.Name, e)
+	}
+	if e := stats.Endpoints[1]; e.NumRequests != 1 || e.NumErrors != 0 || e.NumTimeouts != 0 {
+		t.Fatalf("Invalid stats for endpoint %q; want 1 request and no errors; got: %+v", e.Name, e)
+	}
+}
+
+func TestEndpointTimeout(t *testing.T) {
+	s := RunServerOnPort(-1)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Expected to connect to server, got %v", err)
+	}
+	defer nc.Close()
+
+	srv, err := micro.AddService(nc, micro.Config{Name: "test_service", Version: "0.1.0"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer srv.Stop()
+
+	slow := micro.HandlerFunc(func(req micro.Request) {
+		time.Sleep(100 * time.Millisecond)
+		req.Respond([]byte("ok"))
+	})
+	if err := srv.AddEndpoint("advertised", slow, micro.WithEndpointTimeout(2*time.Second)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := srv.AddEndpoint("enforced", slow, micro.WithEndpointTimeout(50*time.Millisecond), micro.WithEndpointHandlerTimeout(50*time.Millisecond)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := srv.AddEndpoint("handler_timeout", slow, micro.WithEndpointHandlerTimeout(time.Second)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := srv.AddEndpoint("none", slow); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := srv.AddEndpoint("invalid", slow, micro.WithEndpointTimeout(0)); !errors.Is(err, micro.ErrConfigValidation) {
+		t.Fatalf("Expected error: %v; got: %v", micro.ErrConfigValidation, err)
+	}
+
+	// The timeouts are advertised in the INFO response.
+	resp, err := nc.Request("$SRV.INFO.test_service", nil, time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var info micro.Info
+	if err := json.Unmarshal(resp.Data, &info); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]time.Duration{
+		"advertised":      2 * time.Second,
+		"enforced":        50 * time.Millisecond,
+		"handler_timeout": time.Second,
+		"none":            0,
+	}
+	if len(info.Endpoints) != len(expected) {
+		t.Fatalf("Expected %d endpoints; got: %d", len(expected), len(info.Endpoints))
+	}
+	for _, e := range info.Endpoints {
+		if e.Timeout != expected[e.Name] {
+			t.Fatalf("Invalid timeout of endpoint %q; want: %v; got: %v", e.Name, expected[e.Name], e.Timeout)
+		}
+	}
+	var raw struct {
+		Endpoints []map[string]any `json:"endpoints"`
+	}
+	if err := json.Unmarshal(resp.Data, &raw); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, e := range raw.Endpoints {
+		if _, ok := e["timeout"]; ok && e["name"] == "none" {
+			t.Fatalf("Expected timeout to be omitted: %s", resp.Data)
+		}
+	}
+
+	// An advertised timeout is not enforced without a handler timeout.
+	resp, err = nc.Request("advertised", nil, time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if code := resp.Header.Get(micro.ErrorCodeHeader); code != "" || string(resp.Data) != "ok" {
+		t.Fatalf("Expected successful response; got: %q (%q)", resp.Data, code)
+	}
+	resp, err = nc.Request("enforced", nil, time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if code := resp.Header.Get(micro.ErrorCodeHeader); code != "504" {
+		t.Fatalf("Invalid error code; want: %q; got: %q", "504", code)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	s := RunServerOnPort(-1)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Expected to connect to server, got %v", err)
+	}
+	defer nc.Close()
+
+	srv, err := micro.AddService(nc, micro.Config{
+		Name:    "test_service",
+		Version: "0.1.0",
+		Endpoint: &micro.EndpointConfig{
+			Subject: "test.func",
+			Handler: micro.HandlerFunc(func(req micro.Request) {
+				if string(req.Data()) == "fail" {
+					req.Error("400", "bad request", []byte(`{"field":"name"}`))
+					return
+				}
+				req.Respond([]byte("ok"))
+			}),
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer srv.Stop()
+
+	resp, err := nc.Request("test.func", []byte("fail"), time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	svcErr, ok := micro.ParseError(resp)
+	if !ok {
+		t.Fatalf("Expected error response")
+	}
+	expected := &micro.ServiceError{Code: "400", Description: "bad request", Data: []byte(`{"field":"name"}`)}
+	if !reflect.DeepEqual(svcErr, expected) {
+		t.Fatalf("Invalid service error; want: %+v; got: %+v", expected, svcErr)
+	}
+
+	resp, err = nc.Request("test.func", []byte("data"), time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if svcErr, ok := micro.ParseError(resp); ok {
+		t.Fatalf("Expected success response; got error: %v", svcErr)
+	}
+	if _, ok := micro.ParseError(nil); ok {
+		t.Fatalf("Expected nil message not to be an error response")
+	}
+}
+
+func TestServiceSubjectPrefix(t *testing.T) {
+	s := RunServerOnPort(-1)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL(), nats.SubjectPrefix("tenant"))
+	if err != nil {
+		t.Fatalf("Expected to connect to server, got %v", err)
+	}
+	defer nc.Close()
+
+	// Responses are published within the namespace, so an unprefixed
+	// client has to use inboxes from the namespace.
+	raw, err := nats.Connect(s.ClientURL(), nats.CustomInboxPrefix("tenant._INBOX"))
+	if err != nil {
+		t.Fatalf("Expected to connect to server, got %v", err)
+	}
+	defer raw.Close()
+
+	srv, err := micro.AddService(nc, micro.Config{
+		Name:    "test_service",
+		Version: "0.1.0",
+		Endpoint: &micro.EndpointConfig{
+			Subject: "test.func",
+			Handler: micro.HandlerFunc(func(req micro.Request) {
+				req.Respond([]byte(req.Subject()))
+			}),
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer srv.Stop()
+
+	if subj := srv.Info().Endpoints[0].Subject; subj != "test.func" {
+		t.Fatalf("Expected unprefixed endpoint subject; got: %q", subj)
+	}
+	for _, test := range []struct {
+		name string
+		nc   *nats.Conn
+		subj string
+	}{
+		{"prefixed connection", nc, "test.func"},
+		{"unprefixed connection", raw, "tenant.test.func"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := test.nc.Request(test.subj, nil, time.Second)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(resp.Data) != "test.func" {
+				t.Fatalf("Expected handler to see unprefixed subject; got: %q", resp.Data)
+			}
+		})
+	}
+
+	if _, err := raw.Request("test.func", nil, 100*time.Millisecond); !errors.Is(err, nats.ErrNoResponders) {
+		t.Fatalf("Expected error: %v; got: %v", nats.ErrNoResponders, err)
+	}
+
+	pingSubject, err := micro.ControlSubject(micro.PingVerb, "test_service", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Monitoring subjects are namespaced as well.
+	if _, err := raw.Request(pingSubject, nil, 100*time.Millisecond); !errors.Is(err, nats.ErrNoResponders) {
+		t.Fatalf("Expected error: %v; got: %v", nats.ErrNoResponders, err)
+	}
+	resp, err := raw.Request("tenant."+pingSubject, nil, time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var ping micro.Ping
+	if err := json.Unmarshal(resp.Data, &ping); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if ping.Name != "test_service" {
+		t.Fatalf("Invalid ping response: %+v", ping)
+	}
+}
+
+func TestServiceReconfigure(t *testing.T) {
+	s := RunServerOnPort(-1)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Expected to connect to server, got %v", err)
+	}
+	defer nc.Close()
+
+	respond := func(data string) micro.Handler {
+		return micro.HandlerFunc(func(req micro.Request) {
+			req.Respond([]byte(data))
+		})
+	}
+	config := micro.Config{
+		Name:    "test_service",
+		Version: "0.1.0",
+		Endpoint: &micro.EndpointConfig{
+			Subject: "test.func",
+			Handler: respond("v1"),
+		},
+		Endpoints: map[string]micro.EndpointConfig{
+			"a": {Handler: respond("a")},
+			"b": {Handler: respond("b")},
+		},
+	}
+	srv, err := micro.AddService(nc, config)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer srv.Stop()
+	// endpoints not registered from the config are not affected
+	if err := srv.AddGroup("g").AddEndpoint("extra", respond("extra")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	info := srv.Info()
+	if len(info.Endpoints) != 4 {
+		t.Fatalf("Expected 4 endpoints; got: %+v", info.Endpoints)
+	}
+
+	// keep sending requests to endpoints which are not removed
+	stop := make(chan struct{})
+	errs := make(chan error, 1)
+	wg := sync.WaitGroup{}
+	for _, subject := range []string{"test.func", "b"} {
+		wg.Add(1)
+		go func(subject string) {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if _, err := nc.Request(subject, nil, time.Second); err != nil {
+					select {
+					case errs <- fmt.Errorf("request on %q: %w", subject, err):
+					default:
+					}
+					return
+				}
+			}
+		}(subject)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	invalid := []micro.Config{
+		{Name: "other_service", Version: "0.2.0"},
+		{Name: "test_service", Version: "0.2.0", Endpoints: map[string]micro.EndpointConfig{"c": {Subject: "c.>.c", Handler: respond("c")}}},
+		{Name: "test_service", Version: "0.2.0", Endpoints: map[string]micro.EndpointConfig{"c": {}}},
+	}
+	for _, cfg := range invalid {
+		if err := srv.Reconfigure(cfg); !errors.Is(err, micro.ErrConfigValidation) {
+			t.Fatalf("Expected error: %v; got: %v", micro.ErrConfigValidation, err)
+		}
+	}
+	if !reflect.DeepEqual(srv.Info(), info) {
+		t.Fatalf("Expected service not to be modified by invalid config; got: %+v", srv.Info())
+	}
+
+	err = srv.Reconfigure(micro.Config{
+		Name:     "test_service",
+		Version:  "0.2.0",
+		Metadata: map[string]string{"color": "green"},
+		Endpoint: &micro.EndpointConfig{
+			Subject: "test.func",
+			Handler: respond("v2"),
+		},
+		Endpoints: map[string]micro.EndpointConfig{
+			"b": {Handler: respond("b"), QueueGroup: "other"},
+			"c": {Handler: respond("c")},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+	select {
+	case err := <-errs:
+		t.Fatalf("Unexpected error during reconfiguration: %v", err)
+	default:
+	}
+
+	for subject, expected := range map[string]string{"test.func": "v2", "b": "b", "c": "c", "g.extra": "extra"} {
+		resp, err := nc.Request(subject, nil, time.Second)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if string(resp.Data) != expected {
+			t.Fatalf("Invalid response on %q; want: %q; got: %q", subject, expected, resp.Data)
+		}
+	}
+	if _, err := nc.Request("a", nil, 100*time.Millisecond); !errors.Is(err, nats.ErrNoResponders) {
+		t.Fatalf("Expected error: %v; got: %v", nats.ErrNoResponders, err)
+	}
+
+	newInfo := srv.Info()
+	if newInfo.ID != info.ID || newInfo.Version != "0.2.0" || newInfo.Metadata["color"] != "green" {
+		t.Fatalf("Invalid service info: %+v", newInfo)
+	}
+	if len(newInfo.Endpoints) != 4 {
+		t.Fatalf("Expected 4 endpoints; got: %+v", newInfo.Endpoints)
+	}
+	b, ok := srv.Endpoint("b")
+	if !ok || b.QueueGroup != "other" {
+		t.Fatalf("Expected endpoint %q in queue group %q", "b", "other")
+	}
+
+	srv.Stop()
+	if err := srv.Reconfigure(config); !errors.Is(err, micro.ErrServiceStopped) {
+		t.Fatalf("Expected error: %v; got: %v", micro.ErrServiceStopped, err)
+	}
+}
+
+func TestServiceReconfigureRollback(t *testing.T) {
+	s := RunServerOnPort(-1)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Expected to connect to server, got %v", err)
+	}
+	defer nc.Close()
+
+	respond := func(data string) micro.Handler {
+		return micro.HandlerFunc(func(req micro.Request) {
+			req.Respond([]byte(data))
+		})
+	}
+	// The transformer rejects the "fail" subject once it was validated,
+	// making the subscription of the endpoint fail.
+	var failCalls atomic.Int32
+	srv, err := micro.AddService(nc, micro.Config{
+		Name:    "test_service",
+		Version: "0.1.0",
+		Endpoints: map[string]micro.EndpointConfig{
+			"a": {Handler: respond("a")},
+		},
+		SubjectTransformer: func(subject string) string {
+			if subject == "fail" && failCalls.Add(1) > 1 {
+				return ""
+			}
+			return subject
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer srv.Stop()
+	info := srv.Info()
+
+	err = srv.Reconfigure(micro.Config{
+		Name:    "test_service",
+		Version: "0.2.0",
+		Endpoints: map[string]micro.EndpointConfig{
+			"a":    {Subject: "a.moved", Handler: respond("a2")},
+			"fail": {Handler: respond("fail")},
+		},
+	})
+	if !errors.Is(err, micro.ErrConfigValidation) {
+		t.Fatalf("Expected error: %v; got: %v", micro.ErrConfigValidation, err)
+	}
+	if !reflect.DeepEqual(srv.Info(), info) {
+		t.Fatalf("Expected service not to be modified; got: %+v", srv.Info())
+	}
+	resp, err := nc.Request("a", nil, time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(resp.Data) != "a" {
+		t.Fatalf("Invalid response; want: %q; got: %q", "a", resp.Data)
+	}
+	if _, err := nc.Request("a.moved", nil, 100*time.Millisecond); !errors.Is(err, nats.ErrNoResponders) {
+		t.Fatalf("Expected error: %v; got: %v", nats.ErrNoResponders, err)
+	}
+}
+
+func TestMonitoringResponseJitter(t *testing.T) {
+	s := RunServerOnPort(-1)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Expected to connect to server, got %v", err)
+	}
+	defer nc.Close()
+
+	_, err = micro.AddService(nc, micro.Config{
+		Name:                     "test_service",
+		Version:                  "0.1.0",
+		MonitoringResponseJitter: -time.Second,
+	})
+	if !errors.Is(err, micro.ErrConfigValidation) {
+		t.Fatalf("Expected error: %v; got: %v", micro.ErrConfigValidation, err)
+	}
+
+	jitter := 300 * time.Millisecond
+	instances := 20
+	var svcs []micro.Service
+	for i := 0; i < instances; i++ {
+		srv, err := micro.AddService(nc, micro.Config{
+			Name:                     "test_service",
+			Version:                  "0.1.0",
+			MonitoringResponseJitter: jitter,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer srv.Stop()
+		svcs = append(svcs, srv)
+	}
+
+	for _, subject := range []string{"$SRV.PING", "$SRV.PING.test_service"} {
+		t.Run(subject, func(t *testing.T) {
+			inbox := nats.NewInbox()
+			sub, err := nc.SubscribeSync(inbox)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			defer sub.Unsubscribe()
+
+			start := time.Now()
+			if err := nc.PublishRequest(subject, inbox, nil); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			var first, last time.Duration
+			for i := 0; i < instances; i++ {
+				if _, err := sub.NextMsg(2 * time.Second); err != nil {
+					t.Fatalf("Expected %d responses, got %d: %v", instances, i, err)
+				}
+				last = time.Since(start)
+				if i == 0 {
+					first = last
+				}
+			}
+			if last > jitter+time.Second {
+				t.Fatalf("Expected responses within %v, last received after %v", jitter, last)
+			}
+			if last-first < jitter/10 {
+				t.Fatalf("Expected responses to be spread over time; first: %v, last: %v", first, last)
+			}
+		})
+	}
+
+	// Requests targeted at an instance are not delayed.
+	start := time.Now()
+	if _, err := nc.Request(fmt.Sprintf("$SRV.PING.test_service.%s", svcs[0].Info().ID), nil, time.Second); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > jitter/3 {
+		t.Fatalf("Expected targeted request not to be delayed, took %v", elapsed)
+	}
+}
+
+func TestStatsPush(t *testing.T) {
+	s := RunServerOnPort(-1)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Expected to connect to server, got %v", err)
+	}
+	defer nc.Close()
+
+	for _, cfg := range []micro.Config{
+		{Name: "test_service", Version: "0.1.0", StatsPushInterval: -time.Second, StatsPushSubject: "stats"},
+		{Name: "test_service", Version: "0.1.0", StatsPushInterval: time.Second},
+		{Name: "test_service", Version: "0.1.0", StatsPushInterval: time.Second, StatsPushSubject: "stats.*"},
+	} {
+		if _, err := micro.AddService(nc, cfg); !errors.Is(err, micro.ErrConfigValidation) {
+			t.Fatalf("Expected error: %v; got: %v", micro.ErrConfigValidation, err)
+		}
+	}
+
+	sub, err := nc.SubscribeSync("stats.push")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	srv, err := micro.AddService(nc, micro.Config{
+		Name:              "test_service",
+		Version:           "0.1.0",
+		StatsPushSubject:  "stats.push",
+		StatsPushInterval: 50 * time.Millisecond,
+		Endpoint: &micro.EndpointConfig{
+			Subject: "test.func",
+			Handler: micro.HandlerFunc(func(r micro.Request) { r.Respond(nil) }),
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := nc.Request("test.func", nil, time.Second); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		msg, err := sub.NextMsg(time.Second)
+		if err != nil {
+			t.Fatalf("Expected pushed stats: %v", err)
+		}
+		var stats micro.Stats
+		if err := json.Unmarshal(msg.Data, &stats); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if stats.ID != srv.Info().ID || stats.Type != micro.StatsResponseType {
+			t.Fatalf("Invalid stats: %+v", stats)
+		}
+		if len(stats.Endpoints) != 1 || stats.Endpoints[0].NumRequests != 1 {
+			t.Fatalf("Invalid endpoint stats: %+v", stats.Endpoints)
+		}
+	}
+
+	if err := srv.Stop(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Drop stats which could have been published while stopping.
+	time.Sleep(100 * time.Millisecond)
+	for {
+		if _, err := sub.NextMsg(10 * time.Millisecond); err != nil {
+			break
+		}
+	}
+	if msg, err := sub.NextMsg(200 * time.Millisecond); err == nil {
+		t.Fatalf("Expected no stats after stop, got: %s", msg.Data)
+	}
+}
+
+func TestServiceContext(t *testing.T) {
+	s := RunServerOnPort(-1)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Expected to connect to server, got %v", err)
+	}
+	defer nc.Close()
+
+	t.Run("stop on context cancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		done := make(chan struct{})
+		srv, err := micro.AddService(nc, micro.Config{
+			Name:    "test_service",
+			Version: "0.1.0",
+			Context: ctx,
+			Endpoint: &micro.EndpointConfig{
+				Subject: "test.func",
+				Handler: micro.HandlerFunc(func(r micro.Request) { r.Respond([]byte("ok")) }),
+			},
+			DoneHandler: func(micro.Service) {
+				close(done)
+			},
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := nc.Request("test.func", nil, time.Second); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Timeout on DoneHandler")
+		}
+		if !srv.Stopped() {
+			t.Fatal("Expected service to be stopped")
+		}
+		if _, err := nc.Request("test.func", nil, 100*time.Millisecond); !errors.Is(err, nats.ErrNoResponders) {
+			t.Fatalf("Expected error: %v; got: %v", nats.ErrNoResponders, err)
+		}
+	})
+
+	t.Run("explicit stop", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var doneCount atomic.Int32
+		srv, err := micro.AddService(nc, micro.Config{
+			Name:    "test_service",
+			Version: "0.1.0",
+			Context: ctx,
+			DoneHandler: func(micro.Service) {
+				doneCount.Add(1)
+			},
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := srv.Stop(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		// cancelling the context after stop should be a no-op
+		cancel()
+		time.Sleep(100 * time.Millisecond)
+		if doneCount.Load() != 1 {
+			t.Fatalf("Expected DoneHandler to be invoked once; got: %d", doneCount.Load())
+		}
+	})
+}
+
+func TestRequestRespondTo(t *testing.T) {
+	s := RunServerOnPort(-1)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Expected to connect to server, got %v", err)
+	}
+	defer nc.Close()
+
+	srv, err := micro.AddService(nc, micro.Config{
+		Name:    "test_service",
+		Version: "0.1.0",
+		Endpoint: &micro.EndpointConfig{
+			Subject: "test.func",
+			Handler: micro.HandlerFunc(func(r micro.Request) {
+				r.(micro.RespondToRequest).RespondTo([]string{"audit.a", "audit.b"}, []byte("ok"), micro.WithHeaders(micro.Headers{"A": []string{"b"}}))
+			}),
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer srv.Stop()
+
+	audit, err := nc.SubscribeSync("audit.*")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	resp, err := nc.Request("test.func", nil, time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(resp.Data) != "ok" || resp.Header.Get("A") != "b" {
+		t.Fatalf("Invalid response: %q; headers: %v", resp.Data, resp.Header)
+	}
+	for _, subject := range []string{"audit.a", "audit.b"} {
+		msg, err := audit.NextMsg(time.Second)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if msg.Subject != subject || string(msg.Data) != "ok" || msg.Header.Get("A") != "b" {
+			t.Fatalf("Invalid message on %q: %q; headers: %v", msg.Subject, msg.Data, msg.Header)
+		}
+	}
+
+	stats := srv.Stats().Endpoints[0]
+	if stats.NumRequests != 1 || stats.NumErrors != 0 || stats.NumExtraResponses != 2 {
+		t.Fatalf("Invalid stats: %+v", stats)
+	}
+}
+
+func TestAddEndpointE(t *testing.T) {
+	s := RunServerOnPort(-1)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Expected to connect to server, got %v", err)
+	}
+	defer nc.Close()
+
+	srv, err := micro.AddService(nc, micro.Config{
+		Name:    "test_service",
+		Version: "0.1.0",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer srv.Stop()
+
+	tests := []struct {
+		name            string
+		handler         micro.HandlerFuncE
+		expectedData    string
+		expectedCode    string
+		expectedMessage string
+	}{
+		{
+			name: "responded",
+			handler: func(r micro.Request) error {
+				return r.Respond([]byte("ok"))
+			},
+			expectedData: "ok",
+		},
+		{
+			name: "service error",
+			handler: func(r micro.Request) error {
+				return fmt.Errorf("checking order: %w", &micro.ServiceError{Code: "404", Description: "order not found", Data: []byte("123")})
+			},
+			expectedData:    "123",
+			expectedCode:    "404",
+			expectedMessage: "order not found",
+		},
+		{
+			name: "error",
+			handler: func(r micro.Request) error {
+				return errors.New("oops")
+			},
+			expectedCode:    "500",
+			expectedMessage: "oops",
+		},
+		{
+			name: "nil without response",
+			handler: func(r micro.Request) error {
+				return nil
+			},
+			expectedCode:    "500",
+			expectedMessage: micro.ErrNoResponse.Error(),
+		},
+		{
+			name: "error after response",
+			handler: func(r micro.Request) error {
+				r.Respond([]byte("ok"))
+				return errors.New("oops")
+			},
+			expectedData: "ok",
+		},
+	}
+
+	group := srv.AddGroup("tests")
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			name := fmt.Sprintf("e%d", i)
+			if err := group.AddEndpointE(name, test.handler); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			resp, err := nc.Request("tests."+name, nil, time.Second)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(resp.Data) != test.expectedData {
+				t.Fatalf("Invalid response data; want: %q; got: %q", test.expectedData, resp.Data)
+			}
+			if code := resp.Header.Get(micro.ErrorCodeHeader); code != test.expectedCode {
+				t.Fatalf("Invalid error code; want: %q; got: %q", test.expectedCode, code)
+			}
+			if msg := resp.Header.Get(micro.ErrorHeader); msg != test.expectedMessage {
+				t.Fatalf("Invalid error message; want: %q; got: %q", test.expectedMessage, msg)
+			}
+			var expectedErrors int
+			if test.expectedCode != "" {
+				expectedErrors = 1
+			}
+			if stats := srv.Stats().Endpoints[i]; stats.NumRequests != 1 || stats.NumErrors != expectedErrors {
+				t.Fatalf("Invalid stats: %+v", stats)
+			}
+		})
+	}
+
+	if err := srv.AddEndpointE("top", func(r micro.Request) error {
+		return r.Respond([]byte("top"))
+	}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp, err := nc.Request("top", nil, time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(resp.Data) != "top" {
+		t.Fatalf("Invalid response data: %q", resp.Data)
+	}
+}
+
+func TestRequestConnection(t *testing.T) {
+	s := RunServerOnPort(-1)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Expected to connect to server, got %v", err)
+	}
+	defer nc.Close()
+
+	srv, err := micro.AddService(nc, micro.Config{
+		Name:    "test_service",
+		Version: "0.1.0",
+		Endpoint: &micro.EndpointConfig{
+			Subject: "test.func",
+			Handler: micro.HandlerFunc(func(r micro.Request) {
+				conn := r.(micro.ConnectionRequest).Connection()
+				if conn != nc {
+					r.Error("500", "unexpected connection", nil)
+					return
+				}
+				if err := conn.Publish("events.handled", r.Data()); err != nil {
+					r.Error("500", err.Error(), nil)
+					return
+				}
+				r.Respond([]byte("ok"))
+			}),
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer srv.Stop()
+
+	events, err := nc.SubscribeSync("events.handled")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	resp, err := nc.Request("test.func", []byte("req"), time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(resp.Data) != "ok" {
+		t.Fatalf("Invalid response: %q; headers: %v", resp.Data, resp.Header)
+	}
+	msg, err := events.NextMsg(time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(msg.Data) != "req" {
+		t.Fatalf("Invalid event: %q", msg.Data)
+	}
+
+	stats := srv.Stats().Endpoints[0]
+	if stats.NumRequests != 1 || stats.NumErrors != 0 || stats.NumExtraResponses != 0 {
+		t.Fatalf("Invalid stats: %+v", stats)
+	}
+}
+
+func TestEndpointDrain(t *testing.T) {
+	s := RunServerOnPort(-1)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Expected to connect to server, got %v", err)
+	}
+	defer nc.Close()
+
+	srv, err := micro.AddService(nc, micro.Config{
+		Name:    "test_service",
+		Version: "0.1.0",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer srv.Stop()
+
+	var inFlight, completed atomic.Int32
+	slow := micro.HandlerFunc(func(r micro.Request) {
+		inFlight.Add(1)
+		time.Sleep(100 * time.Millisecond)
+		completed.Add(1)
+		r.Respond([]byte("slow"))
+	})
+	fast := micro.HandlerFunc(func(r micro.Request) {
+		r.Respond([]byte("fast"))
+	})
+	if err := srv.AddEndpoint("slow", slow); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := srv.AddEndpoint("fast", fast); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Send requests to the slow endpoint without waiting for responses.
+	inbox := nats.NewInbox()
+	replies, err := nc.SubscribeSync(inbox)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := nc.PublishRequest("slow", inbox, nil); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	nc.Flush()
+	for deadline := time.Now().Add(time.Second); inFlight.Load() == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("Request not in flight")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	endpoint, ok := srv.Endpoint("slow")
+	if !ok {
+		t.Fatal("Expected endpoint to be found")
+	}
+	if err := endpoint.Drain(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// All pending requests were processed before Drain returned.
+	if completed.Load() != 5 {
+		t.Fatalf("Expected 5 completed requests; got: %d", completed.Load())
+	}
+	for i := 0; i < 5; i++ {
+		if _, err := replies.NextMsg(time.Second); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	// Draining again is a no-op.
+	if err := endpoint.Drain(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, err := nc.Request("slow", nil, 100*time.Millisecond); !errors.Is(err, nats.ErrNoResponders) {
+		t.Fatalf("Expected error: %v; got: %v", nats.ErrNoResponders, err)
+	}
+	resp, err := nc.Request("fast", nil, time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(resp.Data) != "fast" {
+		t.Fatalf("Invalid response: %q", resp.Data)
+	}
+	if _, err := nc.Request("$SRV.PING", nil, time.Second); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, e := range srv.Info().Endpoints {
+		if e.Drained != (e.Name == "slow") {
+			t.Fatalf("Invalid drained state for endpoint %q: %v", e.Name, e.Drained)
+		}
+	}
+	for _, e := range srv.Stats().Endpoints {
+		if e.Drained != (e.Name == "slow") {
+			t.Fatalf("Invalid drained state for endpoint %q: %v", e.Name, e.Drained)
+		}
+	}
+
+	// Re-add the endpoint with a new handler.
+	if err := srv.AddEndpoint("slow", fast); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if e, _ := srv.Endpoint("slow"); e == endpoint {
+		t.Fatal("Expected re-added endpoint to be returned")
+	}
+	resp, err = nc.Request("slow", nil, time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(resp.Data) != "fast" {
+		t.Fatalf("Invalid response: %q", resp.Data)
+	}
+
+	if err := srv.Stop(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := nc.Request("fast", nil, 100*time.Millisecond); !errors.Is(err, nats.ErrNoResponders) {
+		t.Fatalf("Expected error: %v; got: %v", nats.ErrNoResponders, err)
+	}
+}
+
+func TestServiceSetDrainWithTimeout(t *testing.T) {
+	tests := []struct {
+		name       string
+		slowDelay  time.Duration
+		timeout    time.Duration
+		withErrors bool
+	}{
+		{
+			name:      "drain within deadline",
+			slowDelay: 50 * time.Millisecond,
+			timeout:   2 * time.Second,
+		},
+		{
+			name:       "deadline exceeded",
+			slowDelay:  500 * time.Millisecond,
+			timeout:    200 * time.Millisecond,
+			withErrors: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := RunServerOnPort(-1)
+			defer s.Shutdown()
+
+			nc, err := nats.Connect(s.ClientURL())
+			if err != nil {
+				t.Fatalf("Expected to connect to server, got %v", err)
+			}
+			defer nc.Close()
+
+			delays := map[string]time.Duration{
+				"fast_service": 10 * time.Millisecond,
+				"slow_service": test.slowDelay,
+			}
+			set := micro.NewServiceSet()
+			var inFlight atomic.Int32
+			for name, delay := range delays {
+				delay := delay
+				srv, err := micro.AddService(nc, micro.Config{
+					Name:    name,
+					Version: "0.1.0",
+					Endpoint: &micro.EndpointConfig{
+						Subject: name,
+						Handler: micro.HandlerFunc(func(r micro.Request) {
+							inFlight.Add(1)
+							time.Sleep(delay)
+							r.Respond([]byte("ok"))
+						}),
+					},
+				})
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				set.Add(srv)
+			}
+
+			// Send requests to all services without waiting for responses.
+			for name := range delays {
+				for i := 0; i < 3; i++ {
+					if err := nc.PublishRequest(name, nats.NewInbox(), nil); err != nil {
+						t.Fatalf("Unexpected error: %v", err)
+					}
+				}
+			}
+			nc.Flush()
+			for deadline := time.Now().Add(time.Second); inFlight.Load() < 2; {
+				if time.Now().After(deadline) {
+					t.Fatal("Requests not in flight")
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			err = set.DrainWithTimeout(test.timeout)
+			if test.withErrors {
+				if !errors.Is(err, nats.ErrDrainTimeout) {
+					t.Fatalf("Expected error: %v; got: %v", nats.ErrDrainTimeout, err)
+				}
+				if !strings.Contains(err.Error(), "slow_service") || strings.Contains(err.Error(), "fast_service") {
+					t.Fatalf("Expected error to only list slow_service; got: %v", err)
+				}
+			} else if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			for _, srv := range set.Services() {
+				if !srv.Stopped() {
+					t.Fatalf("Expected service %q to be stopped", srv.Info().Name)
+				}
+			}
+			results := set.DrainResults()
+			if len(results) != 2 {
+				t.Fatalf("Expected 2 drain results; got: %d", len(results))
+			}
+			for _, res := range results {
+				expectErr := test.withErrors && res.Name == "slow_service"
+				if (res.Err != nil) != expectErr {
+					t.Fatalf("Unexpected drain error for service %q: %v", res.Name, res.Err)
+				}
+				if res.Duration <= 0 || res.Duration > test.timeout+100*time.Millisecond {
+					t.Fatalf("Invalid drain duration for service %q: %v", res.Name, res.Duration)
+				}
+			}
+		})
+	}
+}
+
+func TestServiceInFlight(t *testing.T) {
+	s := RunServerOnPort(-1)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Expected to connect to server, got %v", err)
+	}
+	defer nc.Close()
+
+	progress := make(chan int, 10)
+	srv, err := micro.AddService(nc, micro.Config{
+		Name:    "test_service",
+		Version: "0.1.0",
+		DrainProgressHandler: func(_ micro.Service, inFlight int) {
+			progress <- inFlight
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer srv.Stop()
+
+	names := []string{"foo", "bar", "baz"}
+	release := make(map[string]chan struct{})
+	for _, name := range names {
+		ch := make(chan struct{})
+		release[name] = ch
+		if err := srv.AddEndpoint(name, micro.HandlerFunc(func(r micro.Request) {
+			<-ch
+			r.Respond([]byte("ok"))
+		})); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if n := srv.InFlight(); n != 0 {
+		t.Fatalf("Expected no requests in flight; got: %d", n)
+	}
+
+	for _, name := range names {
+		if err := nc.PublishRequest(name, nats.NewInbox(), nil); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	for deadline := time.Now().Add(time.Second); srv.InFlight() < len(names); {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d requests in flight; got: %d", len(names), srv.InFlight())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	drained := make(chan error, 1)
+	go func() {
+		drained <- micro.NewServiceSet(srv).DrainWithTimeout(5 * time.Second)
+	}()
+	select {
+	case n := <-progress:
+		if n != len(names) {
+			t.Fatalf("Expected %d requests in flight; got: %d", len(names), n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timeout waiting for drain to start")
+	}
+	for i, name := range names {
+		close(release[name])
+		expected := len(names) - i - 1
+		select {
+		case n := <-progress:
+			if n != expected {
+				t.Fatalf("Expected %d requests in flight; got: %d", expected, n)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Timeout waiting for drain progress")
+		}
+		if n := srv.InFlight(); n != expected {
+			t.Fatalf("Expected %d requests in flight; got: %d", expected, n)
+		}
+	}
+	select {
+	case err := <-drained:
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timeout waiting for drain")
+	}
+	if !srv.Stopped() {
+		t.Fatal("Expected service to be stopped")
+	}
+}
+func TestRequestGroup(t *testing.T) {
+	s := RunServerOnPort(-1)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Expected to connect to server, got %v", err)
+	}
+	defer nc.Close()
+
+	for _, version := range []string{"v1", "v2"} {
+		for i := 0; i < 2; i++ {
+			srv, err := micro.AddService(nc, micro.Config{
+				Name:       "test_service",
+				Version:    "0.1.0",
+				QueueGroup: version,
+				Endpoint: &micro.EndpointConfig{
+					Subject: "test.func",
+					Handler: micro.HandlerFunc(func(r micro.Request) {
+						r.Respond([]byte(version))
+					}),
+				},
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			defer srv.Stop()
+		}
+	}
+
+	for _, version := range []string{"v1", "v2"} {
+		for i := 0; i < 10; i++ {
+			resp, err := nc.RequestGroup("test.func", version, nil, time.Second)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(resp.Data) != version {
+				t.Fatalf("Invalid response; want: %q; got: %q", version, resp.Data)
+			}
+		}
+	}
+
+	if _, err := nc.RequestGroup("test.func", "v3", nil, 100*time.Millisecond); !errors.Is(err, nats.ErrTimeout) {
+		t.Fatalf("Expected error: %v; got: %v", nats.ErrTimeout, err)
+	}
+	if _, err := nc.RequestGroup("test.func", "", nil, time.Second); !errors.Is(err, nats.ErrBadQueueName) {
+		t.Fatalf("Expected error: %v; got: %v", nats.ErrBadQueueName, err)
+	}
+}
+
+func TestServiceStats(t *testing.T) {
+	handler := func(r micro.Request) {
+		r.Respond([]byte("ok"))
+	}
+	tests := []struct {
+		name          string
+		config        micro.Config
+		expectedStats map[string]any
+	}{
+		{
+			name: "stats handler",
+			config: micro.Config{
+				Name:    "test_service",
+				Version: "0.1.0",
+			},
+		},
+		{
+			name: "with stats handler",
+			config: micro.Config{
+				Name:    "test_service",
+				Version: "0.1.0",
+				StatsHandler: func(e *micro.Endpoint) any {
+					return map[string]any{
+						"key": "val",
+					}
+				},
+			},
+			expectedStats: map[string]any{
+				"key": "val",
+			},
+		},
+		{
+			name: "with default endpoint",
+			config: micro.Config{
+				Name:    "test_service",
+				Version: "0.1.0",
+				Endpoint: &micro.EndpointConfig{
+					Subject:  "test.func",
+					Handler:  micro.HandlerFunc(handler),
+					Metadata: map[string]string{"test": "value"},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := RunServerOnPort(-1)
+			defer s.Shutdown()
+
+			nc, err := nats.Connect(s.ClientURL())
+			if err != nil {
+				t.Fatalf("Expected to connect to server, got %v", err)
+			}
+			defer nc.Close()
+
+			srv, err := micro.AddService(nc, test.config)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if test.config.Endpoint == nil {
+				opts := []micro.EndpointOpt{micro.WithEndpointSubject("test.func")}
+				if err := srv.AddEndpoint("func", micro.HandlerFunc(handler), opts...); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			}
+			defer srv.Stop()
+			for i := 0; i < 10; i++ {
+				if _, err := nc.Request("test.func", []byte("msg"), time.Second); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			}
+
+			// Malformed request, missing reply subjtct
+			// This should be reflected in errors
+			if err := nc.Publish("test.func", []byte("err")); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			time.Sleep(10 * time.Millisecond)
+
+			info := srv.Info()
+			resp, err := nc.Request(fmt.Sprintf("$SRV.STATS.test_service.%s", info.ID), nil, 1*time.Second)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var stats micro.Stats
+			if err := json.Unmarshal(resp.Data, &stats); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if len(stats.Endpoints) != 1 {
+				t.Fatalf("Unexpected number of endpoints: want: %d; got: %d", 1, len(stats.Endpoints))
+			}
+			if stats.Name != info.Name {
+				t.Errorf("Unexpected service name; want: %s; got: %s", info.Name, stats.Name)
+			}
+			if stats.ID != info.ID {
+				t.Errorf("Unexpected service name; want: %s; got: %s", info.ID, stats.ID)
+			}
+			if test.config.Endpoint == nil && stats.Endpoints[0].Name != "func" {
+				t.Errorf("Invalid endpoint name; want: %s; got: %s", "func", stats.Endpoints[0].Name)
+			}
+			if test.config.Endpoint != nil && stats.Endpoints[0].Name != "default" {
+				t.Errorf("Invalid endpoint name; want: %s; got: %s", "default", stats.Endpoints[0].Name)
+			}
+			if stats.Endpoints[0].Subject != "test.func" {
+				t.Errorf("Invalid endpoint subject; want: %s; got: %s", "test.func", stats.Endpoints[0].Subject)
+			}
+			if stats.Endpoints[0].NumRequests != 11 {
+				t.Errorf("Unexpected num_requests; want: 11; got: %d", stats.Endpoints[0].NumRequests)
+			}
+			if stats.Endpoints[0].NumErrors != 1 {
+				t.Errorf("Unexpected num_errors; want: 1; got: %d", stats.Endpoints[0].NumErrors)
+			}
+			if stats.Endpoints[0].AverageProcessingTime == 0 {
+				t.Errorf("Expected non-empty AverageProcessingTime")
+			}
+			if stats.Endpoints[0].ProcessingTime == 0 {
+				t.Errorf("Expected non-empty ProcessingTime")
+			}
+			if stats.Started.IsZero() {
+				t.Errorf("Expected non-empty start time")
+			}
+			if stats.Type != micro.StatsResponseType {
+				t.Errorf("Invalid response type; want: %s; got: %s", micro.StatsResponseType, stats.Type)
+			}
+
+			if test.expectedStats != nil {
+				var data map[string]any
+				if err := json.Unmarshal(stats.Endpoints[0].Data, &data); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if !reflect.DeepEqual(data, test.expectedStats) {
+					t.Fatalf("Invalid data from stats handler; want: %v; got: %v", test.expectedStats, data)
+				}
+			}
+		})
+	}
+}
+
+func TestEndpointReset(t *testing.T) {
+	s := RunServerOnPort(-1)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Expected to connect to server, got %v", err)
+	}
+	defer nc.Close()
+
+	handler := micro.HandlerFunc(func(r micro.Request) {
+		r.Respond([]byte("ok"))
+	})
+	srv, err := micro.AddService(nc, micro.Config{
+		Name:    "test_service",
+		Version: "0.1.0",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer srv.Stop()
+
+	for _, name := range []string{"foo", "bar", "baz"} {
+		if err := srv.AddEndpoint(name, handler, micro.WithEndpointQueueGroup("q-"+name)); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	sendRequests := func() {
+		t.Helper()
+		for _, name := range []string{"foo", "bar", "baz"} {
+			for i := 0; i < 2; i++ {
+				if _, err := nc.Request(name, nil, time.Second); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			}
+		}
+	}
+	checkRequests := func(stats micro.Stats, expected map[string]int) {
+		t.Helper()
+		for _, e := range stats.Endpoints {
+			if e.NumRequests != expected[e.Name] {
+				t.Fatalf("Expected %d requests for endpoint %q; got: %d", expected[e.Name], e.Name, e.NumRequests)
+			}
+			if e.QueueGroup != "q-"+e.Name {
+				t.Fatalf("Invalid queue group for endpoint %q: %q", e.Name, e.QueueGroup)
+			}
+		}
+	}
+
+	sendRequests()
+	started := srv.Stats().Started
+	foo, ok := srv.Endpoint("foo")
+	if !ok {
+		t.Fatal("Expected endpoint to be found")
+	}
+	foo.Reset()
+	stats := srv.Stats()
+	checkRequests(stats, map[string]int{"foo": 0, "bar": 2, "baz": 2})
+	if !stats.Started.Equal(started) {
+		t.Fatalf("Expected start time to be preserved; was: %v, got: %v", started, stats.Started)
+	}
+
+	// STATS requests sent to all instances of the service do not reset stats.
+	subject, err := micro.ControlSubject(micro.StatsVerb, "test_service", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	req := nats.NewMsg(subject)
+	req.Header.Set(micro.StatsResetEndpointHeader, "bar")
+	if _, err := nc.RequestMsg(req, time.Second); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkRequests(srv.Stats(), map[string]int{"foo": 0, "bar": 2, "baz": 2})
+
+	// Reset using a STATS request targeting the instance,
+	// which returns the stats before the reset.
+	sendRequests()
+	subject, err = micro.ControlSubject(micro.StatsVerb, "test_service", srv.Info().ID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	req = nats.NewMsg(subject)
+	req.Header.Set(micro.StatsResetEndpointHeader, "bar")
+	resp, err := nc.RequestMsg(req, time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := json.Unmarshal(resp.Data, &stats); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkRequests(stats, map[string]int{"foo": 2, "bar": 4, "baz": 4})
+	stats = srv.Stats()
+	checkRequests(stats, map[string]int{"foo": 2, "bar": 0, "baz": 4})
+	if !stats.Started.Equal(started) {
+		t.Fatalf("Expected start time to be preserved; was: %v, got: %v", started, stats.Started)
+	}
+}
+
+func TestEndpointLastError(t *testing.T) {
+	s := RunServerOnPort(-1)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Expected to connect to server, got %v", err)
+	}
+	defer nc.Close()
+
+	srv, err := micro.AddService(nc, micro.Config{
+		Name:    "test_service",
+		Version: "0.1.0",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer srv.Stop()
+
+	if err := srv.AddEndpoint("fail", micro.HandlerFunc(func(r micro.Request) {
+		r.Error("500", "internal error", nil)
+	})); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := srv.AddEndpoint("slow", micro.HandlerFunc(func(r micro.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}), micro.WithEndpointHandlerTimeout(50*time.Millisecond)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := srv.AddEndpoint("ok", micro.HandlerFunc(func(r micro.Request) {
+		r.Respond(nil)
+	})); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	before := time.Now()
+	for _, name := range []string{"fail", "slow", "ok"} {
+		if _, err := nc.Request(name, nil, time.Second); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	subject, err := micro.ControlSubject(micro.StatsVerb, "test_service", srv.Info().ID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp, err := nc.Request(subject, nil, time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var stats micro.Stats
+	if err := json.Unmarshal(resp.Data, &stats); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]string{
+		"fail": "500:internal error",
+		"slow": "504:handler timeout",
+		"ok":   "",
+	}
+	for _, e := range stats.Endpoints {
+		if e.LastError != expected[e.Name] {
+			t.Fatalf("Invalid last error for endpoint %q; want: %q; got: %q", e.Name, expected[e.Name], e.LastError)
+		}
+		if e.LastError == "" {
+			if !e.LastErrorTime.IsZero() {
+				t.Fatalf("Expected no last error time for endpoint %q; got: %v", e.Name, e.LastErrorTime)
+			}
+			continue
+		}
+		if e.LastErrorTime.Before(before) || e.LastErrorTime.After(time.Now()) {
+			t.Fatalf("Invalid last error time for endpoint %q: %v", e.Name, e.LastErrorTime)
+		}
+	}
+
+	fail, ok := srv.Endpoint("fail")
+	if !ok {
+		t.Fatal("Expected endpoint to be found")
+	}
+	fail.Reset()
+	for _, e := range srv.Stats().Endpoints {
+		if e.Name == "fail" && (e.LastError != "" || !e.LastErrorTime.IsZero()) {
+			t.Fatalf("Expected last error to be cleared; got: %q at %v", e.LastError, e.LastErrorTime)
+		}
+	}
+}
+
+func TestSubjectTransformer(t *testing.T) {
+	s := RunServerOnPort(-1)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Expected to connect to server, got %v", err)
+	}
+	defer nc.Close()
+
+	srv, err := micro.AddService(nc, micro.Config{
+		Name:    "test_service",
+		Version: "0.1.0",
+		SubjectTransformer: func(subject string) string {
+			return "tenant1." + subject
+		},
+		Endpoint: &micro.EndpointConfig{
+			Subject: "orders.get",
+			Handler: micro.HandlerFunc(func(r micro.Request) {
+				r.Respond([]byte(r.Subject()))
+			}),
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer srv.Stop()
+
+	resp, err := nc.Request("tenant1.orders.get", nil, time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(resp.Data) != "tenant1.orders.get" {
+		t.Fatalf("Invalid response: %q", resp.Data)
+	}
+	if _, err := nc.Request("orders.get", nil, 100*time.Millisecond); !errors.Is(err, nats.ErrNoResponders) {
+		t.Fatalf("Expected error: %v; got: %v", nats.ErrNoResponders, err)
+	}
+
+	subject, err := micro.ControlSubject(micro.InfoVerb, "test_service", srv.Info().ID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp, err = nc.Request(subject, nil, time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var info micro.Info
+	if err := json.Unmarshal(resp.Data, &info); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(info.Endpoints) != 1 || info.Endpoints[0].Subject != "orders.get" {
+		t.Fatalf("Expected logical subject to be advertised; got: %+v", info.Endpoints)
+	}
+	if subj := srv.Stats().Endpoints[0].Subject; subj != "orders.get" {
+		t.Fatalf("Expected logical subject in stats; got: %q", subj)
+	}
+
+	_, err = micro.AddService(nc, micro.Config{
+		Name:    "invalid_service",
+		Version: "0.1.0",
+		SubjectTransformer: func(subject string) string {
+			return "tenant 1." + subject
+		},
+		Endpoint: &micro.EndpointConfig{
+			Subject: "orders.get",
+			Handler: micro.HandlerFunc(func(r micro.Request) {}),
+		},
+	})
+	if !errors.Is(err, micro.ErrConfigValidation) {
+		t.Fatalf("Expected error: %v; got: %v", micro.ErrConfigValidation, err)
+	}
+}
+
+func TestResponseCompression(t *testing.T) {
+	s := RunServerOnPort(-1)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Expected to connect to server, got %v", err)
+	}
+	defer nc.Close()
+
+	large := bytes.Repeat([]byte("compressible "), 100)
+	srv, err := micro.AddService(nc, micro.Config{
+		Name:                 "test_service",
+		Version:              "0.1.0",
+		CompressionThreshold: 512,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer srv.Stop()
+
+	respond := func(data []byte) micro.Handler {
+		return micro.HandlerFunc(func(r micro.Request) {
+			r.Respond(data)
+		})
+	}
+	if err := srv.AddEndpoint("large", respond(large)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := srv.AddEndpoint("small", respond([]byte("small"))); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := srv.AddEndpoint("uncompressed", respond(large), micro.WithEndpointCompression(0)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := srv.AddEndpoint("invalid", respond(large), micro.WithEndpointCompression(-1)); !errors.Is(err, micro.ErrConfigValidation) {
+		t.Fatalf("Expected error: %v; got: %v", micro.ErrConfigValidation, err)
+	}
+
+	tests := []struct {
+		name           string
+		subject        string
+		acceptEncoding string
+		expected       []byte
+		compressed     bool
+	}{
+		{
+			name:           "large response with gzip accepted",
+			subject:        "large",
+			acceptEncoding: "br, gzip",
+			expected:       large,
+			compressed:     true,
+		},
+		{
+			name:     "large response without accept encoding",
+			subject:  "large",
+			expected: large,
+		},
+		{
+			name:           "gzip refused",
+			subject:        "large",
+			acceptEncoding: "gzip;q=0",
+			expected:       large,
+		},
+		{
+			name:           "response below threshold",
+			subject:        "small",
+			acceptEncoding: "gzip",
+			expected:       []byte("small"),
+		},
+		{
+			name:           "compression disabled for endpoint",
+			subject:        "uncompressed",
+			acceptEncoding: "gzip",
+			expected:       large,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := nats.NewMsg(test.subject)
+			if test.acceptEncoding != "" {
+				req.Header.Set(micro.AcceptEncodingHeader, test.acceptEncoding)
+			}
+			resp, err := nc.RequestMsg(req, time.Second)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			compressed := resp.Header.Get(micro.ContentEncodingHeader) == "gzip"
+			if compressed != test.compressed {
+				t.Fatalf("Expected compressed: %t; got headers: %v", test.compressed, resp.Header)
+			}
+			if compressed && len(resp.Data) >= len(test.expected) {
+				t.Fatalf("Expected compressed payload to be smaller than %d bytes; got: %d", len(test.expected), len(resp.Data))
+			}
+			data, err := micro.DecompressResponse(resp)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !bytes.Equal(data, test.expected) {
+				t.Fatalf("Invalid response data: %q", data)
+			}
+		})
+	}
+}
+
+func TestServiceDefaultHandler(t *testing.T) {
+	s := RunServerOnPort(-1)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Expected to connect to server, got %v", err)
+	}
+	defer nc.Close()
+
+	notFound := micro.HandlerFunc(func(r micro.Request) {
+		r.Error("404", "unknown method", nil)
+	})
+	if _, err := micro.AddService(nc, micro.Config{
+		Name:           "test_service",
+		Version:        "0.1.0",
+		DefaultHandler: notFound,
+	}); !errors.Is(err, micro.ErrConfigValidation) {
+		t.Fatalf("Expected error: %v; got: %v", micro.ErrConfigValidation, err)
+	}
+
+	srv, err := micro.AddService(nc, micro.Config{
+		Name:           "test_service",
+		Version:        "0.1.0",
+		DefaultSubject: "svc.>",
+		DefaultHandler: notFound,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer srv.Stop()
+	respond := micro.HandlerFunc(func(r micro.Request) {
+		r.Respond([]byte(r.Subject()))
+	})
+	if err := srv.AddEndpoint("get", respond, micro.WithEndpointSubject("svc.get")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := srv.AddEndpoint("items", respond, micro.WithEndpointSubject("svc.items.*")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Requests to endpoints are only answered by the endpoints.
+	inbox := nats.NewInbox()
+	responses, err := nc.SubscribeSync(inbox)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, subject := range []string{"svc.get", "svc.items.1"} {
+		if err := nc.PublishRequest(subject, inbox, nil); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		resp, err := responses.NextMsg(time.Second)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if string(resp.Data) != subject {
+			t.Fatalf("Invalid response: %q", resp.Data)
+		}
+	}
+	if resp, err := responses.NextMsg(100 * time.Millisecond); err == nil {
+		t.Fatalf("Unexpected response: %+v", resp)
+	}
+
+	resp, err := nc.Request("svc.delete", nil, time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	svcErr, ok := micro.ParseError(resp)
+	if !ok || svcErr.Code != "404" || svcErr.Description != "unknown method" {
+		t.Fatalf("Expected 404 error response; got: %+v", resp.Header)
+	}
+
+	stats := srv.Stats()
+	if stats.NumUnmatched != 1 {
+		t.Fatalf("Expected 1 unmatched request; got: %d", stats.NumUnmatched)
+	}
+	srv.Reset()
+	if n := srv.Stats().NumUnmatched; n != 0 {
+		t.Fatalf("Expected unmatched requests to be reset; got: %d", n)
+	}
+}
+
+func TestEndpointLogSampling(t *testing.T) {
+	s := RunServerOnPort(-1)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Expected to connect to server, got %v", err)
+	}
+	defer nc.Close()
+
+	var mu sync.Mutex
+	var logs []micro.RequestLog
+	srv, err := micro.AddService(nc, micro.Config{
+		Name:    "test_service",
+		Version: "0.1.0",
+		RequestObserver: func(_ micro.Service, l micro.RequestLog) {
+			mu.Lock()
+			logs = append(logs, l)
+			mu.Unlock()
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer srv.Stop()
+
+	handler := micro.HandlerFunc(func(r micro.Request) {
+		if string(r.Data()) == "err" {
+			r.Error("500", "failed", nil)
+			return
+		}
+		r.Respond([]byte("ok"))
+	})
+	for _, rate := range []float64{-0.1, 1.1} {
+		if err := srv.AddEndpoint("invalid", handler, micro.WithEndpointLogSampling(rate)); !errors.Is(err, micro.ErrConfigValidation) {
+			t.Fatalf("Expected error: %v; got: %v", micro.ErrConfigValidation, err)
+		}
+	}
+	if err := srv.AddEndpoint("sampled", handler, micro.WithEndpointLogSampling(0.1)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := srv.AddEndpoint("all", handler); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for i := 0; i < 200; i++ {
+		if _, err := nc.Request("sampled", nil, time.Second); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	for i := 0; i < 20; i++ {
+		if _, err := nc.Request("sampled", []byte("err"), time.Second); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	for i := 0; i < 5; i++ {
+		if _, err := nc.Request("all", nil, time.Second); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	counts := make(map[string]int)
+	for _, l := range logs {
+		key := l.Endpoint
+		if l.Err != nil {
+			key += " errors"
+		}
+		if l.Subject != l.Endpoint {
+			t.Fatalf("Invalid subject for endpoint %q: %q", l.Endpoint, l.Subject)
+		}
+		counts[key]++
+	}
+	// About 10% of successful requests are logged.
+	if n := counts["sampled"]; n < 15 || n > 25 {
+		t.Fatalf("Expected about 20 sampled requests to be logged; got: %d", n)
+	}
+	if n := counts["sampled errors"]; n != 20 {
+		t.Fatalf("Expected all 20 errors to be logged; got: %d", n)
+	}
+	if n := counts["all"]; n != 5 {
+		t.Fatalf("Expected all 5 requests to be logged; got: %d", n)
+	}
+}
 
-			// Malformed request, missing reply subjtct
-			// This should be reflected in errors
-			if err := nc.Publish("test.func", []byte("err")); err != nil {
-				t.Fatalf("Unexpected error: %v", err)
-			}
-			time.Sleep(10 * time.Millisecond)
+func TestServiceGroupStats(t *testing.T) {
+	s := RunServerOnPort(-1)
+	defer s.Shutdown()
 
-			info := srv.Info()
-			resp, err := nc.Request(fmt.Sprintf("$SRV.STATS.test_service.%s", info.ID), nil, 1*time.Second)
-			if err != nil {
-				t.Fatalf("Unexpected error: %v", err)
-			}
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Expected to connect to server, got %v", err)
+	}
+	defer nc.Close()
 
-			var stats micro.Stats
-			if err := json.Unmarshal(resp.Data, &stats); err != nil {
+	handler := micro.HandlerFunc(func(r micro.Request) {
+		r.Respond([]byte("ok"))
+	})
+	srv, err := micro.AddService(nc, micro.Config{
+		Name:       "test_service",
+		Version:    "0.1.0",
+		GroupStats: true,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer srv.Stop()
+
+	if err := srv.AddEndpoint("health", handler); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	orders := srv.AddGroup("orders")
+	if err := orders.AddEndpoint("create", handler); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := orders.AddEndpoint("get", handler); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := orders.AddGroup("admin").AddEndpoint("purge", handler); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	requests := map[string]int{
+		"health":             1,
+		"orders.create":      3,
+		"orders.get":         2,
+		"orders.admin.purge": 4,
+	}
+	for subject, n := range requests {
+		for i := 0; i < n; i++ {
+			if _, err := nc.Request(subject, []byte("msg"), time.Second); err != nil {
 				t.Fatalf("Unexpected error: %v", err)
 			}
+		}
+	}
+	// Malformed request, missing reply subject
+	if err := nc.Publish("orders.admin.purge", []byte("err")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
 
-			if len(stats.Endpoints) != 1 {
-				t.Fatalf("Unexpected number of endpoints: want: %d; got: %d", 1, len(stats.Endpoints))
-			}
-			if stats.Name != info.Name {
-				t.Errorf("Unexpected service name; want: %s; got: %s", info.Name, stats.Name)
-			}
-			if stats.ID != info.ID {
-				t.Errorf("Unexpected service name; want: %s; got: %s", info.ID, stats.ID)
-			}
-			if test.config.Endpoint == nil && stats.Endpoints[0].Name != "func" {
-				t.Errorf("Invalid endpoint name; want: %s; got: %s", "func", stats.Endpoints[0].Name)
-			}
-			if test.config.Endpoint != nil && stats.Endpoints[0].Name != "default" {
-				t.Errorf("Invalid endpoint name; want: %s; got: %s", "default", stats.Endpoints[0].Name)
-			}
-			if stats.Endpoints[0].Subject != "test.func" {
-				t.Errorf("Invalid endpoint subject; want: %s; got: %s", "test.func", stats.Endpoints[0].Subject)
-			}
-			if stats.Endpoints[0].NumRequests != 11 {
-				t.Errorf("Unexpected num_requests; want: 11; got: %d", stats.Endpoints[0].NumRequests)
-			}
-			if stats.Endpoints[0].NumErrors != 1 {
-				t.Errorf("Unexpected num_errors; want: 1; got: %d", stats.Endpoints[0].NumErrors)
-			}
-			if stats.Endpoints[0].AverageProcessingTime == 0 {
-				t.Errorf("Expected non-empty AverageProcessingTime")
-			}
-			if stats.Endpoints[0].ProcessingTime == 0 {
-				t.Errorf("Expected non-empty ProcessingTime")
-			}
-			if stats.Started.IsZero() {
-				t.Errorf("Expected non-empty start time")
-			}
-			if stats.Type != micro.StatsResponseType {
-				t.Errorf("Invalid response type; want: %s; got: %s", micro.StatsResponseType, stats.Type)
-			}
+	resp, err := nc.Request(fmt.Sprintf("$SRV.STATS.test_service.%s", srv.Info().ID), nil, time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var stats micro.Stats
+	if err := json.Unmarshal(resp.Data, &stats); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(stats.Endpoints) != 4 {
+		t.Fatalf("Unexpected number of endpoints: want: %d; got: %d", 4, len(stats.Endpoints))
+	}
+	processingTime := make(map[string]time.Duration)
+	for _, e := range stats.Endpoints {
+		processingTime[e.Subject] = e.ProcessingTime
+	}
 
-			if test.expectedStats != nil {
-				var data map[string]any
-				if err := json.Unmarshal(stats.Endpoints[0].Data, &data); err != nil {
-					t.Fatalf("Unexpected error: %v", err)
-				}
-				if !reflect.DeepEqual(data, test.expectedStats) {
-					t.Fatalf("Invalid data from stats handler; want: %v; got: %v", test.expectedStats, data)
-				}
-			}
-		})
+	expected := []struct {
+		name         string
+		numEndpoints int
+		numRequests  int
+		numErrors    int
+		subjects     []string
+	}{
+		{"orders", 3, 10, 1, []string{"orders.create", "orders.get", "orders.admin.purge"}},
+		{"orders.admin", 1, 5, 1, []string{"orders.admin.purge"}},
+	}
+	if len(stats.Groups) != len(expected) {
+		t.Fatalf("Unexpected number of groups: want: %d; got: %d", len(expected), len(stats.Groups))
+	}
+	for i, want := range expected {
+		got := stats.Groups[i]
+		if got.Name != want.name {
+			t.Fatalf("Invalid group name; want: %s; got: %s", want.name, got.Name)
+		}
+		if got.NumEndpoints != want.numEndpoints {
+			t.Errorf("Unexpected num_endpoints for %q; want: %d; got: %d", want.name, want.numEndpoints, got.NumEndpoints)
+		}
+		if got.NumRequests != want.numRequests {
+			t.Errorf("Unexpected num_requests for %q; want: %d; got: %d", want.name, want.numRequests, got.NumRequests)
+		}
+		if got.NumErrors != want.numErrors {
+			t.Errorf("Unexpected num_errors for %q; want: %d; got: %d", want.name, want.numErrors, got.NumErrors)
+		}
+		var total time.Duration
+		for _, subject := range want.subjects {
+			total += processingTime[subject]
+		}
+		if got.ProcessingTime != total {
+			t.Errorf("Unexpected processing_time for %q; want: %v; got: %v", want.name, total, got.ProcessingTime)
+		}
+		if avg := total / time.Duration(want.numRequests); got.AverageProcessingTime != avg {
+			t.Errorf("Unexpected average_processing_time for %q; want: %v; got: %v", want.name, avg, got.AverageProcessingTime)
+		}
+	}
+
+	// group stats are only reported when enabled
+	srv2, err := micro.AddService(nc, micro.Config{Name: "no_groups", Version: "0.1.0"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer srv2.Stop()
+	if err := srv2.AddGroup("g").AddEndpoint("e", handler); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if groups := srv2.Stats().Groups; groups != nil {
+		t.Fatalf("Expected no group stats; got: %v", groups)
 	}
 }
 
@@ -1247,6 +3805,19 @@ func TestRequestRespond(t *testing.T) {
 			respondData:      []byte("OK"),
 			expectedResponse: []byte("OK"),
 		},
+		{
+			name:             "byte response, header injection",
+			respondHeaders:   micro.Headers{"key": []string{"value\r\nPUB test.func 1\r\nx"}},
+			respondData:      []byte("OK"),
+			withRespondError: nats.ErrInvalidHeader,
+		},
+		{
+			name:             "error, header injection",
+			respondHeaders:   micro.Headers{"key": []string{"value\r\nPUB test.func 1\r\nx"}},
+			errDescription:   "oops",
+			errCode:          "500",
+			withRespondError: nats.ErrInvalidHeader,
+		},
 		{
 			name:             "byte response, connection closed",
 			respondData:      []byte("OK"),
@@ -1529,6 +4100,59 @@ func TestCustomQueueGroup(t *testing.T) {
 				"bar":     "q",
 			},
 		},
+		{
+			name: "queue group derived from service name",
+			endpointInit: func(t *testing.T, nc *nats.Conn) micro.Service {
+				srv, err := micro.AddService(nc, micro.Config{
+					Name:              "test_service",
+					Version:           "0.0.1",
+					ServiceQueueGroup: true,
+					Endpoint: &micro.EndpointConfig{
+						Subject: "foo",
+						Handler: micro.HandlerFunc(func(r micro.Request) {}),
+					},
+				})
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				err = srv.AddGroup("g1").AddEndpoint("bar", micro.HandlerFunc(func(r micro.Request) {}))
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				err = srv.AddEndpoint("baz", micro.HandlerFunc(func(r micro.Request) {}), micro.WithEndpointQueueGroup("custom"))
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				return srv
+			},
+			expectedQueueGroups: map[string]string{
+				"default": "q.test_service",
+				"bar":     "q.test_service",
+				"baz":     "custom",
+			},
+		},
+		{
+			name: "custom queue group overrides queue group derived from service name",
+			endpointInit: func(t *testing.T, nc *nats.Conn) micro.Service {
+				srv, err := micro.AddService(nc, micro.Config{
+					Name:              "test_service",
+					Version:           "0.0.1",
+					QueueGroup:        "custom",
+					ServiceQueueGroup: true,
+					Endpoint: &micro.EndpointConfig{
+						Subject: "foo",
+						Handler: micro.HandlerFunc(func(r micro.Request) {}),
+					},
+				})
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				return srv
+			},
+			expectedQueueGroups: map[string]string{
+				"default": "custom",
+			},
+		},
 		{
 			name: "custom queue group on service config",
 			endpointInit: func(t *testing.T, nc *nats.Conn) micro.Service {
@@ -1799,3 +4423,211 @@ func TestCustomQueueGroupMultipleResponses(t *testing.T) {
 		}
 	}
 }
+
+func TestServiceQueueGroupSharedSubject(t *testing.T) {
+	for _, test := range []struct {
+		name              string
+		serviceQueueGroup bool
+		expectedResponses int
+	}{
+		{name: "default queue group", serviceQueueGroup: false, expectedResponses: 1},
+		{name: "queue group derived from service name", serviceQueueGroup: true, expectedResponses: 2},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			s := RunServerOnPort(-1)
+			defer s.Shutdown()
+
+			nc, err := nats.Connect(s.ClientURL())
+			if err != nil {
+				t.Fatalf("Expected to connect to server, got %v", err)
+			}
+			defer nc.Close()
+
+			for _, name := range []string{"service_a", "service_b"} {
+				srv, err := micro.AddService(nc, micro.Config{
+					Name:              name,
+					Version:           "0.0.1",
+					ServiceQueueGroup: test.serviceQueueGroup,
+					Endpoint: &micro.EndpointConfig{
+						Subject: "foo",
+						Handler: micro.HandlerFunc(func(r micro.Request) {
+							r.Respond([]byte(name))
+						}),
+					},
+				})
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				defer srv.Stop()
+			}
+
+			sub, err := nc.SubscribeSync("rply")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			defer sub.Unsubscribe()
+			if err := nc.PublishRequest("foo", "rply", []byte("req")); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			responses := make(map[string]bool)
+			for i := 0; i < test.expectedResponses; i++ {
+				msg, err := sub.NextMsg(time.Second)
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				responses[string(msg.Data)] = true
+			}
+			if msg, err := sub.NextMsg(100 * time.Millisecond); err == nil {
+				t.Fatalf("Unexpected message: %s", msg.Data)
+			}
+			if len(responses) != test.expectedResponses {
+				t.Fatalf("Expected responses from %d services; got: %v", test.expectedResponses, responses)
+			}
+		})
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	handler := micro.HandlerFunc(func(micro.Request) {})
+	valid := func() micro.Config {
+		return micro.Config{
+			Name:    "test_service",
+			Version: "0.1.0",
+			Endpoint: &micro.EndpointConfig{
+				Subject: "test.default",
+				Handler: handler,
+			},
+			Endpoints: map[string]micro.EndpointConfig{
+				"add": {Handler: handler},
+			},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(*micro.Config)
+		withErr string
+	}{
+		{
+			name:   "valid config",
+			modify: func(*micro.Config) {},
+		},
+		{
+			name:    "invalid name",
+			modify:  func(c *micro.Config) { c.Name = "test_service!" },
+			withErr: "service name",
+		},
+		{
+			name:    "invalid version",
+			modify:  func(c *micro.Config) { c.Version = "abc" },
+			withErr: "version",
+		},
+		{
+			name:    "invalid queue group",
+			modify:  func(c *micro.Config) { c.QueueGroup = "q g" },
+			withErr: "queue group",
+		},
+		{
+			name: "default endpoint configured twice",
+			modify: func(c *micro.Config) {
+				c.Endpoints["default"] = micro.EndpointConfig{Handler: handler}
+			},
+			withErr: "already configured",
+		},
+		{
+			name:    "negative monitoring response jitter",
+			modify:  func(c *micro.Config) { c.MonitoringResponseJitter = -time.Second },
+			withErr: "monitoring response jitter",
+		},
+		{
+			name: "invalid default subject",
+			modify: func(c *micro.Config) {
+				c.DefaultHandler = handler
+				c.DefaultSubject = "test default"
+			},
+			withErr: "default subject",
+		},
+		{
+			name:    "default subject without handler",
+			modify:  func(c *micro.Config) { c.DefaultSubject = "test.>" },
+			withErr: "default handler",
+		},
+		{
+			name:    "negative compression threshold",
+			modify:  func(c *micro.Config) { c.CompressionThreshold = -1 },
+			withErr: "compression threshold",
+		},
+		{
+			name:    "negative stats push interval",
+			modify:  func(c *micro.Config) { c.StatsPushInterval = -time.Second },
+			withErr: "stats push interval",
+		},
+		{
+			name:    "stats push without subject",
+			modify:  func(c *micro.Config) { c.StatsPushInterval = time.Second },
+			withErr: "stats push subject",
+		},
+		{
+			name: "invalid endpoint name",
+			modify: func(c *micro.Config) {
+				c.Endpoints["add!"] = micro.EndpointConfig{Subject: "add", Handler: handler}
+			},
+			withErr: `endpoint "add!": validation: invalid endpoint name`,
+		},
+		{
+			name:    "invalid endpoint subject",
+			modify:  func(c *micro.Config) { c.Endpoint.Subject = "test default" },
+			withErr: `endpoint "default": validation: invalid endpoint subject`,
+		},
+		{
+			name: "invalid endpoint queue group",
+			modify: func(c *micro.Config) {
+				c.Endpoints["add"] = micro.EndpointConfig{QueueGroup: "q g", Handler: handler}
+			},
+			withErr: `endpoint "add": validation: invalid endpoint queue group`,
+		},
+		{
+			name: "invalid transformed subject",
+			modify: func(c *micro.Config) {
+				c.SubjectTransformer = func(subject string) string { return "" }
+			},
+			withErr: "invalid transformed endpoint subject",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := valid()
+			test.modify(&cfg)
+			err := micro.ValidateConfig(cfg)
+			if test.withErr == "" {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, micro.ErrConfigValidation) {
+				t.Fatalf("Expected error: %v; got: %v", micro.ErrConfigValidation, err)
+			}
+			if !strings.Contains(err.Error(), test.withErr) {
+				t.Fatalf("Expected error containing %q; got: %v", test.withErr, err)
+			}
+		})
+	}
+
+	t.Run("all problems reported", func(t *testing.T) {
+		cfg := valid()
+		cfg.Name = ""
+		cfg.Version = ""
+		cfg.CompressionThreshold = -1
+		cfg.Endpoint.Subject = "test default"
+		err := micro.ValidateConfig(cfg)
+		joined, ok := err.(interface{ Unwrap() []error })
+		if !ok {
+			t.Fatalf("Expected joined errors; got: %v", err)
+		}
+		if errs := joined.Unwrap(); len(errs) != 4 {
+			t.Fatalf("Expected 4 errors; got: %d (%v)", len(errs), err)
+		}
+	})
+}
@@ -61,6 +61,7 @@ const (
 	DefaultReconnectBufSize   = 8 * 1024 * 1024 // 8MB
 	RequestChanLen            = 8
 	DefaultDrainTimeout       = 30 * time.Second
+	DefaultReconnectHistory   = 10
 	DefaultFlusherTimeout     = time.Minute
 	LangString                = "go"
 )
@@ -101,6 +102,7 @@ var (
 	ErrSecureConnWanted            = errors.New("nats: secure connection not available")
 	ErrBadSubscription             = errors.New("nats: invalid subscription")
 	ErrTypeSubscription            = errors.New("nats: invalid subscription type")
+	ErrSubscriptionDrained         = errors.New("nats: subscription drained")
 	ErrBadSubject                  = errors.New("nats: invalid subject")
 	ErrBadQueueName                = errors.New("nats: invalid queue name")
 	ErrSlowConsumer                = errors.New("nats: slow consumer, messages dropped")
@@ -142,10 +144,13 @@ var (
 	ErrDisconnected                = errors.New("nats: server is disconnected")
 	ErrHeadersNotSupported         = errors.New("nats: headers not supported by this server")
 	ErrBadHeaderMsg                = errors.New("nats: message could not decode headers")
+	ErrInvalidHeader               = errors.New("nats: invalid header")
 	ErrNoResponders                = errors.New("nats: no responders available for request")
+	ErrRequestCanceled             = errors.New("nats: request canceled")
 	ErrMaxConnectionsExceeded      = errors.New("nats: server maximum connections exceeded")
 	ErrConnectionNotTLS            = errors.New("nats: connection is not tls")
 	ErrMaxSubscriptionsExceeded    = errors.New("nats: server maximum subscriptions exceeded")
+	ErrOutboundFull                = errors.New("nats: outbound queue is full")
 )
 
 // GetDefaultOptions returns default configuration options for the client.
@@ -290,7 +295,8 @@ type Options struct {
 	Servers []string
 
 	// NoRandomize configures whether we will randomize the
-	// server pool.
+	// server pool. When randomized, the pool is shuffled again
+	// after each full reconnect pass over the servers.
 	NoRandomize bool
 
 	// NoEcho configures whether the server will echo back messages
@@ -328,6 +334,12 @@ type Options struct {
 	// first, the connection will fail.
 	TLSHandshakeFirst bool
 
+	// NoTLSSessionCache disables caching TLS sessions, which otherwise
+	// allows resuming them when reconnecting instead of performing a full
+	// handshake. It has no effect if TLSConfig sets a ClientSessionCache,
+	// which is then used instead.
+	NoTLSSessionCache bool
+
 	// RootCAsCB is used to fetch and return a set of root certificate
 	// authorities that clients use when verifying server certificates.
 	RootCAsCB RootCAsHandler
@@ -355,6 +367,19 @@ type Options struct {
 	// jitter to prevent all connections to attempt reconnecting at the same time.
 	CustomReconnectDelayCB ReconnectDelayHandler
 
+	// PreReconnectCallback is invoked with a copy of the current options
+	// when the connection is lost, before any reconnect attempt is made.
+	// It allows the application to return updated options, e.g. a new
+	// server list, TLS configuration or credentials, which are used for
+	// reconnecting from then on. Returning nil keeps the current options.
+	// Invalid options are reported to the AsyncErrorCB and ignored.
+	// Only the servers (Url, Servers, NoRandomize), TLS (Secure,
+	// TLSConfig, TLSHandshakeFirst, TLSCertCB, RootCAsCB) and
+	// authentication (UserJWT, Nkey, SignatureCB, User, Password,
+	// UserInfo, Token, TokenHandler) options are applied, changes to
+	// other options are ignored.
+	PreReconnectCallback func(*Options) *Options
+
 	// ReconnectJitter sets the upper bound for a random delay added to
 	// ReconnectWait during a reconnect when no TLS is used.
 	// Defaults to 100ms.
@@ -422,11 +447,70 @@ type Options struct {
 	// AsyncErrorCB sets the async error handler (e.g. slow consumer errors)
 	AsyncErrorCB ErrHandler
 
+	// FlushCB is invoked asynchronously with the round trip time measured
+	// by each successful Flush, FlushTimeout or FlushWithContext call. It
+	// is not invoked for flushes which fail or time out.
+	FlushCB func(rtt time.Duration)
+
 	// ReconnectBufSize is the size of the backing bufio during reconnect.
 	// Once this has been exhausted publish operations will return an error.
 	// Defaults to 8388608 bytes (8MB).
 	ReconnectBufSize int
 
+	// ReconnectBufMsgs is the maximum number of messages kept while
+	// reconnecting. Once reached, publish operations will return an error,
+	// even if ReconnectBufSize has not been exhausted.
+	// Defaults to 0, which means no limit on the number of messages.
+	ReconnectBufMsgs int
+
+	// ReaderBufSize is the size of the buffer used to read from the
+	// connection. Protocol lines longer than the buffer, e.g. an INFO
+	// with a large list of connect URLs, are read in several chunks.
+	// Defaults to 32KB.
+	ReaderBufSize int
+
+	// OutboundQueueSize enables an in-memory queue of published messages
+	// of the given size. Publish calls add messages to the queue, which
+	// are written to the connection in order by a background go routine,
+	// so that producers are not stalled by the socket or reconnects.
+	// Messages which do not fit in the reconnect buffer are kept in the
+	// queue and sent once reconnected. Flush and Drain wait for the queue
+	// to be emptied, while Close discards the queued messages.
+	// Defaults to 0 (disabled).
+	OutboundQueueSize int
+
+	// OutboundFullPolicy determines whether Publish blocks or returns
+	// ErrOutboundFull when the outbound queue is full.
+	// Defaults to OutboundFullError.
+	OutboundFullPolicy OutboundFullPolicy
+
+	// ReconnectHistorySize is the number of most recent reconnect events
+	// kept by the connection and returned by ReconnectHistory.
+	// Defaults to 10. It can be disabled by setting it to -1.
+	ReconnectHistorySize int
+
+	// SharedDispatcher enables delivering messages to all asynchronous
+	// subscriptions from a shared pool of goroutines, instead of starting
+	// a goroutine for each subscription. Messages of a single subscription
+	// are still delivered in order, one at a time, but a slow message
+	// handler delays delivery to other subscriptions.
+	SharedDispatcher bool
+
+	// SharedDispatcherWorkers is the number of goroutines used by the
+	// shared dispatcher. Defaults to DefaultSharedDispatcherWorkers.
+	SharedDispatcherWorkers int
+
+	// MaxAsyncCallbacks limits the number of message handlers of
+	// asynchronous subscriptions executing concurrently on the connection,
+	// regardless of the number of subscriptions. Messages waiting for a
+	// handler to complete stay pending on their subscription and count
+	// against its pending limits. Handlers should not wait for messages
+	// delivered to other asynchronous subscriptions of the connection,
+	// as these may not be delivered once the limit is reached.
+	// Responses to requests are not subject to the limit.
+	// Defaults to 0 (unlimited).
+	MaxAsyncCallbacks int
+
 	// SubChanLen is the size of the buffered channel used between the socket
 	// Go routine and the message delivery for SyncSubscriptions.
 	// NOTE: This does not affect AsyncSubscriptions which are
@@ -437,6 +521,16 @@ type Options struct {
 	// UserJWT sets the callback handler that will fetch a user's JWT.
 	UserJWT UserJWTHandler
 
+	// ReconnectJWTCallback sets the callback handler that will fetch a
+	// fresh user's JWT when reconnecting after the server reported that
+	// the user authentication expired. If not set, UserJWT is used.
+	ReconnectJWTCallback UserJWTHandler
+
+	// AuthExpiredCB sets the handler called whenever the server reports
+	// that the user authentication expired, allowing the application to
+	// refresh its credentials before the client reconnects.
+	AuthExpiredCB ConnHandler
+
 	// Nkey sets the public nkey that will be used to authenticate
 	// when connecting to the server. UserJWT and Nkey are mutually exclusive
 	// and if defined, UserJWT will take precedence.
@@ -505,6 +599,21 @@ type Options struct {
 	// InboxPrefix allows the default _INBOX prefix to be customized
 	InboxPrefix string
 
+	// SubjectPrefix namespaces all traffic of the connection. It is
+	// prepended to the subjects of published messages and subscriptions
+	// and to inbox reply subjects, and stripped from the subject and reply
+	// of delivered messages, so that the application only deals with
+	// unprefixed subjects. Responses to requests are published within
+	// the namespace, even if the reply subject does not carry the prefix.
+	// Service endpoint and monitoring ($SRV.) subjects are prefixed, so
+	// that services are only visible within the namespace.
+	// SubjectPrefix is not compatible with JetStream: subjects carried in
+	// JetStream API payloads, such as stream subjects and consumer filters,
+	// are not namespaced, so creating a JetStream context (including KV and
+	// object store) on such a connection returns
+	// ErrSubjectPrefixNotSupported.
+	SubjectPrefix string
+
 	// IgnoreAuthErrorAbort - if set to true, client opts out of the default connect behavior of aborting
 	// subsequent reconnect attempts if server returns the same auth error twice (regardless of reconnect policy).
 	IgnoreAuthErrorAbort bool
@@ -512,10 +621,74 @@ type Options struct {
 	// SkipHostLookup skips the DNS lookup for the server hostname.
 	SkipHostLookup bool
 
+	// IPResolutionOrder determines the address families used, and in
+	// which order, when connecting and reconnecting to servers.
+	// Defaults to IPResolutionAny, letting the resolver and the OS pick.
+	IPResolutionOrder IPResolutionOrder
+
 	// PermissionErrOnSubscribe - if set to true, the client will return ErrPermissionViolation
 	// from SubscribeSync if the server returns a permissions error for a subscription.
 	// Defaults to false.
 	PermissionErrOnSubscribe bool
+
+	// TCPDelay enables Nagle's algorithm, making the operating system
+	// delay packet transmission in hopes of sending fewer packets. It is
+	// applied to TCP connections only and is ignored if a CustomDialer
+	// returns a connection of a different type.
+	// Go sets TCP_NODELAY on the connections it dials, so the option is
+	// inverted: its zero value, including in Options built without
+	// GetDefaultOptions, keeps TCP_NODELAY set. Use the TCPNoDelay option
+	// to set it.
+	TCPDelay bool
+
+	// FlushOnPublish makes every publish write the message to the socket
+	// synchronously, bypassing the flusher Go routine. This lowers latency
+	// for low-rate request/reply workloads at the expense of throughput.
+	// Defaults to false.
+	FlushOnPublish bool
+
+	// FlushChanBuf sets the size of the channel used to wake up the flusher
+	// Go routine when messages are published. A pending wake up flushes
+	// everything buffered by the time the flusher runs, so a larger size
+	// only allows more wake ups to be queued under load. It has no effect
+	// when FlushOnPublish is set. Defaults to 1.
+	FlushChanBuf int
+
+	// TCPKeepAlive sets the keep-alive period for TCP connections. If zero,
+	// the dialer's defaults are used. If negative, keep-alive probes are
+	// disabled. It is ignored if a CustomDialer returns a connection which
+	// is not a TCP connection.
+	TCPKeepAlive time.Duration
+
+	// ProtocolTraceWriter, if set, receives every protocol line sent to
+	// and received from the server, encoded as a JSON ProtocolTraceEntry
+	// per line. Credentials in CONNECT are redacted. Intended for debugging
+	// only.
+	ProtocolTraceWriter io.Writer
+
+	// ProtocolTracePayloads includes message payloads (truncated to
+	// ProtocolTraceMaxPayload bytes) in the protocol trace. Payloads may
+	// contain sensitive data, so this defaults to false.
+	ProtocolTracePayloads bool
+
+	// ReplayBufferMsgs is the number of most recently published messages
+	// kept per subject for SubscribeWithReplay. Only messages published
+	// on this connection are kept. Zero disables the replay buffer.
+	ReplayBufferMsgs int
+
+	// ReplayBufferSubjects bounds the number of subjects kept in the
+	// replay buffer. When exceeded, the least recently published subject
+	// is evicted.
+	ReplayBufferSubjects int
+
+	// wrapConn, if set, wraps connections to the server once established.
+	// It is only set in tests, to inject transport faults.
+	wrapConn func(net.Conn) net.Conn
+
+	// poolRand, if set, is used instead of a time seeded source to
+	// shuffle the server pool. It is only set in tests, to make the
+	// order deterministic.
+	poolRand *rand.Rand
 }
 
 const (
@@ -525,7 +698,7 @@ const (
 	// The size of the bufio reader/writer on top of the socket.
 	defaultBufSize = 32768
 
-	// The buffered size of the flush "kick" channel
+	// The default buffered size of the flush "kick" channel
 	flushChanSize = 1
 
 	// Default server pool size
@@ -548,6 +721,11 @@ type Conn struct {
 	// struct and make sure they are all 64bits (or use padding if necessary).
 	// atomic.* functions crash on 32bit machines if operand is not aligned
 	// at 64bit. See https://github.com/golang/go/issues/599
+	//
+	// Statistics are updated with atomic operations.
+	//
+	// Deprecated: reading the counters directly is racy, use [Conn.Stats]
+	// to get a consistent snapshot instead.
 	Statistics
 	mu sync.RWMutex
 	// Opts holds the configuration of the Conn.
@@ -558,6 +736,7 @@ type Conn struct {
 	current       *srv
 	urls          map[string]struct{} // Keep track of all known URLs (used by processInfo)
 	conn          net.Conn
+	tlsSessions   tls.ClientSessionCache // kept across reconnects
 	bw            *natsWriter
 	br            *natsReader
 	fch           chan struct{}
@@ -566,6 +745,7 @@ type Conn struct {
 	subsMu        sync.RWMutex
 	subs          map[int64]*Subscription
 	ach           *asyncCallbacksHandler
+	subDispatcher *subDispatcher
 	pongs         []chan struct{}
 	scratch       [scratchSize]byte
 	status        Status
@@ -573,11 +753,16 @@ type Conn struct {
 	initc         bool // true if the connection is performing the initial connect
 	err           error
 	ps            *parseState
+	tracer        *protoTracer
+	replay        *replayBuffer
 	ptmr          *time.Timer
 	pout          int
 	ar            bool // abort reconnect
+	authExpired   bool // true if the server reported the user authentication expired
+	reconnects    []ReconnectEvent
 	rqch          chan struct{}
-	ws            bool // true if a websocket connection
+	ws            bool   // true if a websocket connection
+	subjPrefix    string // subject prefix including trailing ., if set
 
 	// New style response handler
 	respSub       string               // The wildcard subject
@@ -586,6 +771,9 @@ type Conn struct {
 	respMux       *Subscription        // A single response subscription
 	respMap       map[string]chan *Msg // Request map for the response msg channels
 	respRand      *rand.Rand           // Used for generating suffix
+	inflight      inflightRequests     // Requests waiting for a response
+	outq          *outboundQueue       // Queue of published messages, if enabled
+	cbSem         chan struct{}        // Limits concurrent message callbacks, if set
 
 	// Msg filters for testing.
 	// Protected by subsMu
@@ -601,10 +789,16 @@ type natsReader struct {
 
 type natsWriter struct {
 	w       io.Writer
+	conn    io.Closer
+	err     error
 	bufs    []byte
 	limit   int
 	pending *bytes.Buffer
 	plimit  int
+	pmsgs   int
+	pmlimit int
+	// connection stats, updated atomically on each flush
+	stats *Statistics
 }
 
 // Subscription represents interest in a given subject.
@@ -630,10 +824,13 @@ type Subscription struct {
 	mcb            MsgHandler
 	mch            chan *Msg
 	errCh          chan (error)
+	errs           chan error
+	errsClosed     bool
 	closed         bool
 	sc             bool
 	connClosed     bool
 	draining       bool
+	drained        bool // set once a drain completed
 	status         SubStatus
 	statListeners  map[chan SubStatus][]SubStatus
 	permissionsErr error
@@ -647,6 +844,15 @@ type Subscription struct {
 	pCond *sync.Cond
 	pDone func(subject string)
 
+	// Shared dispatcher delivering messages, if used, and whether
+	// the subscription is queued or being dispatched.
+	dispatcher *subDispatcher
+	scheduled  bool
+
+	// Filter set with SubscribeFiltered and number of messages it discarded.
+	filter   func(*Msg) bool
+	filtered int
+
 	// Pending stats, async subscriptions, high-speed etc.
 	pMsgs       int
 	pBytes      int
@@ -655,6 +861,17 @@ type Subscription struct {
 	pMsgsLimit  int
 	pBytesLimit int
 	dropped     int
+
+	// Ring of the subjects of the last dropped messages,
+	// only set if enabled with CaptureDroppedSubjects.
+	droppedSubjs []string
+	droppedNext  int
+	droppedFull  bool
+
+	// Messages pending for longer than maxMsgAge are not delivered,
+	// see SetMaxMsgAge.
+	maxMsgAge    time.Duration
+	droppedByAge int
 }
 
 // Status represents the state of the connection.
@@ -710,6 +927,11 @@ type Msg struct {
 	wsz     int
 	barrier *barrierInfo
 	ackd    uint32
+	// raw header block of a received message
+	rawHdr []byte
+	// when the message was received, only set if the subscription
+	// has a maximum message age
+	received time.Time
 }
 
 // Compares two msgs, ignores sub but checks all other public fields.
@@ -752,11 +974,36 @@ func (m *Msg) Size() int {
 	return len(m.Subject) + len(m.Reply) + len(hdr) + len(m.Data)
 }
 
+// HeaderBytes returns the header block of the message in wire format.
+// For received messages, it is the header block as received from the
+// server, which shares its memory with the message and is returned
+// without copying, so it must not be modified. Changes made to Header
+// after the message was received are not reflected. For other messages,
+// the headers are encoded, returning nil if they cannot be.
+func (m *Msg) HeaderBytes() []byte {
+	if m.rawHdr != nil {
+		return m.rawHdr
+	}
+	hdr, _ := m.headerBytes()
+	return hdr
+}
+
+// PayloadSize returns the size of the header block and data of the
+// message in bytes, without the subjects accounted for by Size.
+// For received messages, headers are not encoded to compute it.
+func (m *Msg) PayloadSize() int {
+	return len(m.HeaderBytes()) + len(m.Data)
+}
+
 func (m *Msg) headerBytes() ([]byte, error) {
 	var hdr []byte
 	if len(m.Header) == 0 {
 		return hdr, nil
 	}
+	// Reject headers which would corrupt the protocol.
+	if err := m.Header.validate(); err != nil {
+		return nil, err
+	}
 
 	var b bytes.Buffer
 	_, err := b.WriteString(hdrLine)
@@ -790,6 +1037,36 @@ type Statistics struct {
 	InBytes    uint64
 	OutBytes   uint64
 	Reconnects uint64
+
+	// FlusherWakeups is the number of times the flusher Go routine
+	// was woken up to write buffered data to the socket.
+	FlusherWakeups uint64
+	// Flushes is the number of writes of buffered data to the socket,
+	// and FlushedBytes the number of bytes written by them.
+	Flushes      uint64
+	FlushedBytes uint64
+}
+
+// AvgBytesPerFlush returns the average number of bytes written to the
+// socket per flush. A low value relative to the size of published
+// messages indicates that writes are poorly coalesced.
+func (s Statistics) AvgBytesPerFlush() float64 {
+	if s.Flushes == 0 {
+		return 0
+	}
+	return float64(s.FlushedBytes) / float64(s.Flushes)
+}
+
+// ReconnectEvent describes a successful reconnect of the connection.
+type ReconnectEvent struct {
+	// Time is the time at which the connection was re-established.
+	Time time.Time
+	// PreviousURL is the URL of the server the connection was lost from.
+	PreviousURL string
+	// URL is the URL of the server the connection reconnected to.
+	URL string
+	// Disconnected is the time spent disconnected.
+	Disconnected time.Duration
 }
 
 // Tracks individual backend servers.
@@ -1064,6 +1341,15 @@ func CustomReconnectDelay(cb ReconnectDelayHandler) Option {
 	}
 }
 
+// PreReconnectHandler is an Option to set the PreReconnectCallback option.
+// See PreReconnectCallback Option for more details.
+func PreReconnectHandler(cb func(*Options) *Options) Option {
+	return func(o *Options) error {
+		o.PreReconnectCallback = cb
+		return nil
+	}
+}
+
 // PingInterval is an Option to set the period for client ping commands.
 // Defaults to 2m.
 func PingInterval(t time.Duration) Option {
@@ -1092,6 +1378,54 @@ func ReconnectBufSize(size int) Option {
 	}
 }
 
+// ReconnectHistorySize sets the number of most recent reconnect events
+// returned by ReconnectHistory. Defaults to 10. It can be disabled by setting it to -1.
+func ReconnectHistorySize(size int) Option {
+	return func(o *Options) error {
+		o.ReconnectHistorySize = size
+		return nil
+	}
+}
+
+// ReconnectBufMsgs sets the maximum number of messages kept while busy reconnecting.
+// Both this limit and ReconnectBufSize apply, whichever is reached first.
+// Defaults to 0, which means the number of messages is not limited.
+func ReconnectBufMsgs(msgs int) Option {
+	return func(o *Options) error {
+		if msgs < 0 {
+			return errors.New("nats: reconnect buffer messages limit cannot be negative")
+		}
+		o.ReconnectBufMsgs = msgs
+		return nil
+	}
+}
+
+// ReaderBufSize sets the size of the buffer used to read from the connection.
+// Defaults to 32KB.
+func ReaderBufSize(size int) Option {
+	return func(o *Options) error {
+		if size <= 0 {
+			return errors.New("nats: reader buffer size must be greater than 0")
+		}
+		o.ReaderBufSize = size
+		return nil
+	}
+}
+
+// OutboundQueue is an Option to enable a queue of published messages of
+// the given size, written to the connection in order by a background
+// go routine. See OutboundQueueSize Option for more details.
+func OutboundQueue(size int, policy OutboundFullPolicy) Option {
+	return func(o *Options) error {
+		if size <= 0 {
+			return errors.New("nats: outbound queue size must be greater than 0")
+		}
+		o.OutboundQueueSize = size
+		o.OutboundFullPolicy = policy
+		return nil
+	}
+}
+
 // Timeout is an Option to set the timeout for Dial on a connection.
 // Defaults to 2s.
 func Timeout(t time.Duration) Option {
@@ -1151,6 +1485,34 @@ func ReconnectHandler(cb ConnHandler) Option {
 	}
 }
 
+// FlushHandler is an Option to set the callback invoked with the round trip
+// time of each successful flush.
+func FlushHandler(cb func(rtt time.Duration)) Option {
+	return func(o *Options) error {
+		o.FlushCB = cb
+		return nil
+	}
+}
+
+// ReconnectJWTHandler is an Option to set the callback handler fetching
+// a fresh user's JWT when reconnecting after the user authentication
+// expired. The nonce is signed using the SignatureCB set with UserJWT.
+func ReconnectJWTHandler(cb UserJWTHandler) Option {
+	return func(o *Options) error {
+		o.ReconnectJWTCallback = cb
+		return nil
+	}
+}
+
+// AuthExpiredHandler is an Option to set the handler called when the
+// server reports that the user authentication expired.
+func AuthExpiredHandler(cb ConnHandler) Option {
+	return func(o *Options) error {
+		o.AuthExpiredCB = cb
+		return nil
+	}
+}
+
 // ClosedHandler is an Option to set the closed handler.
 func ClosedHandler(cb ConnHandler) Option {
 	return func(o *Options) error {
@@ -1294,6 +1656,31 @@ func Nkey(pubKey string, sigCB SignatureHandler) Option {
 	}
 }
 
+// SharedDispatcher is an Option to deliver messages to all asynchronous
+// subscriptions using a shared pool of goroutines, reducing the number of
+// goroutines for applications with many subscriptions. If workers is not
+// positive, DefaultSharedDispatcherWorkers is used.
+func SharedDispatcher(workers int) Option {
+	return func(o *Options) error {
+		o.SharedDispatcher = true
+		o.SharedDispatcherWorkers = workers
+		return nil
+	}
+}
+
+// MaxAsyncCallbacks is an Option to limit the number of message handlers
+// of asynchronous subscriptions executing concurrently on the connection.
+// See MaxAsyncCallbacks Option for more details.
+func MaxAsyncCallbacks(n int) Option {
+	return func(o *Options) error {
+		if n <= 0 {
+			return errors.New("nats: max async callbacks must be greater than 0")
+		}
+		o.MaxAsyncCallbacks = n
+		return nil
+	}
+}
+
 // SyncQueueLen will set the maximum queue len for the internal
 // channel used for SubscribeSync().
 // Defaults to 65536.
@@ -1392,6 +1779,21 @@ func CustomInboxPrefix(p string) Option {
 	}
 }
 
+// SubjectPrefix is an Option to namespace all subjects used by the connection
+// under the given prefix, e.g. "tenant-a" publishes "foo" as "tenant-a.foo".
+// Delivered messages have the prefix stripped from their subject and reply.
+// JetStream, KV and object store are not supported on connections using
+// this option, see Options.SubjectPrefix.
+func SubjectPrefix(prefix string) Option {
+	return func(o *Options) error {
+		if prefix == "" || badSubject(prefix) || strings.ContainsAny(prefix, "*>") {
+			return errors.New("nats: invalid subject prefix")
+		}
+		o.SubjectPrefix = prefix
+		return nil
+	}
+}
+
 // IgnoreAuthErrorAbort opts out of the default connect behavior of aborting
 // subsequent reconnect attempts if server returns the same auth error twice.
 func IgnoreAuthErrorAbort() Option {
@@ -1401,6 +1803,18 @@ func IgnoreAuthErrorAbort() Option {
 	}
 }
 
+// IPResolution is an Option to set the address families used, and in which
+// order, when connecting and reconnecting to servers.
+func IPResolution(order IPResolutionOrder) Option {
+	return func(o *Options) error {
+		if !order.valid() {
+			return fmt.Errorf("nats: invalid IP resolution order %q", order)
+		}
+		o.IPResolutionOrder = order
+		return nil
+	}
+}
+
 // SkipHostLookup is an Option to skip the host lookup when connecting to a server.
 func SkipHostLookup() Option {
 	return func(o *Options) error {
@@ -1416,6 +1830,67 @@ func PermissionErrOnSubscribe(enabled bool) Option {
 	}
 }
 
+// TCPNoDelay is an Option to enable or disable Nagle's algorithm on the
+// underlying TCP connection. Defaults to true.
+func TCPNoDelay(enabled bool) Option {
+	return func(o *Options) error {
+		o.TCPDelay = !enabled
+		return nil
+	}
+}
+
+// TCPKeepAlive is an Option to set the keep-alive period for the underlying
+// TCP connection. A negative value disables keep-alive probes.
+func TCPKeepAlive(period time.Duration) Option {
+	return func(o *Options) error {
+		o.TCPKeepAlive = period
+		return nil
+	}
+}
+
+// FlushOnPublish is an Option to flush the outbound buffer synchronously
+// on every publish instead of relying on the flusher Go routine.
+// This trades throughput for latency and should only be used for
+// latency-critical, low-rate workloads.
+func FlushOnPublish() Option {
+	return func(o *Options) error {
+		o.FlushOnPublish = true
+		return nil
+	}
+}
+
+// ReplayBuffer is an Option to keep the last msgsPerSubject messages
+// published on this connection for up to maxSubjects subjects, so that
+// they can be delivered to new local subscribers with SubscribeWithReplay.
+// Memory is bounded by msgsPerSubject*maxSubjects messages.
+func ReplayBuffer(msgsPerSubject, maxSubjects int) Option {
+	return func(o *Options) error {
+		o.ReplayBufferMsgs = msgsPerSubject
+		o.ReplayBufferSubjects = maxSubjects
+		return nil
+	}
+}
+
+// FlushChanBuf is an Option to set the size of the channel used to wake
+// up the flusher Go routine. See Options.FlushChanBuf.
+func FlushChanBuf(size int) Option {
+	return func(o *Options) error {
+		o.FlushChanBuf = size
+		return nil
+	}
+}
+
+// ProtocolTrace is an Option to write a JSON trace of the protocol
+// exchanged with the server to w. Message payloads are only included
+// when includePayloads is true.
+func ProtocolTrace(w io.Writer, includePayloads bool) Option {
+	return func(o *Options) error {
+		o.ProtocolTraceWriter = w
+		o.ProtocolTracePayloads = includePayloads
+		return nil
+	}
+}
+
 // TLSHandshakeFirst is an Option to perform the TLS handshake first, that is
 // before receiving the INFO protocol. This requires the server to also be
 // configured with such option, otherwise the connection will fail.
@@ -1427,6 +1902,15 @@ func TLSHandshakeFirst() Option {
 	}
 }
 
+// NoTLSSessionCache is an Option to disable the TLS session cache used
+// to resume TLS sessions when reconnecting.
+func NoTLSSessionCache() Option {
+	return func(o *Options) error {
+		o.NoTLSSessionCache = true
+		return nil
+	}
+}
+
 // Handler processing
 
 // SetDisconnectHandler will set the disconnect event handler.
@@ -1558,45 +2042,16 @@ func processUrlString(url string) []string {
 // Connect will attempt to connect to a NATS server with multiple options.
 func (o Options) Connect() (*Conn, error) {
 	nc := &Conn{Opts: o}
+	nc.tracer = newProtoTracer(o.ProtocolTraceWriter, o.ProtocolTracePayloads)
 
-	// Some default options processing.
-	if nc.Opts.MaxPingsOut == 0 {
-		nc.Opts.MaxPingsOut = DefaultMaxPingOut
-	}
-	// Allow old default for channel length to work correctly.
-	if nc.Opts.SubChanLen == 0 {
-		nc.Opts.SubChanLen = DefaultMaxChanLen
-	}
-	// Default ReconnectBufSize
-	if nc.Opts.ReconnectBufSize == 0 {
-		nc.Opts.ReconnectBufSize = DefaultReconnectBufSize
-	}
-	// Ensure that Timeout is not 0
-	if nc.Opts.Timeout == 0 {
-		nc.Opts.Timeout = DefaultTimeout
-	}
-
-	// Check first for user jwt callback being defined and nkey.
-	if nc.Opts.UserJWT != nil && nc.Opts.Nkey != "" {
-		return nil, ErrNkeyAndUser
-	}
-
-	// Check if we have an nkey but no signature callback defined.
-	if nc.Opts.Nkey != "" && nc.Opts.SignatureCB == nil {
-		return nil, ErrNkeyButNoSigCB
+	if err := nc.Opts.setDefaults(); err != nil {
+		return nil, err
 	}
-
-	// Allow custom Dialer for connecting using a timeout by default
-	if nc.Opts.Dialer == nil {
-		nc.Opts.Dialer = &net.Dialer{
-			Timeout: nc.Opts.Timeout,
-		}
+	if nc.Opts.ReplayBufferMsgs > 0 {
+		nc.replay = newReplayBuffer(nc.Opts.ReplayBufferMsgs, nc.Opts.ReplayBufferSubjects)
 	}
-
-	// If the TLSHandshakeFirst option is specified, make sure that
-	// the Secure boolean is true.
-	if nc.Opts.TLSHandshakeFirst {
-		nc.Opts.Secure = true
+	if nc.Opts.SubjectPrefix != _EMPTY_ {
+		nc.subjPrefix = nc.Opts.SubjectPrefix + "."
 	}
 
 	if err := nc.setupServerPool(); err != nil {
@@ -1615,21 +2070,104 @@ func (o Options) Connect() (*Conn, error) {
 	// Create reader/writer
 	nc.newReaderWriter()
 
+	// Created before connecting, as the reconnect go routine
+	// may already be running when using RetryOnFailedConnect.
+	if nc.Opts.OutboundQueueSize > 0 {
+		nc.outq = newOutboundQueue(nc.Opts.OutboundQueueSize, nc.Opts.OutboundFullPolicy)
+	}
+	if nc.Opts.MaxAsyncCallbacks > 0 {
+		nc.cbSem = make(chan struct{}, nc.Opts.MaxAsyncCallbacks)
+	}
+
 	connectionEstablished, err := nc.connect()
 	if err != nil {
 		return nil, err
 	}
 
+	if nc.outq != nil {
+		go nc.sendOutbound(nc.outq)
+	}
+
 	// Spin up the async cb dispatcher on success
 	go nc.ach.asyncCBDispatcher()
 
-	if connectionEstablished && nc.Opts.ConnectedCB != nil {
-		nc.ach.push(func() { nc.Opts.ConnectedCB(nc) })
+	if nc.Opts.SharedDispatcher {
+		nc.subDispatcher = newSubDispatcher(nc, nc.Opts.SharedDispatcherWorkers)
+	}
+
+	if cb := nc.Opts.ConnectedCB; connectionEstablished && cb != nil {
+		nc.ach.push(func() { cb(nc) })
 	}
 
 	return nc, nil
 }
 
+// setDefaults applies the default values of unset options
+// and checks that the options are consistent.
+func (o *Options) setDefaults() error {
+	// Some default options processing.
+	if o.MaxPingsOut == 0 {
+		o.MaxPingsOut = DefaultMaxPingOut
+	}
+	// Allow old default for channel length to work correctly.
+	if o.SubChanLen == 0 {
+		o.SubChanLen = DefaultMaxChanLen
+	}
+	// Default ReconnectBufSize
+	if o.ReconnectBufSize == 0 {
+		o.ReconnectBufSize = DefaultReconnectBufSize
+	}
+	// Default ReconnectHistorySize
+	if o.ReconnectHistorySize == 0 {
+		o.ReconnectHistorySize = DefaultReconnectHistory
+	}
+	// Default FlushChanBuf
+	if o.FlushChanBuf == 0 {
+		o.FlushChanBuf = flushChanSize
+	} else if o.FlushChanBuf < 0 {
+		return errors.New("nats: flush channel buffer size must not be negative")
+	}
+	// Ensure that Timeout is not 0
+	if o.Timeout == 0 {
+		o.Timeout = DefaultTimeout
+	}
+
+	// Check first for user jwt callback being defined and nkey.
+	if o.UserJWT != nil && o.Nkey != "" {
+		return ErrNkeyAndUser
+	}
+
+	// Check if we have an nkey but no signature callback defined.
+	if o.Nkey != "" && o.SignatureCB == nil {
+		return ErrNkeyButNoSigCB
+	}
+
+	// Allow custom Dialer for connecting using a timeout by default
+	if o.Dialer == nil {
+		o.Dialer = &net.Dialer{
+			Timeout: o.Timeout,
+		}
+	}
+
+	// If the TLSHandshakeFirst option is specified, make sure that
+	// the Secure boolean is true.
+	if o.TLSHandshakeFirst {
+		o.Secure = true
+	}
+
+	if o.ReplayBufferMsgs < 0 || o.ReplayBufferSubjects < 0 {
+		return errors.New("nats: replay buffer limits must not be negative")
+	}
+	if o.ReplayBufferMsgs > 0 && o.ReplayBufferSubjects == 0 {
+		return errors.New("nats: replay buffer requires a maximum number of subjects")
+	}
+
+	if !o.IPResolutionOrder.valid() {
+		return fmt.Errorf("nats: invalid IP resolution order %q", o.IPResolutionOrder)
+	}
+	return nil
+}
+
 func defaultErrHandler(nc *Conn, sub *Subscription, err error) {
 	var cid uint64
 	if nc != nil {
@@ -1789,6 +2327,40 @@ func (nc *Conn) setupServerPool() error {
 	return nc.pickServer()
 }
 
+// applyReconnectOptions validates the options returned by the
+// PreReconnectCallback and, if valid, uses their servers, TLS and
+// authentication settings and the server pool built from them for
+// reconnecting. Other options are left untouched, as some of them are
+// read without holding the lock.
+// Lock is assumed held.
+func (nc *Conn) applyReconnectOptions(o *Options) error {
+	tmp := &Conn{Opts: nc.Opts}
+	tmp.Opts.copyReconnectOptions(o)
+	if err := tmp.Opts.setDefaults(); err != nil {
+		return err
+	}
+	if err := tmp.setupServerPool(); err != nil {
+		return err
+	}
+	nc.Opts.copyReconnectOptions(&tmp.Opts)
+	nc.srvPool, nc.urls, nc.ws = tmp.srvPool, tmp.urls, tmp.ws
+	// selectNextServer moves the current server to the end of the
+	// pool, so mark the last one as current for the first to be tried first.
+	nc.current = nc.srvPool[len(nc.srvPool)-1]
+	return nil
+}
+
+// copyReconnectOptions copies the options which can be updated by the
+// PreReconnectCallback: servers, TLS and authentication settings.
+func (o *Options) copyReconnectOptions(from *Options) {
+	o.Url, o.Servers, o.NoRandomize = from.Url, from.Servers, from.NoRandomize
+	o.Secure, o.TLSConfig, o.TLSHandshakeFirst = from.Secure, from.TLSConfig, from.TLSHandshakeFirst
+	o.TLSCertCB, o.RootCAsCB = from.TLSCertCB, from.RootCAsCB
+	o.UserJWT, o.Nkey, o.SignatureCB = from.UserJWT, from.Nkey, from.SignatureCB
+	o.User, o.Password, o.UserInfo = from.User, from.Password, from.UserInfo
+	o.Token, o.TokenHandler = from.Token, from.TokenHandler
+}
+
 // Helper function to return scheme
 func (nc *Conn) connScheme() string {
 	if nc.ws {
@@ -1879,8 +2451,10 @@ func (nc *Conn) shufflePool(offset int) {
 	if len(nc.srvPool) <= offset+1 {
 		return
 	}
-	source := rand.NewSource(time.Now().UnixNano())
-	r := rand.New(source)
+	r := nc.Opts.poolRand
+	if r == nil {
+		r = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
 	for i := offset; i < len(nc.srvPool); i++ {
 		j := offset + r.Intn(i+1-offset)
 		nc.srvPool[i], nc.srvPool[j] = nc.srvPool[j], nc.srvPool[i]
@@ -1888,19 +2462,26 @@ func (nc *Conn) shufflePool(offset int) {
 }
 
 func (nc *Conn) newReaderWriter() {
+	rbsize := nc.Opts.ReaderBufSize
+	if rbsize <= 0 {
+		rbsize = defaultBufSize
+	}
 	nc.br = &natsReader{
-		buf: make([]byte, defaultBufSize),
+		buf: make([]byte, rbsize),
 		off: -1,
 	}
 	nc.bw = &natsWriter{
-		limit:  defaultBufSize,
-		plimit: nc.Opts.ReconnectBufSize,
+		limit:   defaultBufSize,
+		plimit:  nc.Opts.ReconnectBufSize,
+		pmlimit: nc.Opts.ReconnectBufMsgs,
+		stats:   &nc.Statistics,
 	}
 }
 
 func (nc *Conn) bindToNewConn() {
 	bw := nc.bw
 	bw.w, bw.bufs = nc.newWriter(), nil
+	bw.conn, bw.err = nc.conn, nil
 	br := nc.br
 	br.r, br.n, br.off = nc.conn, 0, -1
 }
@@ -1918,6 +2499,11 @@ func (w *natsWriter) appendString(str string) error {
 }
 
 func (w *natsWriter) appendBufs(bufs ...[]byte) error {
+	// Do not buffer anything after a failed write, the connection
+	// is going to be re-established.
+	if w.pending == nil && w.err != nil {
+		return w.err
+	}
 	for _, buf := range bufs {
 		if len(buf) == 0 {
 			continue
@@ -1953,11 +2539,40 @@ func (w *natsWriter) flush() error {
 	// Do not skip calling w.w.Write() here if len(w.bufs) is 0 because
 	// the actual writer (if websocket for instance) may have things
 	// to do such as sending control frames, etc..
+	if w.err != nil {
+		w.bufs = w.bufs[:0]
+		return w.err
+	}
+	w.flushed(len(w.bufs))
 	_, err := w.w.Write(w.bufs)
 	w.bufs = w.bufs[:0]
+	if err != nil {
+		w.failed(err)
+	}
 	return err
 }
 
+// failed is invoked when a write to the connection returns an error.
+// Part of a protocol message may have been written, so nothing else can
+// be written to the connection without corrupting the protocol stream.
+// The connection is closed, so that the read loop detects the error and
+// reconnects.
+func (w *natsWriter) failed(err error) {
+	w.err = err
+	if w.conn != nil {
+		w.conn.Close()
+	}
+}
+
+// flushed accounts for a flush of n bytes.
+func (w *natsWriter) flushed(n int) {
+	if n == 0 || w.stats == nil {
+		return
+	}
+	atomic.AddUint64(&w.stats.Flushes, 1)
+	atomic.AddUint64(&w.stats.FlushedBytes, uint64(n))
+}
+
 func (w *natsWriter) buffered() int {
 	if w.pending != nil {
 		return w.pending.Len()
@@ -1967,16 +2582,27 @@ func (w *natsWriter) buffered() int {
 
 func (w *natsWriter) switchToPending() {
 	w.pending = new(bytes.Buffer)
+	w.pmsgs = 0
+}
+
+// pendingMsgAdded accounts for a message appended while using the
+// pending buffer.
+func (w *natsWriter) pendingMsgAdded() {
+	if w.pending != nil {
+		w.pmsgs++
+	}
 }
 
 func (w *natsWriter) flushPendingBuffer() error {
 	if w.pending == nil || w.pending.Len() == 0 {
 		return nil
 	}
+	w.flushed(w.pending.Len())
 	_, err := w.w.Write(w.pending.Bytes())
 	// Reset the pending buffer at this point because we don't want
 	// to take the risk of sending duplicates or partials.
 	w.pending.Reset()
+	w.pmsgs = 0
 	return err
 }
 
@@ -1984,11 +2610,15 @@ func (w *natsWriter) atLimitIfUsingPending() bool {
 	if w.pending == nil {
 		return false
 	}
+	if w.pmlimit > 0 && w.pmsgs >= w.pmlimit {
+		return true
+	}
 	return w.pending.Len() >= w.plimit
 }
 
 func (w *natsWriter) doneWithPending() {
 	w.pending = nil
+	w.pmsgs = 0
 }
 
 // Notify the reader that we are done with the connect, where "read" operations
@@ -2039,6 +2669,82 @@ build_string:
 	goto build_string
 }
 
+// IPResolutionOrder determines the address families used when connecting
+// to servers, and in which order addresses are tried.
+type IPResolutionOrder string
+
+const (
+	// IPResolutionAny uses the addresses of both families, in the order
+	// returned by the resolver (randomized unless NoRandomize is set).
+	IPResolutionAny IPResolutionOrder = ""
+
+	// IPResolutionIP4 only uses IPv4 addresses.
+	IPResolutionIP4 IPResolutionOrder = "ip4"
+
+	// IPResolutionIP6 only uses IPv6 addresses.
+	IPResolutionIP6 IPResolutionOrder = "ip6"
+
+	// IPResolutionIP4ThenIP6 tries IPv4 addresses before IPv6 addresses.
+	IPResolutionIP4ThenIP6 IPResolutionOrder = "ip4-then-ip6"
+
+	// IPResolutionIP6ThenIP4 tries IPv6 addresses before IPv4 addresses.
+	IPResolutionIP6ThenIP4 IPResolutionOrder = "ip6-then-ip4"
+)
+
+// valid reports whether the order is one of the known values.
+func (o IPResolutionOrder) valid() bool {
+	switch o {
+	case IPResolutionAny, IPResolutionIP4, IPResolutionIP6, IPResolutionIP4ThenIP6, IPResolutionIP6ThenIP4:
+		return true
+	}
+	return false
+}
+
+// network returns the network used to dial servers, restricting the
+// address family if a single one is allowed.
+func (o IPResolutionOrder) network() string {
+	switch o {
+	case IPResolutionIP4:
+		return "tcp4"
+	case IPResolutionIP6:
+		return "tcp6"
+	}
+	return "tcp"
+}
+
+// order filters and sorts the resolved host:port addresses by family,
+// preserving the relative order of addresses of the same family.
+// Addresses which are not IPs are kept, as the family is then enforced
+// by the dialer network.
+func (o IPResolutionOrder) order(hosts []string) []string {
+	if o == IPResolutionAny {
+		return hosts
+	}
+	var ip4, ip6, other []string
+	for _, host := range hosts {
+		h, _, err := net.SplitHostPort(host)
+		ip := net.ParseIP(h)
+		switch {
+		case err != nil || ip == nil:
+			other = append(other, host)
+		case ip.To4() != nil:
+			ip4 = append(ip4, host)
+		default:
+			ip6 = append(ip6, host)
+		}
+	}
+	switch o {
+	case IPResolutionIP4:
+		return append(ip4, other...)
+	case IPResolutionIP6:
+		return append(ip6, other...)
+	case IPResolutionIP4ThenIP6:
+		return append(append(ip4, ip6...), other...)
+	default:
+		return append(append(ip6, ip4...), other...)
+	}
+}
+
 // createConn will connect to the server and wrap the appropriate
 // bufio structures. It will do the right thing when an existing
 // connection is in place.
@@ -2072,6 +2778,12 @@ func (nc *Conn) createConn() (err error) {
 			hosts = append(hosts, net.JoinHostPort(addr, u.Port()))
 		}
 	}
+	if len(hosts) > 1 && !nc.Opts.NoRandomize {
+		rand.Shuffle(len(hosts), func(i, j int) {
+			hosts[i], hosts[j] = hosts[j], hosts[i]
+		})
+	}
+	hosts = nc.Opts.IPResolutionOrder.order(hosts)
 	// Fall back to what we were given.
 	if len(hosts) == 0 {
 		hosts = append(hosts, u.Host)
@@ -2088,13 +2800,9 @@ func (nc *Conn) createConn() (err error) {
 		dialer = &copyDialer
 	}
 
-	if len(hosts) > 1 && !nc.Opts.NoRandomize {
-		rand.Shuffle(len(hosts), func(i, j int) {
-			hosts[i], hosts[j] = hosts[j], hosts[i]
-		})
-	}
+	network := nc.Opts.IPResolutionOrder.network()
 	for _, host := range hosts {
-		nc.conn, err = dialer.Dial("tcp", host)
+		nc.conn, err = dialer.Dial(network, host)
 		if err == nil {
 			break
 		}
@@ -2103,6 +2811,20 @@ func (nc *Conn) createConn() (err error) {
 		return err
 	}
 
+	// Custom dialers may return connections which are not TCP based,
+	// in which case socket options are not applicable.
+	if tcpConn, ok := nc.conn.(*net.TCPConn); ok {
+		if err := nc.setTCPOptions(tcpConn); err != nil {
+			nc.conn.Close()
+			nc.conn = nil
+			return err
+		}
+	}
+
+	if nc.Opts.wrapConn != nil {
+		nc.conn = nc.Opts.wrapConn(nc.conn)
+	}
+
 	// If scheme starts with "ws" then branch out to websocket code.
 	if isWebsocketScheme(u) {
 		return nc.wsInitHandshake(u)
@@ -2113,6 +2835,25 @@ func (nc *Conn) createConn() (err error) {
 	return nil
 }
 
+// setTCPOptions applies the socket level options to a TCP connection.
+func (nc *Conn) setTCPOptions(conn *net.TCPConn) error {
+	// TCP connections are created with TCP_NODELAY set.
+	if nc.Opts.TCPDelay {
+		if err := conn.SetNoDelay(false); err != nil {
+			return err
+		}
+	}
+	if ka := nc.Opts.TCPKeepAlive; ka > 0 {
+		if err := conn.SetKeepAlive(true); err != nil {
+			return err
+		}
+		return conn.SetKeepAlivePeriod(ka)
+	} else if ka < 0 {
+		return conn.SetKeepAlive(false)
+	}
+	return nil
+}
+
 type skipTLSDialer interface {
 	SkipTLSHandshake() bool
 }
@@ -2145,6 +2886,12 @@ func (nc *Conn) makeTLSConn() error {
 		}
 		tlsCopy.RootCAs = rootCAs
 	}
+	if tlsCopy.ClientSessionCache == nil && !nc.Opts.NoTLSSessionCache {
+		if nc.tlsSessions == nil {
+			nc.tlsSessions = tls.NewLRUClientSessionCache(0)
+		}
+		tlsCopy.ClientSessionCache = nc.tlsSessions
+	}
 	// If its blank we will override it with the current host
 	if tlsCopy.ServerName == _EMPTY_ {
 		if nc.current.tlsName != _EMPTY_ {
@@ -2280,6 +3027,39 @@ func (nc *Conn) ConnectedAddr() string {
 	return nc.conn.RemoteAddr().String()
 }
 
+// LocalAddr returns the local network address of the connection to the
+// server, or nil if not connected. The address may change on reconnect.
+func (nc *Conn) LocalAddr() net.Addr {
+	if nc == nil {
+		return nil
+	}
+
+	nc.mu.RLock()
+	defer nc.mu.RUnlock()
+
+	if nc.status != CONNECTED {
+		return nil
+	}
+	return nc.conn.LocalAddr()
+}
+
+// RemoteAddr returns the network address of the server the connection is
+// established with, or nil if not connected. The address may change on
+// reconnect.
+func (nc *Conn) RemoteAddr() net.Addr {
+	if nc == nil {
+		return nil
+	}
+
+	nc.mu.RLock()
+	defer nc.mu.RUnlock()
+
+	if nc.status != CONNECTED {
+		return nil
+	}
+	return nc.conn.RemoteAddr()
+}
+
 // ConnectedServerId reports the connected server's Id
 func (nc *Conn) ConnectedServerId() string {
 	if nc == nil {
@@ -2376,7 +3156,7 @@ func (nc *Conn) setup() {
 	nc.subs = make(map[int64]*Subscription)
 	nc.pongs = make([]chan struct{}, 0, 8)
 
-	nc.fch = make(chan struct{}, flushChanSize)
+	nc.fch = make(chan struct{}, nc.Opts.FlushChanBuf)
 	nc.rqch = make(chan struct{})
 
 	// Setup scratch outbound buffer for PUB/HPUB
@@ -2571,6 +3351,7 @@ func (nc *Conn) processExpectedInfo() error {
 // and kicking the flush Go routine.  These writes are protected.
 func (nc *Conn) sendProto(proto string) {
 	nc.mu.Lock()
+	nc.tracer.out(proto)
 	nc.bw.appendString(proto)
 	nc.kickFlusher()
 	nc.mu.Unlock()
@@ -2605,9 +3386,14 @@ func (nc *Conn) connectProto() (string, error) {
 		}
 	}
 
-	// Look for user jwt.
-	if o.UserJWT != nil {
-		if jwt, err := o.UserJWT(); err != nil {
+	// Look for user jwt, using the reconnect handler if the previous
+	// authentication expired.
+	userJWT := o.UserJWT
+	if nc.authExpired && o.ReconnectJWTCallback != nil {
+		userJWT = o.ReconnectJWTCallback
+	}
+	if userJWT != nil {
+		if jwt, err := userJWT(); err != nil {
 			return _EMPTY_, err
 		} else {
 			ujwt = jwt
@@ -2683,13 +3469,14 @@ func (nc *Conn) sendConnect() error {
 	// Construct the CONNECT protocol string
 	cProto, err := nc.connectProto()
 	if err != nil {
-		if !nc.initc && nc.Opts.AsyncErrorCB != nil {
-			nc.ach.push(func() { nc.Opts.AsyncErrorCB(nc, nil, err) })
+		if errCB := nc.Opts.AsyncErrorCB; !nc.initc && errCB != nil {
+			nc.ach.push(func() { errCB(nc, nil, err) })
 		}
 		return err
 	}
 
 	// Write the protocol and PING directly to the underlying writer.
+	nc.tracer.out(cProto + pingProto)
 	if err := nc.bw.writeDirect(cProto, pingProto); err != nil {
 		return err
 	}
@@ -2700,8 +3487,8 @@ func (nc *Conn) sendConnect() error {
 	// reading byte-by-byte here is ok.
 	proto, err := nc.readProto()
 	if err != nil {
-		if !nc.initc && nc.Opts.AsyncErrorCB != nil {
-			nc.ach.push(func() { nc.Opts.AsyncErrorCB(nc, nil, err) })
+		if errCB := nc.Opts.AsyncErrorCB; !nc.initc && errCB != nil {
+			nc.ach.push(func() { errCB(nc, nil, err) })
 		}
 		return err
 	}
@@ -2711,8 +3498,8 @@ func (nc *Conn) sendConnect() error {
 		// Read the rest now...
 		proto, err = nc.readProto()
 		if err != nil {
-			if !nc.initc && nc.Opts.AsyncErrorCB != nil {
-				nc.ach.push(func() { nc.Opts.AsyncErrorCB(nc, nil, err) })
+			if errCB := nc.Opts.AsyncErrorCB; !nc.initc && errCB != nil {
+				nc.ach.push(func() { errCB(nc, nil, err) })
 			}
 			return err
 		}
@@ -2747,6 +3534,7 @@ func (nc *Conn) sendConnect() error {
 	}
 
 	// This is where we are truly connected.
+	nc.authExpired = false
 	nc.changeConnStatus(CONNECTED)
 
 	return nil
@@ -2754,7 +3542,57 @@ func (nc *Conn) sendConnect() error {
 
 // reads a protocol line.
 func (nc *Conn) readProto() (string, error) {
-	return nc.br.ReadString('\n')
+	line, err := nc.br.ReadString('\n')
+	if err == nil {
+		nc.tracer.in(line)
+	}
+	return line, err
+}
+
+// unprefixedSubjects lists the API subjects shared by all connections,
+// which are not namespaced by the SubjectPrefix option.
+var unprefixedSubjects = []string{"$JS.", "$KV.", "$O."}
+
+// subjectPrefix returns the prefix applied to the given subject, which is
+// empty if SubjectPrefix is not set or for JetStream, KV and object store
+// API subjects.
+// Lock should be held.
+func (nc *Conn) subjectPrefix(subj string) string {
+	if nc.subjPrefix == _EMPTY_ {
+		return _EMPTY_
+	}
+	for _, p := range unprefixedSubjects {
+		if strings.HasPrefix(subj, p) {
+			return _EMPTY_
+		}
+	}
+	return nc.subjPrefix
+}
+
+// replyPrefix returns the prefix applied to the given reply subject, which
+// is only set for inboxes, as other reply subjects may not be namespaced.
+// Lock should be held.
+func (nc *Conn) replyPrefix(reply string) string {
+	if nc.subjPrefix == _EMPTY_ {
+		return _EMPTY_
+	}
+	inboxPrefix := InboxPrefix
+	if nc.Opts.InboxPrefix != _EMPTY_ {
+		inboxPrefix = nc.Opts.InboxPrefix + "."
+	}
+	if !strings.HasPrefix(reply, inboxPrefix) {
+		return _EMPTY_
+	}
+	return nc.subjPrefix
+}
+
+// trimSubjectPrefix returns the subject without the given prefix,
+// or the subject itself if it does not start with the prefix.
+func trimSubjectPrefix(subject []byte, prefix string) []byte {
+	if len(subject) >= len(prefix) && string(subject[:len(prefix)]) == prefix {
+		return subject[len(prefix):]
+	}
+	return subject
 }
 
 // A control protocol line.
@@ -2814,15 +3652,38 @@ func (nc *Conn) doReconnect(err error, forceReconnect bool) {
 	// can't do defer here.
 	nc.mu.Lock()
 
+	disconnectedAt := time.Now()
+	var prevURL string
+	if nc.current != nil {
+		prevURL = nc.current.url.Redacted()
+	}
+
 	// Clear any errors.
 	nc.err = nil
 	// Perform appropriate callback if needed for a disconnect.
 	// DisconnectedErrCB has priority over deprecated DisconnectedCB
 	if !nc.initc {
-		if nc.Opts.DisconnectedErrCB != nil {
-			nc.ach.push(func() { nc.Opts.DisconnectedErrCB(nc, err) })
-		} else if nc.Opts.DisconnectedCB != nil {
-			nc.ach.push(func() { nc.Opts.DisconnectedCB(nc) })
+		if disconnectedErrCB := nc.Opts.DisconnectedErrCB; disconnectedErrCB != nil {
+			nc.ach.push(func() { disconnectedErrCB(nc, err) })
+		} else if disconnectedCB := nc.Opts.DisconnectedCB; disconnectedCB != nil {
+			nc.ach.push(func() { disconnectedCB(nc) })
+		}
+	}
+
+	// Give the application a chance to update the options, e.g. following
+	// a server list or credentials rotation, before reconnecting.
+	if cb := nc.Opts.PreReconnectCallback; cb != nil {
+		opts := nc.Opts
+		opts.Servers = append([]string(nil), nc.Opts.Servers...)
+		nc.mu.Unlock()
+		newOpts := cb(&opts)
+		nc.mu.Lock()
+		if newOpts != nil && !nc.isClosed() {
+			if err := nc.applyReconnectOptions(newOpts); err != nil {
+				if errCB := nc.Opts.AsyncErrorCB; errCB != nil {
+					nc.ach.push(func() { errCB(nc, nil, err) })
+				}
+			}
 		}
 	}
 
@@ -2906,6 +3767,14 @@ func (nc *Conn) doReconnect(err error, forceReconnect bool) {
 			break
 		}
 
+		// Once the whole pool was tried, shuffle it again so that the
+		// next pass does not retry the servers in the same order.
+		if doSleep && !nc.Opts.NoRandomize {
+			nc.shufflePool(0)
+			cur = nc.srvPool[0]
+			nc.current = cur
+		}
+
 		// Mark that we tried a reconnect
 		cur.reconnects++
 
@@ -2920,7 +3789,7 @@ func (nc *Conn) doReconnect(err error, forceReconnect bool) {
 		}
 
 		// We are reconnected
-		nc.Reconnects++
+		atomic.AddUint64(&nc.Reconnects, 1)
 
 		// Process connect logic
 		if nc.err = nc.processConnectInit(); nc.err != nil {
@@ -2960,13 +3829,28 @@ func (nc *Conn) doReconnect(err error, forceReconnect bool) {
 		// Done with the pending buffer
 		nc.bw.doneWithPending()
 
+		// Resume sending queued messages which did not fit
+		// in the pending buffer.
+		if nc.outq != nil {
+			nc.outq.reconnect()
+		}
+
+		if !nc.initc {
+			nc.addReconnectEvent(ReconnectEvent{
+				Time:         time.Now(),
+				PreviousURL:  prevURL,
+				URL:          cur.url.Redacted(),
+				Disconnected: time.Since(disconnectedAt),
+			})
+		}
+
 		// Queue up the correct callback. If we are in initial connect state
 		// (using retry on failed connect), we will call the ConnectedCB,
 		// otherwise the ReconnectedCB.
-		if nc.Opts.ReconnectedCB != nil && !nc.initc {
-			nc.ach.push(func() { nc.Opts.ReconnectedCB(nc) })
-		} else if nc.Opts.ConnectedCB != nil && nc.initc {
-			nc.ach.push(func() { nc.Opts.ConnectedCB(nc) })
+		if reconnectedCB := nc.Opts.ReconnectedCB; reconnectedCB != nil && !nc.initc {
+			nc.ach.push(func() { reconnectedCB(nc) })
+		} else if connectedCB := nc.Opts.ConnectedCB; connectedCB != nil && nc.initc {
+			nc.ach.push(func() { connectedCB(nc) })
 		}
 
 		// If we are here with a retry on failed connect, indicate that the
@@ -3118,6 +4002,13 @@ func (nc *Conn) readLoop() {
 			err = nc.parse(buf)
 		}
 		if err != nil {
+			// If the connection was closed after a failed write,
+			// report the write error instead.
+			nc.mu.Lock()
+			if bw := nc.bw; bw != nil && bw.err != nil {
+				err = bw.err
+			}
+			nc.mu.Unlock()
 			if shouldClose := nc.processOpErr(err); shouldClose {
 				nc.close(CLOSED, true, nil)
 			}
@@ -3133,12 +4024,38 @@ func (nc *Conn) readLoop() {
 // waitForMsgs waits on the conditional shared with readLoop and processMsg.
 // It is used to deliver messages to asynchronous subscribers.
 func (nc *Conn) waitForMsgs(s *Subscription) {
+	nc.deliverMsgs(s, 0)
+}
+
+// callbackSem returns the semaphore limiting concurrent message callbacks
+// of the subscription, or nil if callbacks are not limited.
+// Responses to new style requests are not limited, as handlers may be
+// waiting for them while holding the semaphore.
+func (nc *Conn) callbackSem(s *Subscription) chan struct{} {
+	nc.mu.RLock()
+	defer nc.mu.RUnlock()
+	if nc.cbSem == nil || s == nc.respMux {
+		return nil
+	}
+	return nc.cbSem
+}
+
+// deliverMsgs delivers pending messages to an asynchronous subscriber.
+// If batch is 0, it waits for new messages until the subscription is
+// closed. Otherwise, it is called by the shared dispatcher and returns
+// once there are no pending messages or after delivering batch messages,
+// in which case it returns true to signal that the subscription should
+// be queued again.
+func (nc *Conn) deliverMsgs(s *Subscription, batch int) bool {
 	var closed bool
 	var delivered, max uint64
+	var count int
 
 	// Used to account for adjustments to sub.pBytes when we wrap back around.
 	msgLen := -1
 
+	sem := nc.callbackSem(s)
+
 	for {
 		s.mu.Lock()
 		// Do accounting for last msg delivered here so we only lock once
@@ -3150,8 +4067,20 @@ func (nc *Conn) waitForMsgs(s *Subscription) {
 		}
 
 		if s.pHead == nil && !s.closed {
+			if batch > 0 {
+				// Will be queued again on the next message.
+				s.scheduled = false
+				s.mu.Unlock()
+				return false
+			}
 			s.pCond.Wait()
 		}
+		if batch > 0 && count == batch && !s.closed {
+			// Let other subscriptions be dispatched.
+			s.mu.Unlock()
+			return true
+		}
+		count++
 		// Pop the msg off the list
 		m := s.pHead
 		if m != nil {
@@ -3167,6 +4096,11 @@ func (nc *Conn) waitForMsgs(s *Subscription) {
 				continue
 			}
 			msgLen = len(m.Data)
+			if s.maxMsgAge > 0 && !m.received.IsZero() && time.Since(m.received) > s.maxMsgAge {
+				s.droppedByAge++
+				s.mu.Unlock()
+				continue
+			}
 		}
 		mcb := s.mcb
 		max = s.max
@@ -3192,7 +4126,13 @@ func (nc *Conn) waitForMsgs(s *Subscription) {
 
 		// Deliver the message.
 		if m != nil && (max == 0 || delivered <= max) {
-			mcb(m)
+			if sem != nil {
+				sem <- struct{}{}
+				mcb(m)
+				<-sem
+			} else {
+				mcb(m)
+			}
 		}
 		// If we have hit the max for delivered msgs, remove sub.
 		if max > 0 && delivered >= max {
@@ -3221,6 +4161,7 @@ func (nc *Conn) waitForMsgs(s *Subscription) {
 	if done != nil {
 		done(s.Subject)
 	}
+	return false
 }
 
 // Used for debugging and simulating loss for certain tests.
@@ -3236,14 +4177,24 @@ func (nc *Conn) processMsg(data []byte) {
 	atomic.AddUint64(&nc.InMsgs, 1)
 	atomic.AddUint64(&nc.InBytes, uint64(len(data)))
 
+	if nc.tracer != nil {
+		nc.traceMsg(data)
+	}
+
 	// Don't lock the connection to avoid server cutting us off if the
 	// flusher is holding the connection lock, trying to send to the server
 	// that is itself trying to send data to us.
+	subject, replySubject := nc.ps.ma.subject, nc.ps.ma.reply
+	if nc.subjPrefix != _EMPTY_ {
+		subject = trimSubjectPrefix(subject, nc.subjPrefix)
+		replySubject = trimSubjectPrefix(replySubject, nc.subjPrefix)
+	}
+
 	nc.subsMu.RLock()
 	sub := nc.subs[nc.ps.ma.sid]
 	var mf msgFilter
 	if nc.filters != nil {
-		mf = nc.filters[string(nc.ps.ma.subject)]
+		mf = nc.filters[string(subject)]
 	}
 	nc.subsMu.RUnlock()
 
@@ -3252,8 +4203,8 @@ func (nc *Conn) processMsg(data []byte) {
 	}
 
 	// Copy them into string
-	subj := string(nc.ps.ma.subject)
-	reply := string(nc.ps.ma.reply)
+	subj := string(subject)
+	reply := string(replySubject)
 
 	// Doing message create outside of the sub's lock to reduce contention.
 	// It's possible that we end-up not using the message, but that's ok.
@@ -3267,21 +4218,22 @@ func (nc *Conn) processMsg(data []byte) {
 
 	// Check if we have headers encoded here.
 	var h Header
+	var hbuf []byte
 	var err error
 	var ctrlMsg bool
 	var ctrlType int
 	var fcReply string
 
 	if nc.ps.ma.hdr > 0 {
-		hbuf := msgPayload[:nc.ps.ma.hdr]
+		hbuf = msgPayload[:nc.ps.ma.hdr:nc.ps.ma.hdr]
 		msgPayload = msgPayload[nc.ps.ma.hdr:]
 		h, err = DecodeHeadersMsg(hbuf)
 		if err != nil {
 			// We will pass the message through but send async error.
 			nc.mu.Lock()
 			nc.err = ErrBadHeaderMsg
-			if nc.Opts.AsyncErrorCB != nil {
-				nc.ach.push(func() { nc.Opts.AsyncErrorCB(nc, sub, ErrBadHeaderMsg) })
+			if errCB := nc.Opts.AsyncErrorCB; errCB != nil {
+				nc.ach.push(func() { errCB(nc, sub, ErrBadHeaderMsg) })
 			}
 			nc.mu.Unlock()
 		}
@@ -3295,6 +4247,7 @@ func (nc *Conn) processMsg(data []byte) {
 		Data:    msgPayload,
 		Sub:     sub,
 		wsz:     len(data) + len(subj) + len(reply),
+		rawHdr:  hbuf,
 	}
 
 	// Check for message filters.
@@ -3305,6 +4258,9 @@ func (nc *Conn) processMsg(data []byte) {
 		}
 	}
 
+	// Check for subscription filter.
+	filtered := sub.filter != nil && !sub.filter(m)
+
 	sub.mu.Lock()
 
 	// Check if closed.
@@ -3313,6 +4269,16 @@ func (nc *Conn) processMsg(data []byte) {
 		return
 	}
 
+	if filtered {
+		sub.filtered++
+		sub.mu.Unlock()
+		return
+	}
+
+	if sub.maxMsgAge > 0 {
+		m.received = time.Now()
+	}
+
 	// Skip flow control messages in case of using a JetStream context.
 	jsi := sub.jsi
 	if jsi != nil {
@@ -3373,6 +4339,7 @@ func (nc *Conn) processMsg(data []byte) {
 				sub.pTail = m
 				if sub.pCond != nil {
 					sub.pCond.Signal()
+					sub.schedule()
 				}
 			} else {
 				sub.pTail.next = m
@@ -3426,6 +4393,13 @@ func (nc *Conn) processMsg(data []byte) {
 
 slowConsumer:
 	sub.dropped++
+	if sub.droppedSubjs != nil {
+		sub.droppedSubjs[sub.droppedNext] = m.Subject
+		sub.droppedNext = (sub.droppedNext + 1) % len(sub.droppedSubjs)
+		if sub.droppedNext == 0 {
+			sub.droppedFull = true
+		}
+	}
 	sc := !sub.sc
 	sub.sc = true
 	// Undo stats from above
@@ -3435,14 +4409,15 @@ slowConsumer:
 	}
 	if sc {
 		sub.changeSubStatus(SubscriptionSlowConsumer)
+		sub.sendError(ErrSlowConsumer)
 		sub.mu.Unlock()
 		// Now we need connection's lock and we may end-up in the situation
 		// that we were trying to avoid, except that in this case, the client
 		// is already experiencing client-side slow consumer situation.
 		nc.mu.Lock()
 		nc.err = ErrSlowConsumer
-		if nc.Opts.AsyncErrorCB != nil {
-			nc.ach.push(func() { nc.Opts.AsyncErrorCB(nc, sub, ErrSlowConsumer) })
+		if errCB := nc.Opts.AsyncErrorCB; errCB != nil {
+			nc.ach.push(func() { errCB(nc, sub, ErrSlowConsumer) })
 		}
 		nc.mu.Unlock()
 	} else {
@@ -3452,6 +4427,45 @@ slowConsumer:
 
 var permissionsRe = regexp.MustCompile(`Subscription to "(\S+)"`)
 var permissionsQueueRe = regexp.MustCompile(`using queue "(\S+)"`)
+var permissionsPubRe = regexp.MustCompile(`Publish to "(\S+)"`)
+
+// PermissionViolationError is the error passed to the async error handler
+// when the server rejects a publish or a subscription because of missing
+// permissions. The connection is kept alive. It matches
+// ErrPermissionViolation when using errors.Is.
+type PermissionViolationError struct {
+	// Subscribe is true if the violation was caused by a subscription,
+	// false if it was caused by a publish.
+	Subscribe bool
+	// Subject is the subject the client was not allowed to use.
+	Subject string
+	// Queue is the queue group of the rejected subscription, if any.
+	Queue string
+
+	desc string
+}
+
+func newPermissionViolationError(desc string) *PermissionViolationError {
+	err := &PermissionViolationError{desc: desc}
+	if matches := permissionsRe.FindStringSubmatch(desc); len(matches) >= 2 {
+		err.Subscribe = true
+		err.Subject = matches[1]
+		if queueMatches := permissionsQueueRe.FindStringSubmatch(desc); len(queueMatches) >= 2 {
+			err.Queue = queueMatches[1]
+		}
+	} else if matches := permissionsPubRe.FindStringSubmatch(desc); len(matches) >= 2 {
+		err.Subject = matches[1]
+	}
+	return err
+}
+
+func (e *PermissionViolationError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrPermissionViolation, e.desc)
+}
+
+func (e *PermissionViolationError) Unwrap() error {
+	return ErrPermissionViolation
+}
 
 // processTransientError is called when the server signals a non terminal error
 // which does not close the connection or trigger a reconnect.
@@ -3462,29 +4476,31 @@ var permissionsQueueRe = regexp.MustCompile(`using queue "(\S+)"`)
 func (nc *Conn) processTransientError(err error) {
 	nc.mu.Lock()
 	nc.err = err
-	if errors.Is(err, ErrPermissionViolation) {
-		matches := permissionsRe.FindStringSubmatch(err.Error())
-		if len(matches) >= 2 {
-			queueMatches := permissionsQueueRe.FindStringSubmatch(err.Error())
-			var q string
-			if len(queueMatches) >= 2 {
-				q = queueMatches[1]
-			}
-			subject := matches[1]
-			for _, sub := range nc.subs {
-				if sub.Subject == subject && sub.Queue == q && sub.permissionsErr == nil {
-					sub.mu.Lock()
-					if sub.errCh != nil {
-						sub.errCh <- err
-					}
-					sub.permissionsErr = err
-					sub.mu.Unlock()
+	// Subscriptions affected by a permissions violation are passed
+	// to the async error callback.
+	var affected []*Subscription
+	var pErr *PermissionViolationError
+	if errors.As(err, &pErr) && pErr.Subscribe {
+		for _, sub := range nc.subs {
+			if sub.Subject == pErr.Subject && sub.Queue == pErr.Queue && sub.permissionsErr == nil {
+				sub.mu.Lock()
+				if sub.errCh != nil {
+					sub.errCh <- err
 				}
+				sub.sendError(err)
+				sub.permissionsErr = err
+				sub.mu.Unlock()
+				affected = append(affected, sub)
 			}
 		}
 	}
-	if nc.Opts.AsyncErrorCB != nil {
-		nc.ach.push(func() { nc.Opts.AsyncErrorCB(nc, nil, err) })
+	if errCB := nc.Opts.AsyncErrorCB; errCB != nil {
+		if len(affected) == 0 {
+			nc.ach.push(func() { errCB(nc, nil, err) })
+		}
+		for _, sub := range affected {
+			nc.ach.push(func() { errCB(nc, sub, err) })
+		}
 	}
 	nc.mu.Unlock()
 }
@@ -3496,8 +4512,14 @@ func (nc *Conn) processTransientError(err error) {
 // Connection lock is held on entry
 func (nc *Conn) processAuthError(err error) bool {
 	nc.err = err
-	if !nc.initc && nc.Opts.AsyncErrorCB != nil {
-		nc.ach.push(func() { nc.Opts.AsyncErrorCB(nc, nil, err) })
+	if errCB := nc.Opts.AsyncErrorCB; !nc.initc && errCB != nil {
+		nc.ach.push(func() { errCB(nc, nil, err) })
+	}
+	if err == ErrAuthExpired {
+		nc.authExpired = true
+		if authExpiredCB := nc.Opts.AuthExpiredCB; !nc.initc && authExpiredCB != nil {
+			nc.ach.push(func() { authExpiredCB(nc) })
+		}
 	}
 	// We should give up if we tried twice on this server and got the
 	// same error. This behavior can be modified using IgnoreAuthErrorAbort.
@@ -3530,6 +4552,7 @@ func (nc *Conn) flusher() {
 		if _, ok := <-fch; !ok {
 			return
 		}
+		atomic.AddUint64(&nc.FlusherWakeups, 1)
 		nc.mu.Lock()
 
 		// Check to see if we should bail out.
@@ -3542,8 +4565,8 @@ func (nc *Conn) flusher() {
 				if nc.err == nil {
 					nc.err = err
 				}
-				if nc.Opts.AsyncErrorCB != nil {
-					nc.ach.push(func() { nc.Opts.AsyncErrorCB(nc, nil, err) })
+				if errCB := nc.Opts.AsyncErrorCB; errCB != nil {
+					nc.ach.push(func() { errCB(nc, nil, err) })
 				}
 			}
 		}
@@ -3554,12 +4577,14 @@ func (nc *Conn) flusher() {
 // processPing will send an immediate pong protocol response to the
 // server. The server uses this mechanism to detect dead clients.
 func (nc *Conn) processPing() {
+	nc.tracer.in(pingProto)
 	nc.sendProto(pongProto)
 }
 
 // processPong is used to process responses to the client's ping
 // messages. We use pings for the flush mechanism as well.
 func (nc *Conn) processPong() {
+	nc.tracer.in(pongProto)
 	var ch chan struct{}
 
 	nc.mu.Lock()
@@ -3576,7 +4601,7 @@ func (nc *Conn) processPong() {
 
 // processOK is a placeholder for processing OK messages.
 func (nc *Conn) processOK() {
-	// do nothing
+	nc.tracer.in(okProto)
 }
 
 // processInfo is used to parse the info messages sent
@@ -3598,8 +4623,8 @@ func (nc *Conn) processInfo(info string) error {
 	// did not include themselves in the async INFO protocol.
 	// If empty, do not remove the implicit servers from the pool.
 	if len(nc.info.ConnectURLs) == 0 {
-		if !nc.initc && ncInfo.LameDuckMode && nc.Opts.LameDuckModeHandler != nil {
-			nc.ach.push(func() { nc.Opts.LameDuckModeHandler(nc) })
+		if cb := nc.Opts.LameDuckModeHandler; !nc.initc && ncInfo.LameDuckMode && cb != nil {
+			nc.ach.push(func() { cb(nc) })
 		}
 		return nil
 	}
@@ -3657,12 +4682,12 @@ func (nc *Conn) processInfo(info string) error {
 		if !nc.Opts.NoRandomize {
 			nc.shufflePool(1)
 		}
-		if !nc.initc && nc.Opts.DiscoveredServersCB != nil {
-			nc.ach.push(func() { nc.Opts.DiscoveredServersCB(nc) })
+		if cb := nc.Opts.DiscoveredServersCB; !nc.initc && cb != nil {
+			nc.ach.push(func() { cb(nc) })
 		}
 	}
-	if !nc.initc && ncInfo.LameDuckMode && nc.Opts.LameDuckModeHandler != nil {
-		nc.ach.push(func() { nc.Opts.LameDuckModeHandler(nc) })
+	if cb := nc.Opts.LameDuckModeHandler; !nc.initc && ncInfo.LameDuckMode && cb != nil {
+		nc.ach.push(func() { cb(nc) })
 	}
 	return nil
 }
@@ -3671,6 +4696,9 @@ func (nc *Conn) processInfo(info string) error {
 // from the parser. Calls processInfo under connection's lock
 // protection.
 func (nc *Conn) processAsyncInfo(info []byte) {
+	if nc.tracer != nil {
+		nc.tracer.in(_INFO_OP_ + _SPC_ + string(info))
+	}
 	nc.mu.Lock()
 	// Ignore errors, we will simply not update the server pool...
 	nc.processInfo(string(info))
@@ -3711,6 +4739,9 @@ func checkAuthError(e string) error {
 // processErr processes any error messages from the server and
 // sets the connection's LastError.
 func (nc *Conn) processErr(ie string) {
+	if nc.tracer != nil {
+		nc.tracer.in(_ERR_OP_ + _SPC_ + ie)
+	}
 	// Trim, remove quotes
 	ne := normalizeErr(ie)
 	// convert to lower case.
@@ -3724,7 +4755,7 @@ func (nc *Conn) processErr(ie string) {
 	} else if e == MAX_CONNECTIONS_ERR {
 		close = nc.processOpErr(ErrMaxConnectionsExceeded)
 	} else if strings.HasPrefix(e, PERMISSIONS_ERR) {
-		nc.processTransientError(fmt.Errorf("%w: %s", ErrPermissionViolation, ne))
+		nc.processTransientError(newPermissionViolationError(ne))
 	} else if strings.HasPrefix(e, MAX_SUBSCRIPTIONS_ERR) {
 		nc.processTransientError(ErrMaxSubscriptionsExceeded)
 	} else if authErr := checkAuthError(e); authErr != nil {
@@ -3760,6 +4791,47 @@ func (nc *Conn) Publish(subj string, data []byte) error {
 	return nc.publish(subj, _EMPTY_, nil, data)
 }
 
+// PublishIfConnected publishes the data argument to the given subject only
+// if the connection is currently connected. While the connection is
+// reconnecting or connecting, the message is dropped instead of being
+// buffered and false is returned. This is intended for non-critical
+// data, such as telemetry, which should not fill the reconnect buffer.
+// When an outbound queue is used (see OutboundQueue), a message queued
+// while connected may still be buffered if the connection is lost before
+// it is written.
+func (nc *Conn) PublishIfConnected(subj string, data []byte) (bool, error) {
+	if nc == nil {
+		return false, ErrInvalidConnection
+	}
+	if subj == "" {
+		return false, ErrBadSubject
+	}
+	if nc.outq != nil {
+		if nc.IsClosed() {
+			return false, ErrConnectionClosed
+		}
+		if !nc.IsConnected() {
+			return false, nil
+		}
+		if err := nc.queuePublish(subj, _EMPTY_, nil, data); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	if nc.isClosed() {
+		return false, ErrConnectionClosed
+	}
+	if !nc.isConnected() {
+		return false, nil
+	}
+	if err := nc.writePublishLocked(subj, _EMPTY_, nil, data); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 // Header represents the optional Header for a NATS message,
 // based on the implementation of http.Header.
 type Header map[string][]string
@@ -3801,6 +4873,31 @@ func (h Header) Del(key string) {
 	delete(h, key)
 }
 
+// validate checks that the header keys and values can be encoded in
+// the protocol without corrupting it. Keys have to be non-empty and
+// consist of printable ASCII characters other than colon, while values
+// cannot contain CR, LF or other control characters except tabs.
+func (h Header) validate() error {
+	for key, values := range h {
+		if key == _EMPTY_ {
+			return fmt.Errorf("%w: empty key", ErrInvalidHeader)
+		}
+		for i := 0; i < len(key); i++ {
+			if c := key[i]; c <= ' ' || c >= 0x7f || c == ':' {
+				return fmt.Errorf("%w: invalid key %q", ErrInvalidHeader, key)
+			}
+		}
+		for _, value := range values {
+			for i := 0; i < len(value); i++ {
+				if c := value[i]; (c < ' ' && c != '\t') || c == 0x7f {
+					return fmt.Errorf("%w: invalid value for key %q", ErrInvalidHeader, key)
+				}
+			}
+		}
+	}
+	return nil
+}
+
 // NewMsg creates a message for publishing that will use headers.
 func NewMsg(subject string) *Msg {
 	return &Msg{
@@ -3892,6 +4989,8 @@ func readMIMEHeader(tp *textproto.Reader) (textproto.MIMEHeader, error) {
 
 // PublishMsg publishes the Msg structure, which includes the
 // Subject, an optional Reply and an optional Data field.
+// ErrInvalidHeader is returned if a header key or value could
+// corrupt the protocol, e.g. if it contains CR or LF characters.
 func (nc *Conn) PublishMsg(m *Msg) error {
 	if m == nil {
 		return ErrInvalidMsg
@@ -3903,6 +5002,30 @@ func (nc *Conn) PublishMsg(m *Msg) error {
 	return nc.publish(m.Subject, m.Reply, hdr, m.Data)
 }
 
+// PublishWithHeaders publishes the data argument to the given subject
+// with the given headers, without having to build a Msg. As with
+// PublishMsg, ErrInvalidHeader is returned if the headers cannot be
+// sent, e.g. if a value contains CR or LF characters.
+func (nc *Conn) PublishWithHeaders(subj string, data []byte, hdr Header) error {
+	m := Msg{Header: hdr}
+	hdrBytes, err := m.headerBytes()
+	if err != nil {
+		return err
+	}
+	return nc.publish(subj, _EMPTY_, hdrBytes, data)
+}
+
+// ForwardMsg publishes a received message on the given subject, keeping
+// its reply subject. Unlike PublishMsg, the header block as received is
+// published as is, without encoding the headers again, so changes made
+// to the message Header are not forwarded.
+func (nc *Conn) ForwardMsg(subj string, m *Msg) error {
+	if m == nil {
+		return ErrInvalidMsg
+	}
+	return nc.publish(subj, m.Reply, m.HeaderBytes(), m.Data)
+}
+
 // PublishRequest will perform a Publish() expecting a response on the
 // reply subject. Use Request() for automatically waiting for a response
 // inline.
@@ -3920,24 +5043,65 @@ func (nc *Conn) publish(subj, reply string, hdr, data []byte) error {
 	if nc == nil {
 		return ErrInvalidConnection
 	}
+	if nc.outq != nil {
+		return nc.queuePublish(subj, reply, hdr, data)
+	}
+	return nc.writePublish(subj, reply, hdr, data)
+}
+
+// queuePublish adds a message to the outbound queue. Errors which
+// would prevent the message from being sent are returned right away.
+func (nc *Conn) queuePublish(subj, reply string, hdr, data []byte) error {
+	if subj == "" {
+		return ErrBadSubject
+	}
+	nc.mu.RLock()
+	if len(hdr) > 0 && !nc.info.Headers {
+		nc.mu.RUnlock()
+		return ErrHeadersNotSupported
+	}
+	if nc.isClosed() {
+		nc.mu.RUnlock()
+		return ErrConnectionClosed
+	}
+	if nc.isDrainingPubs() {
+		nc.mu.RUnlock()
+		return ErrConnectionDraining
+	}
+	if !nc.initc && int64(len(data)+len(hdr)) > nc.info.MaxPayload {
+		nc.mu.RUnlock()
+		return ErrMaxPayload
+	}
+	nc.mu.RUnlock()
+	return nc.outq.push(subj, reply, hdr, data)
+}
+
+// writePublish writes a message to the connection buffer.
+func (nc *Conn) writePublish(subj, reply string, hdr, data []byte) error {
 	if subj == "" {
 		return ErrBadSubject
 	}
 	nc.mu.Lock()
+	err := nc.writePublishLocked(subj, reply, hdr, data)
+	nc.mu.Unlock()
+	return err
+}
 
+// writePublishLocked writes a message to the connection buffer.
+// Lock should be held.
+func (nc *Conn) writePublishLocked(subj, reply string, hdr, data []byte) error {
 	// Check if headers attempted to be sent to server that does not support them.
 	if len(hdr) > 0 && !nc.info.Headers {
-		nc.mu.Unlock()
 		return ErrHeadersNotSupported
 	}
 
 	if nc.isClosed() {
-		nc.mu.Unlock()
 		return ErrConnectionClosed
 	}
 
-	if nc.isDrainingPubs() {
-		nc.mu.Unlock()
+	// Queued messages are still sent while draining,
+	// as they were published before the drain started.
+	if nc.isDrainingPubs() && nc.outq == nil {
 		return ErrConnectionDraining
 	}
 
@@ -3945,14 +5109,12 @@ func (nc *Conn) publish(subj, reply string, hdr, data []byte) error {
 	msgSize := int64(len(data) + len(hdr))
 	// Skip this check if we are not yet connected (RetryOnFailedConnect)
 	if !nc.initc && msgSize > nc.info.MaxPayload {
-		nc.mu.Unlock()
 		return ErrMaxPayload
 	}
 
 	// Check if we are reconnecting, and if so check if
 	// we have exceeded our reconnect outbound buffer limits.
 	if nc.bw.atLimitIfUsingPending() {
-		nc.mu.Unlock()
 		return ErrReconnectBufExceeded
 	}
 
@@ -3962,9 +5124,11 @@ func (nc *Conn) publish(subj, reply string, hdr, data []byte) error {
 	} else {
 		mh = nc.scratch[1:len(_HPUB_P_)]
 	}
+	mh = append(mh, nc.subjectPrefix(subj)...)
 	mh = append(mh, subj...)
 	mh = append(mh, ' ')
 	if reply != "" {
+		mh = append(mh, nc.replyPrefix(reply)...)
 		mh = append(mh, reply...)
 		mh = append(mh, ' ')
 	}
@@ -4007,18 +5171,33 @@ func (nc *Conn) publish(subj, reply string, hdr, data []byte) error {
 	mh = append(mh, b[i:]...)
 	mh = append(mh, _CRLF_...)
 
+	if nc.tracer != nil {
+		nc.tracer.out(string(mh), hdr, data)
+	}
 	if err := nc.bw.appendBufs(mh, hdr, data, _CRLF_BYTES_); err != nil {
-		nc.mu.Unlock()
 		return err
 	}
+	nc.bw.pendingMsgAdded()
 
-	nc.OutMsgs++
-	nc.OutBytes += uint64(len(data) + len(hdr))
+	atomic.AddUint64(&nc.OutMsgs, 1)
+	atomic.AddUint64(&nc.OutBytes, uint64(len(data)+len(hdr)))
 
-	if len(nc.fch) == 0 {
+	if nc.replay != nil {
+		nc.replay.record(subj, reply, hdr, data)
+	}
+
+	if nc.Opts.FlushOnPublish {
+		// This is a no-op if we are reconnecting and using
+		// the pending buffer.
+		if err := nc.bw.flush(); err != nil {
+			if nc.err == nil {
+				nc.err = err
+			}
+			return err
+		}
+	} else if len(nc.fch) < cap(nc.fch) {
 		nc.kickFlusher()
 	}
-	nc.mu.Unlock()
 	return nil
 }
 
@@ -4077,7 +5256,7 @@ func (nc *Conn) createNewRequestAndSend(subj string, hdr, data []byte) (chan *Ms
 		// Create the response subscription we will use for all new style responses.
 		// This will be on an _INBOX with an additional terminal token. The subscription
 		// will be on a wildcard.
-		s, err := nc.subscribeLocked(nc.respSub, _EMPTY_, nc.respHandler, nil, nil, false, nil)
+		s, err := nc.subscribeLocked(nc.respSub, _EMPTY_, nc.respHandler, nil, nil, false, nil, nil)
 		if err != nil {
 			nc.mu.Unlock()
 			return nil, token, err
@@ -4113,6 +5292,60 @@ func (nc *Conn) Request(subj string, data []byte, timeout time.Duration) (*Msg,
 	return nc.request(subj, nil, data, timeout)
 }
 
+// RequestGroupHeader is the header used by RequestGroup to select
+// the queue group which should handle a request.
+const RequestGroupHeader = "Nats-Request-Group"
+
+// RequestGroup will send a request payload intended for the given queue
+// group and deliver the response message, or an error, including a timeout
+// if no message was received properly.
+// Since the server delivers a request to a member of every queue group
+// subscribed to the subject, the group is selected using the
+// RequestGroupHeader header, and responders from other groups are expected
+// to ignore the request. Services built with the micro package honor it.
+// A request for a group without subscribers times out instead of
+// returning ErrNoResponders.
+func (nc *Conn) RequestGroup(subj, group string, data []byte, timeout time.Duration) (*Msg, error) {
+	if group == _EMPTY_ || badQueue(group) {
+		return nil, ErrBadQueueName
+	}
+	msg := NewMsg(subj)
+	msg.Header.Set(RequestGroupHeader, group)
+	msg.Data = data
+	return nc.RequestMsg(msg, timeout)
+}
+
+// RequestWithReply will send a request payload using the provided reply
+// subject instead of a generated inbox, and deliver the first response
+// message, or an error, including a timeout if no message was received
+// properly. This allows replies to be routed through subjects permitted
+// for the connection. The reply subject must not contain wildcards and
+// should not be shared with other requests in flight.
+func (nc *Conn) RequestWithReply(subj, reply string, data []byte, timeout time.Duration) (*Msg, error) {
+	if nc == nil {
+		return nil, ErrInvalidConnection
+	}
+	if reply == _EMPTY_ || badSubject(reply) || strings.ContainsAny(reply, "*>") {
+		return nil, ErrBadSubject
+	}
+	ch := make(chan *Msg, RequestChanLen)
+	s, err := nc.subscribe(reply, _EMPTY_, nil, ch, nil, true, nil)
+	if err != nil {
+		return nil, err
+	}
+	s.AutoUnsubscribe(1)
+	defer s.Unsubscribe()
+
+	if err := nc.publish(subj, reply, nil, data); err != nil {
+		return nil, err
+	}
+	m, err := nc.oldRequestWait(s, reply, subj, timeout)
+	if err == nil && len(m.Data) == 0 && m.Header.Get(statusHdr) == noResponders {
+		m, err = nil, ErrNoResponders
+	}
+	return m, err
+}
+
 func (nc *Conn) useOldRequestStyle() bool {
 	nc.mu.RLock()
 	r := nc.Opts.UseOldRequestStyle
@@ -4146,6 +5379,9 @@ func (nc *Conn) newRequest(subj string, hdr, data []byte, timeout time.Duration)
 	if err != nil {
 		return nil, err
 	}
+	canceled := make(chan struct{})
+	req := nc.inflight.add(nc.respSubPrefix+token, subj, func() { close(canceled) })
+	defer nc.inflight.remove(req)
 
 	t := globalTimerPool.Get(timeout)
 	defer globalTimerPool.Put(t)
@@ -4163,6 +5399,11 @@ func (nc *Conn) newRequest(subj string, hdr, data []byte, timeout time.Duration)
 		delete(nc.respMap, token)
 		nc.mu.Unlock()
 		return nil, ErrTimeout
+	case <-canceled:
+		nc.mu.Lock()
+		delete(nc.respMap, token)
+		nc.mu.Unlock()
+		return nil, ErrRequestCanceled
 	}
 
 	return msg, nil
@@ -4187,7 +5428,7 @@ func (nc *Conn) oldRequest(subj string, hdr, data []byte, timeout time.Duration)
 		return nil, err
 	}
 
-	return s.NextMsg(timeout)
+	return nc.oldRequestWait(s, inbox, subj, timeout)
 }
 
 // InboxPrefix is the prefix for all inbox subjects.
@@ -4284,6 +5525,50 @@ func (nc *Conn) Subscribe(subj string, cb MsgHandler) (*Subscription, error) {
 	return nc.subscribe(subj, _EMPTY_, cb, nil, nil, false, nil)
 }
 
+// SubscribeFiltered will express interest in the given subject, delivering
+// to the associated MsgHandler only the messages for which filter returns
+// true. The filter is invoked before the messages are queued for delivery,
+// so non-matching messages do not count against pending limits. They are
+// dropped and counted in Subscription.Filtered().
+// The filter is called from the connection's read loop and must be cheap
+// and must not block.
+func (nc *Conn) SubscribeFiltered(subj string, filter func(*Msg) bool, cb MsgHandler) (*Subscription, error) {
+	if nc == nil {
+		return nil, ErrInvalidConnection
+	}
+	if filter == nil {
+		return nil, ErrBadSubscription
+	}
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	return nc.subscribeLocked(subj, _EMPTY_, cb, nil, nil, false, nil, filter)
+}
+
+// SubscribeWithBuffer will express interest in the given subject, buffering
+// up to bufSize messages pending delivery to the associated MsgHandler.
+// This is equivalent to calling SetPendingLimits on the subscription with
+// bufSize as the message limit, but applies from the start: a small buffer
+// bounds memory usage and reports a slow consumer sooner, while a large one
+// absorbs bursts. The bytes limit remains DefaultSubPendingBytesLimit.
+func (nc *Conn) SubscribeWithBuffer(subj string, bufSize int, cb MsgHandler) (*Subscription, error) {
+	if nc == nil {
+		return nil, ErrInvalidConnection
+	}
+	if bufSize <= 0 {
+		return nil, ErrInvalidArg
+	}
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	sub, err := nc.subscribeLocked(subj, _EMPTY_, cb, nil, nil, false, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	sub.mu.Lock()
+	sub.pMsgsLimit = bufSize
+	sub.mu.Unlock()
+	return sub, nil
+}
+
 // ChanSubscribe will express interest in the given subject and place
 // all messages received on the channel.
 // You should not close the channel until sub.Unsubscribe() has been called.
@@ -4361,6 +5646,29 @@ func badSubject(subj string) bool {
 	return false
 }
 
+// subjectIsSubsetMatch reports whether every subject matched by subj,
+// which may contain wildcards, is also matched by the filter.
+func subjectIsSubsetMatch(subj, filter string) bool {
+	tokens := strings.Split(subj, ".")
+	filterTokens := strings.Split(filter, ".")
+	for i, ft := range filterTokens {
+		if ft == ">" {
+			return len(tokens) > i
+		}
+		if i >= len(tokens) {
+			return false
+		}
+		t := tokens[i]
+		if t == ">" {
+			return false
+		}
+		if ft != "*" && ft != t {
+			return false
+		}
+	}
+	return len(tokens) == len(filterTokens)
+}
+
 // badQueue will check a queue name for whitespace.
 func badQueue(qname string) bool {
 	return strings.ContainsAny(qname, " \t\r\n")
@@ -4373,10 +5681,10 @@ func (nc *Conn) subscribe(subj, queue string, cb MsgHandler, ch chan *Msg, errCh
 	}
 	nc.mu.Lock()
 	defer nc.mu.Unlock()
-	return nc.subscribeLocked(subj, queue, cb, ch, errCh, isSync, js)
+	return nc.subscribeLocked(subj, queue, cb, ch, errCh, isSync, js, nil)
 }
 
-func (nc *Conn) subscribeLocked(subj, queue string, cb MsgHandler, ch chan *Msg, errCh chan (error), isSync bool, js *jsSub) (*Subscription, error) {
+func (nc *Conn) subscribeLocked(subj, queue string, cb MsgHandler, ch chan *Msg, errCh chan (error), isSync bool, js *jsSub, filter func(*Msg) bool) (*Subscription, error) {
 	if nc == nil {
 		return nil, ErrInvalidConnection
 	}
@@ -4405,6 +5713,7 @@ func (nc *Conn) subscribeLocked(subj, queue string, cb MsgHandler, ch chan *Msg,
 		mcb:     cb,
 		conn:    nc,
 		jsi:     js,
+		filter:  filter,
 	}
 	// Set pending limits.
 	if ch != nil {
@@ -4415,12 +5724,14 @@ func (nc *Conn) subscribeLocked(subj, queue string, cb MsgHandler, ch chan *Msg,
 	sub.pBytesLimit = DefaultSubPendingBytesLimit
 
 	// If we have an async callback, start up a sub specific
-	// Go routine to deliver the messages.
+	// Go routine to deliver the messages, unless using the
+	// shared dispatcher.
 	var sr bool
 	if cb != nil {
 		sub.typ = AsyncSubscription
 		sub.pCond = sync.NewCond(&sub.mu)
-		sr = true
+		sub.dispatcher = nc.subDispatcher
+		sr = sub.dispatcher == nil
 	} else if !isSync {
 		sub.typ = ChanSubscription
 		sub.mch = ch
@@ -4444,7 +5755,9 @@ func (nc *Conn) subscribeLocked(subj, queue string, cb MsgHandler, ch chan *Msg,
 	// We will send these for all subs when we reconnect
 	// so that we can suppress here if reconnecting.
 	if !nc.isReconnecting() {
-		nc.bw.appendString(fmt.Sprintf(subProto, subj, queue, sub.sid))
+		proto := fmt.Sprintf(subProto, nc.subjectPrefix(subj)+subj, queue, sub.sid)
+		nc.tracer.out(proto)
+		nc.bw.appendString(proto)
 		nc.kickFlusher()
 	}
 
@@ -4493,8 +5806,10 @@ func (nc *Conn) removeSub(s *Subscription) {
 	// Mark as invalid
 	s.closed = true
 	s.changeSubStatus(SubscriptionClosed)
+	s.closeErrors()
 	if s.pCond != nil {
 		s.pCond.Broadcast()
+		s.schedule()
 	}
 }
 
@@ -4539,7 +5854,8 @@ func (s *Subscription) IsValid() bool {
 }
 
 // Drain will remove interest but continue callbacks until all messages
-// have been processed.
+// have been processed. For a synchronous subscription, NextMsg returns
+// ErrSubscriptionDrained once all pending messages have been delivered.
 //
 // For a JetStream subscription, if the library has created the JetStream
 // consumer, the library will send a DeleteConsumer request to the server
@@ -4594,6 +5910,50 @@ func (s *Subscription) StatusChanged(statuses ...SubStatus) <-chan SubStatus {
 	return ch
 }
 
+// subErrorsChanLen is the buffer size of the channel returned by Errors.
+const subErrorsChanLen = 8
+
+// Errors returns a channel on which errors specific to the subscription
+// are sent, such as ErrSlowConsumer when the subscription starts dropping
+// messages, or a permissions violation for its subject. Errors are sent
+// without blocking and are discarded if the channel buffer is full.
+// The returned channel will be closed when the subscription is closed.
+func (s *Subscription) Errors() <-chan error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.errs == nil {
+		s.errs = make(chan error, subErrorsChanLen)
+		if s.closed {
+			s.closeErrors()
+		}
+	}
+	return s.errs
+}
+
+// sendError sends the error to the channel returned by Errors, if any.
+// Lock should be held entering.
+func (s *Subscription) sendError(err error) {
+	if s.errs == nil || s.closed {
+		return
+	}
+	select {
+	case s.errs <- err:
+	default:
+	}
+}
+
+// closeErrors closes the channel returned by Errors, if any.
+// Lock should be held entering, after marking the subscription closed.
+func (s *Subscription) closeErrors() {
+	if s.errs != nil && !s.errsClosed {
+		close(s.errs)
+		s.errsClosed = true
+	}
+}
+
 // registerStatusChangeListener registers a channel waiting for a specific status change event.
 // Status change events are non-blocking - if no receiver is waiting for the status change,
 // it will not be sent on the channel. Closed channels are ignored.
@@ -4720,6 +6080,9 @@ func (nc *Conn) checkDrained(sub *Subscription) {
 		sub.mu.Unlock()
 
 		if conn == nil || closed || pMsgs == 0 {
+			sub.mu.Lock()
+			sub.drained = !sub.closed && sub.conn != nil
+			sub.mu.Unlock()
 			nc.mu.Lock()
 			nc.removeSub(sub)
 			nc.mu.Unlock()
@@ -4809,7 +6172,9 @@ func (nc *Conn) unsubscribe(sub *Subscription, max int, drainMode bool) error {
 	// We will send these for all subs when we reconnect
 	// so that we can suppress here.
 	if !nc.isReconnecting() {
-		nc.bw.appendString(fmt.Sprintf(unsubProto, s.sid, maxStr))
+		proto := fmt.Sprintf(unsubProto, s.sid, maxStr)
+		nc.tracer.out(proto)
+		nc.bw.appendString(proto)
 		nc.kickFlusher()
 	}
 
@@ -4831,7 +6196,8 @@ func (nc *Conn) unsubscribe(sub *Subscription, max int, drainMode bool) error {
 
 // NextMsg will return the next message available to a synchronous subscriber
 // or block until one is available. An error is returned if the subscription is invalid (ErrBadSubscription),
-// the connection is closed (ErrConnectionClosed), the timeout is reached (ErrTimeout),
+// the connection is closed (ErrConnectionClosed), the subscription was drained and all
+// its messages were delivered (ErrSubscriptionDrained), the timeout is reached (ErrTimeout),
 // or if there were no responders (ErrNoResponders) when used in the context of a request/reply.
 func (s *Subscription) NextMsg(timeout time.Duration) (*Msg, error) {
 	if s == nil {
@@ -4967,6 +6333,9 @@ func (s *Subscription) nextMsgNoTimeout() (*Msg, error) {
 // state to call NextMsg and be delivered another message synchronously.
 // This should be called while holding the lock.
 func (s *Subscription) validateNextMsgState(pullSubInternal bool) error {
+	if s.drained {
+		return ErrSubscriptionDrained
+	}
 	if s.connClosed {
 		return ErrConnectionClosed
 	}
@@ -5000,11 +6369,14 @@ func (s *Subscription) validateNextMsgState(pullSubInternal bool) error {
 }
 
 // This is called when the sync channel has been closed.
-// The error returned will be either connection or subscription
-// closed depending on what caused NextMsg() to fail.
+// The error returned will be either subscription drained, connection
+// or subscription closed depending on what caused NextMsg() to fail.
 func (s *Subscription) getNextMsgErr() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if s.drained {
+		return ErrSubscriptionDrained
+	}
 	if s.connClosed {
 		return ErrConnectionClosed
 	}
@@ -5189,6 +6561,104 @@ func (s *Subscription) Dropped() (int, error) {
 	return s.dropped, nil
 }
 
+// MaxDroppedSubjects is the maximum number of subjects of dropped
+// messages which can be captured by a subscription.
+const MaxDroppedSubjects = 1024
+
+// CaptureDroppedSubjects enables capturing the subjects of the last n
+// messages dropped because of a slow consumer, which are then returned by
+// DroppedSubjects. Capture is disabled by default to avoid the overhead,
+// and setting n to 0 disables it again. n must not exceed MaxDroppedSubjects.
+func (s *Subscription) CaptureDroppedSubjects(n int) error {
+	if s == nil {
+		return ErrBadSubscription
+	}
+	if n < 0 || n > MaxDroppedSubjects {
+		return ErrInvalidArg
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil || s.closed {
+		return ErrBadSubscription
+	}
+	s.droppedNext, s.droppedFull = 0, false
+	if n == 0 {
+		s.droppedSubjs = nil
+	} else {
+		s.droppedSubjs = make([]string, n)
+	}
+	return nil
+}
+
+// DroppedSubjects returns the subjects of the last messages dropped because
+// of a slow consumer, oldest first, if enabled with CaptureDroppedSubjects.
+func (s *Subscription) DroppedSubjects() []string {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.droppedFull {
+		return append([]string(nil), s.droppedSubjs[:s.droppedNext]...)
+	}
+	subjs := make([]string, 0, len(s.droppedSubjs))
+	subjs = append(subjs, s.droppedSubjs[s.droppedNext:]...)
+	return append(subjs, s.droppedSubjs[:s.droppedNext]...)
+}
+
+// Filtered returns the number of messages discarded by the filter of a
+// subscription created with SubscribeFiltered.
+func (s *Subscription) Filtered() (int, error) {
+	if s == nil {
+		return -1, ErrBadSubscription
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil || s.closed {
+		return -1, ErrBadSubscription
+	}
+	return s.filtered, nil
+}
+
+// SetMaxMsgAge sets the maximum time a message can be pending before being
+// delivered to the handler of an asynchronous subscription. Messages which
+// were received longer ago, e.g. because the handler fell behind, are
+// dropped instead of being delivered, and counted in DroppedByAge.
+// This is useful when processing messages late is worse than not
+// processing them at all. A zero duration disables the check.
+func (s *Subscription) SetMaxMsgAge(d time.Duration) error {
+	if s == nil {
+		return ErrBadSubscription
+	}
+	if d < 0 {
+		return ErrInvalidArg
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil || s.closed {
+		return ErrBadSubscription
+	}
+	if s.typ != AsyncSubscription {
+		return ErrTypeSubscription
+	}
+	s.maxMsgAge = d
+	return nil
+}
+
+// DroppedByAge returns the number of messages dropped because they were
+// pending for longer than the maximum age set with SetMaxMsgAge.
+func (s *Subscription) DroppedByAge() (int, error) {
+	if s == nil {
+		return -1, ErrBadSubscription
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil || s.closed {
+		return -1, ErrBadSubscription
+	}
+	return s.droppedByAge, nil
+}
+
 // Respond allows a convenient way to respond to requests in service based subscriptions.
 func (m *Msg) Respond(data []byte) error {
 	if m == nil || m.Sub == nil {
@@ -5242,6 +6712,7 @@ func (nc *Conn) removeFlushEntry(ch chan struct{}) bool {
 // The lock must be held entering this function.
 func (nc *Conn) sendPing(ch chan struct{}) {
 	nc.pongs = append(nc.pongs, ch)
+	nc.tracer.out(pingProto)
 	nc.bw.appendString(pingProto)
 	// Flush in place.
 	nc.bw.flush()
@@ -5281,19 +6752,29 @@ func (nc *Conn) FlushTimeout(timeout time.Duration) (err error) {
 	if timeout <= 0 {
 		return ErrBadTimeout
 	}
+	t := globalTimerPool.Get(timeout)
+	defer globalTimerPool.Put(t)
+
+	// Wait for queued messages to be written first.
+	if nc.outq != nil {
+		select {
+		case <-nc.outq.emptied():
+		case <-t.C:
+			return ErrTimeout
+		}
+	}
 
 	nc.mu.Lock()
 	if nc.isClosed() {
 		nc.mu.Unlock()
 		return ErrConnectionClosed
 	}
-	t := globalTimerPool.Get(timeout)
-	defer globalTimerPool.Put(t)
 
 	// Create a buffered channel to prevent chan send to block
 	// in processPong() if this code here times out just when
 	// PONG was received.
 	ch := make(chan struct{}, 1)
+	start := time.Now()
 	nc.sendPing(ch)
 	nc.mu.Unlock()
 
@@ -5303,6 +6784,7 @@ func (nc *Conn) FlushTimeout(timeout time.Duration) (err error) {
 			err = ErrConnectionClosed
 		} else {
 			close(ch)
+			nc.flushed(time.Since(start))
 		}
 	case <-t.C:
 		err = ErrTimeout
@@ -5314,6 +6796,14 @@ func (nc *Conn) FlushTimeout(timeout time.Duration) (err error) {
 	return
 }
 
+// flushed reports the round trip time of a successful flush to the
+// FlushCB callback, if set.
+func (nc *Conn) flushed(rtt time.Duration) {
+	if cb := nc.Opts.FlushCB; cb != nil {
+		nc.ach.push(func() { cb(rtt) })
+	}
+}
+
 // RTT calculates the round trip time between this client and the server.
 func (nc *Conn) RTT() (time.Duration, error) {
 	if nc.IsClosed() {
@@ -5372,17 +6862,23 @@ func (nc *Conn) resendSubscriptions() {
 			// reached the max, if so unsubscribe.
 			if adjustedMax == 0 {
 				s.mu.Unlock()
-				nc.bw.writeDirect(fmt.Sprintf(unsubProto, s.sid, _EMPTY_))
+				proto := fmt.Sprintf(unsubProto, s.sid, _EMPTY_)
+				nc.tracer.out(proto)
+				nc.bw.writeDirect(proto)
 				continue
 			}
 		}
 		subj, queue, sid := s.Subject, s.Queue, s.sid
 		s.mu.Unlock()
 
-		nc.bw.writeDirect(fmt.Sprintf(subProto, subj, queue, sid))
+		proto := fmt.Sprintf(subProto, nc.subjectPrefix(subj)+subj, queue, sid)
+		nc.tracer.out(proto)
+		nc.bw.writeDirect(proto)
 		if adjustedMax > 0 {
 			maxStr := strconv.Itoa(int(adjustedMax))
-			nc.bw.writeDirect(fmt.Sprintf(unsubProto, sid, maxStr))
+			proto = fmt.Sprintf(unsubProto, sid, maxStr)
+			nc.tracer.out(proto)
+			nc.bw.writeDirect(proto)
 		}
 	}
 }
@@ -5439,6 +6935,11 @@ func (nc *Conn) close(status Status, doCBs bool, err error) {
 	// Clear any queued and blocking Requests.
 	nc.clearPendingRequestCalls()
 
+	// Discard queued messages and release blocked publishers.
+	if nc.outq != nil {
+		nc.outq.close()
+	}
+
 	// Stop ping timer if set.
 	nc.stopPingTimer()
 	nc.ptmr = nil
@@ -5470,9 +6971,11 @@ func (nc *Conn) close(status Status, doCBs bool, err error) {
 		s.closed = true
 		// Mark connection closed in subscription
 		s.connClosed = true
+		s.closeErrors()
 		// If we have an async subscription, signals it to exit
 		if s.typ == AsyncSubscription && s.pCond != nil {
 			s.pCond.Signal()
+			s.schedule()
 		}
 
 		s.mu.Unlock()
@@ -5491,14 +6994,17 @@ func (nc *Conn) close(status Status, doCBs bool, err error) {
 				nc.ach.push(func() { disconnectedCB(nc) })
 			}
 		}
-		if nc.Opts.ClosedCB != nil {
-			nc.ach.push(func() { nc.Opts.ClosedCB(nc) })
+		if closedCB := nc.Opts.ClosedCB; closedCB != nil {
+			nc.ach.push(func() { closedCB(nc) })
 		}
 	}
 	// If this is terminal, then we have to notify the asyncCB handler that
 	// it can exit once all async callbacks have been dispatched.
 	if status == CLOSED {
 		nc.ach.close()
+		if nc.subDispatcher != nil {
+			nc.subDispatcher.close()
+		}
 	}
 	nc.mu.Unlock()
 }
@@ -5746,18 +7252,46 @@ func (nc *Conn) isDrainingPubs() bool {
 
 // Stats will return a race safe copy of the Statistics section for the connection.
 func (nc *Conn) Stats() Statistics {
-	// Stats are updated either under connection's mu or with atomic operations
-	// for inbound stats in processMsg().
-	nc.mu.Lock()
-	stats := Statistics{
+	// Stats are always updated with atomic operations.
+	return Statistics{
 		InMsgs:     atomic.LoadUint64(&nc.InMsgs),
 		InBytes:    atomic.LoadUint64(&nc.InBytes),
-		OutMsgs:    nc.OutMsgs,
-		OutBytes:   nc.OutBytes,
-		Reconnects: nc.Reconnects,
+		OutMsgs:    atomic.LoadUint64(&nc.OutMsgs),
+		OutBytes:   atomic.LoadUint64(&nc.OutBytes),
+		Reconnects: atomic.LoadUint64(&nc.Reconnects),
+
+		FlusherWakeups: atomic.LoadUint64(&nc.FlusherWakeups),
+		Flushes:        atomic.LoadUint64(&nc.Flushes),
+		FlushedBytes:   atomic.LoadUint64(&nc.FlushedBytes),
 	}
-	nc.mu.Unlock()
-	return stats
+}
+
+// addReconnectEvent records a reconnect, keeping at most
+// Options.ReconnectHistorySize events.
+// Lock for nc should be held.
+func (nc *Conn) addReconnectEvent(ev ReconnectEvent) {
+	size := nc.Opts.ReconnectHistorySize
+	if size <= 0 {
+		return
+	}
+	if len(nc.reconnects) >= size {
+		n := copy(nc.reconnects, nc.reconnects[len(nc.reconnects)-size+1:])
+		nc.reconnects = nc.reconnects[:n]
+	}
+	nc.reconnects = append(nc.reconnects, ev)
+}
+
+// ReconnectHistory returns the most recent reconnect events,
+// oldest first. See ReconnectHistorySize option.
+func (nc *Conn) ReconnectHistory() []ReconnectEvent {
+	if nc == nil {
+		return nil
+	}
+	nc.mu.RLock()
+	defer nc.mu.RUnlock()
+	history := make([]ReconnectEvent, len(nc.reconnects))
+	copy(history, nc.reconnects)
+	return history
 }
 
 // MaxPayload returns the size limit that a message payload can have.
@@ -5790,6 +7324,42 @@ func (nc *Conn) TLSRequired() bool {
 	return nc.info.TLSRequired
 }
 
+// PendingOutbound returns the number of messages in the outbound queue
+// which have not yet been written to the connection. It returns 0 if
+// the outbound queue is not enabled.
+func (nc *Conn) PendingOutbound() int {
+	if nc == nil || nc.outq == nil {
+		return 0
+	}
+	return nc.outq.len()
+}
+
+// SubscriptionsPending returns the total number of messages and bytes
+// pending delivery across all subscriptions of the connection, excluding
+// channel based subscriptions.
+func (nc *Conn) SubscriptionsPending() (int, int) {
+	if nc == nil {
+		return 0, 0
+	}
+	nc.subsMu.RLock()
+	subs := make([]*Subscription, 0, len(nc.subs))
+	for _, sub := range nc.subs {
+		subs = append(subs, sub)
+	}
+	nc.subsMu.RUnlock()
+
+	var msgs, bytes int
+	for _, sub := range subs {
+		sub.mu.Lock()
+		if sub.typ != ChanSubscription {
+			msgs += sub.pMsgs
+			bytes += sub.pBytes
+		}
+		sub.mu.Unlock()
+	}
+	return msgs, bytes
+}
+
 // Barrier schedules the given function `f` to all registered asynchronous
 // subscriptions.
 // Only the last subscription to see this barrier will invoke the function.
@@ -5828,6 +7398,7 @@ func (nc *Conn) Barrier(f func()) error {
 			} else {
 				sub.pHead = msg
 				sub.pCond.Signal()
+				sub.schedule()
 			}
 			sub.pTail = msg
 		}
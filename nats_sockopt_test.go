@@ -0,0 +1,165 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package nats
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func getSockOpt(t *testing.T, conn net.Conn, level, opt int) int {
+	t.Helper()
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		t.Fatalf("Expected a TCP connection, got %T", conn)
+	}
+	rc, err := tcpConn.SyscallConn()
+	if err != nil {
+		t.Fatalf("Error getting raw connection: %v", err)
+	}
+	var val int
+	var serr error
+	if err := rc.Control(func(fd uintptr) {
+		val, serr = syscall.GetsockoptInt(int(fd), level, opt)
+	}); err != nil {
+		t.Fatalf("Error accessing raw connection: %v", err)
+	}
+	if serr != nil {
+		t.Fatalf("Error getting socket option: %v", serr)
+	}
+	return val
+}
+
+func TestTCPSocketOptions(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not listen on an ephemeral port: %v", err)
+	}
+	defer l.Close()
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				conn.Write([]byte("INFO {\"server_id\":\"foobar\"}\r\n"))
+				br := bufio.NewReaderSize(conn, 1024)
+				for {
+					line, _, err := br.ReadLine()
+					if err != nil {
+						return
+					}
+					if string(line) == "PING" {
+						conn.Write([]byte(pongProto))
+					}
+				}
+			}(conn)
+		}
+	}()
+	url := fmt.Sprintf("nats://%s", l.Addr().String())
+
+	for _, test := range []struct {
+		name      string
+		opts      []Option
+		noDelay   int
+		keepAlive int
+		keepIdle  time.Duration
+	}{
+		{"defaults", nil, 1, 1, 0},
+		{"no delay disabled", []Option{TCPNoDelay(false)}, 0, 1, 0},
+		{"no delay re-enabled", []Option{TCPNoDelay(false), TCPNoDelay(true)}, 1, 1, 0},
+		{"keep alive period", []Option{TCPKeepAlive(7 * time.Second)}, 1, 1, 7 * time.Second},
+		{"keep alive disabled", []Option{TCPKeepAlive(-1)}, 1, 0, 0},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			nc, err := Connect(url, test.opts...)
+			if err != nil {
+				t.Fatalf("Error on connect: %v", err)
+			}
+			defer nc.Close()
+
+			nc.mu.Lock()
+			conn := nc.conn
+			nc.mu.Unlock()
+
+			if v := getSockOpt(t, conn, syscall.IPPROTO_TCP, syscall.TCP_NODELAY); v != test.noDelay {
+				t.Fatalf("Expected TCP_NODELAY to be %d, got %d", test.noDelay, v)
+			}
+			if v := getSockOpt(t, conn, syscall.SOL_SOCKET, syscall.SO_KEEPALIVE); v != test.keepAlive {
+				t.Fatalf("Expected SO_KEEPALIVE to be %d, got %d", test.keepAlive, v)
+			}
+			if test.keepIdle > 0 {
+				v := getSockOpt(t, conn, syscall.IPPROTO_TCP, syscall.TCP_KEEPIDLE)
+				if time.Duration(v)*time.Second != test.keepIdle {
+					t.Fatalf("Expected TCP_KEEPIDLE to be %v, got %vs", test.keepIdle, v)
+				}
+			}
+		})
+	}
+
+	t.Run("options without defaults", func(t *testing.T) {
+		nc, err := (&Options{Url: url}).Connect()
+		if err != nil {
+			t.Fatalf("Error on connect: %v", err)
+		}
+		defer nc.Close()
+
+		nc.mu.Lock()
+		conn := nc.conn
+		nc.mu.Unlock()
+
+		if v := getSockOpt(t, conn, syscall.IPPROTO_TCP, syscall.TCP_NODELAY); v != 1 {
+			t.Fatalf("Expected TCP_NODELAY to be 1, got %d", v)
+		}
+	})
+
+	t.Run("non tcp connection from custom dialer", func(t *testing.T) {
+		nc, err := Connect(url, SetCustomDialer(&wrappingDialer{addr: l.Addr().String()}), TCPKeepAlive(time.Second))
+		if err != nil {
+			t.Fatalf("Error on connect: %v", err)
+		}
+		defer nc.Close()
+		if !nc.IsConnected() {
+			t.Fatalf("Expected to be connected")
+		}
+	})
+}
+
+// wrappingDialer dials a TCP connection and hides it behind
+// a wrapper, so that it is not seen as a *net.TCPConn.
+type wrappingDialer struct {
+	addr string
+}
+
+type wrappedConn struct {
+	net.Conn
+}
+
+func (d *wrappingDialer) Dial(network, address string) (net.Conn, error) {
+	conn, err := net.Dial(network, d.addr)
+	if err != nil {
+		return nil, err
+	}
+	return &wrappedConn{conn}, nil
+}
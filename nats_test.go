@@ -23,12 +23,14 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math/rand"
 	"net"
 	"net/http"
 	"os"
 	"reflect"
 	"regexp"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -375,6 +377,136 @@ func TestServersRandomize(t *testing.T) {
 	}
 }
 
+// recordingDialer records the addresses dialed, failing every attempt.
+type recordingDialer struct {
+	sync.Mutex
+	dialed []string
+}
+
+func (d *recordingDialer) Dial(_, address string) (net.Conn, error) {
+	d.Lock()
+	defer d.Unlock()
+	d.dialed = append(d.dialed, address)
+	return nil, errors.New("connection refused")
+}
+
+func (d *recordingDialer) addresses() []string {
+	d.Lock()
+	defer d.Unlock()
+	return append([]string(nil), d.dialed...)
+}
+
+func TestServersRandomizeDistribution(t *testing.T) {
+	servers := []string{"nats://127.0.0.1:1222", "nats://127.0.0.1:1223", "nats://127.0.0.1:1224"}
+	firstServers := func(seed int64) map[string]int {
+		first := make(map[string]int)
+		r := rand.New(rand.NewSource(seed))
+		for i := 0; i < 3000; i++ {
+			opts := GetDefaultOptions()
+			opts.Servers = servers
+			opts.poolRand = r
+			dialer := &recordingDialer{}
+			opts.CustomDialer = dialer
+			if _, err := opts.Connect(); err == nil {
+				t.Fatal("Expected connect to fail")
+			}
+			first[dialer.addresses()[0]]++
+		}
+		return first
+	}
+
+	first := firstServers(1)
+	for _, server := range servers {
+		// Each server should be dialed first by about a third of the clients.
+		if n := first[strings.TrimPrefix(server, "nats://")]; n < 900 || n > 1100 {
+			t.Fatalf("Server %q dialed first %d times out of 3000: %v", server, n, first)
+		}
+	}
+	if again := firstServers(1); !reflect.DeepEqual(first, again) {
+		t.Fatalf("Expected same distribution with same seed; got %v and %v", first, again)
+	}
+}
+
+func TestServersRandomizeOnReconnectPass(t *testing.T) {
+	servers := []string{"nats://127.0.0.1:1222", "nats://127.0.0.1:1223", "nats://127.0.0.1:1224"}
+	// passes returns the order in which servers were dialed on each full
+	// pass over the pool during reconnect. Passes are separated by the
+	// reconnect delay.
+	passes := func(noRandomize bool) [][]string {
+		closed := make(chan struct{})
+		dialer := &recordingDialer{}
+		opts := GetDefaultOptions()
+		opts.Servers = servers
+		opts.NoRandomize = noRandomize
+		opts.poolRand = rand.New(rand.NewSource(1))
+		opts.CustomDialer = dialer
+		opts.RetryOnFailedConnect = true
+		opts.MaxReconnect = 10
+		opts.CustomReconnectDelayCB = func(int) time.Duration {
+			dialer.Lock()
+			dialer.dialed = append(dialer.dialed, "")
+			dialer.Unlock()
+			return time.Millisecond
+		}
+		opts.ClosedCB = func(_ *Conn) { close(closed) }
+		nc, err := opts.Connect()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer nc.Close()
+		select {
+		case <-closed:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Connection was not closed after exhausting reconnects")
+		}
+
+		var res [][]string
+		var pass []string
+		// skip the connects done before the first reconnect delay
+		dialed := dialer.addresses()
+		for _, addr := range dialed[slices.Index(dialed, "")+1:] {
+			if addr != "" {
+				pass = append(pass, addr)
+				continue
+			}
+			// servers are removed from the pool once out of reconnects
+			if len(pass) != len(servers) {
+				break
+			}
+			res = append(res, pass)
+			pass = nil
+		}
+		if len(res) < 5 {
+			t.Fatalf("Expected at least 5 passes; got: %v", dialed)
+		}
+		for _, pass := range res {
+			seen := make(map[string]struct{})
+			for _, addr := range pass {
+				seen[addr] = struct{}{}
+			}
+			if len(seen) != len(servers) {
+				t.Fatalf("Expected each server to be dialed once per pass; got: %v", dialed)
+			}
+		}
+		return res
+	}
+
+	samePasses := func(passes [][]string) bool {
+		for _, pass := range passes[1:] {
+			if !reflect.DeepEqual(pass, passes[0]) {
+				return false
+			}
+		}
+		return true
+	}
+	if p := passes(false); samePasses(p) {
+		t.Fatalf("Expected the pool to be shuffled between passes; got: %v", p)
+	}
+	if p := passes(true); !samePasses(p) {
+		t.Fatalf("Expected the pool order to be kept with NoRandomize; got: %v", p)
+	}
+}
+
 func TestSelectNextServer(t *testing.T) {
 	opts := GetDefaultOptions()
 	opts.Servers = testServers
@@ -1644,6 +1776,63 @@ X-Test-Keys: F
 	}
 }
 
+func TestUnsolicitedPong(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not listen on an ephemeral port: %v", err)
+	}
+	defer l.Close()
+
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		conn.Write([]byte("INFO {\"server_id\":\"foobar\"}\r\n"))
+
+		// Read connect and ping commands sent from the client
+		br := bufio.NewReaderSize(conn, 10*1024)
+		br.ReadLine()
+		br.ReadLine()
+		conn.Write([]byte(pongProto))
+
+		// Send PONGs the client did not ask for.
+		conn.Write([]byte(pongProto + pongProto))
+
+		for {
+			line, _, err := br.ReadLine()
+			if err != nil {
+				return
+			}
+			if string(line) == "PING" {
+				conn.Write([]byte(pongProto))
+			}
+		}
+	}()
+
+	nc, err := Connect(fmt.Sprintf("nats://%s", l.Addr()), NoReconnect())
+	if err != nil {
+		t.Fatalf("Expected to connect, got %v", err)
+	}
+	defer nc.Close()
+
+	time.Sleep(100 * time.Millisecond)
+	if !nc.IsConnected() {
+		t.Fatalf("Expected connection to stay alive, got status %v", nc.Status())
+	}
+	if err := nc.FlushTimeout(time.Second); err != nil {
+		t.Fatalf("Error on flush: %v", err)
+	}
+
+	nc.Close()
+	wg.Wait()
+}
+
 func TestLameDuckMode(t *testing.T) {
 	l, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
@@ -1738,6 +1927,159 @@ func TestLameDuckMode(t *testing.T) {
 	wg.Wait()
 }
 
+func TestSetDiscoveredServersHandlerWhileCallbacksFire(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not listen on an ephemeral port: %v", err)
+	}
+	tl := l.(*net.TCPListener)
+	defer tl.Close()
+
+	addr := tl.Addr().(*net.TCPAddr)
+
+	const numInfos = 50
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		info := "INFO {\"server_id\":\"foobar\"}\r\n"
+		conn.Write([]byte(info))
+
+		// Read connect and ping commands sent from the client
+		br := bufio.NewReaderSize(conn, 10*1024)
+		br.ReadLine()
+		br.ReadLine()
+		conn.Write([]byte(pongProto))
+
+		// Every INFO adds a new server to the pool.
+		for i := 0; i < numInfos; i++ {
+			conn.Write([]byte(fmt.Sprintf("INFO {\"connect_urls\":[\"127.0.0.1:%d\"]}\r\n", 10000+i)))
+		}
+		br.ReadLine()
+	}()
+
+	url := fmt.Sprintf("nats://127.0.0.1:%d", addr.Port)
+	discovered := make(chan struct{}, numInfos)
+	handler := func(_ *Conn) { discovered <- struct{}{} }
+	nc, err := Connect(url, DiscoveredServersHandler(handler))
+	if err != nil {
+		t.Fatalf("Expected to connect, got %v", err)
+	}
+	defer nc.Close()
+
+	// Keep swapping the handler while callbacks are dispatched.
+	for i := 0; i < numInfos; i++ {
+		select {
+		case <-discovered:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Expected discovered servers callback; got %d", i)
+		}
+		nc.SetDiscoveredServersHandler(handler)
+	}
+
+	nc.Close()
+	wg.Wait()
+}
+
+func TestLongINFOLine(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not listen on an ephemeral port: %v", err)
+	}
+	tl := l.(*net.TCPListener)
+	defer tl.Close()
+
+	addr := tl.Addr().(*net.TCPAddr)
+
+	// Make INFO lines larger than the default reader buffer.
+	urls := make([]string, 0, 4000)
+	for i := 0; i < cap(urls); i++ {
+		urls = append(urls, fmt.Sprintf("\"127.0.0.1:%d\"", 10000+i))
+	}
+	curls := strings.Join(urls, ",")
+	name := strings.Repeat("a", 2*defaultBufSize)
+	longName := fmt.Sprintf("INFO {\"server_id\":\"foobar\",\"server_name\":%q}\r\n", name)
+	longInfo := fmt.Sprintf("INFO {\"server_id\":\"foobar\",\"server_name\":%q,\"connect_urls\":[%s]}\r\n", name, curls)
+	if len(longInfo) <= defaultBufSize {
+		t.Fatalf("INFO line should be longer than %d, got %d", defaultBufSize, len(longInfo))
+	}
+
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 2; i++ {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+
+			conn.Write([]byte(longName))
+
+			// Read connect and ping commands sent from the client
+			br := bufio.NewReaderSize(conn, 10*1024)
+			br.ReadLine()
+			br.ReadLine()
+			conn.Write([]byte(pongProto))
+
+			// Send the long INFO asynchronously, followed by a PING.
+			conn.Write([]byte(longInfo))
+			conn.Write([]byte(pingProto))
+			br.ReadLine()
+			conn.Close()
+		}
+	}()
+
+	url := fmt.Sprintf("nats://127.0.0.1:%d", addr.Port)
+	for _, test := range []struct {
+		name string
+		opts []Option
+	}{
+		{"default buffer", nil},
+		{"small buffer", []Option{ReaderBufSize(512)}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ch := make(chan int, 1)
+			opts := append(test.opts, DiscoveredServersHandler(func(nc *Conn) {
+				ch <- len(nc.DiscoveredServers())
+			}))
+			nc, err := Connect(url, opts...)
+			if err != nil {
+				t.Fatalf("Expected to connect, got %v", err)
+			}
+			defer nc.Close()
+
+			select {
+			case n := <-ch:
+				if n != len(urls) {
+					t.Fatalf("Expected %d discovered servers, got %d", len(urls), n)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("should have been notified of discovered servers")
+			}
+			if !nc.IsConnected() {
+				t.Fatalf("Expected to be connected, got %v", nc.Status())
+			}
+			if nc.ConnectedServerName() != name {
+				t.Fatalf("Unexpected server name of length %d", len(nc.ConnectedServerName()))
+			}
+			nc.Close()
+		})
+	}
+	wg.Wait()
+
+	if _, err := Connect(url, ReaderBufSize(0)); err == nil {
+		t.Fatal("Expected error for invalid reader buffer size")
+	}
+}
+
 func BenchmarkHeaderDecode(b *testing.B) {
 	benchmarks := []struct {
 		name   string
@@ -1780,3 +2122,30 @@ func BenchmarkHeaderDecode(b *testing.B) {
 		})
 	}
 }
+
+func TestIPResolutionOrderHosts(t *testing.T) {
+	hosts := []string{"[::1]:4222", "127.0.0.1:4222", "[fe80::1]:4222", "10.0.0.1:4222"}
+	for _, test := range []struct {
+		order    IPResolutionOrder
+		expected []string
+	}{
+		{IPResolutionAny, hosts},
+		{IPResolutionIP4, []string{"127.0.0.1:4222", "10.0.0.1:4222"}},
+		{IPResolutionIP6, []string{"[::1]:4222", "[fe80::1]:4222"}},
+		{IPResolutionIP4ThenIP6, []string{"127.0.0.1:4222", "10.0.0.1:4222", "[::1]:4222", "[fe80::1]:4222"}},
+		{IPResolutionIP6ThenIP4, []string{"[::1]:4222", "[fe80::1]:4222", "127.0.0.1:4222", "10.0.0.1:4222"}},
+	} {
+		if got := test.order.order(append([]string(nil), hosts...)); !reflect.DeepEqual(got, test.expected) {
+			t.Fatalf("Invalid order for %q; want: %v; got: %v", test.order, test.expected, got)
+		}
+		if !test.order.valid() {
+			t.Fatalf("Expected %q to be valid", test.order)
+		}
+	}
+	if got := IPResolutionIP4.order([]string{"localhost:4222"}); !reflect.DeepEqual(got, []string{"localhost:4222"}) {
+		t.Fatalf("Expected host names to be kept, got: %v", got)
+	}
+	if IPResolutionOrder("ip5").valid() {
+		t.Fatal("Expected invalid order")
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"errors"
+	"sync"
+)
+
+// OutboundFullPolicy determines the behavior of publish calls
+// when the outbound queue is full.
+type OutboundFullPolicy int
+
+const (
+	// OutboundFullError makes publish calls return ErrOutboundFull
+	// when the outbound queue is full.
+	OutboundFullError OutboundFullPolicy = iota
+
+	// OutboundFullBlock makes publish calls block until there is room
+	// in the outbound queue, or the connection is closed.
+	OutboundFullBlock
+)
+
+// outboundQueue is an ordered queue of messages published on the
+// connection. Messages are written to the connection by a single
+// sender go routine, which retries messages that cannot be buffered
+// while reconnecting once the connection is reestablished.
+// It has its own lock so that producers blocked on a full queue do
+// not hold the connection lock.
+type outboundQueue struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	msgs   []outboundMsg
+	head   int
+	n      int
+	block  bool
+	closed bool
+	// empty is closed once all queued messages have been written.
+	empty chan struct{}
+	// reconnected wakes up the sender waiting for a reconnect.
+	reconnected chan struct{}
+	done        chan struct{}
+}
+
+type outboundMsg struct {
+	subj  string
+	reply string
+	hdr   []byte
+	data  []byte
+}
+
+func newOutboundQueue(size int, policy OutboundFullPolicy) *outboundQueue {
+	q := &outboundQueue{
+		msgs:        make([]outboundMsg, size),
+		block:       policy == OutboundFullBlock,
+		reconnected: make(chan struct{}, 1),
+		done:        make(chan struct{}),
+	}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// push adds a copy of the message to the queue, blocking or
+// returning ErrOutboundFull if the queue is full.
+func (q *outboundQueue) push(subj, reply string, hdr, data []byte) error {
+	m := outboundMsg{subj: subj, reply: reply}
+	if hdr != nil {
+		m.hdr = append([]byte{}, hdr...)
+	}
+	m.data = append([]byte{}, data...)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for !q.closed && q.n == len(q.msgs) {
+		if !q.block {
+			return ErrOutboundFull
+		}
+		q.cond.Wait()
+	}
+	if q.closed {
+		return ErrConnectionClosed
+	}
+	q.msgs[(q.head+q.n)%len(q.msgs)] = m
+	q.n++
+	q.cond.Broadcast()
+	return nil
+}
+
+// next waits for the message at the head of the queue,
+// returning false if the queue is closed.
+func (q *outboundQueue) next() (outboundMsg, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for !q.closed && q.n == 0 {
+		q.cond.Wait()
+	}
+	if q.closed {
+		return outboundMsg{}, false
+	}
+	return q.msgs[q.head], true
+}
+
+// pop removes the message at the head of the queue
+// once it has been written to the connection.
+func (q *outboundQueue) pop() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.msgs[q.head] = outboundMsg{}
+	q.head = (q.head + 1) % len(q.msgs)
+	q.n--
+	if q.n == 0 && q.empty != nil {
+		close(q.empty)
+		q.empty = nil
+	}
+	q.cond.Broadcast()
+}
+
+// len returns the number of messages not yet written to the connection.
+func (q *outboundQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.n
+}
+
+// emptied returns a channel which is closed once all queued messages
+// have been written to the connection, or the queue is closed.
+func (q *outboundQueue) emptied() <-chan struct{} {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.n == 0 || q.closed {
+		ch := make(chan struct{})
+		close(ch)
+		return ch
+	}
+	if q.empty == nil {
+		q.empty = make(chan struct{})
+	}
+	return q.empty
+}
+
+// reconnect wakes up the sender if it is waiting for the connection
+// to be reestablished.
+func (q *outboundQueue) reconnect() {
+	select {
+	case q.reconnected <- struct{}{}:
+	default:
+	}
+}
+
+// close discards the queued messages and unblocks producers.
+func (q *outboundQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return
+	}
+	q.closed = true
+	if q.empty != nil {
+		close(q.empty)
+		q.empty = nil
+	}
+	close(q.done)
+	q.cond.Broadcast()
+}
+
+// sendOutbound writes queued messages to the connection in order until
+// the queue is closed. A message which cannot be buffered while
+// reconnecting is retried once the connection is reestablished.
+func (nc *Conn) sendOutbound(q *outboundQueue) {
+	for {
+		m, ok := q.next()
+		if !ok {
+			return
+		}
+		err := nc.writePublish(m.subj, m.reply, m.hdr, m.data)
+		switch {
+		case errors.Is(err, ErrReconnectBufExceeded):
+			select {
+			case <-q.reconnected:
+			case <-q.done:
+				return
+			}
+			continue
+		case errors.Is(err, ErrConnectionClosed):
+			return
+		case err != nil:
+			// The message can not be sent, report and drop it.
+			nc.mu.Lock()
+			if errCB := nc.Opts.AsyncErrorCB; errCB != nil {
+				nc.ach.push(func() { errCB(nc, nil, err) })
+			}
+			nc.mu.Unlock()
+		}
+		q.pop()
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrQuorumNotReached is returned by RequestQuorum if fewer responses than
+// required were received before the timeout.
+var ErrQuorumNotReached = errors.New("nats: quorum not reached")
+
+// RequestQuorum sends a request and gathers the responses of all the
+// responders until k of them are received or the timeout elapses. It
+// returns as soon as k responses are received. Since a queue group delivers
+// the request to a single member only, responders are expected to be
+// subscribed without a queue group.
+//
+// If fewer than k responses are received before the timeout, the responses
+// received are returned along with ErrQuorumNotReached. ErrNoResponders is
+// returned if no responder is subscribed to the subject.
+func (nc *Conn) RequestQuorum(subj string, data []byte, k int, timeout time.Duration) ([]*Msg, error) {
+	if nc == nil {
+		return nil, ErrInvalidConnection
+	}
+	if k < 1 {
+		return nil, ErrInvalidArg
+	}
+	if timeout <= 0 {
+		return nil, ErrBadTimeout
+	}
+
+	inbox := nc.NewInbox()
+	s, err := nc.subscribe(inbox, _EMPTY_, nil, make(chan *Msg, max(k, RequestChanLen)), nil, true, nil)
+	if err != nil {
+		return nil, err
+	}
+	s.AutoUnsubscribe(k)
+	defer s.Unsubscribe()
+	if err := nc.publish(subj, inbox, nil, data); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	msgs := make([]*Msg, 0, k)
+	for len(msgs) < k {
+		m, err := s.NextMsgWithContext(ctx)
+		if errors.Is(err, context.DeadlineExceeded) {
+			break
+		}
+		if err != nil {
+			return msgs, err
+		}
+		if len(m.Data) == 0 && m.Header.Get(statusHdr) == noResponders {
+			return nil, ErrNoResponders
+		}
+		msgs = append(msgs, m)
+	}
+	if len(msgs) < k {
+		return msgs, fmt.Errorf("%w: received %d of %d responses", ErrQuorumNotReached, len(msgs), k)
+	}
+	return msgs, nil
+}
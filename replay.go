@@ -0,0 +1,195 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"container/list"
+	"errors"
+)
+
+// ErrReplayBufferNotEnabled is returned by SubscribeWithReplay when the
+// connection was not created with the ReplayBuffer option.
+var ErrReplayBufferNotEnabled = errors.New("nats: replay buffer not enabled")
+
+// replayBuffer keeps the last messages published on this connection,
+// per subject. It is protected by the connection lock.
+type replayBuffer struct {
+	msgsPerSubject int
+	maxSubjects    int
+	subjects       map[string]*list.Element
+	// lru orders subjects from the most to the least recently published.
+	lru *list.List
+}
+
+type replaySubject struct {
+	subject string
+	ring    []*Msg
+	next    int
+	full    bool
+}
+
+func newReplayBuffer(msgsPerSubject, maxSubjects int) *replayBuffer {
+	return &replayBuffer{
+		msgsPerSubject: msgsPerSubject,
+		maxSubjects:    maxSubjects,
+		subjects:       make(map[string]*list.Element),
+		lru:            list.New(),
+	}
+}
+
+// record stores a copy of a published message, evicting the least recently
+// published subject if the subject limit is reached.
+func (rb *replayBuffer) record(subj, reply string, hdr, data []byte) {
+	var rs *replaySubject
+	if e, ok := rb.subjects[subj]; ok {
+		rb.lru.MoveToFront(e)
+		rs = e.Value.(*replaySubject)
+	} else {
+		if rb.lru.Len() >= rb.maxSubjects {
+			oldest := rb.lru.Back()
+			rb.lru.Remove(oldest)
+			delete(rb.subjects, oldest.Value.(*replaySubject).subject)
+		}
+		rs = &replaySubject{subject: subj, ring: make([]*Msg, rb.msgsPerSubject)}
+		rb.subjects[subj] = rb.lru.PushFront(rs)
+	}
+
+	m := &Msg{Subject: subj, Reply: reply}
+	if len(data) > 0 {
+		m.Data = append([]byte(nil), data...)
+	}
+	if len(hdr) > 0 {
+		// Headers were encoded by this client, so decoding can only
+		// fail for malformed input which was never sent.
+		if h, err := DecodeHeadersMsg(hdr); err == nil {
+			m.Header = h
+		}
+	}
+	rs.ring[rs.next] = m
+	rs.next = (rs.next + 1) % len(rs.ring)
+	if rs.next == 0 {
+		rs.full = true
+	}
+}
+
+// messages returns the buffered messages of a single subject, oldest first.
+func (rs *replaySubject) messages() []*Msg {
+	if !rs.full {
+		return rs.ring[:rs.next]
+	}
+	msgs := make([]*Msg, 0, len(rs.ring))
+	msgs = append(msgs, rs.ring[rs.next:]...)
+	return append(msgs, rs.ring[:rs.next]...)
+}
+
+// lookup returns copies of up to the last n buffered messages matching the
+// subject, which may contain wildcards. For wildcard subjects, messages are
+// grouped per subject, starting with the least recently published one.
+func (rb *replayBuffer) lookup(subj string, n int) []*Msg {
+	var matched []*Msg
+	for e := rb.lru.Back(); e != nil; e = e.Prev() {
+		rs := e.Value.(*replaySubject)
+		if !subjectIsSubsetMatch(rs.subject, subj) {
+			continue
+		}
+		msgs := rs.messages()
+		if len(msgs) > n {
+			msgs = msgs[len(msgs)-n:]
+		}
+		matched = append(matched, msgs...)
+	}
+	if len(matched) > n {
+		matched = matched[len(matched)-n:]
+	}
+	replayed := make([]*Msg, 0, len(matched))
+	for _, m := range matched {
+		replayed = append(replayed, &Msg{
+			Subject: m.Subject,
+			Reply:   m.Reply,
+			Header:  copyHeader(m.Header),
+			Data:    append([]byte(nil), m.Data...),
+		})
+	}
+	return replayed
+}
+
+func copyHeader(h Header) Header {
+	if h == nil {
+		return nil
+	}
+	c := make(Header, len(h))
+	for k, v := range h {
+		c[k] = append([]string(nil), v...)
+	}
+	return c
+}
+
+// SubscribeWithReplay will express interest in the given subject, like
+// Subscribe, but first delivers to the handler up to n of the most recent
+// messages this connection published on matching subjects.
+//
+// Replay is purely client-side: only messages published through this
+// connection are buffered, never messages published by other clients, and
+// only while the connection was created with the ReplayBuffer option.
+// Replayed messages are delivered before any message received from the
+// server for the new subscription.
+func (nc *Conn) SubscribeWithReplay(subj string, n int, cb MsgHandler) (*Subscription, error) {
+	if nc == nil {
+		return nil, ErrInvalidConnection
+	}
+	if n < 0 {
+		return nil, errors.New("nats: replay count must not be negative")
+	}
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	if nc.replay == nil {
+		return nil, ErrReplayBufferNotEnabled
+	}
+	// Holding the connection lock for both the lookup and the subscription
+	// ensures no message published in between is missed or delivered twice.
+	sub, err := nc.subscribeLocked(subj, _EMPTY_, cb, nil, nil, false, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return sub, nil
+	}
+	msgs := nc.replay.lookup(subj, n)
+	if len(msgs) == 0 {
+		return sub, nil
+	}
+
+	sub.mu.Lock()
+	for _, m := range msgs {
+		m.Sub = sub
+		sub.pMsgs++
+		sub.pBytes += len(m.Data)
+		if sub.pTail == nil {
+			sub.pHead = m
+		} else {
+			sub.pTail.next = m
+		}
+		sub.pTail = m
+	}
+	if sub.pMsgs > sub.pMsgsMax {
+		sub.pMsgsMax = sub.pMsgs
+	}
+	if sub.pBytes > sub.pBytesMax {
+		sub.pBytesMax = sub.pBytes
+	}
+	sub.pCond.Signal()
+	sub.schedule()
+	sub.mu.Unlock()
+	return sub, nil
+}
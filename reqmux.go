@@ -0,0 +1,155 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"errors"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrRequestMuxClosed is returned by RequestMux.Request once the mux
+// has been closed.
+var ErrRequestMuxClosed = errors.New("nats: request mux closed")
+
+// RequestMux sends requests whose responses are all received on a single
+// wildcard inbox subscription, and correlated using the last token of the
+// reply subject. Compared to creating a subscription per request, this
+// lowers the cost of each request at the expense of keeping the mux
+// subscription open, and of delivering all responses through a single
+// handler, in order.
+//
+// A RequestMux is safe to use in multiple Go routines concurrently.
+type RequestMux struct {
+	nc     *Conn
+	sub    *Subscription
+	prefix string
+
+	mu     sync.Mutex
+	resps  map[string]chan *Msg
+	rand   *rand.Rand
+	closed chan struct{}
+}
+
+// NewRequestMux creates a RequestMux with its own inbox subscription,
+// independent of the one used by Conn.Request. Close should be called
+// to remove the subscription once the mux is no longer needed.
+func (nc *Conn) NewRequestMux() (*RequestMux, error) {
+	if nc == nil {
+		return nil, ErrInvalidConnection
+	}
+	rm := &RequestMux{
+		nc:     nc,
+		prefix: nc.NewInbox() + ".",
+		resps:  make(map[string]chan *Msg),
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+		closed: make(chan struct{}),
+	}
+	sub, err := nc.Subscribe(rm.prefix+"*", rm.handleResponse)
+	if err != nil {
+		return nil, err
+	}
+	rm.sub = sub
+	return rm, nil
+}
+
+func (rm *RequestMux) handleResponse(m *Msg) {
+	token, ok := strings.CutPrefix(m.Subject, rm.prefix)
+	if !ok {
+		return
+	}
+	rm.mu.Lock()
+	mch := rm.resps[token]
+	// Delete the key regardless, one response only.
+	delete(rm.resps, token)
+	rm.mu.Unlock()
+
+	select {
+	case mch <- m:
+	default:
+	}
+}
+
+// newToken returns a new response token.
+// Lock should be held.
+func (rm *RequestMux) newToken() string {
+	var b [replySuffixLen]byte
+	rn := rm.rand.Int63()
+	for i := range b {
+		b[i] = rdigits[rn%base]
+		rn /= base
+	}
+	return string(b[:])
+}
+
+// Request will send a request payload and deliver the response message,
+// or an error, including a timeout if no message was received properly.
+func (rm *RequestMux) Request(subj string, data []byte, timeout time.Duration) (*Msg, error) {
+	mch := make(chan *Msg, RequestChanLen)
+	rm.mu.Lock()
+	select {
+	case <-rm.closed:
+		rm.mu.Unlock()
+		return nil, ErrRequestMuxClosed
+	default:
+	}
+	token := rm.newToken()
+	rm.resps[token] = mch
+	rm.mu.Unlock()
+
+	remove := func() {
+		rm.mu.Lock()
+		delete(rm.resps, token)
+		rm.mu.Unlock()
+	}
+
+	if err := rm.nc.publish(subj, rm.prefix+token, nil, data); err != nil {
+		remove()
+		return nil, err
+	}
+
+	t := globalTimerPool.Get(timeout)
+	defer globalTimerPool.Put(t)
+
+	select {
+	case m := <-mch:
+		if len(m.Data) == 0 && m.Header.Get(statusHdr) == noResponders {
+			return nil, ErrNoResponders
+		}
+		return m, nil
+	case <-t.C:
+		remove()
+		return nil, ErrTimeout
+	case <-rm.closed:
+		return nil, ErrRequestMuxClosed
+	}
+}
+
+// Close removes the mux subscription. Requests in flight return
+// ErrRequestMuxClosed.
+func (rm *RequestMux) Close() error {
+	rm.mu.Lock()
+	select {
+	case <-rm.closed:
+		rm.mu.Unlock()
+		return nil
+	default:
+	}
+	close(rm.closed)
+	rm.resps = make(map[string]chan *Msg)
+	rm.mu.Unlock()
+	return rm.sub.Unsubscribe()
+}
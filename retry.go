@@ -0,0 +1,152 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	// DefaultRequestRetryAttempts is the default maximum number of
+	// attempts made by RequestRetry.
+	DefaultRequestRetryAttempts = 3
+)
+
+type (
+	// RetryOpt configures RequestRetry.
+	RetryOpt func(*retryOpts) error
+
+	// RetryBackoff returns the time to wait before the given retry
+	// attempt. Attempts are numbered from 1, so the first retry (second
+	// request) is attempt 1.
+	RetryBackoff func(attempt int) time.Duration
+
+	retryOpts struct {
+		ctx      context.Context
+		attempts int
+		timeout  time.Duration
+		backoff  RetryBackoff
+	}
+)
+
+// RetryMaxAttempts sets the maximum number of requests sent by RequestRetry,
+// including the first one. Defaults to DefaultRequestRetryAttempts.
+func RetryMaxAttempts(attempts int) RetryOpt {
+	return func(opts *retryOpts) error {
+		if attempts < 1 {
+			return errors.New("nats: retry attempts must be at least 1")
+		}
+		opts.attempts = attempts
+		return nil
+	}
+}
+
+// RetryAttemptTimeout sets the timeout of a single request attempt.
+// Defaults to the connection's Timeout option.
+func RetryAttemptTimeout(timeout time.Duration) RetryOpt {
+	return func(opts *retryOpts) error {
+		if timeout <= 0 {
+			return ErrBadTimeout
+		}
+		opts.timeout = timeout
+		return nil
+	}
+}
+
+// RetryBackoffFunc sets the function used to compute the wait time
+// between attempts. By default, attempts are retried immediately.
+func RetryBackoffFunc(backoff RetryBackoff) RetryOpt {
+	return func(opts *retryOpts) error {
+		if backoff == nil {
+			return errors.New("nats: retry backoff function cannot be nil")
+		}
+		opts.backoff = backoff
+		return nil
+	}
+}
+
+// RetryContext sets a context bounding all attempts. RequestRetry returns
+// the context's error as soon as it is done, even while waiting between
+// attempts.
+func RetryContext(ctx context.Context) RetryOpt {
+	return func(opts *retryOpts) error {
+		if ctx == nil {
+			return ErrInvalidContext
+		}
+		opts.ctx = ctx
+		return nil
+	}
+}
+
+// RequestRetry sends a request and waits for a response, retrying the
+// request if it times out or if there are no responders. Any other error,
+// as well as any response (including application level error replies),
+// is returned to the caller right away. If all attempts fail, the error
+// of the last attempt is returned.
+func (nc *Conn) RequestRetry(subj string, data []byte, opts ...RetryOpt) (*Msg, error) {
+	if nc == nil {
+		return nil, ErrInvalidConnection
+	}
+	o := retryOpts{
+		ctx:      context.Background(),
+		attempts: DefaultRequestRetryAttempts,
+		backoff:  func(int) time.Duration { return 0 },
+	}
+	nc.mu.RLock()
+	o.timeout = nc.Opts.Timeout
+	nc.mu.RUnlock()
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+	for attempt := 0; attempt < o.attempts; attempt++ {
+		if attempt > 0 {
+			if wait := o.backoff(attempt); wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-timer.C:
+				case <-o.ctx.Done():
+					timer.Stop()
+					return nil, o.ctx.Err()
+				}
+			}
+		}
+		var m *Msg
+		m, err = nc.requestAttempt(o.ctx, subj, data, o.timeout)
+		if err == nil {
+			return m, nil
+		}
+		if !errors.Is(err, ErrTimeout) && !errors.Is(err, ErrNoResponders) {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+// requestAttempt sends a single request bounded by both ctx and timeout.
+// Expiration of the timeout is reported as ErrTimeout.
+func (nc *Conn) requestAttempt(ctx context.Context, subj string, data []byte, timeout time.Duration) (*Msg, error) {
+	actx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	m, err := nc.RequestWithContext(actx, subj, data)
+	if err != nil && ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+		err = ErrTimeout
+	}
+	return m, err
+}
@@ -0,0 +1,125 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"context"
+	"time"
+)
+
+// StreamEndHeader is the header marking the last message of a streamed
+// response. Its value is ignored.
+const StreamEndHeader = "Nats-Stream-End"
+
+type (
+	// StreamReqOpt configures RequestStream.
+	StreamReqOpt func(*streamReqOpts) error
+
+	streamReqOpts struct {
+		ctx  context.Context
+		idle time.Duration
+	}
+)
+
+// StreamIdleTimeout sets the maximum time RequestStream waits for the next
+// response message, or for the caller to receive the previous one, before
+// ending the stream. Defaults to the connection's Timeout option.
+func StreamIdleTimeout(timeout time.Duration) StreamReqOpt {
+	return func(opts *streamReqOpts) error {
+		if timeout <= 0 {
+			return ErrBadTimeout
+		}
+		opts.idle = timeout
+		return nil
+	}
+}
+
+// StreamContext sets a context bounding the whole stream. The stream is
+// ended as soon as the context is done.
+func StreamContext(ctx context.Context) StreamReqOpt {
+	return func(opts *streamReqOpts) error {
+		if ctx == nil {
+			return ErrInvalidContext
+		}
+		opts.ctx = ctx
+		return nil
+	}
+}
+
+// RequestStream sends a request and returns a channel delivering all the
+// response messages, in order, until a message with the StreamEndHeader
+// header is received. The end message is delivered only if it has a
+// payload. The channel is also closed once no message was received, or
+// the caller did not receive from the channel, for the idle timeout, as
+// well as when there are no responders, the context set with
+// StreamContext is done or the connection is closed.
+// The reply subscription is removed once the channel is closed.
+func (nc *Conn) RequestStream(subj string, data []byte, opts ...StreamReqOpt) (<-chan *Msg, error) {
+	if nc == nil {
+		return nil, ErrInvalidConnection
+	}
+	o := streamReqOpts{ctx: context.Background()}
+	nc.mu.RLock()
+	o.idle = nc.Opts.Timeout
+	nc.mu.RUnlock()
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return nil, err
+		}
+	}
+
+	inbox := nc.NewInbox()
+	s, err := nc.subscribe(inbox, _EMPTY_, nil, make(chan *Msg, RequestChanLen), nil, true, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := nc.publish(subj, inbox, nil, data); err != nil {
+		s.Unsubscribe()
+		return nil, err
+	}
+
+	out := make(chan *Msg)
+	go func() {
+		defer close(out)
+		defer s.Unsubscribe()
+		for nc.nextStreamMsg(o, s, out) {
+		}
+	}()
+	return out, nil
+}
+
+// nextStreamMsg waits for the next message of a streamed response and
+// passes it to out, returning false once the stream has ended.
+func (nc *Conn) nextStreamMsg(o streamReqOpts, s *Subscription, out chan<- *Msg) bool {
+	ctx, cancel := context.WithTimeout(o.ctx, o.idle)
+	defer cancel()
+
+	m, err := s.NextMsgWithContext(ctx)
+	if err != nil {
+		return false
+	}
+	if len(m.Data) == 0 && m.Header.Get(statusHdr) == noResponders {
+		return false
+	}
+	_, end := m.Header[StreamEndHeader]
+	if end && len(m.Data) == 0 {
+		return false
+	}
+	select {
+	case out <- m:
+	case <-ctx.Done():
+		return false
+	}
+	return !end
+}
@@ -368,6 +368,92 @@ func TestPermViolation(t *testing.T) {
 	}
 }
 
+func TestPermViolationTypedError(t *testing.T) {
+	opts := test.DefaultTestOptions
+	opts.Port = -1
+	opts.Users = []*server.User{
+		{
+			Username: "ivan",
+			Password: "pwd",
+			Permissions: &server.Permissions{
+				Publish:   &server.SubjectPermission{Allow: []string{"Foo"}},
+				Subscribe: &server.SubjectPermission{Allow: []string{"Foo"}},
+			},
+		},
+	}
+	s := RunServerWithOptions(&opts)
+	defer s.Shutdown()
+
+	type asyncErr struct {
+		sub *nats.Subscription
+		err error
+	}
+	errCh := make(chan asyncErr, 2)
+	nc, err := nats.Connect(s.ClientURL(), nats.UserInfo("ivan", "pwd"),
+		nats.ErrorHandler(func(_ *nats.Conn, sub *nats.Subscription, err error) {
+			errCh <- asyncErr{sub, err}
+		}))
+	if err != nil {
+		t.Fatalf("Error on connect: %v", err)
+	}
+	defer nc.Close()
+
+	forbidden, err := nc.QueueSubscribe("Bar", "q", func(_ *nats.Msg) {})
+	if err != nil {
+		t.Fatalf("Error on subscribe: %v", err)
+	}
+	var e asyncErr
+	select {
+	case e = <-errCh:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Did not get the permission error")
+	}
+	var pErr *nats.PermissionViolationError
+	if !errors.As(e.err, &pErr) {
+		t.Fatalf("Expected permission violation error, got %v", e.err)
+	}
+	if !errors.Is(e.err, nats.ErrPermissionViolation) {
+		t.Fatalf("Expected error to match %v", nats.ErrPermissionViolation)
+	}
+	if !pErr.Subscribe || pErr.Subject != "Bar" || pErr.Queue != "q" {
+		t.Fatalf("Unexpected permission violation details: %+v", pErr)
+	}
+	if e.sub != forbidden {
+		t.Fatalf("Expected the forbidden subscription to be passed to the error handler")
+	}
+
+	nc.Publish("Bar", []byte("fail"))
+	select {
+	case e = <-errCh:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Did not get the permission error")
+	}
+	if !errors.As(e.err, &pErr) {
+		t.Fatalf("Expected permission violation error, got %v", e.err)
+	}
+	if pErr.Subscribe || pErr.Subject != "Bar" {
+		t.Fatalf("Unexpected permission violation details: %+v", pErr)
+	}
+	if e.sub != nil {
+		t.Fatalf("Expected no subscription for a publish violation")
+	}
+
+	// The connection survives and allowed subjects can still be used.
+	if nc.IsClosed() {
+		t.Fatal("Connection should be not be closed")
+	}
+	sub, err := nc.SubscribeSync("Foo")
+	if err != nil {
+		t.Fatalf("Error on subscribe: %v", err)
+	}
+	if err := nc.Publish("Foo", []byte("ok")); err != nil {
+		t.Fatalf("Error on publish: %v", err)
+	}
+	if _, err := sub.NextMsg(time.Second); err != nil {
+		t.Fatalf("Error getting message: %v", err)
+	}
+}
+
 func TestConnectMissingCreds(t *testing.T) {
 	s := RunServerOnPort(-1)
 	defer s.Shutdown()
@@ -16,10 +16,13 @@ package test
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"math"
+	"reflect"
 	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -255,6 +258,79 @@ func TestPublishDoesNotFailOnSlowConsumer(t *testing.T) {
 	}
 }
 
+func TestSetErrorHandlerWhileCallbacksFire(t *testing.T) {
+	s := RunDefaultServer()
+	defer s.Shutdown()
+	nc := NewDefaultConnection(t)
+	defer nc.Close()
+
+	sub, err := nc.SubscribeSync("foo")
+	if err != nil {
+		t.Fatalf("Unable to create subscription: %v", err)
+	}
+	if err := sub.SetPendingLimits(1, 1000); err != nil {
+		t.Fatalf("Unable to set pending limits: %v", err)
+	}
+
+	// Keep swapping the handler while slow consumer errors are dispatched.
+	done := make(chan struct{})
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			nc.SetErrorHandler(func(_ *nats.Conn, _ *nats.Subscription, _ error) {})
+			nc.SetClosedHandler(func(_ *nats.Conn) {})
+			nc.SetDisconnectHandler(func(_ *nats.Conn) {})
+			nc.SetReconnectHandler(func(_ *nats.Conn) {})
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		if err := nc.Publish("foo", []byte("hello")); err != nil {
+			t.Fatalf("Error on publish: %v", err)
+		}
+	}
+	if err := nc.Flush(); err != nil {
+		t.Fatalf("Error on flush: %v", err)
+	}
+	close(done)
+	wg.Wait()
+
+	// Consume the pending message so that the subscription is
+	// no longer flagged as a slow consumer.
+	for {
+		if _, err := sub.NextMsg(100 * time.Millisecond); err != nil {
+			break
+		}
+	}
+
+	// Once swapped, only the new handler should be invoked.
+	errCh := make(chan error, 1)
+	nc.SetErrorHandler(func(_ *nats.Conn, _ *nats.Subscription, err error) {
+		select {
+		case errCh <- err:
+		default:
+		}
+	})
+	for i := 0; i < 10; i++ {
+		nc.Publish("foo", []byte("hello"))
+	}
+	nc.Flush()
+	select {
+	case err := <-errCh:
+		if err != nats.ErrSlowConsumer {
+			t.Fatalf("Expected %v, got %v", nats.ErrSlowConsumer, err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Did not get the async error on the new handler")
+	}
+}
+
 func TestAsyncSubscribe(t *testing.T) {
 	s := RunDefaultServer()
 	defer s.Shutdown()
@@ -357,6 +433,152 @@ func TestAsyncSubscribeRoutineLeakOnClose(t *testing.T) {
 	checkNoGoroutineLeak(t, base, "Close()")
 }
 
+func TestSharedDispatcher(t *testing.T) {
+	s := RunDefaultServer()
+	defer s.Shutdown()
+
+	base := getStableNumGoroutine(t)
+
+	nc, err := nats.Connect(nats.DefaultURL, nats.SharedDispatcher(4))
+	if err != nil {
+		t.Fatalf("Error on connect: %v", err)
+	}
+	defer nc.Close()
+
+	const numSubs = 1000
+	const numMsgs = 10
+	var wg sync.WaitGroup
+	wg.Add(numSubs * numMsgs)
+	errCh := make(chan error, numSubs)
+	for i := 0; i < numSubs; i++ {
+		var expected int
+		if _, err := nc.Subscribe(fmt.Sprintf("foo.%d", i), func(m *nats.Msg) {
+			defer wg.Done()
+			// Messages of a single subscription are delivered in order.
+			if seq, _ := strconv.Atoi(string(m.Data)); seq != expected {
+				errCh <- fmt.Errorf("unexpected message on %q: want %d, got %d", m.Subject, expected, seq)
+			}
+			expected++
+		}); err != nil {
+			t.Fatalf("Error on subscribe: %v", err)
+		}
+	}
+
+	// Connection goroutines and workers, but not one per subscription.
+	if delta := runtime.NumGoroutine() - base; delta > 50 {
+		t.Fatalf("Expected shared dispatcher to limit goroutines, got %d new goroutines", delta)
+	}
+
+	for j := 0; j < numMsgs; j++ {
+		for i := 0; i < numSubs; i++ {
+			nc.Publish(fmt.Sprintf("foo.%d", i), []byte(strconv.Itoa(j)))
+		}
+	}
+	nc.Flush()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Did not receive all messages")
+	}
+	select {
+	case err := <-errCh:
+		t.Fatal(err)
+	default:
+	}
+
+	nc.Close()
+	checkNoGoroutineLeak(t, base, "Close()")
+}
+
+func TestMaxAsyncCallbacks(t *testing.T) {
+	s := RunDefaultServer()
+	defer s.Shutdown()
+
+	if _, err := nats.Connect(nats.DefaultURL, nats.MaxAsyncCallbacks(0)); err == nil {
+		t.Fatal("Expected error for invalid max async callbacks")
+	}
+
+	const maxCallbacks = 3
+	nc, err := nats.Connect(nats.DefaultURL, nats.MaxAsyncCallbacks(maxCallbacks))
+	if err != nil {
+		t.Fatalf("Error on connect: %v", err)
+	}
+	defer nc.Close()
+
+	// The responder uses its own connection, as handlers waiting for
+	// messages of other subscriptions on the same connection could
+	// block each other once the limit is reached.
+	nc2 := NewDefaultConnection(t)
+	defer nc2.Close()
+	responder, err := nc2.Subscribe("req", func(m *nats.Msg) {
+		m.Respond([]byte("ok"))
+	})
+	if err != nil {
+		t.Fatalf("Error on subscribe: %v", err)
+	}
+	defer responder.Unsubscribe()
+	nc2.Flush()
+
+	const numSubs = 20
+	const numMsgs = 10
+	var running, maxRunning atomic.Int32
+	var wg sync.WaitGroup
+	wg.Add(numSubs * numMsgs)
+	errCh := make(chan error, numSubs*numMsgs)
+	for i := 0; i < numSubs; i++ {
+		if _, err := nc.Subscribe(fmt.Sprintf("foo.%d", i), func(m *nats.Msg) {
+			defer wg.Done()
+			n := running.Add(1)
+			defer running.Add(-1)
+			for {
+				cur := maxRunning.Load()
+				if n <= cur || maxRunning.CompareAndSwap(cur, n) {
+					break
+				}
+			}
+			// Responses to requests are delivered while the limit is reached.
+			if _, err := nc.Request("req", nil, time.Second); err != nil {
+				errCh <- err
+			}
+			time.Sleep(time.Millisecond)
+		}); err != nil {
+			t.Fatalf("Error on subscribe: %v", err)
+		}
+	}
+
+	for j := 0; j < numMsgs; j++ {
+		for i := 0; i < numSubs; i++ {
+			nc.Publish(fmt.Sprintf("foo.%d", i), nil)
+		}
+	}
+	nc.Flush()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Did not receive all messages")
+	}
+	select {
+	case err := <-errCh:
+		t.Fatalf("Error on request: %v", err)
+	default:
+	}
+	if n := maxRunning.Load(); n > maxCallbacks || n < 2 {
+		t.Fatalf("Expected up to %d concurrent callbacks, got %d", maxCallbacks, n)
+	}
+}
+
 func TestSyncSubscribe(t *testing.T) {
 	s := RunDefaultServer()
 	defer s.Shutdown()
@@ -453,6 +675,39 @@ func TestFlush(t *testing.T) {
 	}
 }
 
+func TestFlushOnPublish(t *testing.T) {
+	s := RunDefaultServer()
+	defer s.Shutdown()
+	nc, err := nats.Connect(nats.DefaultURL, nats.FlushOnPublish())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer nc.Close()
+
+	sub, err := nc.SubscribeSync("flush")
+	if err != nil {
+		t.Fatalf("Error on subscribe: %v", err)
+	}
+	if err := nc.Flush(); err != nil {
+		t.Fatalf("Received error from flush: %s\n", err)
+	}
+
+	omsg := []byte("Hello World")
+	for i := 0; i < 100; i++ {
+		if err := nc.Publish("flush", omsg); err != nil {
+			t.Fatalf("Error on publish: %v", err)
+		}
+		if nb, _ := nc.Buffered(); nb > 0 {
+			t.Fatalf("Outbound buffer not empty: %d bytes\n", nb)
+		}
+	}
+	for i := 0; i < 100; i++ {
+		if _, err := sub.NextMsg(time.Second); err != nil {
+			t.Fatalf("Error receiving message %d: %v", i, err)
+		}
+	}
+}
+
 func TestQueueSubscriber(t *testing.T) {
 	s := RunDefaultServer()
 	defer s.Shutdown()
@@ -712,6 +967,429 @@ func TestRequest(t *testing.T) {
 	}
 }
 
+func TestRequestWithReply(t *testing.T) {
+	s := RunDefaultServer()
+	defer s.Shutdown()
+	nc := NewDefaultConnection(t)
+	defer nc.Close()
+
+	response := []byte("I will help you")
+	nc.Subscribe("foo", func(m *nats.Msg) {
+		if m.Reply != "replies.app.1" {
+			t.Errorf("Expected reply subject %q, got %q", "replies.app.1", m.Reply)
+		}
+		nc.Publish(m.Reply, response)
+	})
+	msg, err := nc.RequestWithReply("foo", "replies.app.1", []byte("help"), 500*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Received an error on Request test: %s", err)
+	}
+	if !bytes.Equal(msg.Data, response) || msg.Subject != "replies.app.1" {
+		t.Fatalf("Received invalid response: %+v", msg)
+	}
+	if n := nc.NumSubscriptions(); n != 1 {
+		t.Fatalf("Expected reply subscription to be removed, got %d subscriptions", n)
+	}
+
+	for _, reply := range []string{"", "replies.*", "replies.>", "replies..1", "replies 1"} {
+		if _, err := nc.RequestWithReply("foo", reply, nil, 100*time.Millisecond); !errors.Is(err, nats.ErrBadSubject) {
+			t.Fatalf("Expected %v for reply %q, got %v", nats.ErrBadSubject, reply, err)
+		}
+	}
+
+	nc.Subscribe("slow", func(m *nats.Msg) {})
+	if _, err := nc.RequestWithReply("slow", "replies.app.2", nil, 100*time.Millisecond); !errors.Is(err, nats.ErrTimeout) {
+		t.Fatalf("Expected %v, got %v", nats.ErrTimeout, err)
+	}
+	if n := nc.NumSubscriptions(); n != 2 {
+		t.Fatalf("Expected reply subscription to be removed on timeout, got %d subscriptions", n)
+	}
+
+	if _, err := nc.RequestWithReply("none", "replies.app.3", nil, time.Second); !errors.Is(err, nats.ErrNoResponders) {
+		t.Fatalf("Expected %v, got %v", nats.ErrNoResponders, err)
+	}
+}
+
+func TestRequestMux(t *testing.T) {
+	s := RunDefaultServer()
+	defer s.Shutdown()
+	nc := NewDefaultConnection(t)
+	defer nc.Close()
+
+	nc.Subscribe("echo", func(m *nats.Msg) {
+		nc.Publish(m.Reply, m.Data)
+	})
+	nc.Subscribe("slow", func(m *nats.Msg) {})
+
+	mux, err := nc.NewRequestMux()
+	if err != nil {
+		t.Fatalf("Error creating request mux: %v", err)
+	}
+	if n := nc.NumSubscriptions(); n != 3 {
+		t.Fatalf("Expected 3 subscriptions, got %d", n)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 50)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			data := []byte(strconv.Itoa(i))
+			msg, err := mux.Request("echo", data, time.Second)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if !bytes.Equal(msg.Data, data) {
+				errs <- fmt.Errorf("expected response %q, got %q", data, msg.Data)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// All requests shared the mux subscription.
+	if n := nc.NumSubscriptions(); n != 3 {
+		t.Fatalf("Expected 3 subscriptions, got %d", n)
+	}
+
+	if _, err := mux.Request("slow", nil, 100*time.Millisecond); !errors.Is(err, nats.ErrTimeout) {
+		t.Fatalf("Expected %v, got %v", nats.ErrTimeout, err)
+	}
+	if _, err := mux.Request("none", nil, time.Second); !errors.Is(err, nats.ErrNoResponders) {
+		t.Fatalf("Expected %v, got %v", nats.ErrNoResponders, err)
+	}
+
+	// Requests in flight are released on close.
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := mux.Request("slow", nil, 5*time.Second)
+		errCh <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if err := mux.Close(); err != nil {
+		t.Fatalf("Error closing request mux: %v", err)
+	}
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, nats.ErrRequestMuxClosed) {
+			t.Fatalf("Expected %v, got %v", nats.ErrRequestMuxClosed, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Request was not released on close")
+	}
+	if n := nc.NumSubscriptions(); n != 2 {
+		t.Fatalf("Expected mux subscription to be removed, got %d subscriptions", n)
+	}
+	if _, err := mux.Request("echo", nil, time.Second); !errors.Is(err, nats.ErrRequestMuxClosed) {
+		t.Fatalf("Expected %v, got %v", nats.ErrRequestMuxClosed, err)
+	}
+}
+
+func TestRequestStream(t *testing.T) {
+	s := RunDefaultServer()
+	defer s.Shutdown()
+	nc := NewDefaultConnection(t)
+	defer nc.Close()
+
+	// Streaming endpoint, sending the number of chunks requested.
+	sub, err := nc.Subscribe("pages", func(m *nats.Msg) {
+		n, _ := strconv.Atoi(string(m.Data))
+		for i := 0; i < n; i++ {
+			nc.Publish(m.Reply, []byte(strconv.Itoa(i)))
+		}
+		end := nats.NewMsg(m.Reply)
+		end.Header.Set(nats.StreamEndHeader, "true")
+		nc.PublishMsg(end)
+	})
+	if err != nil {
+		t.Fatalf("Error on subscribe: %v", err)
+	}
+	defer sub.Unsubscribe()
+
+	t.Run("all chunks until end marker", func(t *testing.T) {
+		ch, err := nc.RequestStream("pages", []byte("5"), nats.StreamIdleTimeout(time.Second))
+		if err != nil {
+			t.Fatalf("Error on request: %v", err)
+		}
+		var i int
+		for m := range ch {
+			if string(m.Data) != strconv.Itoa(i) {
+				t.Fatalf("Expected chunk %d, got %q", i, m.Data)
+			}
+			i++
+		}
+		if i != 5 {
+			t.Fatalf("Expected 5 chunks, got %d", i)
+		}
+		checkFor(t, time.Second, 10*time.Millisecond, func() error {
+			if n := nc.NumSubscriptions(); n != 1 {
+				return fmt.Errorf("expected inbox subscription to be removed, got %d subscriptions", n)
+			}
+			return nil
+		})
+	})
+
+	t.Run("idle timeout", func(t *testing.T) {
+		slow, err := nc.Subscribe("slow", func(m *nats.Msg) {
+			m.Respond([]byte("first"))
+		})
+		if err != nil {
+			t.Fatalf("Error on subscribe: %v", err)
+		}
+		defer slow.Unsubscribe()
+
+		start := time.Now()
+		ch, err := nc.RequestStream("slow", nil, nats.StreamIdleTimeout(100*time.Millisecond))
+		if err != nil {
+			t.Fatalf("Error on request: %v", err)
+		}
+		var got int
+		for range ch {
+			got++
+		}
+		if got != 1 {
+			t.Fatalf("Expected 1 chunk, got %d", got)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Fatalf("Expected stream to end after idle timeout, took %v", elapsed)
+		}
+	})
+
+	t.Run("caller stops reading", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		ch, err := nc.RequestStream("pages", []byte("100"), nats.StreamContext(ctx))
+		if err != nil {
+			t.Fatalf("Error on request: %v", err)
+		}
+		<-ch
+		cancel()
+		checkFor(t, time.Second, 10*time.Millisecond, func() error {
+			if n := nc.NumSubscriptions(); n != 1 {
+				return fmt.Errorf("expected inbox subscription to be removed, got %d subscriptions", n)
+			}
+			return nil
+		})
+	})
+
+	t.Run("no responders", func(t *testing.T) {
+		ch, err := nc.RequestStream("none", nil)
+		if err != nil {
+			t.Fatalf("Error on request: %v", err)
+		}
+		if m, ok := <-ch; ok {
+			t.Fatalf("Expected channel to be closed, got %+v", m)
+		}
+	})
+
+	if _, err := nc.RequestStream("pages", nil, nats.StreamIdleTimeout(0)); !errors.Is(err, nats.ErrBadTimeout) {
+		t.Fatalf("Expected %v, got %v", nats.ErrBadTimeout, err)
+	}
+}
+
+func TestRequestRetry(t *testing.T) {
+	s := RunDefaultServer()
+	defer s.Shutdown()
+	nc := NewDefaultConnection(t)
+	defer nc.Close()
+
+	t.Run("success on retry", func(t *testing.T) {
+		var received atomic.Int32
+		sub, err := nc.Subscribe("retry.ok", func(m *nats.Msg) {
+			// Drop the first 2 requests.
+			if received.Add(1) < 3 {
+				return
+			}
+			m.Respond([]byte("ok"))
+		})
+		if err != nil {
+			t.Fatalf("Error on subscribe: %v", err)
+		}
+		defer sub.Unsubscribe()
+
+		var backoffs []int
+		msg, err := nc.RequestRetry("retry.ok", []byte("help"),
+			nats.RetryMaxAttempts(5),
+			nats.RetryAttemptTimeout(100*time.Millisecond),
+			nats.RetryBackoffFunc(func(attempt int) time.Duration {
+				backoffs = append(backoffs, attempt)
+				return 10 * time.Millisecond
+			}))
+		if err != nil {
+			t.Fatalf("Error on request: %v", err)
+		}
+		if string(msg.Data) != "ok" {
+			t.Fatalf("Unexpected response: %q", msg.Data)
+		}
+		if n := received.Load(); n != 3 {
+			t.Fatalf("Expected 3 requests, got %d", n)
+		}
+		if !reflect.DeepEqual(backoffs, []int{1, 2}) {
+			t.Fatalf("Unexpected backoff attempts: %v", backoffs)
+		}
+	})
+
+	t.Run("exhausted on timeout", func(t *testing.T) {
+		var received atomic.Int32
+		sub, err := nc.Subscribe("retry.timeout", func(m *nats.Msg) {
+			received.Add(1)
+		})
+		if err != nil {
+			t.Fatalf("Error on subscribe: %v", err)
+		}
+		defer sub.Unsubscribe()
+
+		_, err = nc.RequestRetry("retry.timeout", nil,
+			nats.RetryMaxAttempts(3),
+			nats.RetryAttemptTimeout(50*time.Millisecond))
+		if !errors.Is(err, nats.ErrTimeout) {
+			t.Fatalf("Expected %v, got %v", nats.ErrTimeout, err)
+		}
+		if n := received.Load(); n != 3 {
+			t.Fatalf("Expected 3 requests, got %d", n)
+		}
+	})
+
+	t.Run("exhausted on no responders", func(t *testing.T) {
+		_, err := nc.RequestRetry("retry.none", nil, nats.RetryMaxAttempts(2))
+		if !errors.Is(err, nats.ErrNoResponders) {
+			t.Fatalf("Expected %v, got %v", nats.ErrNoResponders, err)
+		}
+	})
+
+	t.Run("error reply is not retried", func(t *testing.T) {
+		var received atomic.Int32
+		sub, err := nc.Subscribe("retry.err", func(m *nats.Msg) {
+			received.Add(1)
+			m.Respond([]byte("-ERR something went wrong"))
+		})
+		if err != nil {
+			t.Fatalf("Error on subscribe: %v", err)
+		}
+		defer sub.Unsubscribe()
+
+		msg, err := nc.RequestRetry("retry.err", nil, nats.RetryMaxAttempts(3))
+		if err != nil {
+			t.Fatalf("Error on request: %v", err)
+		}
+		if string(msg.Data) != "-ERR something went wrong" {
+			t.Fatalf("Unexpected response: %q", msg.Data)
+		}
+		if n := received.Load(); n != 1 {
+			t.Fatalf("Expected 1 request, got %d", n)
+		}
+	})
+
+	t.Run("context canceled during backoff", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		_, err := nc.RequestRetry("retry.none", nil,
+			nats.RetryContext(ctx),
+			nats.RetryMaxAttempts(10),
+			nats.RetryBackoffFunc(func(int) time.Duration { return time.Second }))
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Expected %v, got %v", context.DeadlineExceeded, err)
+		}
+		if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+			t.Fatalf("Expected request to stop early, took %v", elapsed)
+		}
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		if _, err := nc.RequestRetry("foo", nil, nats.RetryMaxAttempts(0)); err == nil {
+			t.Fatal("Expected error for invalid attempts")
+		}
+		if _, err := nc.RequestRetry("foo", nil, nats.RetryAttemptTimeout(0)); !errors.Is(err, nats.ErrBadTimeout) {
+			t.Fatalf("Expected %v, got %v", nats.ErrBadTimeout, err)
+		}
+	})
+}
+
+func TestCancelInflightRequest(t *testing.T) {
+	s := RunDefaultServer()
+	defer s.Shutdown()
+
+	for _, test := range []struct {
+		name     string
+		oldStyle bool
+		withCtx  bool
+	}{
+		{"new style", false, false},
+		{"new style with context", false, true},
+		{"old style", true, false},
+		{"old style with context", true, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			opts := []nats.Option{}
+			if test.oldStyle {
+				opts = append(opts, nats.UseOldRequestStyle())
+			}
+			nc, err := nats.Connect(nats.DefaultURL, opts...)
+			if err != nil {
+				t.Fatalf("Error on connect: %v", err)
+			}
+			defer nc.Close()
+
+			// Responder which never replies.
+			if _, err := nc.SubscribeSync("slow"); err != nil {
+				t.Fatalf("Error on subscribe: %v", err)
+			}
+			nc.Flush()
+
+			errCh := make(chan error, 1)
+			go func() {
+				var err error
+				if test.withCtx {
+					ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+					defer cancel()
+					_, err = nc.RequestWithContext(ctx, "slow", nil)
+				} else {
+					_, err = nc.Request("slow", nil, 5*time.Second)
+				}
+				errCh <- err
+			}()
+
+			var reqs []nats.RequestInfo
+			deadline := time.Now().Add(2 * time.Second)
+			for len(reqs) == 0 && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+				reqs = nc.InflightRequests()
+			}
+			if len(reqs) != 1 {
+				t.Fatalf("Expected 1 in-flight request, got %d", len(reqs))
+			}
+			if reqs[0].Subject != "slow" || !strings.HasPrefix(reqs[0].Inbox, nats.InboxPrefix) {
+				t.Fatalf("Unexpected request info: %+v", reqs[0])
+			}
+			if reqs[0].Age <= 0 || reqs[0].Started.IsZero() {
+				t.Fatalf("Expected request age to be set: %+v", reqs[0])
+			}
+
+			if nc.CancelRequest("_INBOX.unknown") {
+				t.Fatal("Expected unknown request not to be canceled")
+			}
+			if !nc.CancelRequest(reqs[0].Inbox) {
+				t.Fatal("Expected request to be canceled")
+			}
+			select {
+			case err := <-errCh:
+				if err != nats.ErrRequestCanceled {
+					t.Fatalf("Expected %v, got %v", nats.ErrRequestCanceled, err)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("Request was not canceled")
+			}
+			if reqs := nc.InflightRequests(); len(reqs) != 0 {
+				t.Fatalf("Expected no in-flight requests, got %d", len(reqs))
+			}
+		})
+	}
+}
+
 func TestRequestNoBody(t *testing.T) {
 	s := RunDefaultServer()
 	defer s.Shutdown()
@@ -894,6 +1572,238 @@ func TestRaceSafeStats(t *testing.T) {
 	}
 }
 
+func TestStatsConcurrentAccess(t *testing.T) {
+	s := RunDefaultServer()
+	defer s.Shutdown()
+	nc := NewDefaultConnection(t)
+	defer nc.Close()
+
+	const publishers, iter = 4, 250
+	var received atomic.Int64
+	if _, err := nc.Subscribe("foo", func(_ *nats.Msg) {
+		received.Add(1)
+	}); err != nil {
+		t.Fatalf("Error on subscribe: %v", err)
+	}
+
+	done := make(chan struct{})
+	readerDone := make(chan struct{})
+	go func() {
+		defer close(readerDone)
+		var last nats.Statistics
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			stats := nc.Stats()
+			if stats.OutMsgs < last.OutMsgs || stats.InMsgs < last.InMsgs {
+				t.Errorf("Statistics went backwards: %+v after %+v", stats, last)
+				return
+			}
+			last = stats
+		}
+	}()
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < publishers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < iter; j++ {
+				nc.Publish("foo", []byte("hello"))
+			}
+		}()
+	}
+	wg.Wait()
+	if err := nc.Flush(); err != nil {
+		t.Fatalf("Error on flush: %v", err)
+	}
+	waitFor(t, 2*time.Second, 10*time.Millisecond, func() error {
+		if n := received.Load(); n != publishers*iter {
+			return fmt.Errorf("Received %d messages, wanted %d", n, publishers*iter)
+		}
+		return nil
+	})
+	close(done)
+	<-readerDone
+
+	stats := nc.Stats()
+	if stats.OutMsgs != publishers*iter || stats.OutBytes != publishers*iter*5 {
+		t.Fatalf("Not properly tracking outbound stats: %+v", stats)
+	}
+	if stats.InMsgs != publishers*iter || stats.InBytes != publishers*iter*5 {
+		t.Fatalf("Not properly tracking inbound stats: %+v", stats)
+	}
+}
+
+func TestFlushChanBuf(t *testing.T) {
+	s := RunDefaultServer()
+	defer s.Shutdown()
+
+	if _, err := nats.Connect(nats.DefaultURL, nats.FlushChanBuf(-1)); err == nil {
+		t.Fatal("Expected error for negative flush channel buffer size")
+	}
+
+	for _, size := range []int{0, 1, 64} {
+		t.Run(strconv.Itoa(size), func(t *testing.T) {
+			sub := NewDefaultConnection(t)
+			defer sub.Close()
+			probes, err := sub.SubscribeSync("probe")
+			if err != nil {
+				t.Fatalf("Error on subscribe: %v", err)
+			}
+			sub.Flush()
+
+			nc, err := nats.Connect(nats.DefaultURL, nats.FlushChanBuf(size))
+			if err != nil {
+				t.Fatalf("Error on connect: %v", err)
+			}
+			defer nc.Close()
+
+			// Sustained publish load, without explicit flushes.
+			done := make(chan struct{})
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				filler := []byte("filler")
+				for {
+					select {
+					case <-done:
+						return
+					case <-time.After(time.Millisecond):
+						for i := 0; i < 100; i++ {
+							nc.Publish("load", filler)
+						}
+					}
+				}
+			}()
+			defer func() {
+				close(done)
+				wg.Wait()
+			}()
+
+			for i := 0; i < 10; i++ {
+				sent := time.Now()
+				if err := nc.Publish("probe", nil); err != nil {
+					t.Fatalf("Error on publish: %v", err)
+				}
+				if _, err := probes.NextMsg(time.Second); err != nil {
+					t.Fatalf("Probe not received: %v", err)
+				}
+				if latency := time.Since(sent); latency > 250*time.Millisecond {
+					t.Fatalf("Flushes were delayed under load, latency: %v", latency)
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		})
+	}
+}
+
+func TestFlushStats(t *testing.T) {
+	s := RunDefaultServer()
+	defer s.Shutdown()
+
+	publishBursts := func(t *testing.T, opts ...nats.Option) nats.Statistics {
+		t.Helper()
+		nc, err := nats.Connect(nats.DefaultURL, opts...)
+		if err != nil {
+			t.Fatalf("Error on connect: %v", err)
+		}
+		defer nc.Close()
+		start := nc.Stats()
+
+		msg := []byte("Hello World")
+		for burst := 0; burst < 10; burst++ {
+			for i := 0; i < 100; i++ {
+				if err := nc.Publish("foo", msg); err != nil {
+					t.Fatalf("Error on publish: %v", err)
+				}
+			}
+			if err := nc.Flush(); err != nil {
+				t.Fatalf("Error on flush: %v", err)
+			}
+		}
+		stats := nc.Stats()
+		stats.FlusherWakeups -= start.FlusherWakeups
+		stats.Flushes -= start.Flushes
+		stats.FlushedBytes -= start.FlushedBytes
+		return stats
+	}
+
+	unbatched := publishBursts(t, nats.FlushOnPublish())
+	if unbatched.Flushes < 1000 {
+		t.Fatalf("Expected at least one flush per publish, got %d", unbatched.Flushes)
+	}
+
+	batched := publishBursts(t)
+	if batched.FlusherWakeups == 0 {
+		t.Fatal("Expected flusher wakeups")
+	}
+	if batched.Flushes >= unbatched.Flushes {
+		t.Fatalf("Expected fewer flushes with batching, got %d vs %d", batched.Flushes, unbatched.Flushes)
+	}
+	if batched.AvgBytesPerFlush() <= unbatched.AvgBytesPerFlush() {
+		t.Fatalf("Expected more bytes per flush with batching, got %.1f vs %.1f",
+			batched.AvgBytesPerFlush(), unbatched.AvgBytesPerFlush())
+	}
+	// the connect protocol and pings are flushed as well
+	if batched.FlushedBytes < batched.OutBytes {
+		t.Fatalf("Expected at least %d flushed bytes, got %d", batched.OutBytes, batched.FlushedBytes)
+	}
+}
+
+func TestOutboundQueue(t *testing.T) {
+	s := RunDefaultServer()
+	defer s.Shutdown()
+
+	sc := NewDefaultConnection(t)
+	defer sc.Close()
+	sub, err := sc.SubscribeSync("foo")
+	if err != nil {
+		t.Fatalf("Error on subscribe: %v", err)
+	}
+	sc.Flush()
+
+	nc, err := nats.Connect(nats.DefaultURL, nats.OutboundQueue(100, nats.OutboundFullBlock))
+	if err != nil {
+		t.Fatalf("Error on connect: %v", err)
+	}
+	defer nc.Close()
+
+	total := 1000
+	for i := 0; i < total; i++ {
+		if err := nc.Publish("foo", []byte(strconv.Itoa(i))); err != nil {
+			t.Fatalf("Error on publish: %v", err)
+		}
+	}
+	// Queued messages are sent before the connection is closed.
+	if err := nc.Drain(); err != nil {
+		t.Fatalf("Error on drain: %v", err)
+	}
+	for i := 0; i < total; i++ {
+		msg, err := sub.NextMsg(2 * time.Second)
+		if err != nil {
+			t.Fatalf("Error receiving message %d: %v", i, err)
+		}
+		if string(msg.Data) != strconv.Itoa(i) {
+			t.Fatalf("Expected message %d, got %q", i, msg.Data)
+		}
+	}
+	if n := nc.PendingOutbound(); n != 0 {
+		t.Fatalf("Expected no pending outbound messages, got %d", n)
+	}
+	if err := nc.Publish("foo", []byte("closed")); !errors.Is(err, nats.ErrConnectionClosed) && !errors.Is(err, nats.ErrConnectionDraining) {
+		t.Fatalf("Expected error publishing on a drained connection, got %v", err)
+	}
+
+	if _, err := nats.Connect(nats.DefaultURL, nats.OutboundQueue(0, nats.OutboundFullError)); err == nil {
+		t.Fatal("Expected error for invalid outbound queue size")
+	}
+}
+
 func TestBadSubject(t *testing.T) {
 	s := RunDefaultServer()
 	defer s.Shutdown()
@@ -1057,3 +1967,116 @@ func TestNilConnection(t *testing.T) {
 		t.Fatalf("Expected ErrBadSubscription error, got %v\n", err)
 	}
 }
+
+func TestRequestQuorum(t *testing.T) {
+	s := RunDefaultServer()
+	defer s.Shutdown()
+	nc := NewDefaultConnection(t)
+	defer nc.Close()
+
+	// 3 fast replicas and a slow one.
+	for i, delay := range []time.Duration{0, 0, 0, time.Second} {
+		id, delay := strconv.Itoa(i), delay
+		sub, err := nc.Subscribe("replicas", func(m *nats.Msg) {
+			time.Sleep(delay)
+			m.Respond([]byte(id))
+		})
+		if err != nil {
+			t.Fatalf("Error on subscribe: %v", err)
+		}
+		defer sub.Unsubscribe()
+	}
+
+	t.Run("quorum reached", func(t *testing.T) {
+		start := time.Now()
+		msgs, err := nc.RequestQuorum("replicas", []byte("write"), 3, 2*time.Second)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(msgs) != 3 {
+			t.Fatalf("Expected 3 responses, got %d", len(msgs))
+		}
+		if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+			t.Fatalf("Expected to return once quorum was reached, took %v", elapsed)
+		}
+		for _, m := range msgs {
+			if string(m.Data) == "3" {
+				t.Fatalf("Unexpected response from slow replica")
+			}
+		}
+	})
+
+	t.Run("quorum not reached", func(t *testing.T) {
+		msgs, err := nc.RequestQuorum("replicas", []byte("write"), 5, 200*time.Millisecond)
+		if !errors.Is(err, nats.ErrQuorumNotReached) {
+			t.Fatalf("Expected error: %v; got: %v", nats.ErrQuorumNotReached, err)
+		}
+		if len(msgs) != 3 {
+			t.Fatalf("Expected 3 responses, got %d", len(msgs))
+		}
+	})
+
+	t.Run("no responders", func(t *testing.T) {
+		if _, err := nc.RequestQuorum("none", nil, 2, time.Second); !errors.Is(err, nats.ErrNoResponders) {
+			t.Fatalf("Expected error: %v; got: %v", nats.ErrNoResponders, err)
+		}
+	})
+
+	t.Run("invalid arguments", func(t *testing.T) {
+		if _, err := nc.RequestQuorum("replicas", nil, 0, time.Second); !errors.Is(err, nats.ErrInvalidArg) {
+			t.Fatalf("Expected error: %v; got: %v", nats.ErrInvalidArg, err)
+		}
+		if _, err := nc.RequestQuorum("replicas", nil, 1, 0); !errors.Is(err, nats.ErrBadTimeout) {
+			t.Fatalf("Expected error: %v; got: %v", nats.ErrBadTimeout, err)
+		}
+	})
+}
+
+func TestFlushHandler(t *testing.T) {
+	s := RunDefaultServer()
+	defer s.Shutdown()
+
+	rtts := make(chan time.Duration, 10)
+	nc, err := nats.Connect(nats.DefaultURL, nats.FlushHandler(func(rtt time.Duration) {
+		rtts <- rtt
+	}))
+	if err != nil {
+		t.Fatalf("Error on connect: %v", err)
+	}
+	defer nc.Close()
+
+	checkRTT := func(t *testing.T) {
+		t.Helper()
+		select {
+		case rtt := <-rtts:
+			if rtt <= 0 || rtt > time.Second {
+				t.Fatalf("Unexpected round trip time: %v", rtt)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Flush handler was not invoked")
+		}
+	}
+
+	if err := nc.Flush(); err != nil {
+		t.Fatalf("Error on flush: %v", err)
+	}
+	checkRTT(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := nc.FlushWithContext(ctx); err != nil {
+		t.Fatalf("Error on flush: %v", err)
+	}
+	checkRTT(t)
+
+	// Failed flushes are not reported.
+	nc.Close()
+	if err := nc.Flush(); !errors.Is(err, nats.ErrConnectionClosed) {
+		t.Fatalf("Expected error: %v; got: %v", nats.ErrConnectionClosed, err)
+	}
+	select {
+	case rtt := <-rtts:
+		t.Fatalf("Unexpected flush handler call with: %v", rtt)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
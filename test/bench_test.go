@@ -82,6 +82,64 @@ func BenchmarkPubSubSpeed(b *testing.B) {
 	b.StopTimer()
 }
 
+func BenchmarkForwardMsg(b *testing.B) {
+	for _, bm := range []struct {
+		name    string
+		forward func(nc *nats.Conn, m *nats.Msg) error
+	}{
+		{"PublishMsg", func(nc *nats.Conn, m *nats.Msg) error {
+			m.Subject = "out"
+			return nc.PublishMsg(m)
+		}},
+		{"ForwardMsg", func(nc *nats.Conn, m *nats.Msg) error {
+			return nc.ForwardMsg("out", m)
+		}},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			s := RunDefaultServer()
+			defer s.Shutdown()
+			nc := NewDefaultConnection(b)
+			defer nc.Close()
+
+			msg := nats.NewMsg("in")
+			msg.Header.Set("Nats-Msg-Id", "123")
+			msg.Header.Set("X-Trace", "abcdef")
+			msg.Data = []byte("Hello World")
+
+			// Collect received messages first, so that only
+			// forwarding is measured.
+			sub, err := nc.SubscribeSync("in")
+			if err != nil {
+				b.Fatalf("Error subscribing: %v", err)
+			}
+			sub.SetPendingLimits(-1, -1)
+			received := make([]*nats.Msg, 0, b.N)
+			for i := 0; i < b.N; i++ {
+				if err := nc.PublishMsg(msg); err != nil {
+					b.Fatalf("Error publishing: %v", err)
+				}
+			}
+			for i := 0; i < b.N; i++ {
+				m, err := sub.NextMsg(5 * time.Second)
+				if err != nil {
+					b.Fatalf("Error receiving: %v", err)
+				}
+				received = append(received, m)
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for _, m := range received {
+				if err := bm.forward(nc, m); err != nil {
+					b.Fatalf("Error forwarding: %v", err)
+				}
+			}
+			b.StopTimer()
+			nc.Flush()
+		})
+	}
+}
+
 func BenchmarkAsyncSubscriptionCreationSpeed(b *testing.B) {
 	b.StopTimer()
 	s := RunDefaultServer()
@@ -149,6 +207,30 @@ func BenchmarkRequest(b *testing.B) {
 	}
 }
 
+func BenchmarkRequestFlushOnPublish(b *testing.B) {
+	b.StopTimer()
+	s := RunDefaultServer()
+	defer s.Shutdown()
+	nc, err := nats.Connect(nats.DefaultURL, nats.FlushOnPublish())
+	if err != nil {
+		b.Fatalf("Failed to connect: %v", err)
+	}
+	defer nc.Close()
+	ok := []byte("ok")
+	nc.Subscribe("req", func(m *nats.Msg) {
+		nc.Publish(m.Reply, ok)
+	})
+	b.StartTimer()
+	b.ReportAllocs()
+	q := []byte("q")
+	for i := 0; i < b.N; i++ {
+		_, err := nc.Request("req", q, 1*time.Second)
+		if err != nil {
+			b.Fatalf("Err %v\n", err)
+		}
+	}
+}
+
 func BenchmarkOldRequest(b *testing.B) {
 	b.StopTimer()
 	s := RunDefaultServer()
@@ -172,3 +254,44 @@ func BenchmarkOldRequest(b *testing.B) {
 		}
 	}
 }
+
+func BenchmarkRequestMux(b *testing.B) {
+	s := RunDefaultServer()
+	defer s.Shutdown()
+	nc := NewDefaultConnection(b)
+	defer nc.Close()
+	ok := []byte("ok")
+	nc.Subscribe("req", func(m *nats.Msg) {
+		nc.Publish(m.Reply, ok)
+	})
+	mux, err := nc.NewRequestMux()
+	if err != nil {
+		b.Fatalf("Error creating request mux: %v", err)
+	}
+	defer mux.Close()
+	q := []byte("q")
+
+	b.Run("mux", func(b *testing.B) {
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if _, err := mux.Request("req", q, time.Second); err != nil {
+					b.Errorf("Err %v\n", err)
+					return
+				}
+			}
+		})
+	})
+	b.Run("per-request subscription", func(b *testing.B) {
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				inbox := nc.NewInbox()
+				if _, err := nc.RequestWithReply("req", inbox, q, time.Second); err != nil {
+					b.Errorf("Err %v\n", err)
+					return
+				}
+			}
+		})
+	})
+}
@@ -0,0 +1,136 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestBridge(t *testing.T) {
+	srcServer := RunServerOnPort(-1)
+	defer srcServer.Shutdown()
+	dstServer := RunServerOnPort(-1)
+	defer dstServer.Shutdown()
+
+	src, err := nats.Connect(srcServer.ClientURL())
+	if err != nil {
+		t.Fatalf("Error on connect: %v", err)
+	}
+	defer src.Close()
+	dst, err := nats.Connect(dstServer.ClientURL())
+	if err != nil {
+		t.Fatalf("Error on connect: %v", err)
+	}
+	defer dst.Close()
+
+	if _, err := nats.NewBridge(src, dst, nats.BridgeConfig{}); !errors.Is(err, nats.ErrBadSubject) {
+		t.Fatalf("Expected error: %v; got: %v", nats.ErrBadSubject, err)
+	}
+
+	// Bridges in both directions, sharing the same ID to prevent loops.
+	toDst, err := nats.NewBridge(src, dst, nats.BridgeConfig{
+		Subject: "src.>",
+		ID:      "bridge",
+		Remap: func(subject string) string {
+			return "dst." + strings.TrimPrefix(subject, "src.")
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	toSrc, err := nats.NewBridge(dst, src, nats.BridgeConfig{
+		Subject: "dst.>",
+		ID:      "bridge",
+		Remap: func(subject string) string {
+			return "src." + strings.TrimPrefix(subject, "dst.")
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, b := range []*nats.Bridge{toDst, toSrc} {
+		if err := b.Start(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer b.Stop()
+	}
+	if err := toDst.Start(); !errors.Is(err, nats.ErrBridgeStarted) {
+		t.Fatalf("Expected error: %v; got: %v", nats.ErrBridgeStarted, err)
+	}
+
+	dstSub, err := dst.SubscribeSync("dst.>")
+	if err != nil {
+		t.Fatalf("Error on subscribe: %v", err)
+	}
+	srcSub, err := src.SubscribeSync("src.>")
+	if err != nil {
+		t.Fatalf("Error on subscribe: %v", err)
+	}
+	src.Flush()
+	dst.Flush()
+
+	msg := nats.NewMsg("src.orders.1")
+	msg.Header.Set("Trace", "abc")
+	msg.Data = []byte("order")
+	if err := src.PublishMsg(msg); err != nil {
+		t.Fatalf("Error on publish: %v", err)
+	}
+
+	received, err := dstSub.NextMsg(time.Second)
+	if err != nil {
+		t.Fatalf("Message was not bridged: %v", err)
+	}
+	if received.Subject != "dst.orders.1" || string(received.Data) != "order" {
+		t.Fatalf("Invalid bridged message: %q: %q", received.Subject, received.Data)
+	}
+	if received.Header.Get("Trace") != "abc" {
+		t.Fatalf("Expected headers to be preserved, got: %v", received.Header)
+	}
+	if via := received.Header.Values(nats.BridgeHeader); !reflect.DeepEqual(via, []string{"bridge"}) {
+		t.Fatalf("Invalid bridge header: %v", via)
+	}
+
+	// The original message is received on the source, but it is not
+	// forwarded back by the reverse bridge.
+	if _, err := srcSub.NextMsg(time.Second); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if m, err := srcSub.NextMsg(200 * time.Millisecond); err == nil {
+		t.Fatalf("Unexpected message forwarded back: %q", m.Subject)
+	}
+	if _, err := dstSub.NextMsg(100 * time.Millisecond); err == nil {
+		t.Fatal("Unexpected duplicate bridged message")
+	}
+	if stats := toDst.Stats(); stats != (nats.BridgeStats{Forwarded: 1}) {
+		t.Fatalf("Invalid stats: %+v", stats)
+	}
+	if stats := toSrc.Stats(); stats != (nats.BridgeStats{Skipped: 1}) {
+		t.Fatalf("Invalid stats: %+v", stats)
+	}
+
+	// No messages are forwarded once stopped.
+	if err := toDst.Stop(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	src.Publish("src.orders.2", nil)
+	if _, err := dstSub.NextMsg(200 * time.Millisecond); err == nil {
+		t.Fatal("Unexpected message after stop")
+	}
+}
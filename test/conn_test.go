@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net"
@@ -536,6 +537,63 @@ func TestServerTLSHintConnections(t *testing.T) {
 	defer nc.Close()
 }
 
+func TestTLSSessionResumption(t *testing.T) {
+	s, opts := RunServerWithConfig("./configs/tls.conf")
+	defer s.Shutdown()
+
+	endpoint := fmt.Sprintf("%s:%d", opts.Host, opts.Port)
+	secureURL := fmt.Sprintf("tls://%s:%s@%s/", opts.Username, opts.Password, endpoint)
+
+	for _, test := range []struct {
+		name    string
+		opts    []nats.Option
+		resumed bool
+	}{
+		{"default", nil, true},
+		{"no session cache", []nats.Option{nats.NoTLSSessionCache()}, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			reconnected := make(chan bool, 1)
+			nc, err := nats.Connect(secureURL, append(test.opts,
+				nats.RootCAs("./configs/certs/ca.pem"),
+				nats.ReconnectWait(10*time.Millisecond),
+				nats.ReconnectHandler(func(*nats.Conn) {
+					reconnected <- true
+				}))...)
+			if err != nil {
+				t.Fatalf("Failed to create secure (TLS) connection: %v", err)
+			}
+			defer nc.Close()
+
+			// Make sure the session ticket sent after the handshake is received.
+			if err := nc.Flush(); err != nil {
+				t.Fatalf("Error on flush: %v", err)
+			}
+			state, err := nc.TLSConnectionState()
+			if err != nil {
+				t.Fatalf("Expected connection state: %v", err)
+			}
+			if state.DidResume {
+				t.Fatal("Expected full handshake on first connect")
+			}
+
+			if err := nc.ForceReconnect(); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if err := Wait(reconnected); err != nil {
+				t.Fatal("Did not reconnect")
+			}
+			state, err = nc.TLSConnectionState()
+			if err != nil {
+				t.Fatalf("Expected connection state: %v", err)
+			}
+			if state.DidResume != test.resumed {
+				t.Fatalf("Expected session resumed to be %v; got: %v", test.resumed, state.DidResume)
+			}
+		})
+	}
+}
+
 func TestClosedConnections(t *testing.T) {
 	s := RunDefaultServer()
 	defer s.Shutdown()
@@ -876,6 +934,84 @@ func isAsyncDispatcherRunning() bool {
 	return strings.Contains(strStacks, "asyncCBDispatcher")
 }
 
+type syncBuffer struct {
+	sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.Lock()
+	defer b.Unlock()
+	return b.buf.String()
+}
+
+func TestProtocolTrace(t *testing.T) {
+	s := RunDefaultServer()
+	defer s.Shutdown()
+
+	for _, withPayloads := range []bool{false, true} {
+		t.Run(fmt.Sprintf("payloads=%v", withPayloads), func(t *testing.T) {
+			w := &syncBuffer{}
+			nc, err := nats.Connect(nats.DefaultURL,
+				nats.UserInfo("derek", "s3cr3t"),
+				nats.ProtocolTrace(w, withPayloads))
+			if err != nil {
+				t.Fatalf("Error on connect: %v", err)
+			}
+			sub, err := nc.SubscribeSync("foo")
+			if err != nil {
+				t.Fatalf("Error on subscribe: %v", err)
+			}
+			if err := nc.Publish("foo", []byte("hello")); err != nil {
+				t.Fatalf("Error on publish: %v", err)
+			}
+			if _, err := sub.NextMsg(time.Second); err != nil {
+				t.Fatalf("Error getting message: %v", err)
+			}
+			nc.Close()
+
+			if strings.Contains(w.String(), "s3cr3t") {
+				t.Fatalf("Expected credentials to be redacted, got %s", w.String())
+			}
+			ops := make(map[string]nats.ProtocolTraceEntry)
+			dec := json.NewDecoder(strings.NewReader(w.String()))
+			for dec.More() {
+				var e nats.ProtocolTraceEntry
+				if err := dec.Decode(&e); err != nil {
+					t.Fatalf("Error decoding trace entry: %v", err)
+				}
+				if e.Time.IsZero() {
+					t.Fatalf("Expected time to be set: %+v", e)
+				}
+				ops[e.Direction+" "+e.Op] = e
+			}
+			for _, op := range []string{"in INFO", "out CONNECT", "out PING", "in PONG", "out SUB", "out PUB", "in MSG"} {
+				if _, ok := ops[op]; !ok {
+					t.Fatalf("Expected %q in trace, got %v", op, ops)
+				}
+			}
+			if line := ops["out PUB"].Line; line != "PUB foo 5" {
+				t.Fatalf("Unexpected PUB line: %q", line)
+			}
+			for _, op := range []string{"out PUB", "in MSG"} {
+				expected := ""
+				if withPayloads {
+					expected = "hello"
+				}
+				if p := ops[op].Payload; p != expected {
+					t.Fatalf("Expected %q payload to be %q, got %q", op, expected, p)
+				}
+			}
+		})
+	}
+}
+
 func TestCallbacksOrder(t *testing.T) {
 	authS, authSOpts := RunServerWithConfig("./configs/tls.conf")
 	defer authS.Shutdown()
@@ -1843,6 +1979,78 @@ func TestUseCustomDialer(t *testing.T) {
 	}
 }
 
+type recordingDialer struct {
+	mu    sync.Mutex
+	dials []string
+}
+
+func (rd *recordingDialer) Dial(network, address string) (net.Conn, error) {
+	rd.mu.Lock()
+	rd.dials = append(rd.dials, network+" "+address)
+	rd.mu.Unlock()
+	return net.Dial(network, address)
+}
+
+func (rd *recordingDialer) reset() []string {
+	rd.mu.Lock()
+	defer rd.mu.Unlock()
+	dials := rd.dials
+	rd.dials = nil
+	return dials
+}
+
+func TestIPResolutionOrder(t *testing.T) {
+	s := RunDefaultServer()
+	defer s.Shutdown()
+
+	if _, err := nats.Connect(nats.DefaultURL, nats.IPResolution("ip5")); err == nil {
+		t.Fatal("Expected error for invalid IP resolution order")
+	}
+	opts := nats.GetDefaultOptions()
+	opts.IPResolutionOrder = "ip5"
+	if _, err := opts.Connect(); err == nil {
+		t.Fatal("Expected error for invalid IP resolution order")
+	}
+
+	dialer := &recordingDialer{}
+	reconnected := make(chan struct{}, 1)
+	nc, err := nats.Connect("nats://localhost:4222",
+		nats.IPResolution(nats.IPResolutionIP4),
+		nats.SetCustomDialer(dialer),
+		nats.ReconnectWait(10*time.Millisecond),
+		nats.ReconnectHandler(func(_ *nats.Conn) { reconnected <- struct{}{} }))
+	if err != nil {
+		t.Fatalf("Unexpected error on connect: %v", err)
+	}
+	defer nc.Close()
+
+	checkDials := func(dials []string) {
+		t.Helper()
+		if len(dials) == 0 {
+			t.Fatal("Expected the dialer to be used")
+		}
+		for _, dial := range dials {
+			network, addr, _ := strings.Cut(dial, " ")
+			host, _, _ := net.SplitHostPort(addr)
+			if ip := net.ParseIP(host); network != "tcp4" || (ip != nil && ip.To4() == nil) {
+				t.Fatalf("Expected IPv4 dial, got %q", dial)
+			}
+		}
+	}
+	checkDials(dialer.reset())
+
+	// the order is also used when reconnecting
+	s.Shutdown()
+	s = RunDefaultServer()
+	defer s.Shutdown()
+	select {
+	case <-reconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Did not reconnect")
+	}
+	checkDials(dialer.reset())
+}
+
 func TestDefaultOptionsDialer(t *testing.T) {
 	s := RunDefaultServer()
 	defer s.Shutdown()
@@ -193,6 +193,48 @@ func TestDrainUnSubs(t *testing.T) {
 	})
 }
 
+func TestDrainSyncSubscription(t *testing.T) {
+	s := RunDefaultServer()
+	defer s.Shutdown()
+	nc := NewDefaultConnection(t)
+	defer nc.Close()
+
+	sub, err := nc.SubscribeSync("foo")
+	if err != nil {
+		t.Fatalf("Error creating subscription; %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		nc.Publish("foo", []byte("hello"))
+	}
+	nc.Flush()
+
+	if err := sub.Drain(); err != nil {
+		t.Fatalf("Unexpected error on drain: %v", err)
+	}
+	// All pending messages are delivered, then the drain is reported.
+	for i := 0; i < 10; i++ {
+		if _, err := sub.NextMsg(time.Second); err != nil {
+			t.Fatalf("Unexpected error getting message %d: %v", i, err)
+		}
+	}
+	if _, err := sub.NextMsg(time.Second); !errors.Is(err, nats.ErrSubscriptionDrained) {
+		t.Fatalf("Expected error: %v; got: %v", nats.ErrSubscriptionDrained, err)
+	}
+	if _, err := sub.NextMsg(time.Second); !errors.Is(err, nats.ErrSubscriptionDrained) {
+		t.Fatalf("Expected error: %v; got: %v", nats.ErrSubscriptionDrained, err)
+	}
+
+	// Closing the connection is still reported as such.
+	sub, err = nc.SubscribeSync("foo")
+	if err != nil {
+		t.Fatalf("Error creating subscription; %v", err)
+	}
+	nc.Close()
+	if _, err := sub.NextMsg(time.Second); !errors.Is(err, nats.ErrConnectionClosed) {
+		t.Fatalf("Expected error: %v; got: %v", nats.ErrConnectionClosed, err)
+	}
+}
+
 func TestDrainSlowSubscriber(t *testing.T) {
 	s := RunDefaultServer()
 	defer s.Shutdown()
@@ -0,0 +1,90 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/expvars"
+)
+
+func TestExpvars(t *testing.T) {
+	s := RunServerOnPort(-1)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Error on connect: %v", err)
+	}
+	defer nc.Close()
+
+	if err := expvars.Publish(nc, "nats_test_conn"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := expvars.Publish(nc, "nats_test_conn"); !errors.Is(err, expvars.ErrNameInUse) {
+		t.Fatalf("Expected error: %v; got: %v", expvars.ErrNameInUse, err)
+	}
+
+	// Messages are left pending on the sync subscription.
+	if _, err := nc.SubscribeSync("foo"); err != nil {
+		t.Fatalf("Error on subscribe: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := nc.Publish("foo", []byte("hello")); err != nil {
+			t.Fatalf("Error on publish: %v", err)
+		}
+	}
+	if err := nc.Flush(); err != nil {
+		t.Fatalf("Error on flush: %v", err)
+	}
+
+	var values struct {
+		Status        string `json:"status"`
+		InMsgs        uint64 `json:"in_msgs"`
+		OutMsgs       uint64 `json:"out_msgs"`
+		OutBytes      uint64 `json:"out_bytes"`
+		Subscriptions int    `json:"subscriptions"`
+		PendingMsgs   int    `json:"pending_msgs"`
+		PendingBytes  int    `json:"pending_bytes"`
+	}
+	v := expvar.Get("nats_test_conn")
+	if v == nil {
+		t.Fatal("Expected variable to be published")
+	}
+	if err := json.Unmarshal([]byte(v.String()), &values); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if values.Status != "CONNECTED" {
+		t.Fatalf("Invalid status: %q", values.Status)
+	}
+	if values.InMsgs != 3 || values.OutMsgs != 3 || values.OutBytes != 15 {
+		t.Fatalf("Invalid message stats: %+v", values)
+	}
+	if values.Subscriptions != 1 || values.PendingMsgs != 3 || values.PendingBytes != 15 {
+		t.Fatalf("Invalid subscription stats: %+v", values)
+	}
+
+	// Values are computed when read.
+	nc.Close()
+	if err := json.Unmarshal([]byte(v.String()), &values); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if values.Status != "CLOSED" {
+		t.Fatalf("Invalid status after close: %q", values.Status)
+	}
+}
@@ -15,10 +15,12 @@ package test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"reflect"
 	"sort"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -63,6 +65,180 @@ func TestBasicHeaders(t *testing.T) {
 	}
 }
 
+func TestPublishWithHeaders(t *testing.T) {
+	s := RunServerOnPort(-1)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Error connecting to server: %v", err)
+	}
+	defer nc.Close()
+
+	subject := "headers.test"
+	sub, err := nc.SubscribeSync(subject)
+	if err != nil {
+		t.Fatalf("Could not subscribe to %q: %v", subject, err)
+	}
+	defer sub.Unsubscribe()
+
+	hdr := nats.Header{}
+	hdr.Add("Accept-Encoding", "json")
+	hdr.Add("X-Trace", "a")
+	hdr.Add("X-Trace", "b\tc")
+	if err := nc.PublishWithHeaders(subject, []byte("Hello Headers!"), hdr); err != nil {
+		t.Fatalf("Error publishing: %v", err)
+	}
+	msg, err := sub.NextMsg(time.Second)
+	if err != nil {
+		t.Fatalf("Did not receive message: %v", err)
+	}
+	if string(msg.Data) != "Hello Headers!" {
+		t.Fatalf("Unexpected payload: %q", msg.Data)
+	}
+	if !reflect.DeepEqual(msg.Header, hdr) {
+		t.Fatalf("Headers did not match!\n%+v\n%+v", hdr, msg.Header)
+	}
+
+	for _, hdr := range []nats.Header{
+		{"X-Injected": {"a\r\nPUB foo 1\r\nx"}},
+		{"X-Injected": {"a\nb"}},
+		{"X-Bad Key": {"a"}},
+		{"X-Bad:Key": {"a"}},
+		{"X-Bad\r\nKey": {"a"}},
+		{"": {"a"}},
+	} {
+		if err := nc.PublishWithHeaders(subject, nil, hdr); !errors.Is(err, nats.ErrInvalidHeader) {
+			t.Fatalf("Expected error: %v; got: %v", nats.ErrInvalidHeader, err)
+		}
+	}
+	if msg, err := sub.NextMsg(100 * time.Millisecond); err == nil {
+		t.Fatalf("Unexpected message: %+v", msg)
+	}
+}
+
+func TestHeaderInjection(t *testing.T) {
+	s := RunServerOnPort(-1)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Error connecting to server: %v", err)
+	}
+	defer nc.Close()
+
+	sub, err := nc.SubscribeSync("headers.>")
+	if err != nil {
+		t.Fatalf("Could not subscribe: %v", err)
+	}
+	defer sub.Unsubscribe()
+
+	injected := "a\r\n\r\nPUB headers.injected 1\r\nx"
+	for _, hdr := range []nats.Header{
+		{"X-Value": {injected}},
+		{"X-Value\r\n\r\nPUB headers.injected 1\r\nx": {"a"}},
+	} {
+		m := &nats.Msg{Subject: "headers.test", Header: hdr, Data: []byte("data")}
+		if err := nc.PublishMsg(m); !errors.Is(err, nats.ErrInvalidHeader) {
+			t.Fatalf("Expected error: %v; got: %v", nats.ErrInvalidHeader, err)
+		}
+		if _, err := nc.RequestMsg(m, 100*time.Millisecond); !errors.Is(err, nats.ErrInvalidHeader) {
+			t.Fatalf("Expected error: %v; got: %v", nats.ErrInvalidHeader, err)
+		}
+	}
+
+	// the connection is not affected
+	m := nats.NewMsg("headers.test")
+	m.Header.Set("X-Value", "a")
+	if err := nc.PublishMsg(m); err != nil {
+		t.Fatalf("Error publishing: %v", err)
+	}
+	msg, err := sub.NextMsg(time.Second)
+	if err != nil {
+		t.Fatalf("Did not receive message: %v", err)
+	}
+	if msg.Subject != "headers.test" || msg.Header.Get("X-Value") != "a" {
+		t.Fatalf("Unexpected message: %+v", msg)
+	}
+	if msg, err := sub.NextMsg(100 * time.Millisecond); err == nil {
+		t.Fatalf("Unexpected message: %+v", msg)
+	}
+	if !nc.IsConnected() {
+		t.Fatal("Expected the connection to be connected")
+	}
+}
+
+func TestMsgHeaderBytes(t *testing.T) {
+	s := RunServerOnPort(-1)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Error connecting to server: %v", err)
+	}
+	defer nc.Close()
+
+	sub, err := nc.SubscribeSync("headers.*")
+	if err != nil {
+		t.Fatalf("Could not subscribe: %v", err)
+	}
+	defer sub.Unsubscribe()
+
+	m := nats.NewMsg("headers.in")
+	m.Reply = "reply"
+	m.Header.Add("Accept-Encoding", "json")
+	m.Data = []byte("Hello Headers!")
+	hdr := m.HeaderBytes()
+	if !strings.HasPrefix(string(hdr), "NATS/1.0\r\n") {
+		t.Fatalf("Unexpected header block: %q", hdr)
+	}
+	if m.PayloadSize() != len(hdr)+len(m.Data) {
+		t.Fatalf("Unexpected payload size: %d", m.PayloadSize())
+	}
+
+	if err := nc.PublishMsg(m); err != nil {
+		t.Fatalf("Error publishing: %v", err)
+	}
+	msg, err := sub.NextMsg(time.Second)
+	if err != nil {
+		t.Fatalf("Did not receive message: %v", err)
+	}
+	if string(msg.HeaderBytes()) != string(hdr) {
+		t.Fatalf("Expected header block %q, got %q", hdr, msg.HeaderBytes())
+	}
+	if msg.PayloadSize() != m.PayloadSize() {
+		t.Fatalf("Expected payload size %d, got %d", m.PayloadSize(), msg.PayloadSize())
+	}
+
+	// Forward the received message as is.
+	if err := nc.ForwardMsg("headers.out", msg); err != nil {
+		t.Fatalf("Error forwarding: %v", err)
+	}
+	fwd, err := sub.NextMsg(time.Second)
+	if err != nil {
+		t.Fatalf("Did not receive forwarded message: %v", err)
+	}
+	if fwd.Subject != "headers.out" || fwd.Reply != "reply" ||
+		string(fwd.Data) != string(m.Data) || fwd.Header.Get("Accept-Encoding") != "json" {
+		t.Fatalf("Unexpected forwarded message: %+v", fwd)
+	}
+
+	// Messages without headers are forwarded without a header block.
+	if err := nc.Publish("headers.in", []byte("no headers")); err != nil {
+		t.Fatalf("Error publishing: %v", err)
+	}
+	msg, err = sub.NextMsg(time.Second)
+	if err != nil {
+		t.Fatalf("Did not receive message: %v", err)
+	}
+	if msg.HeaderBytes() != nil || msg.PayloadSize() != len("no headers") {
+		t.Fatalf("Unexpected header block %q or payload size %d", msg.HeaderBytes(), msg.PayloadSize())
+	}
+	if err := nc.ForwardMsg("headers.out", nil); err != nats.ErrInvalidMsg {
+		t.Fatalf("Expected error %v, got %v", nats.ErrInvalidMsg, err)
+	}
+}
+
 func TestRequestMsg(t *testing.T) {
 	s := RunServerOnPort(-1)
 	defer s.Shutdown()
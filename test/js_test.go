@@ -83,6 +83,21 @@ func TestJetStreamNotEnabled(t *testing.T) {
 	}
 }
 
+func TestJetStreamSubjectPrefix(t *testing.T) {
+	s := RunBasicJetStreamServer()
+	defer shutdownJSServerAndRemoveStorage(t, s)
+
+	nc, err := nats.Connect(s.ClientURL(), nats.SubjectPrefix("tenant"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer nc.Close()
+
+	if _, err := nc.JetStream(); err != nats.ErrSubjectPrefixNotSupported {
+		t.Fatalf("Did not get the proper error, got %v", err)
+	}
+}
+
 func TestJetStreamErrors(t *testing.T) {
 	t.Run("API error", func(t *testing.T) {
 		conf := createConfFile(t, []byte(`
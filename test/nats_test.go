@@ -553,6 +553,40 @@ func TestConnectedAddr(t *testing.T) {
 	}
 }
 
+func TestLocalAndRemoteAddr(t *testing.T) {
+	s := RunServerOnPort(-1)
+	defer s.Shutdown()
+
+	var nc *nats.Conn
+	if addr := nc.LocalAddr(); addr != nil {
+		t.Fatalf("Expected nil result for nil connection, got %v", addr)
+	}
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Error connecting: %v", err)
+	}
+	local, remote := nc.LocalAddr(), nc.RemoteAddr()
+	if local == nil || remote == nil {
+		t.Fatalf("Expected addresses, got local: %v, remote: %v", local, remote)
+	}
+	if remote.String() != s.Addr().String() {
+		t.Fatalf("Expected remote address %q, got %q", s.Addr().String(), remote.String())
+	}
+	if remote.String() != nc.ConnectedAddr() {
+		t.Fatalf("Expected remote address %q, got %q", nc.ConnectedAddr(), remote.String())
+	}
+	if local.String() == remote.String() {
+		t.Fatalf("Expected local address to differ from remote address %q", remote.String())
+	}
+	nc.Close()
+	if addr := nc.LocalAddr(); addr != nil {
+		t.Fatalf("Expected nil result for closed connection, got %v", addr)
+	}
+	if addr := nc.RemoteAddr(); addr != nil {
+		t.Fatalf("Expected nil result for closed connection, got %v", addr)
+	}
+}
+
 func TestSubscribeSyncRace(t *testing.T) {
 	s := RunServerOnPort(TEST_PORT)
 	defer s.Shutdown()
@@ -1083,6 +1117,134 @@ func TestCustomInboxPrefix(t *testing.T) {
 	}
 }
 
+func TestSubjectPrefix(t *testing.T) {
+	opts := &nats.Options{}
+	for _, p := range []string{"", ".", "tenant.", "tenant.*", "tenant.>", "ten ant"} {
+		if err := nats.SubjectPrefix(p)(opts); err == nil {
+			t.Fatalf("Expected error for %q", p)
+		}
+	}
+
+	s := RunServerOnPort(-1)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL(), nats.SubjectPrefix("tenant"))
+	if err != nil {
+		t.Fatalf("Expected to connect to server, got %v", err)
+	}
+	defer nc.Close()
+
+	raw, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Expected to connect to server, got %v", err)
+	}
+	defer raw.Close()
+
+	wire, err := raw.SubscribeSync("tenant.>")
+	if err != nil {
+		t.Fatalf("subscribe failed: %s", err)
+	}
+	if err := raw.Flush(); err != nil {
+		t.Fatalf("flush failed: %s", err)
+	}
+
+	received := make(chan *nats.Msg, 10)
+	if _, err := nc.Subscribe("foo", func(msg *nats.Msg) {
+		received <- msg
+		msg.Respond([]byte("ok"))
+	}); err != nil {
+		t.Fatalf("subscribe failed: %s", err)
+	}
+	if err := nc.Flush(); err != nil {
+		t.Fatalf("flush failed: %s", err)
+	}
+
+	resp, err := nc.Request("foo", []byte("req"), time.Second)
+	if err != nil {
+		t.Fatalf("request failed: %s", err)
+	}
+	if !bytes.Equal(resp.Data, []byte("ok")) {
+		t.Fatalf("did not receive ok: %q", resp.Data)
+	}
+	msg := <-received
+	if msg.Subject != "foo" {
+		t.Fatalf("Expected unprefixed subject, got %q", msg.Subject)
+	}
+	if !strings.HasPrefix(msg.Reply, nats.InboxPrefix) {
+		t.Fatalf("Expected unprefixed inbox reply, got %q", msg.Reply)
+	}
+	if !strings.HasPrefix(resp.Subject, nats.InboxPrefix) {
+		t.Fatalf("Expected unprefixed response subject, got %q", resp.Subject)
+	}
+
+	// Check the subjects used on the wire.
+	req, err := wire.NextMsg(time.Second)
+	if err != nil {
+		t.Fatalf("Error receiving request: %v", err)
+	}
+	if req.Subject != "tenant.foo" {
+		t.Fatalf("Expected prefixed subject, got %q", req.Subject)
+	}
+	if !strings.HasPrefix(req.Reply, "tenant."+nats.InboxPrefix) {
+		t.Fatalf("Expected prefixed inbox reply, got %q", req.Reply)
+	}
+	rep, err := wire.NextMsg(time.Second)
+	if err != nil {
+		t.Fatalf("Error receiving response: %v", err)
+	}
+	if rep.Subject != req.Reply {
+		t.Fatalf("Expected response on %q, got %q", req.Reply, rep.Subject)
+	}
+
+	// API subjects and replies other than inboxes are not prefixed.
+	api, err := raw.SubscribeSync("$JS.API.>")
+	if err != nil {
+		t.Fatalf("subscribe failed: %s", err)
+	}
+	if err := raw.Flush(); err != nil {
+		t.Fatalf("flush failed: %s", err)
+	}
+	if err := nc.PublishRequest("$JS.API.INFO", "replies.foo", nil); err != nil {
+		t.Fatalf("publish failed: %s", err)
+	}
+	apiReq, err := api.NextMsg(time.Second)
+	if err != nil {
+		t.Fatalf("Error receiving API request: %v", err)
+	}
+	if apiReq.Subject != "$JS.API.INFO" || apiReq.Reply != "replies.foo" {
+		t.Fatalf("Expected unprefixed subject and reply, got %q and %q", apiReq.Subject, apiReq.Reply)
+	}
+	kv, err := nc.SubscribeSync("$KV.bucket.>")
+	if err != nil {
+		t.Fatalf("subscribe failed: %s", err)
+	}
+	if err := nc.Flush(); err != nil {
+		t.Fatalf("flush failed: %s", err)
+	}
+	raw.Publish("$KV.bucket.key", []byte("value"))
+	if msg, err := kv.NextMsg(time.Second); err != nil || msg.Subject != "$KV.bucket.key" {
+		t.Fatalf("Expected message on unprefixed subject, got %v, %v", msg, err)
+	}
+
+	// Messages outside of the namespace are not delivered.
+	raw.Publish("foo", []byte("outside"))
+	raw.Publish("tenant.foo", []byte("inside"))
+	raw.Flush()
+	select {
+	case msg := <-received:
+		if string(msg.Data) != "inside" || msg.Subject != "foo" {
+			t.Fatalf("Unexpected message %q on %q", msg.Data, msg.Subject)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Did not receive message published in namespace")
+	}
+	select {
+	case msg := <-received:
+		t.Fatalf("Unexpected message %q on %q", msg.Data, msg.Subject)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
 func TestRespInbox(t *testing.T) {
 	s := RunServerOnPort(-1)
 	defer s.Shutdown()
@@ -19,6 +19,7 @@ import (
 	"net"
 	"net/url"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -656,6 +657,152 @@ func TestReconnectBufSize(t *testing.T) {
 	nc.Buffered()
 }
 
+func TestReconnectBufMsgs(t *testing.T) {
+	s := RunDefaultServer()
+	defer s.Shutdown()
+
+	dch := make(chan bool)
+	rch := make(chan bool)
+	nc, err := nats.Connect(nats.DefaultURL,
+		nats.ReconnectBufMsgs(10),
+		nats.ReconnectWait(50*time.Millisecond),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, _ error) {
+			dch <- true
+		}),
+		nats.ReconnectHandler(func(_ *nats.Conn) {
+			rch <- true
+		}))
+	if err != nil {
+		t.Fatalf("Should have connected ok: %v", err)
+	}
+	defer nc.Close()
+
+	sub, err := nc.SubscribeSync("foo")
+	if err != nil {
+		t.Fatalf("Error on subscribe: %v", err)
+	}
+	if err := nc.Flush(); err != nil {
+		t.Fatalf("Error during flush: %v", err)
+	}
+
+	// Force disconnected state.
+	s.Shutdown()
+
+	if e := Wait(dch); e != nil {
+		t.Fatal("DisconnectedErrCB should have been triggered")
+	}
+
+	// Small messages, far below the byte limit.
+	for i := 0; i < 10; i++ {
+		if err := nc.Publish("foo", []byte("x")); err != nil {
+			t.Fatalf("Failed to publish message %d: %v", i, err)
+		}
+	}
+	if err := nc.Publish("foo", []byte("x")); err != nats.ErrReconnectBufExceeded {
+		t.Fatalf("Expected %v, got %v", nats.ErrReconnectBufExceeded, err)
+	}
+
+	s = RunDefaultServer()
+	defer s.Shutdown()
+
+	if e := Wait(rch); e != nil {
+		t.Fatal("ReconnectedCB should have been triggered")
+	}
+
+	// Buffered messages should have been delivered.
+	for i := 0; i < 10; i++ {
+		if _, err := sub.NextMsg(time.Second); err != nil {
+			t.Fatalf("Error receiving message %d: %v", i, err)
+		}
+	}
+	if _, err := sub.NextMsg(100 * time.Millisecond); err != nats.ErrTimeout {
+		t.Fatalf("Expected no more messages, got %v", err)
+	}
+
+	// The limit does not apply once reconnected.
+	for i := 0; i < 20; i++ {
+		if err := nc.Publish("foo", []byte("x")); err != nil {
+			t.Fatalf("Failed to publish message %d: %v", i, err)
+		}
+	}
+	if err := nc.Flush(); err != nil {
+		t.Fatalf("Error during flush: %v", err)
+	}
+}
+
+func TestPublishIfConnected(t *testing.T) {
+	s := RunDefaultServer()
+	defer s.Shutdown()
+
+	dch := make(chan bool)
+	rch := make(chan bool)
+	nc, err := nats.Connect(nats.DefaultURL,
+		nats.ReconnectWait(50*time.Millisecond),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, _ error) {
+			dch <- true
+		}),
+		nats.ReconnectHandler(func(_ *nats.Conn) {
+			rch <- true
+		}))
+	if err != nil {
+		t.Fatalf("Should have connected ok: %v", err)
+	}
+	defer nc.Close()
+
+	sub, err := nc.SubscribeSync("foo")
+	if err != nil {
+		t.Fatalf("Error on subscribe: %v", err)
+	}
+	if sent, err := nc.PublishIfConnected("foo", []byte("connected")); err != nil || !sent {
+		t.Fatalf("Expected message to be sent, got sent: %v, err: %v", sent, err)
+	}
+	if err := nc.Flush(); err != nil {
+		t.Fatalf("Error during flush: %v", err)
+	}
+
+	// Force disconnected state.
+	s.Shutdown()
+
+	if e := Wait(dch); e != nil {
+		t.Fatal("DisconnectedErrCB should have been triggered")
+	}
+	if !nc.IsReconnecting() {
+		t.Fatal("Expected connection to be reconnecting")
+	}
+	buffered, _ := nc.Buffered()
+	if sent, err := nc.PublishIfConnected("foo", []byte("reconnecting")); err != nil || sent {
+		t.Fatalf("Expected message to be dropped, got sent: %v, err: %v", sent, err)
+	}
+	if n, _ := nc.Buffered(); n != buffered {
+		t.Fatalf("Expected message not to be buffered, buffered %d bytes, was %d", n, buffered)
+	}
+
+	s = RunDefaultServer()
+	defer s.Shutdown()
+
+	if e := Wait(rch); e != nil {
+		t.Fatal("ReconnectedCB should have been triggered")
+	}
+
+	if sent, err := nc.PublishIfConnected("foo", []byte("reconnected")); err != nil || !sent {
+		t.Fatalf("Expected message to be sent, got sent: %v, err: %v", sent, err)
+	}
+	for _, expected := range []string{"connected", "reconnected"} {
+		msg, err := sub.NextMsg(time.Second)
+		if err != nil {
+			t.Fatalf("Error receiving message %q: %v", expected, err)
+		}
+		if string(msg.Data) != expected {
+			t.Fatalf("Expected message %q, got %q", expected, msg.Data)
+		}
+	}
+
+	nc.Close()
+	if _, err := nc.PublishIfConnected("foo", nil); !errors.Is(err, nats.ErrConnectionClosed) {
+		t.Fatalf("Expected %v, got %v", nats.ErrConnectionClosed, err)
+	}
+}
+
 // When a cluster is fronted by a single DNS name (desired) but communicates IPs to clients (also desired),
 // and we use TLS, we want to make sure we do the right thing connecting to an IP directly for TLS to work.
 // The reason this may happen is that the cluster has a single DNS name and a single certificate, but the cluster
@@ -882,6 +1029,348 @@ func TestAuthExpiredReconnect(t *testing.T) {
 	nc.Close()
 }
 
+func TestAuthExpiredReconnectJWTHandler(t *testing.T) {
+	ts := runTrustServer()
+	defer ts.Shutdown()
+
+	ukp, err := nkeys.FromSeed(uSeed)
+	if err != nil {
+		t.Fatalf("Error creating user key pair: %v", err)
+	}
+	upub, err := ukp.PublicKey()
+	if err != nil {
+		t.Fatalf("Error getting user public key: %v", err)
+	}
+	akp, err := nkeys.FromSeed(aSeed)
+	if err != nil {
+		t.Fatalf("Error creating account key pair: %v", err)
+	}
+
+	userJWT := func(expires time.Duration) (string, error) {
+		claims := jwt.NewUserClaims("test")
+		claims.Expires = time.Now().Add(expires).Unix()
+		claims.Subject = upub
+		return claims.Encode(akp)
+	}
+	// The initial token is short-lived.
+	jwtCB := func() (string, error) {
+		return userJWT(time.Second)
+	}
+	var refreshed atomic.Int32
+	refreshCB := func() (string, error) {
+		refreshed.Add(1)
+		return userJWT(time.Hour)
+	}
+	sigCB := func(nonce []byte) ([]byte, error) {
+		kp, _ := nkeys.FromSeed(uSeed)
+		sig, _ := kp.Sign(nonce)
+		return sig, nil
+	}
+
+	expiredCh := make(chan struct{}, 1)
+	nc, err := nats.Connect(ts.ClientURL(),
+		nats.UserJWT(jwtCB, sigCB),
+		nats.ReconnectJWTHandler(refreshCB),
+		nats.AuthExpiredHandler(func(_ *nats.Conn) {
+			expiredCh <- struct{}{}
+		}),
+		nats.ReconnectWait(100*time.Millisecond),
+		nats.ErrorHandler(func(_ *nats.Conn, _ *nats.Subscription, _ error) {}))
+	if err != nil {
+		t.Fatalf("Expected to connect, got %v", err)
+	}
+	defer nc.Close()
+	statusCh := nc.StatusChanged(nats.RECONNECTING, nats.CONNECTED)
+
+	select {
+	case <-expiredCh:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Did not get the auth expired callback")
+	}
+	WaitOnChannel(t, statusCh, nats.RECONNECTING)
+	WaitOnChannel(t, statusCh, nats.CONNECTED)
+	if refreshed.Load() != 1 {
+		t.Fatalf("Expected the reconnect JWT handler to be called once, got %d", refreshed.Load())
+	}
+
+	// The refreshed token does not expire, so the connection should
+	// stay connected past the initial token expiration.
+	time.Sleep(1500 * time.Millisecond)
+	if !nc.IsConnected() {
+		t.Fatal("Expected connection to remain connected")
+	}
+	if err := nc.Flush(); err != nil {
+		t.Fatalf("Error on flush: %v", err)
+	}
+	select {
+	case <-expiredCh:
+		t.Fatal("Unexpected auth expired callback")
+	default:
+	}
+}
+
+func TestReconnectHistory(t *testing.T) {
+	s := RunDefaultServer()
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL(), nats.ReconnectHistorySize(2))
+	if err != nil {
+		t.Fatalf("Unexpected error on connect: %v", err)
+	}
+	defer nc.Close()
+
+	if history := nc.ReconnectHistory(); len(history) != 0 {
+		t.Fatalf("Expected empty reconnect history, got %+v", history)
+	}
+
+	statusCh := nc.StatusChanged(nats.CONNECTED)
+	defer close(statusCh)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := nc.ForceReconnect(); err != nil {
+			t.Fatalf("Unexpected error on reconnect: %v", err)
+		}
+		WaitOnChannel(t, statusCh, nats.CONNECTED)
+	}
+
+	history := nc.ReconnectHistory()
+	if len(history) != 2 {
+		t.Fatalf("Expected 2 reconnect events, got %d", len(history))
+	}
+	if nc.Stats().Reconnects != 3 {
+		t.Fatalf("Expected 3 reconnects, got %d", nc.Stats().Reconnects)
+	}
+	for i, ev := range history {
+		if ev.PreviousURL != s.ClientURL() || ev.URL != s.ClientURL() {
+			t.Fatalf("Unexpected URLs in reconnect event: %+v", ev)
+		}
+		if ev.Time.Before(start) || ev.Disconnected < 0 || ev.Disconnected > time.Since(start) {
+			t.Fatalf("Unexpected times in reconnect event: %+v", ev)
+		}
+		if i > 0 && ev.Time.Before(history[i-1].Time) {
+			t.Fatalf("Expected reconnect events to be ordered, got %+v", history)
+		}
+	}
+
+	// History is disabled with a negative size.
+	nc2, err := nats.Connect(s.ClientURL(), nats.ReconnectHistorySize(-1))
+	if err != nil {
+		t.Fatalf("Unexpected error on connect: %v", err)
+	}
+	defer nc2.Close()
+	statusCh2 := nc2.StatusChanged(nats.CONNECTED)
+	defer close(statusCh2)
+	if err := nc2.ForceReconnect(); err != nil {
+		t.Fatalf("Unexpected error on reconnect: %v", err)
+	}
+	WaitOnChannel(t, statusCh2, nats.CONNECTED)
+	if history := nc2.ReconnectHistory(); len(history) != 0 {
+		t.Fatalf("Expected empty reconnect history, got %+v", history)
+	}
+}
+
+func TestPreReconnectCallback(t *testing.T) {
+	s1 := RunServerOnPort(-1)
+	defer s1.Shutdown()
+	s2 := RunServerOnPort(-1)
+	defer s2.Shutdown()
+
+	var calls atomic.Int32
+	nc, err := nats.Connect(s1.ClientURL(), nats.PreReconnectHandler(func(o *nats.Options) *nats.Options {
+		calls.Add(1)
+		o.Url = ""
+		o.Servers = []string{s2.ClientURL()}
+		// Ignored, only servers, TLS and auth options are applied.
+		o.InboxPrefix = "_CHANGED"
+		return o
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error on connect: %v", err)
+	}
+	defer nc.Close()
+
+	// Options read without the connection lock are not modified.
+	done := make(chan struct{})
+	inboxes := make(chan string, 1)
+	go func() {
+		var inbox string
+		for {
+			select {
+			case <-done:
+				inboxes <- inbox
+				return
+			default:
+				inbox = nc.NewInbox()
+			}
+		}
+	}()
+
+	statusCh := nc.StatusChanged(nats.CONNECTED)
+	defer close(statusCh)
+	if err := nc.ForceReconnect(); err != nil {
+		t.Fatalf("Unexpected error on reconnect: %v", err)
+	}
+	WaitOnChannel(t, statusCh, nats.CONNECTED)
+	close(done)
+	if inbox := <-inboxes; !strings.HasPrefix(inbox, nats.InboxPrefix) {
+		t.Fatalf("Expected inbox prefix to be unchanged, got %q", inbox)
+	}
+
+	if calls.Load() != 1 {
+		t.Fatalf("Expected callback to be invoked once, got %d", calls.Load())
+	}
+	if url := nc.ConnectedUrl(); url != s2.ClientURL() {
+		t.Fatalf("Expected to be reconnected to %q, got %q", s2.ClientURL(), url)
+	}
+	if servers := nc.Servers(); len(servers) != 1 || servers[0] != s2.ClientURL() {
+		t.Fatalf("Expected server pool to be replaced, got %v", servers)
+	}
+
+	// Invalid options are reported and the current ones are kept.
+	errCh := make(chan error, 1)
+	nc2, err := nats.Connect(s1.ClientURL(),
+		nats.PreReconnectHandler(func(o *nats.Options) *nats.Options {
+			o.Servers = []string{s2.ClientURL()}
+			o.Nkey = "UCNGL4W5QX66CFX6A6DCBVDH5VOHMI7B2UZZU7TXAUQQSI2JPHULCKBR"
+			return o
+		}),
+		nats.ErrorHandler(func(_ *nats.Conn, _ *nats.Subscription, err error) {
+			errCh <- err
+		}))
+	if err != nil {
+		t.Fatalf("Unexpected error on connect: %v", err)
+	}
+	defer nc2.Close()
+
+	statusCh2 := nc2.StatusChanged(nats.CONNECTED)
+	defer close(statusCh2)
+	if err := nc2.ForceReconnect(); err != nil {
+		t.Fatalf("Unexpected error on reconnect: %v", err)
+	}
+	WaitOnChannel(t, statusCh2, nats.CONNECTED)
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, nats.ErrNkeyButNoSigCB) {
+			t.Fatalf("Expected error %v, got %v", nats.ErrNkeyButNoSigCB, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected invalid options to be reported")
+	}
+	if url := nc2.ConnectedUrl(); url != s1.ClientURL() {
+		t.Fatalf("Expected to be reconnected to %q, got %q", s1.ClientURL(), url)
+	}
+}
+
+func TestOutboundQueueReconnect(t *testing.T) {
+	for _, policy := range []nats.OutboundFullPolicy{nats.OutboundFullError, nats.OutboundFullBlock} {
+		t.Run(fmt.Sprintf("policy %d", policy), func(t *testing.T) {
+			ts := startReconnectServer(t)
+			defer ts.Shutdown()
+
+			dch := make(chan bool, 4)
+			opts := reconnectOpts
+			// Do not buffer while reconnecting, so that messages stay queued.
+			opts.ReconnectBufSize = -1
+			opts.OutboundQueueSize = 10
+			opts.OutboundFullPolicy = policy
+			opts.DisconnectedErrCB = func(_ *nats.Conn, _ error) {
+				dch <- true
+			}
+			nc, err := opts.Connect()
+			if err != nil {
+				t.Fatalf("Should have connected ok: %v", err)
+			}
+			defer nc.Close()
+
+			sub, err := nc.SubscribeSync("foo")
+			if err != nil {
+				t.Fatalf("Error on subscribe: %v", err)
+			}
+			nc.Flush()
+
+			ts.Shutdown()
+			if err := Wait(dch); err != nil {
+				t.Fatal("Did not get the disconnected callback on time")
+			}
+
+			for i := 0; i < 10; i++ {
+				if err := nc.Publish("foo", []byte(strconv.Itoa(i))); err != nil {
+					t.Fatalf("Error on publish: %v", err)
+				}
+			}
+			if n := nc.PendingOutbound(); n != 10 {
+				t.Fatalf("Expected 10 pending outbound messages, got %d", n)
+			}
+
+			errCh := make(chan error, 1)
+			go func() {
+				errCh <- nc.Publish("foo", []byte("10"))
+			}()
+			if policy == nats.OutboundFullError {
+				if err := <-errCh; !errors.Is(err, nats.ErrOutboundFull) {
+					t.Fatalf("Expected error %v, got %v", nats.ErrOutboundFull, err)
+				}
+			} else {
+				select {
+				case err := <-errCh:
+					t.Fatalf("Expected publish to block, got %v", err)
+				case <-time.After(50 * time.Millisecond):
+				}
+			}
+
+			ts = startReconnectServer(t)
+			defer ts.Shutdown()
+
+			if err := nc.FlushTimeout(5 * time.Second); err != nil {
+				t.Fatalf("Error on flush: %v", err)
+			}
+			expected := 10
+			if policy == nats.OutboundFullBlock {
+				if err := <-errCh; err != nil {
+					t.Fatalf("Error on publish: %v", err)
+				}
+				if err := nc.Flush(); err != nil {
+					t.Fatalf("Error on flush: %v", err)
+				}
+				expected = 11
+			}
+			for i := 0; i < expected; i++ {
+				msg, err := sub.NextMsg(time.Second)
+				if err != nil {
+					t.Fatalf("Error receiving message %d: %v", i, err)
+				}
+				if string(msg.Data) != strconv.Itoa(i) {
+					t.Fatalf("Expected message %d, got %q", i, msg.Data)
+				}
+			}
+
+			// Closing the connection releases blocked publishers.
+			if policy == nats.OutboundFullBlock {
+				ts.Shutdown()
+				if err := Wait(dch); err != nil {
+					t.Fatal("Did not get the disconnected callback on time")
+				}
+				for i := 0; i < 10; i++ {
+					nc.Publish("foo", []byte("x"))
+				}
+				go func() {
+					errCh <- nc.Publish("foo", []byte("x"))
+				}()
+				time.Sleep(50 * time.Millisecond)
+				nc.Close()
+				select {
+				case err := <-errCh:
+					if !errors.Is(err, nats.ErrConnectionClosed) {
+						t.Fatalf("Expected error %v, got %v", nats.ErrConnectionClosed, err)
+					}
+				case <-time.After(time.Second):
+					t.Fatal("Publish should have been released on close")
+				}
+			}
+		})
+	}
+}
+
 func TestForceReconnect(t *testing.T) {
 	s := RunDefaultServer()
 
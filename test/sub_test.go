@@ -17,6 +17,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"reflect"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -531,6 +532,78 @@ func TestSlowAsyncSubscriber(t *testing.T) {
 	close(bch)
 }
 
+func TestSubscribeWithBuffer(t *testing.T) {
+	s := RunDefaultServer()
+	defer s.Shutdown()
+
+	nc := NewDefaultConnection(t)
+	defer nc.Close()
+
+	slowSubs := make(chan *nats.Subscription, 10)
+	nc.SetErrorHandler(func(_ *nats.Conn, sub *nats.Subscription, err error) {
+		if err == nats.ErrSlowConsumer {
+			slowSubs <- sub
+		}
+	})
+
+	if _, err := nc.SubscribeWithBuffer("foo", 0, func(*nats.Msg) {}); err != nats.ErrInvalidArg {
+		t.Fatalf("Expected %v, got %v", nats.ErrInvalidArg, err)
+	}
+
+	bch := make(chan struct{})
+	var received atomic.Int32
+	cb := func(m *nats.Msg) {
+		<-bch
+		received.Add(1)
+	}
+	small, err := nc.SubscribeWithBuffer("foo", 10, cb)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	if pm, _, _ := small.PendingLimits(); pm != 10 {
+		t.Fatalf("Expected pending msgs limit of 10, got %d", pm)
+	}
+	large, err := nc.SubscribeWithBuffer("foo", 1000, cb)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	total := 100
+	for i := 0; i < total; i++ {
+		nc.Publish("foo", []byte("Hello"))
+	}
+	if err := nc.Flush(); err != nil {
+		t.Fatalf("Error on flush: %v", err)
+	}
+
+	select {
+	case sub := <-slowSubs:
+		if sub != small {
+			t.Fatalf("Expected slow consumer on the small buffer subscription")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected slow consumer error")
+	}
+	if n, _ := small.Dropped(); n == 0 {
+		t.Fatalf("Expected dropped messages on the small buffer subscription")
+	}
+	if n, _ := large.Dropped(); n != 0 {
+		t.Fatalf("Expected no dropped messages on the large buffer subscription, got %d", n)
+	}
+
+	close(bch)
+	small.Unsubscribe()
+	waitFor(t, time.Second, 15*time.Millisecond, func() error {
+		if n, _, _ := large.Pending(); n != 0 {
+			return fmt.Errorf("%d messages still pending", n)
+		}
+		return nil
+	})
+	if n, _ := large.Delivered(); n != int64(total) {
+		t.Fatalf("Expected %d messages delivered to the large buffer subscription, got %d", total, n)
+	}
+}
+
 func TestAsyncErrHandler(t *testing.T) {
 	s := RunDefaultServer()
 	defer s.Shutdown()
@@ -610,6 +683,195 @@ func TestAsyncErrHandler(t *testing.T) {
 	}
 }
 
+func TestSubscriptionDroppedSubjects(t *testing.T) {
+	s := RunDefaultServer()
+	defer s.Shutdown()
+
+	nc := NewDefaultConnection(t)
+	defer nc.Close()
+
+	bch := make(chan struct{})
+	received := make(chan bool, 10)
+	sub, err := nc.Subscribe("foo.*", func(_ *nats.Msg) {
+		received <- true
+		<-bch
+	})
+	if err != nil {
+		t.Fatalf("Could not subscribe: %v", err)
+	}
+	defer close(bch)
+	sub.SetPendingLimits(1, 1024)
+
+	// Capture is disabled by default.
+	if subjs := sub.DroppedSubjects(); len(subjs) != 0 {
+		t.Fatalf("Expected no dropped subjects, got %v", subjs)
+	}
+	for _, n := range []int{-1, nats.MaxDroppedSubjects + 1} {
+		if err := sub.CaptureDroppedSubjects(n); !errors.Is(err, nats.ErrInvalidArg) {
+			t.Fatalf("Expected error: %v; got: %v", nats.ErrInvalidArg, err)
+		}
+	}
+	if err := sub.CaptureDroppedSubjects(3); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The first message is delivered to the blocked callback, and still
+	// counts as pending until the callback returns, so all the other
+	// messages are dropped.
+	nc.Publish("foo.0", []byte("Hello World!"))
+	if err := Wait(received); err != nil {
+		t.Fatal("Message not received")
+	}
+	for i := 1; i < 7; i++ {
+		nc.Publish(fmt.Sprintf("foo.%d", i), []byte("Hello World!"))
+	}
+	if err := nc.Flush(); err != nil {
+		t.Fatalf("Error on flush: %v", err)
+	}
+
+	dropped, err := sub.Dropped()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if dropped != 6 {
+		t.Fatalf("Expected 6 dropped messages, got %d", dropped)
+	}
+	expected := []string{"foo.4", "foo.5", "foo.6"}
+	if subjs := sub.DroppedSubjects(); !reflect.DeepEqual(subjs, expected) {
+		t.Fatalf("Expected dropped subjects %v, got %v", expected, subjs)
+	}
+
+	if err := sub.CaptureDroppedSubjects(0); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if subjs := sub.DroppedSubjects(); len(subjs) != 0 {
+		t.Fatalf("Expected no dropped subjects, got %v", subjs)
+	}
+}
+
+func TestSubscriptionMaxMsgAge(t *testing.T) {
+	s := RunDefaultServer()
+	defer s.Shutdown()
+
+	nc := NewDefaultConnection(t)
+	defer nc.Close()
+
+	syncSub, err := nc.SubscribeSync("bar")
+	if err != nil {
+		t.Fatalf("Error on subscribe: %v", err)
+	}
+	if err := syncSub.SetMaxMsgAge(time.Second); err != nats.ErrTypeSubscription {
+		t.Fatalf("Expected error: %v; got: %v", nats.ErrTypeSubscription, err)
+	}
+
+	release := make(chan struct{})
+	received := make(chan string, 10)
+	sub, err := nc.Subscribe("foo", func(m *nats.Msg) {
+		if string(m.Data) == "1" {
+			<-release
+		}
+		received <- string(m.Data)
+	})
+	if err != nil {
+		t.Fatalf("Error on subscribe: %v", err)
+	}
+	if err := sub.SetMaxMsgAge(-1); err != nats.ErrInvalidArg {
+		t.Fatalf("Expected error: %v; got: %v", nats.ErrInvalidArg, err)
+	}
+	if err := sub.SetMaxMsgAge(20 * time.Millisecond); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Messages pending while the handler is blocked on the first one
+	// become stale and are dropped.
+	for i := 1; i <= 5; i++ {
+		nc.Publish("foo", []byte(fmt.Sprintf("%d", i)))
+	}
+	nc.Flush()
+	time.Sleep(200 * time.Millisecond)
+	close(release)
+	if data := <-received; data != "1" {
+		t.Fatalf("Expected first message to be delivered, got %q", data)
+	}
+
+	nc.Publish("foo", []byte("6"))
+	select {
+	case data := <-received:
+		if data != "6" {
+			t.Fatalf("Expected fresh message to be delivered, got %q", data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Fresh message was not delivered")
+	}
+	dropped, err := sub.DroppedByAge()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if dropped != 4 {
+		t.Fatalf("Expected 4 messages dropped, got %d", dropped)
+	}
+	if msgs, _, _ := sub.Pending(); msgs != 0 {
+		t.Fatalf("Expected no pending messages, got %d", msgs)
+	}
+}
+
+func TestSubscriptionErrors(t *testing.T) {
+	s := RunDefaultServer()
+	defer s.Shutdown()
+
+	nc := NewDefaultConnection(t)
+	defer nc.Close()
+
+	bch := make(chan struct{})
+	sub, err := nc.Subscribe("foo", func(_ *nats.Msg) {
+		<-bch
+	})
+	if err != nil {
+		t.Fatalf("Could not subscribe: %v", err)
+	}
+	defer close(bch)
+	sub.SetPendingLimits(1, 1024)
+	errs := sub.Errors()
+
+	for i := 0; i < 10; i++ {
+		nc.Publish("foo", []byte("Hello World!"))
+	}
+	if err := nc.Flush(); err != nil {
+		t.Fatalf("Error on flush: %v", err)
+	}
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, nats.ErrSlowConsumer) {
+			t.Fatalf("Expected error: %v; got: %v", nats.ErrSlowConsumer, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Did not receive slow consumer error")
+	}
+	// the error is sent only once, when the subscription becomes
+	// a slow consumer
+	select {
+	case err := <-errs:
+		t.Fatalf("Unexpected error: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := sub.Unsubscribe(); err != nil {
+		t.Fatalf("Error on unsubscribe: %v", err)
+	}
+	select {
+	case _, ok := <-errs:
+		if ok {
+			t.Fatal("Expected errors channel to be closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Errors channel was not closed")
+	}
+	if _, ok := <-sub.Errors(); ok {
+		t.Fatal("Expected errors channel of a closed subscription to be closed")
+	}
+}
+
 func TestAsyncErrHandlerChanSubscription(t *testing.T) {
 	s := RunDefaultServer()
 	defer s.Shutdown()
@@ -742,6 +1004,70 @@ func TestAsyncSubscribersOnClose(t *testing.T) {
 	}
 }
 
+func TestSubscribeFiltered(t *testing.T) {
+	s := RunDefaultServer()
+	defer s.Shutdown()
+
+	nc := NewDefaultConnection(t)
+	defer nc.Close()
+
+	onlyHigh := func(m *nats.Msg) bool {
+		return m.Header.Get("Priority") == "high"
+	}
+	if _, err := nc.SubscribeFiltered("orders.>", nil, func(*nats.Msg) {}); err != nats.ErrBadSubscription {
+		t.Fatalf("Expected %v, got %v", nats.ErrBadSubscription, err)
+	}
+
+	ch := make(chan *nats.Msg, 10)
+	sub, err := nc.SubscribeFiltered("orders.>", onlyHigh, func(m *nats.Msg) {
+		ch <- m
+	})
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	for i, priority := range []string{"low", "high", "", "high", "low"} {
+		msg := nats.NewMsg(fmt.Sprintf("orders.%d", i))
+		if priority != "" {
+			msg.Header.Set("Priority", priority)
+		}
+		if err := nc.PublishMsg(msg); err != nil {
+			t.Fatalf("Error on publish: %v", err)
+		}
+	}
+	if err := nc.Flush(); err != nil {
+		t.Fatalf("Error on flush: %v", err)
+	}
+
+	for _, subj := range []string{"orders.1", "orders.3"} {
+		select {
+		case m := <-ch:
+			if m.Subject != subj {
+				t.Fatalf("Expected message on %q, got %q", subj, m.Subject)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Did not receive message on %q", subj)
+		}
+	}
+	select {
+	case m := <-ch:
+		t.Fatalf("Unexpected message on %q", m.Subject)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if n, err := sub.Filtered(); err != nil || n != 3 {
+		t.Fatalf("Expected 3 filtered messages, got %d (err=%v)", n, err)
+	}
+	if n, _, err := sub.Pending(); err != nil || n != 0 {
+		t.Fatalf("Expected no pending messages, got %d (err=%v)", n, err)
+	}
+
+	sub.Unsubscribe()
+	if _, err := sub.Filtered(); err != nats.ErrBadSubscription {
+		t.Fatalf("Expected %v, got %v", nats.ErrBadSubscription, err)
+	}
+}
+
 func TestNextMsgCallOnAsyncSub(t *testing.T) {
 	s := RunDefaultServer()
 	defer s.Shutdown()
@@ -1859,3 +2185,58 @@ func TestSubscribeSyncPermissionError(t *testing.T) {
 		}
 	})
 }
+
+func TestSubscribeWithReplay(t *testing.T) {
+	s := RunDefaultServer()
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(nats.DefaultURL, nats.ReplayBuffer(3, 10))
+	if err != nil {
+		t.Fatalf("Error on connect: %v", err)
+	}
+	defer nc.Close()
+
+	for i := 0; i < 5; i++ {
+		if err := nc.Publish("foo", []byte(fmt.Sprintf("%d", i))); err != nil {
+			t.Fatalf("Error on publish: %v", err)
+		}
+	}
+	if err := nc.Publish("bar", []byte("bar")); err != nil {
+		t.Fatalf("Error on publish: %v", err)
+	}
+
+	msgs := make(chan *nats.Msg, 10)
+	sub, err := nc.SubscribeWithReplay("foo", 2, func(m *nats.Msg) {
+		msgs <- m
+	})
+	if err != nil {
+		t.Fatalf("Error on subscribe: %v", err)
+	}
+	defer sub.Unsubscribe()
+	if err := nc.Publish("foo", []byte("5")); err != nil {
+		t.Fatalf("Error on publish: %v", err)
+	}
+
+	for _, expected := range []string{"3", "4", "5"} {
+		select {
+		case m := <-msgs:
+			if string(m.Data) != expected {
+				t.Fatalf("Expected message %q, got %q", expected, m.Data)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timeout waiting for message %q", expected)
+		}
+	}
+	select {
+	case m := <-msgs:
+		t.Fatalf("Unexpected message: %q", m.Data)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Without the option, replay is not available.
+	nc2 := NewDefaultConnection(t)
+	defer nc2.Close()
+	if _, err := nc2.SubscribeWithReplay("foo", 1, func(_ *nats.Msg) {}); !errors.Is(err, nats.ErrReplayBufferNotEnabled) {
+		t.Fatalf("Expected error: %v; got: %v", nats.ErrReplayBufferNotEnabled, err)
+	}
+}
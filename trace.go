@@ -0,0 +1,166 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// ProtocolTraceMaxPayload is the maximum number of payload bytes
+	// included in a single protocol trace entry. Longer payloads are
+	// truncated.
+	ProtocolTraceMaxPayload = 1024
+
+	traceDirOut = "out"
+	traceDirIn  = "in"
+
+	traceConnectOp = "CONNECT"
+	traceRedacted  = "[REDACTED]"
+)
+
+// ProtocolTraceEntry is a single protocol line written as JSON to
+// Options.ProtocolTraceWriter.
+type ProtocolTraceEntry struct {
+	// Time is the time at which the line was sent or received.
+	Time time.Time `json:"time"`
+	// Direction is "out" for protocol sent to the server and
+	// "in" for protocol received from the server.
+	Direction string `json:"dir"`
+	// Op is the protocol operation, e.g. PUB, MSG or PING.
+	Op string `json:"op"`
+	// Line is the protocol line, without the trailing CRLF.
+	Line string `json:"line"`
+	// Payload is the message payload (including headers). It is only
+	// set if Options.ProtocolTracePayloads is enabled.
+	Payload string `json:"payload,omitempty"`
+	// Truncated is set if the payload was longer than
+	// ProtocolTraceMaxPayload.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// protoTracer writes protocol lines exchanged with the server
+// as JSON objects, one per line.
+type protoTracer struct {
+	mu       sync.Mutex
+	enc      *json.Encoder
+	payloads bool
+}
+
+func newProtoTracer(w io.Writer, payloads bool) *protoTracer {
+	if w == nil {
+		return nil
+	}
+	return &protoTracer{enc: json.NewEncoder(w), payloads: payloads}
+}
+
+// out records a protocol line sent to the server.
+// It is a no-op on a nil tracer.
+func (t *protoTracer) out(line string, payload ...[]byte) {
+	if t == nil {
+		return
+	}
+	t.trace(traceDirOut, line, payload)
+}
+
+// in records a protocol line received from the server.
+// It is a no-op on a nil tracer.
+func (t *protoTracer) in(line string, payload ...[]byte) {
+	if t == nil {
+		return
+	}
+	t.trace(traceDirIn, line, payload)
+}
+
+func (t *protoTracer) trace(dir, line string, payload [][]byte) {
+	// A single write may contain several protocol lines (e.g. CONNECT+PING).
+	for _, l := range strings.Split(strings.TrimRight(line, _CRLF_), _CRLF_) {
+		op, _, _ := strings.Cut(l, _SPC_)
+		op = strings.ToUpper(op)
+		e := ProtocolTraceEntry{Time: time.Now(), Direction: dir, Op: op, Line: l}
+		if op == traceConnectOp {
+			e.Line = redactConnect(l)
+		}
+		if t.payloads && len(payload) > 0 {
+			e.Payload, e.Truncated = tracePayload(payload)
+			// Only the first line carries the payload.
+			payload = nil
+		}
+		t.mu.Lock()
+		t.enc.Encode(e)
+		t.mu.Unlock()
+	}
+}
+
+func tracePayload(payload [][]byte) (string, bool) {
+	var sb strings.Builder
+	for _, p := range payload {
+		if rem := ProtocolTraceMaxPayload - sb.Len(); len(p) > rem {
+			sb.Write(p[:rem])
+			return sb.String(), true
+		}
+		sb.Write(p)
+	}
+	return sb.String(), false
+}
+
+// redactConnect removes credentials from a CONNECT protocol line.
+func redactConnect(line string) string {
+	op, args, _ := strings.Cut(line, _SPC_)
+	var ci map[string]any
+	if err := json.Unmarshal([]byte(args), &ci); err != nil {
+		return op + _SPC_ + traceRedacted
+	}
+	for _, k := range []string{"pass", "auth_token", "sig", "jwt"} {
+		if _, ok := ci[k]; ok {
+			ci[k] = traceRedacted
+		}
+	}
+	b, err := json.Marshal(ci)
+	if err != nil {
+		return op + _SPC_ + traceRedacted
+	}
+	return op + _SPC_ + string(b)
+}
+
+// traceMsg records a MSG or HMSG received from the server, reconstructing
+// the protocol line from the parser state.
+func (nc *Conn) traceMsg(data []byte) {
+	ma := &nc.ps.ma
+	var sb strings.Builder
+	if ma.hdr >= 0 {
+		sb.WriteString("HMSG ")
+	} else {
+		sb.WriteString("MSG ")
+	}
+	sb.Write(ma.subject)
+	sb.WriteString(_SPC_)
+	sb.WriteString(strconv.FormatInt(ma.sid, 10))
+	if len(ma.reply) > 0 {
+		sb.WriteString(_SPC_)
+		sb.Write(ma.reply)
+	}
+	if ma.hdr >= 0 {
+		sb.WriteString(_SPC_)
+		sb.WriteString(strconv.Itoa(ma.hdr))
+	}
+	sb.WriteString(_SPC_)
+	sb.WriteString(strconv.Itoa(ma.size))
+	nc.tracer.in(sb.String(), data)
+}